@@ -15,3 +15,8 @@ type ResetApiKeyRequest struct {
 type ResetApiKeyResponse struct {
 	ApiKey string `json:"apiKey"`
 }
+
+// UpdateApiKeyGroupRequest Group 为逗号分隔的分组，为空时使用用户分组
+type UpdateApiKeyGroupRequest struct {
+	Group string `json:"group"`
+}
@@ -0,0 +1,35 @@
+package v1
+
+type AuditLogsQuery struct {
+	StartTime  string `form:"startTime"`
+	EndTime    string `form:"endTime"`
+	Page       int    `form:"page" binding:"required"`
+	PageSize   int    `form:"pageSize" binding:"required"`
+	ActorId    string `form:"actorId"`
+	Action     string `form:"action"`
+	TargetType string `form:"targetType"`
+	TargetId   string `form:"targetId"`
+	TraceId    string `form:"traceId"`
+}
+
+type AuditLogItem struct {
+	Id         string `json:"id"`
+	ActorId    string `json:"actorId"`
+	ActorName  string `json:"actorName"`
+	Action     string `json:"action"`
+	TargetType string `json:"targetType"`
+	TargetId   string `json:"targetId"`
+	Before     any    `json:"before"`
+	After      any    `json:"after"`
+	Diff       any    `json:"diff"`
+	Ip         string `json:"ip"`
+	TraceId    string `json:"traceId"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+type AuditLogsResponse struct {
+	List     []AuditLogItem `json:"list"`
+	Total    int            `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+}
@@ -3,26 +3,68 @@ package v1
 import (
 	"github.com/jiu-u/oai-api/internal/dto"
 	"github.com/jiu-u/oai-api/internal/dto/query"
+	"time"
 )
 
 type ChannelResponse struct {
-	Id       string   `json:"id"`
-	Name     string   `json:"name"`
-	Type     string   `json:"type"`
-	Balance  float64  `json:"balance"`
-	EndPoint string   `json:"endPoint"`
-	APIKey   string   `json:"apiKey"`
-	Models   []string `json:"models"`
-	Status   int8     `json:"status"`
+	Id               string               `json:"id"`
+	Name             string               `json:"name"`
+	Type             string               `json:"type"`
+	Balance          float64              `json:"balance"`
+	EndPoint         string               `json:"endPoint"`
+	APIKey           string               `json:"apiKey"`
+	Keys             []ChannelKeyResponse `json:"keys"`
+	Models           []string             `json:"models"`
+	DisabledModels   map[string]string    `json:"disabledModels"`
+	ModelLatencies   []ModelLatency       `json:"modelLatencies"`
+	Status           int8                 `json:"status"`
+	DisableReason    string               `json:"disableReason"`
+	Group            string               `json:"group"`
+	BalanceURL       string               `json:"balanceUrl"`
+	BalancePath      string               `json:"balancePath"`
+	BalanceThreshold float64              `json:"balanceThreshold"`
+	BalanceAction    int8                 `json:"balanceAction"`
+	BalanceUpdatedAt *time.Time           `json:"balanceUpdatedAt"`
+	ResponsesAPI     int8                 `json:"responsesApi"`
 }
 
+// ModelLatency 模型检查得到的延迟，单位毫秒，0表示还没有成功检查过
+type ModelLatency struct {
+	Model             string `json:"model"`
+	FirstTokenLatency int64  `json:"firstTokenLatency"`
+	TotalLatency      int64  `json:"totalLatency"`
+}
+
+type ChannelKeyResponse struct {
+	Id            string    `json:"id"`
+	APIKey        string    `json:"apiKey"`
+	Status        int8      `json:"status"`
+	ErrorCount    int32     `json:"errorCount"`
+	TotalCount    int64     `json:"totalCount"`
+	Balance       float64   `json:"balance"`
+	CoolDownUntil time.Time `json:"coolDownUntil"`
+	LastUsedTime  time.Time `json:"lastUsedTime"`
+	DisableReason string    `json:"disableReason"`
+}
+
+// CreateChannelRequest APIKey 与 APIKeys 至少填写一个，会合并为渠道的key池
+// Group 为逗号分隔的渠道分组，为空时属于默认分组
+// BalanceURL 不为空时按 BalancePath 从自定义接口查询余额，必须与 EndPoint 为同一主机，BalanceAction 1降权 2禁用
+// ResponsesAPI 1 表示上游支持原生 Responses API，/v1/responses 请求直接转发，2 或不填时转换为 chat completions
 type CreateChannelRequest struct {
-	Name     string   `json:"name"`
-	Type     string   `json:"type" binding:"required"`
-	EndPoint string   `json:"endPoint" binding:"required"`
-	APIKey   string   `json:"apiKey" binding:"required"`
-	Weight   int      `json:"weight" default:"10"`
-	Models   []string `json:"models"`
+	Name             string   `json:"name"`
+	Type             string   `json:"type" binding:"required"`
+	EndPoint         string   `json:"endPoint" binding:"required"`
+	APIKey           string   `json:"apiKey"`
+	APIKeys          []string `json:"apiKeys"`
+	Weight           int      `json:"weight" default:"10"`
+	Models           []string `json:"models"`
+	Group            string   `json:"group"`
+	BalanceURL       string   `json:"balanceUrl"`
+	BalancePath      string   `json:"balancePath"`
+	BalanceThreshold float64  `json:"balanceThreshold"`
+	BalanceAction    int8     `json:"balanceAction"`
+	ResponsesAPI     int8     `json:"responsesApi" binding:"omitempty,oneof=1 2"`
 }
 
 type ChannelQueryRequest = query.ChannelQueryRequest
@@ -33,17 +75,152 @@ type ChannelListResponse struct {
 	List     []ChannelResponse `json:"list"`
 }
 
+// UpdateChannelRequest APIKey 与 APIKeys 中的新key会追加到key池，掩码值会被忽略
 type UpdateChannelRequest struct {
-	Name     string   `json:"name"`
-	Type     string   `json:"type" `
-	EndPoint string   `json:"endPoint"`
-	APIKey   string   `json:"apiKey"`
-	Models   []string `json:"models"`
-	Status   int8     `json:"status"`
+	Name             string   `json:"name"`
+	Type             string   `json:"type" `
+	EndPoint         string   `json:"endPoint"`
+	APIKey           string   `json:"apiKey"`
+	APIKeys          []string `json:"apiKeys"`
+	Models           []string `json:"models"`
+	Status           int8     `json:"status"`
+	Group            string   `json:"group"`
+	BalanceURL       string   `json:"balanceUrl"`
+	BalancePath      string   `json:"balancePath"`
+	BalanceThreshold float64  `json:"balanceThreshold"`
+	BalanceAction    int8     `json:"balanceAction"`
+	ResponsesAPI     int8     `json:"responsesApi" binding:"omitempty,oneof=1 2"`
 }
 
 type ChannelModelTestResponse = dto.ModelCheckResult
 
+type RevealChannelKeyResponse struct {
+	APIKey string               `json:"apiKey"`
+	Keys   []ChannelKeyResponse `json:"keys"`
+}
+
+type ChannelBalanceResponse struct {
+	Balance   float64                   `json:"balance"`
+	UpdatedAt time.Time                 `json:"updatedAt"`
+	Keys      []ChannelKeyBalanceResult `json:"keys"`
+}
+
+type ChannelKeyBalanceResult struct {
+	Id      string  `json:"id"`
+	Balance float64 `json:"balance"`
+	Error   string  `json:"error,omitempty"`
+}
+
+type AddChannelKeysRequest struct {
+	APIKeys []string `json:"apiKeys" binding:"required"`
+}
+
+type UpdateChannelKeyStatusRequest struct {
+	Status int8 `json:"status" binding:"required"`
+}
+
+type ModelCheckHistoryRequest struct {
+	Model string `json:"model" form:"model"`
+	Limit int    `json:"limit" form:"limit"`
+}
+
+// ModelCheckRecord 耗时单位均为毫秒
+type ModelCheckRecord struct {
+	Id                 string    `json:"id"`
+	ChannelKeyId       string    `json:"channelKeyId"`
+	Model              string    `json:"model"`
+	Source             string    `json:"source"`
+	Capability         string    `json:"capability"`
+	Status             int8      `json:"status"`
+	StatusCode         int       `json:"statusCode"`
+	ConnectDuration    int64     `json:"connectDuration"`
+	FirstTokenDuration int64     `json:"firstTokenDuration"`
+	TotalDuration      int64     `json:"totalDuration"`
+	ErrorDetail        string    `json:"errorDetail"`
+	CreatedAt          time.Time `json:"createdAt"`
+}
+
 type CheckModelRequest struct {
 	ModelName string `json:"model" binding:"required"`
 }
+
+// BatchCheckModelRequest Models 为空时检查渠道下所有模型，DisableFailed 为true时禁用因模型本身原因检查失败的模型
+// 限流、5xx、超时和key失效不会禁用模型
+type BatchCheckModelRequest struct {
+	Models        []string `json:"models"`
+	Concurrency   int      `json:"concurrency"`
+	DisableFailed bool     `json:"disableFailed"`
+}
+
+// BatchCheckModelResult 批量检查中单个模型的结果，通过SSE的result事件返回
+type BatchCheckModelResult struct {
+	Model              string `json:"model"`
+	Status             int8   `json:"status"`
+	Capability         string `json:"capability"`
+	ConnectionDuration int64  `json:"connectionDuration"`
+	FirstTokenDuration int64  `json:"firstTokenDuration"`
+	TotalDuration      int64  `json:"totalDuration"`
+	Error              string `json:"error"`
+	Disabled           bool   `json:"disabled"`
+}
+
+// BatchCheckModelSummary 批量检查结束后通过SSE的done事件返回
+type BatchCheckModelSummary struct {
+	Total    int `json:"total"`
+	Success  int `json:"success"`
+	Failed   int `json:"failed"`
+	Disabled int `json:"disabled"`
+}
+
+// ChannelStatsQuery window 为统计窗口，按小时对齐，默认 24h
+type ChannelStatsQuery struct {
+	Window string `form:"window" binding:"omitempty,oneof=1h 24h 7d 30d"`
+}
+
+// ChannelErrorBreakdown 失败的上游尝试按错误类型分类的次数
+type ChannelErrorBreakdown struct {
+	RateLimit int64 `json:"rateLimit"`
+	Auth      int64 `json:"auth"`
+	Quota     int64 `json:"quota"`
+	Model     int64 `json:"model"`
+	Timeout   int64 `json:"timeout"`
+	Server    int64 `json:"server"`
+	Client    int64 `json:"client"`
+	Other     int64 `json:"other"`
+}
+
+// ChannelStatsItem 一个渠道或渠道模型在统计窗口内的表现，modelKey 为空表示整个渠道
+// attempts 为上游尝试次数(含重试)，耗时单位为毫秒，check 开头的字段来自模型检查结果
+type ChannelStatsItem struct {
+	ChannelId        string                `json:"channelId"`
+	ChannelName      string                `json:"channelName"`
+	ModelKey         string                `json:"modelKey"`
+	Attempts         int64                 `json:"attempts"`
+	Successes        int64                 `json:"successes"`
+	Failures         int64                 `json:"failures"`
+	SuccessRate      float64               `json:"successRate"`
+	Errors           ChannelErrorBreakdown `json:"errors"`
+	AvgLatency       int64                 `json:"avgLatency"`
+	P95Latency       int64                 `json:"p95Latency"`
+	PromptTokens     int64                 `json:"promptTokens"`
+	CompletionTokens int64                 `json:"completionTokens"`
+	Checks           int64                 `json:"checks"`
+	CheckSuccesses   int64                 `json:"checkSuccesses"`
+	CheckSuccessRate float64               `json:"checkSuccessRate"`
+	CheckAvgLatency  int64                 `json:"checkAvgLatency"`
+}
+
+// ChannelStatsResponse 所有渠道的汇总，按尝试次数从多到少排序
+type ChannelStatsResponse struct {
+	Window    string             `json:"window"`
+	StartTime string             `json:"startTime"`
+	List      []ChannelStatsItem `json:"list"`
+}
+
+// ChannelModelStatsResponse 单个渠道的汇总和按模型的明细
+type ChannelModelStatsResponse struct {
+	Window    string             `json:"window"`
+	StartTime string             `json:"startTime"`
+	Summary   ChannelStatsItem   `json:"summary"`
+	Models    []ChannelStatsItem `json:"models"`
+}
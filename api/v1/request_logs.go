@@ -1,17 +1,66 @@
 package v1
 
 type RequestLogItem struct {
-	Id               string `json:"id"`
-	Model            string `json:"model"`
-	UserId           string `json:"userId"`
-	Username         string `json:"username"`
-	Email            string `json:"email"`
-	Ip               string `json:"ip"`
-	Status           int8   `json:"status"`
-	RetryTimes       int    `json:"retryTimes"`
-	CreatedAt        string `json:"createdAt"`
-	ChannelNameTrace string `json:"channelNameTrace"`
-	ChannelIdTrace   string `json:"channelIdTrace"`
+	Id                string              `json:"id"`
+	RequestId         string              `json:"requestId"`
+	Model             string              `json:"model"`
+	UpstreamModel     string              `json:"upstreamModel"`
+	UserId            string              `json:"userId"`
+	Username          string              `json:"username"`
+	Email             string              `json:"email"`
+	ApiKeyId          string              `json:"apiKeyId"`
+	Ip                string              `json:"ip"`
+	Path              string              `json:"path"`
+	RelayType         string              `json:"relayType"`
+	Stream            bool                `json:"stream"`
+	Status            int8                `json:"status"`
+	RetryTimes        int                 `json:"retryTimes"`
+	TotalLatency      int64               `json:"totalLatency"`
+	FirstTokenLatency int64               `json:"firstTokenLatency"`
+	PromptTokens      int                 `json:"promptTokens"`
+	CompletionTokens  int                 `json:"completionTokens"`
+	TotalTokens       int                 `json:"totalTokens"`
+	Cost              float64             `json:"cost"`
+	Attempts          []RequestLogAttempt `json:"attempts"`
+	CreatedAt         string              `json:"createdAt"`
+}
+
+// RequestLogAttempt 单次上游尝试，耗时单位为毫秒，未选到渠道时 channelId 为 "0"
+type RequestLogAttempt struct {
+	ChannelId     string `json:"channelId"`
+	ChannelName   string `json:"channelName"`
+	ChannelKeyId  string `json:"channelKeyId"`
+	UpstreamModel string `json:"upstreamModel"`
+	StatusCode    int    `json:"statusCode"`
+	Error         string `json:"error"`
+	Latency       int64  `json:"latency"`
+}
+
+// RequestLogDetail 日志详情，body 为采集到的请求体和响应体，未采样或已过保留期时为 null
+type RequestLogDetail struct {
+	RequestLogItem
+	Body *RequestLogBody `json:"body"`
+}
+
+// RequestLogBody 内容已经脱敏，流式响应为拼接后的完整消息
+type RequestLogBody struct {
+	RequestBody       string `json:"requestBody"`
+	ResponseBody      string `json:"responseBody"`
+	RequestTruncated  bool   `json:"requestTruncated"`
+	ResponseTruncated bool   `json:"responseTruncated"`
+	CreatedAt         string `json:"createdAt"`
+}
+
+// RequestLogPurgeResult 一次清理的结果，before 之前的日志被删除，archiveFile 为空表示没有归档
+// skipped 为 true 表示保留策略未开启，定时任务没有执行，duration 单位为毫秒
+type RequestLogPurgeResult struct {
+	Skipped     bool   `json:"skipped"`
+	Before      string `json:"before"`
+	Deleted     int64  `json:"deleted"`
+	Archived    int64  `json:"archived"`
+	ArchiveFile string `json:"archiveFile"`
+	Batches     int    `json:"batches"`
+	Duration    int64  `json:"duration"`
 }
 
 type RequestLogsQuery struct {
@@ -20,6 +69,8 @@ type RequestLogsQuery struct {
 	Page      int    `form:"page"  binding:"required"`
 	PageSize  int    `form:"pageSize"  binding:"required"`
 	UserId    string `form:"userId"`
+	Model     string `form:"model"`
+	ApiKeyId  string `form:"apiKeyId"`
 }
 
 type RequestLogsResponse struct {
@@ -54,3 +105,122 @@ type RequestLogsModelRanking struct {
 type RequestLogsModelRankingResponse struct {
 	List []RequestLogsModelRanking `json:"list"`
 }
+
+// UsageStatsQuery interval 为 minute/hour/day，groupBy 为 model/channel/user/key，为空时不分组
+// 时间格式为 2006-01-02 15:04:05，范围为左闭右开
+type UsageStatsQuery struct {
+	StartTime string `form:"startTime" binding:"required"`
+	EndTime   string `form:"endTime" binding:"required"`
+	Interval  string `form:"interval" binding:"required,oneof=minute hour day"`
+	GroupBy   string `form:"groupBy" binding:"omitempty,oneof=model channel user key"`
+	Model     string `form:"model"`
+	ChannelId string `form:"channelId"`
+	UserId    string `form:"userId"`
+	ApiKeyId  string `form:"apiKeyId"`
+}
+
+// UsageStatsPoint 一个时间桶的统计，耗时单位为毫秒，分位数由耗时直方图估算
+type UsageStatsPoint struct {
+	Time             string  `json:"time"`
+	Requests         int64   `json:"requests"`
+	Errors           int64   `json:"errors"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	TotalTokens      int64   `json:"totalTokens"`
+	Cost             float64 `json:"cost"`
+	AvgLatency       int64   `json:"avgLatency"`
+	P50Latency       int64   `json:"p50Latency"`
+	P95Latency       int64   `json:"p95Latency"`
+}
+
+// UsageStatsSeries group 为分组维度的值(模型名或id)，不分组时为空，没有请求的时间桶不返回
+type UsageStatsSeries struct {
+	Group    string            `json:"group"`
+	Requests int64             `json:"requests"`
+	Points   []UsageStatsPoint `json:"points"`
+}
+
+type UsageStatsResponse struct {
+	Interval string             `json:"interval"`
+	GroupBy  string             `json:"groupBy"`
+	Series   []UsageStatsSeries `json:"series"`
+}
+
+// UserUsageQuery 普通用户查询自己的用量，时间格式为 2006-01-02 15:04:05，范围为左闭右开
+type UserUsageQuery struct {
+	StartTime string `form:"startTime" binding:"required"`
+	EndTime   string `form:"endTime" binding:"required"`
+}
+
+// UsageBreakdownItem 按模型或key汇总的用量，name 为模型名或key的id
+type UsageBreakdownItem struct {
+	Name             string  `json:"name"`
+	Requests         int64   `json:"requests"`
+	Errors           int64   `json:"errors"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	TotalTokens      int64   `json:"totalTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// UserCredit used 为全部历史费用之和，unlimited 为 true 时 limit 和 remaining 无意义
+type UserCredit struct {
+	Unlimited bool    `json:"unlimited"`
+	Limit     float64 `json:"limit"`
+	Used      float64 `json:"used"`
+	Remaining float64 `json:"remaining"`
+}
+
+type UserUsageSummary struct {
+	Models []UsageBreakdownItem `json:"models"`
+	Keys   []UsageBreakdownItem `json:"keys"`
+	Credit UserCredit           `json:"credit"`
+}
+
+// RequestLogsExportQuery 过滤条件与 RequestLogsQuery 一致，format 为 csv 或 jsonl，结果不分页
+type RequestLogsExportQuery struct {
+	StartTime string `form:"startTime" binding:"required"`
+	EndTime   string `form:"endTime" binding:"required"`
+	UserId    string `form:"userId"`
+	Model     string `form:"model"`
+	ApiKeyId  string `form:"apiKeyId"`
+	Format    string `form:"format" binding:"omitempty,oneof=csv jsonl"`
+}
+
+// UsageExportQuery 按 groupBy 汇总时间范围内的用量，每个分组一行，groupBy 为 day 时每天一行
+type UsageExportQuery struct {
+	StartTime string `form:"startTime" binding:"required"`
+	EndTime   string `form:"endTime" binding:"required"`
+	GroupBy   string `form:"groupBy" binding:"required,oneof=user key model channel day"`
+	Model     string `form:"model"`
+	ChannelId string `form:"channelId"`
+	UserId    string `form:"userId"`
+	ApiKeyId  string `form:"apiKeyId"`
+	Format    string `form:"format" binding:"omitempty,oneof=csv jsonl"`
+}
+
+// UsageExportRow group 为分组的值(用户id、key id、模型、渠道id或日期)，name 为用户名或渠道名
+type UsageExportRow struct {
+	Group            string  `json:"group"`
+	Name             string  `json:"name"`
+	Requests         int64   `json:"requests"`
+	Errors           int64   `json:"errors"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	TotalTokens      int64   `json:"totalTokens"`
+	Cost             float64 `json:"cost"`
+	AvgLatency       int64   `json:"avgLatency"`
+}
+
+// UsageReportRequest month 格式为 2006-01，为空时为上个月
+type UsageReportRequest struct {
+	Month string `json:"month"`
+}
+
+// UsageReportResult skipped 为 true 表示定时任务未开启或该月已经发送过
+type UsageReportResult struct {
+	Skipped    bool     `json:"skipped"`
+	Month      string   `json:"month"`
+	Recipients []string `json:"recipients"`
+	Failed     []string `json:"failed"`
+}
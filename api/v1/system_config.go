@@ -11,3 +11,23 @@ type LinuxDoOAuthConfig = dto.LinuxDoOAuthConfig
 type SystemModelConfig = dto.ModelConfig
 
 type RegisterConfig = dto.RegisterConfig
+
+type BodyCaptureConfig = dto.BodyCaptureConfig
+
+type RequestLogRetentionConfig = dto.RequestLogRetentionConfig
+
+type UsageReportConfig = dto.UsageReportConfig
+
+type AlertConfig = dto.AlertConfig
+
+type ResponsesConfig = dto.ResponsesConfig
+
+type AlertTestRequest struct {
+	Sink string `json:"sink"` // 为空时发送到所有启用的通道
+}
+
+type AlertTestResult struct {
+	Sink    string `json:"sink"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
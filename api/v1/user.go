@@ -1,14 +1,17 @@
 package v1
 
 type UserInfo struct {
-	Id          string `json:"id"`
-	Username    string `json:"username"`
-	Email       string `json:"email"`
-	Role        string `json:"role"`
-	Status      int    `json:"status"`
-	Nickname    string `json:"nickname"`
-	LastLoginAt string `json:"lastLoginAt"`
-	LastLoginIP string `json:"lastLoginIP"`
+	Id          string  `json:"id"`
+	Username    string  `json:"username"`
+	Email       string  `json:"email"`
+	Role        string  `json:"role"`
+	Status      int     `json:"status"`
+	Nickname    string  `json:"nickname"`
+	LastLoginAt string  `json:"lastLoginAt"`
+	LastLoginIP string  `json:"lastLoginIP"`
+	Level       int     `json:"level"`
+	Group       string  `json:"group"`
+	CreditLimit float64 `json:"creditLimit"`
 }
 
 type UserListRequest struct {
@@ -24,3 +27,14 @@ type UserListResponse struct {
 	Page     int        `json:"page"`
 	PageSize int        `json:"pageSize"`
 }
+
+// UpdateUserGroupRequest Group 为逗号分隔的分组，为空时按 Level 映射分组
+type UpdateUserGroupRequest struct {
+	Group string `json:"group"`
+	Level int    `json:"level"`
+}
+
+// UpdateUserCreditRequest CreditLimit 为0时不限制额度
+type UpdateUserCreditRequest struct {
+	CreditLimit float64 `json:"creditLimit" binding:"gte=0"`
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/jiu-u/oai-api/pkg/config"
 	"github.com/jiu-u/oai-api/pkg/jwt"
 	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/secret"
 	"github.com/jiu-u/oai-api/pkg/sid"
 )
 
@@ -21,6 +22,9 @@ var repositorySet = wire.NewSet(
 	repository.NewRepository,
 	repository.NewTransaction,
 	repository.NewChannelModelRepository,
+	repository.NewChannelKeyRepository,
+	repository.NewUserRepository,
+	repository.NewSystemRepository,
 	repository.NewChannelRepository,
 )
 
@@ -29,6 +33,8 @@ var serviceSet = wire.NewSet(
 	service.NewOaiService,
 	service.NewChannelService,
 	service.NewLoadBalanceServiceBeta,
+	service.NewNotifyService,
+	service.NewEmailService,
 )
 
 var handlerSet = wire.NewSet(
@@ -47,6 +53,7 @@ func NewWire(cfg *config.Config, logger *log.Logger) (*server.DataLoadTask, func
 		serverSet,
 		sid.NewSid,
 		jwt.NewJwt,
+		secret.NewCipher,
 		cache.New,
 	))
 }
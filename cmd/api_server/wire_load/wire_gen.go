@@ -16,6 +16,7 @@ import (
 	"github.com/jiu-u/oai-api/pkg/config"
 	"github.com/jiu-u/oai-api/pkg/jwt"
 	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/secret"
 	"github.com/jiu-u/oai-api/pkg/sid"
 )
 
@@ -28,11 +29,17 @@ func NewWire(cfg *config.Config, logger *log.Logger) (*server.DataLoadTask, func
 	transaction := repository.NewTransaction(repositoryRepository)
 	jwtJWT := jwt.NewJwt(cfg)
 	cacheCache := cache.New()
-	serviceService := service.NewService(sidSid, transaction, logger, jwtJWT, cacheCache)
+	cipher := secret.NewCipher(cfg)
+	serviceService := service.NewService(sidSid, transaction, logger, jwtJWT, cacheCache, cipher)
 	channelRepository := repository.NewChannelRepository(repositoryRepository)
 	channelModelRepository := repository.NewChannelModelRepository(repositoryRepository)
-	loadBalanceServiceBeta := service.NewLoadBalanceServiceBeta(serviceService, channelRepository, channelModelRepository)
-	channelService := service.NewChannelService(serviceService, channelRepository, channelModelRepository, loadBalanceServiceBeta)
+	channelKeyRepository := repository.NewChannelKeyRepository(repositoryRepository)
+	userRepository := repository.NewUserRepository(repositoryRepository)
+	systemRepository := repository.NewSystemRepository(repositoryRepository, cipher)
+	emailService := service.NewEmailService(systemRepository)
+	notifyService := service.NewNotifyService(serviceService, userRepository, systemRepository, emailService)
+	loadBalanceServiceBeta := service.NewLoadBalanceServiceBeta(serviceService, channelRepository, channelModelRepository, channelKeyRepository, notifyService)
+	channelService := service.NewChannelService(serviceService, channelRepository, channelModelRepository, channelKeyRepository, loadBalanceServiceBeta)
 	dataLoadTask := server.NewDataLoad(channelService, cfg, logger)
 	return dataLoadTask, func() {
 	}, nil
@@ -40,9 +47,9 @@ func NewWire(cfg *config.Config, logger *log.Logger) (*server.DataLoadTask, func
 
 // wire.go:
 
-var repositorySet = wire.NewSet(repository.NewDB, repository.NewRepository, repository.NewTransaction, repository.NewChannelModelRepository, repository.NewChannelRepository)
+var repositorySet = wire.NewSet(repository.NewDB, repository.NewRepository, repository.NewTransaction, repository.NewChannelModelRepository, repository.NewChannelKeyRepository, repository.NewUserRepository, repository.NewSystemRepository, repository.NewChannelRepository)
 
-var serviceSet = wire.NewSet(service.NewService, service.NewOaiService, service.NewChannelService, service.NewLoadBalanceServiceBeta)
+var serviceSet = wire.NewSet(service.NewService, service.NewOaiService, service.NewChannelService, service.NewLoadBalanceServiceBeta, service.NewNotifyService, service.NewEmailService)
 
 var handlerSet = wire.NewSet(handler.NewHandler, handler.NewOAIHandler)
 
@@ -14,6 +14,7 @@ import (
 	"github.com/jiu-u/oai-api/pkg/config"
 	"github.com/jiu-u/oai-api/pkg/jwt"
 	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/secret"
 	"github.com/jiu-u/oai-api/pkg/sid"
 )
 
@@ -23,6 +24,9 @@ var repositorySet = wire.NewSet(
 	repository.NewTransaction,
 	repository.NewChannelRepository,
 	repository.NewChannelModelRepository,
+	repository.NewChannelKeyRepository,
+	repository.NewUserRepository,
+	repository.NewSystemRepository,
 )
 
 var serviceSet = wire.NewSet(
@@ -30,6 +34,8 @@ var serviceSet = wire.NewSet(
 	service.NewOaiService,
 	service.NewChannelService,
 	service.NewLoadBalanceServiceBeta,
+	service.NewNotifyService,
+	service.NewEmailService,
 )
 
 var handlerSet = wire.NewSet(
@@ -60,6 +66,7 @@ func NewWire(cfg *config.Config, logger *log.Logger) (*app.App, func(), error) {
 		serverSet,
 		sid.NewSid,
 		jwt.NewJwt,
+		secret.NewCipher,
 		cache.New,
 		newApp,
 	))
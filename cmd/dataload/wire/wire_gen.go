@@ -17,6 +17,7 @@ import (
 	"github.com/jiu-u/oai-api/pkg/config"
 	"github.com/jiu-u/oai-api/pkg/jwt"
 	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/secret"
 	"github.com/jiu-u/oai-api/pkg/sid"
 )
 
@@ -29,10 +30,17 @@ func NewWire(cfg *config.Config, logger *log.Logger) (*app.App, func(), error) {
 	transaction := repository.NewTransaction(repositoryRepository)
 	jwtJWT := jwt.NewJwt(cfg)
 	cacheCache := cache.New()
-	serviceService := service.NewService(sidSid, transaction, logger, jwtJWT, cacheCache)
+	cipher := secret.NewCipher(cfg)
+	serviceService := service.NewService(sidSid, transaction, logger, jwtJWT, cacheCache, cipher)
 	channelRepository := repository.NewChannelRepository(repositoryRepository)
 	channelModelRepository := repository.NewChannelModelRepository(repositoryRepository)
-	channelService := service.NewChannelService(serviceService, channelRepository, channelModelRepository)
+	channelKeyRepository := repository.NewChannelKeyRepository(repositoryRepository)
+	userRepository := repository.NewUserRepository(repositoryRepository)
+	systemRepository := repository.NewSystemRepository(repositoryRepository, cipher)
+	emailService := service.NewEmailService(systemRepository)
+	notifyService := service.NewNotifyService(serviceService, userRepository, systemRepository, emailService)
+	loadBalanceServiceBeta := service.NewLoadBalanceServiceBeta(serviceService, channelRepository, channelModelRepository, channelKeyRepository, notifyService)
+	channelService := service.NewChannelService(serviceService, channelRepository, channelModelRepository, channelKeyRepository, loadBalanceServiceBeta)
 	dataLoadTask := server.NewDataLoad(channelService, cfg, logger)
 	appApp := newApp(dataLoadTask)
 	return appApp, func() {
@@ -41,9 +49,9 @@ func NewWire(cfg *config.Config, logger *log.Logger) (*app.App, func(), error) {
 
 // wire.go:
 
-var repositorySet = wire.NewSet(repository.NewDB, repository.NewRepository, repository.NewTransaction, repository.NewChannelRepository, repository.NewChannelModelRepository)
+var repositorySet = wire.NewSet(repository.NewDB, repository.NewRepository, repository.NewTransaction, repository.NewChannelRepository, repository.NewChannelModelRepository, repository.NewChannelKeyRepository, repository.NewUserRepository, repository.NewSystemRepository)
 
-var serviceSet = wire.NewSet(service.NewService, service.NewOaiService, service.NewChannelService, service.NewLoadBalanceServiceBeta)
+var serviceSet = wire.NewSet(service.NewService, service.NewOaiService, service.NewChannelService, service.NewLoadBalanceServiceBeta, service.NewNotifyService, service.NewEmailService)
 
 var handlerSet = wire.NewSet(handler.NewHandler, handler.NewOAIHandler)
 
@@ -10,6 +10,8 @@ import (
 	"github.com/jiu-u/oai-api/pkg/app"
 	"github.com/jiu-u/oai-api/pkg/config"
 	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/secret"
+	"github.com/jiu-u/oai-api/pkg/sid"
 )
 
 var repositorySet = wire.NewSet(
@@ -22,6 +24,11 @@ var serverSet = wire.NewSet(
 	server.NewMigrate,
 )
 
+var pkgSet = wire.NewSet(
+	sid.NewSid,
+	secret.NewCipher,
+)
+
 // build App
 func newApp(
 	migrateServer *server.Migrate,
@@ -38,6 +45,7 @@ func NewWire(cfg *config.Config, logger *log.Logger) (*app.App, func(), error) {
 	panic(wire.Build(
 		repositorySet,
 		serverSet,
+		pkgSet,
 		newApp,
 	))
 }
@@ -13,13 +13,17 @@ import (
 	"github.com/jiu-u/oai-api/pkg/app"
 	"github.com/jiu-u/oai-api/pkg/config"
 	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/secret"
+	"github.com/jiu-u/oai-api/pkg/sid"
 )
 
 // Injectors from wire.go:
 
 func NewWire(cfg *config.Config, logger *log.Logger) (*app.App, func(), error) {
 	db := repository.NewDB(cfg)
-	migrate := server.NewMigrate(db, logger)
+	sidSid := sid.NewSid()
+	cipher := secret.NewCipher(cfg)
+	migrate := server.NewMigrate(db, logger, sidSid, cipher)
 	appApp := newApp(migrate)
 	return appApp, func() {
 	}, nil
@@ -31,6 +35,8 @@ var repositorySet = wire.NewSet(repository.NewDB, repository.NewRepository, repo
 
 var serverSet = wire.NewSet(server.NewMigrate)
 
+var pkgSet = wire.NewSet(sid.NewSid, secret.NewCipher)
+
 // build App
 func newApp(
 	migrateServer *server.Migrate,
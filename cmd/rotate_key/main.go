@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/jiu-u/oai-api/cmd/rotate_key/wire"
+	"github.com/jiu-u/oai-api/pkg/config"
+	"github.com/jiu-u/oai-api/pkg/log"
+	"go.uber.org/zap"
+)
+
+// 轮换 security.secret.key:
+// 1. 将旧密钥配置为 security.secret.previous_key，新密钥配置为 security.secret.key
+// 2. 执行 make rotate-key
+// 3. 删除 previous_key 配置
+func main() {
+	var envConf = flag.String("conf", "config/local.yaml", "config path, eg: -conf ./config/local.yml")
+	flag.Parse()
+	conf := config.LoadConfig(*envConf)
+	logger := log.NewLogger(conf)
+	job, cleanup, err := wire.NewWire(conf, logger)
+	if err != nil {
+		panic(err)
+	}
+	defer cleanup()
+	if err = job.Start(context.Background()); err != nil {
+		logger.Error("rotate key error", zap.Error(err))
+		panic(err)
+	}
+}
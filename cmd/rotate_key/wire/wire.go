@@ -0,0 +1,29 @@
+//go:build wireinject
+// +build wireinject
+
+package wire
+
+import (
+	"github.com/google/wire"
+	"github.com/jiu-u/oai-api/internal/repository"
+	"github.com/jiu-u/oai-api/internal/server"
+	"github.com/jiu-u/oai-api/pkg/config"
+	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/secret"
+)
+
+var repositorySet = wire.NewSet(
+	repository.NewDB,
+)
+
+var serverSet = wire.NewSet(
+	server.NewRotateSecret,
+)
+
+func NewWire(cfg *config.Config, logger *log.Logger) (*server.RotateSecret, func(), error) {
+	panic(wire.Build(
+		repositorySet,
+		serverSet,
+		secret.NewCipher,
+	))
+}
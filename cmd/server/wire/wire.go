@@ -15,8 +15,11 @@ import (
 	"github.com/jiu-u/oai-api/pkg/config"
 	"github.com/jiu-u/oai-api/pkg/jwt"
 	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/metrics"
+	"github.com/jiu-u/oai-api/pkg/secret"
 	"github.com/jiu-u/oai-api/pkg/server/http"
 	"github.com/jiu-u/oai-api/pkg/sid"
+	"github.com/jiu-u/oai-api/pkg/tracing"
 )
 
 var repositorySet = wire.NewSet(
@@ -26,18 +29,32 @@ var repositorySet = wire.NewSet(
 	repository.NewUserRepository,
 	repository.NewApiKeyRepository,
 	repository.NewRequestLogRepository,
+	repository.NewRequestLogStatRepository,
+	repository.NewChannelStatRepository,
 	repository.NewChannelRepository,
 	repository.NewChannelModelRepository,
+	repository.NewChannelKeyRepository,
+	repository.NewModelCheckResultRepository,
 	repository.NewSystemRepository,
 	repository.NewUserAuthProviderRepository,
+	repository.NewAuditLogRepository,
+	repository.NewResponseStateRepository,
 )
 
 var serviceSet = wire.NewSet(
 	service.NewService,
 	service.NewOaiService,
+	service.NewResponsesService,
 	service.NewChannelService,
 	service.NewLoadBalanceServiceBeta,
+	service.NewNotifyService,
+	service.NewBalanceService,
 	service.NewRequestLogService,
+	service.NewBodyCaptureService,
+	service.NewRequestLogRetentionService,
+	service.NewRequestLogStatService,
+	service.NewChannelStatService,
+	service.NewUsageReportService,
 	service.NewApiKeyService,
 	service.NewUserService,
 	service.NewAuthService,
@@ -45,6 +62,7 @@ var serviceSet = wire.NewSet(
 	service.NewEmailService,
 	service.NewVerificationService,
 	service.NewModelCheckService,
+	service.NewAuditLogService,
 	oauth2.NewLinuxDoAuthService,
 	oauth2.NewGithubAuthService,
 )
@@ -59,11 +77,17 @@ var handlerSet = wire.NewSet(
 	handler.NewSystemConfigHandler,
 	handler.NewVerificationHandler,
 	handler.NewChannelHandler,
+	handler.NewAuditLogHandler,
 )
 
 var serverSet = wire.NewSet(
 	server.NewHTTPServer,
 	server.NewCheckModelServer,
+	server.NewBalanceServer,
+	server.NewMetricsServer,
+	server.NewRequestLogServer,
+	server.NewResponsesStateServer,
+	server.NewUsageReportServer,
 	server.NewMigrate,
 )
 
@@ -71,11 +95,16 @@ var serverSet = wire.NewSet(
 func newApp(
 	httpServer *http.Server,
 	checkServer *server.CheckModelServer,
+	balanceServer *server.BalanceServer,
+	metricsServer *server.MetricsServer,
+	requestLogServer *server.RequestLogServer,
+	responsesStateServer *server.ResponsesStateServer,
+	usageReportServer *server.UsageReportServer,
 	// job *server.Job,
 	// task *server.Task,
 ) *app.App {
 	return app.NewApp(
-		app.WithServer(httpServer, checkServer),
+		app.WithServer(httpServer, checkServer, balanceServer, metricsServer, usageReportServer, requestLogServer, responsesStateServer),
 		app.WithName("demo-server"),
 	)
 }
@@ -100,7 +129,10 @@ func NewWire(cfg *config.Config, logger *log.Logger) (*WireApp, func(), error) {
 		serverSet,
 		sid.NewSid,
 		jwt.NewJwt,
+		secret.NewCipher,
 		cache.New,
+		metrics.NewMetrics,
+		tracing.NewTracing,
 		newApp,
 		newWireApp,
 	))
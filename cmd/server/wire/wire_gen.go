@@ -18,8 +18,11 @@ import (
 	"github.com/jiu-u/oai-api/pkg/config"
 	"github.com/jiu-u/oai-api/pkg/jwt"
 	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/metrics"
+	"github.com/jiu-u/oai-api/pkg/secret"
 	"github.com/jiu-u/oai-api/pkg/server/http"
 	"github.com/jiu-u/oai-api/pkg/sid"
+	"github.com/jiu-u/oai-api/pkg/tracing"
 )
 
 // Injectors from wire.go:
@@ -31,62 +34,95 @@ func NewWire(cfg *config.Config, logger *log.Logger) (*WireApp, func(), error) {
 	repositoryRepository := repository.NewRepository(logger, db)
 	transaction := repository.NewTransaction(repositoryRepository)
 	cacheCache := cache.New()
-	serviceService := service.NewService(sidSid, transaction, logger, jwtJWT, cacheCache)
+	cipher := secret.NewCipher(cfg)
+	serviceService := service.NewService(sidSid, transaction, logger, jwtJWT, cacheCache, cipher)
 	channelRepository := repository.NewChannelRepository(repositoryRepository)
 	channelModelRepository := repository.NewChannelModelRepository(repositoryRepository)
-	loadBalanceServiceBeta := service.NewLoadBalanceServiceBeta(serviceService, channelRepository, channelModelRepository)
+	channelKeyRepository := repository.NewChannelKeyRepository(repositoryRepository)
 	userRepository := repository.NewUserRepository(repositoryRepository)
+	systemRepository := repository.NewSystemRepository(repositoryRepository, cipher)
+	emailService := service.NewEmailService(systemRepository)
+	notifyService := service.NewNotifyService(serviceService, userRepository, systemRepository, emailService)
+	loadBalanceServiceBeta := service.NewLoadBalanceServiceBeta(serviceService, channelRepository, channelModelRepository, channelKeyRepository, notifyService)
 	requestLogRepository := repository.NewRequestLogRepository(repositoryRepository)
 	apiKeyRepository := repository.NewApiKeyRepository(repositoryRepository)
-	requestLogService := service.NewRequestLogService(serviceService, userRepository, requestLogRepository, apiKeyRepository)
-	oaiService := service.NewOaiService(serviceService, loadBalanceServiceBeta, requestLogService, channelModelRepository)
-	oaiHandler := handler.NewOAIHandler(oaiService)
+	metricsMetrics := metrics.NewMetrics()
+	requestLogStatRepository := repository.NewRequestLogStatRepository(repositoryRepository)
+	requestLogStatService := service.NewRequestLogStatService(serviceService, requestLogStatRepository, userRepository)
+	channelStatRepository := repository.NewChannelStatRepository(repositoryRepository)
+	modelCheckResultRepository := repository.NewModelCheckResultRepository(repositoryRepository)
+	channelStatService := service.NewChannelStatService(serviceService, channelStatRepository, modelCheckResultRepository, channelRepository)
+	requestLogService := service.NewRequestLogService(serviceService, userRepository, requestLogRepository, apiKeyRepository, systemRepository, requestLogStatService, channelStatService, metricsMetrics)
+	bodyCaptureService := service.NewBodyCaptureService(serviceService, systemRepository, apiKeyRepository, requestLogRepository)
+	oaiService := service.NewOaiService(serviceService, loadBalanceServiceBeta, requestLogService, channelModelRepository, metricsMetrics, bodyCaptureService)
+	responseStateRepository := repository.NewResponseStateRepository(repositoryRepository)
+	responsesService := service.NewResponsesService(serviceService, oaiService, responseStateRepository, systemRepository)
+	oaiHandler := handler.NewOAIHandler(oaiService, responsesService)
 	handlerHandler := handler.NewHandler(logger)
-	systemRepository := repository.NewSystemRepository(repositoryRepository)
 	systemConfigService := service.NewSystemConfigService(serviceService, systemRepository)
 	linuxDoOauthService := oauth2.NewLinuxDoAuthService(systemRepository)
 	gitHubOauthService := oauth2.NewGithubAuthService(systemRepository)
 	userAuthProviderRepository := repository.NewUserAuthProviderRepository(repositoryRepository)
 	authService := service.NewAuthService(serviceService, userRepository, systemConfigService, linuxDoOauthService, gitHubOauthService, userAuthProviderRepository)
 	authHandler := handler.NewAuthHandler(handlerHandler, jwtJWT, authService, systemConfigService)
-	apiKeyService := service.NewApiKeyService(serviceService, userRepository, apiKeyRepository)
+	apiKeyService := service.NewApiKeyService(serviceService, userRepository, apiKeyRepository, systemRepository)
 	apiKeyHandler := handler.NewApiKeyHandler(handlerHandler, apiKeyService)
 	userService := service.NewUserService(serviceService, userRepository, apiKeyRepository)
-	userHandler := handler.NewUserHandler(handlerHandler, userService)
-	requestLogHandler := handler.NewRequestLogHandler(handlerHandler, requestLogService)
-	systemConfigHandler := handler.NewSystemConfigHandler(handlerHandler, systemConfigService)
-	emailService := service.NewEmailService(systemRepository)
+	auditLogRepository := repository.NewAuditLogRepository(repositoryRepository)
+	auditLogService := service.NewAuditLogService(serviceService, auditLogRepository)
+	userHandler := handler.NewUserHandler(handlerHandler, userService, auditLogService)
+	requestLogRetentionService := service.NewRequestLogRetentionService(serviceService, systemRepository, requestLogRepository, requestLogStatRepository)
+	usageReportService := service.NewUsageReportService(serviceService, requestLogRepository, requestLogStatRepository, userRepository, channelRepository, systemRepository, emailService)
+	requestLogHandler := handler.NewRequestLogHandler(handlerHandler, requestLogService, requestLogRetentionService, requestLogStatService, usageReportService)
+	systemConfigHandler := handler.NewSystemConfigHandler(handlerHandler, systemConfigService, notifyService, auditLogService)
 	verificationService := service.NewVerificationService(serviceService, emailService)
 	verificationHandler := handler.NewVerificationHandler(handlerHandler, verificationService)
-	channelService := service.NewChannelService(serviceService, channelRepository, channelModelRepository, loadBalanceServiceBeta)
-	modelCheckService := service.NewModelCheckService(serviceService, channelRepository, channelModelRepository, loadBalanceServiceBeta)
-	channelHandler := handler.NewChannelHandler(handlerHandler, channelService, modelCheckService)
-	httpServer := server.NewHTTPServer(logger, cfg, jwtJWT, oaiHandler, authHandler, apiKeyService, apiKeyHandler, userHandler, requestLogHandler, systemConfigHandler, verificationHandler, channelHandler)
-	checkModelServer := server.NewCheckModelServer(loadBalanceServiceBeta, channelRepository, channelModelRepository, logger, systemConfigService)
-	app := newApp(httpServer, checkModelServer)
-	migrate := server.NewMigrate(db, logger)
+	channelService := service.NewChannelService(serviceService, channelRepository, channelModelRepository, channelKeyRepository, loadBalanceServiceBeta)
+	modelCheckService := service.NewModelCheckService(serviceService, channelRepository, channelModelRepository, modelCheckResultRepository, systemRepository, loadBalanceServiceBeta)
+	balanceService := service.NewBalanceService(serviceService, channelRepository, channelModelRepository, channelKeyRepository, loadBalanceServiceBeta, notifyService)
+	channelHandler := handler.NewChannelHandler(handlerHandler, channelService, modelCheckService, balanceService, channelStatService, auditLogService)
+	auditLogHandler := handler.NewAuditLogHandler(handlerHandler, auditLogService)
+	tracingTracing, cleanup, err := tracing.NewTracing(cfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpServer := server.NewHTTPServer(logger, cfg, jwtJWT, oaiHandler, authHandler, apiKeyService, apiKeyHandler, userHandler, requestLogHandler, systemConfigHandler, verificationHandler, channelHandler, auditLogHandler, metricsMetrics, tracingTracing)
+	checkModelServer := server.NewCheckModelServer(loadBalanceServiceBeta, modelCheckService, channelModelRepository, logger, systemConfigService)
+	balanceServer := server.NewBalanceServer(balanceService, logger)
+	metricsServer := server.NewMetricsServer(cfg, logger, metricsMetrics, channelModelRepository)
+	requestLogServer := server.NewRequestLogServer(requestLogService, bodyCaptureService, requestLogRetentionService, logger)
+	responsesStateServer := server.NewResponsesStateServer(responsesService, logger)
+	usageReportServer := server.NewUsageReportServer(usageReportService, logger)
+	app := newApp(httpServer, checkModelServer, balanceServer, metricsServer, requestLogServer, responsesStateServer, usageReportServer)
+	migrate := server.NewMigrate(db, logger, sidSid, cipher)
 	wireApp := newWireApp(app, migrate)
 	return wireApp, func() {
+		cleanup()
 	}, nil
 }
 
 // wire.go:
 
-var repositorySet = wire.NewSet(repository.NewDB, repository.NewRepository, repository.NewTransaction, repository.NewUserRepository, repository.NewApiKeyRepository, repository.NewRequestLogRepository, repository.NewChannelRepository, repository.NewChannelModelRepository, repository.NewSystemRepository, repository.NewUserAuthProviderRepository)
+var repositorySet = wire.NewSet(repository.NewDB, repository.NewRepository, repository.NewTransaction, repository.NewUserRepository, repository.NewApiKeyRepository, repository.NewRequestLogRepository, repository.NewRequestLogStatRepository, repository.NewChannelStatRepository, repository.NewChannelRepository, repository.NewChannelModelRepository, repository.NewChannelKeyRepository, repository.NewModelCheckResultRepository, repository.NewSystemRepository, repository.NewUserAuthProviderRepository, repository.NewAuditLogRepository, repository.NewResponseStateRepository)
 
-var serviceSet = wire.NewSet(service.NewService, service.NewOaiService, service.NewChannelService, service.NewLoadBalanceServiceBeta, service.NewRequestLogService, service.NewApiKeyService, service.NewUserService, service.NewAuthService, service.NewSystemConfigService, service.NewEmailService, service.NewVerificationService, service.NewModelCheckService, oauth2.NewLinuxDoAuthService, oauth2.NewGithubAuthService)
+var serviceSet = wire.NewSet(service.NewService, service.NewOaiService, service.NewResponsesService, service.NewChannelService, service.NewLoadBalanceServiceBeta, service.NewNotifyService, service.NewBalanceService, service.NewRequestLogService, service.NewBodyCaptureService, service.NewRequestLogRetentionService, service.NewRequestLogStatService, service.NewChannelStatService, service.NewUsageReportService, service.NewApiKeyService, service.NewUserService, service.NewAuthService, service.NewSystemConfigService, service.NewEmailService, service.NewVerificationService, service.NewModelCheckService, service.NewAuditLogService, oauth2.NewLinuxDoAuthService, oauth2.NewGithubAuthService)
 
-var handlerSet = wire.NewSet(handler.NewHandler, handler.NewOAIHandler, handler.NewApiKeyHandler, handler.NewAuthHandler, handler.NewRequestLogHandler, handler.NewUserHandler, handler.NewSystemConfigHandler, handler.NewVerificationHandler, handler.NewChannelHandler)
+var handlerSet = wire.NewSet(handler.NewHandler, handler.NewOAIHandler, handler.NewApiKeyHandler, handler.NewAuthHandler, handler.NewRequestLogHandler, handler.NewUserHandler, handler.NewSystemConfigHandler, handler.NewVerificationHandler, handler.NewChannelHandler, handler.NewAuditLogHandler)
 
-var serverSet = wire.NewSet(server.NewHTTPServer, server.NewCheckModelServer, server.NewMigrate)
+var serverSet = wire.NewSet(server.NewHTTPServer, server.NewCheckModelServer, server.NewMigrate, server.NewBalanceServer, server.NewMetricsServer, server.NewRequestLogServer, server.NewResponsesStateServer, server.NewUsageReportServer)
 
 // build App
 func newApp(
 	httpServer *http.Server,
 	checkServer *server.CheckModelServer,
+	balanceServer *server.BalanceServer,
+	metricsServer *server.MetricsServer,
+	requestLogServer *server.RequestLogServer,
+	responsesStateServer *server.ResponsesStateServer,
+	usageReportServer *server.UsageReportServer,
 
 ) *app.App {
-	return app.NewApp(app.WithServer(httpServer, checkServer), app.WithName("demo-server"))
+	return app.NewApp(app.WithServer(httpServer, checkServer, balanceServer, metricsServer, usageReportServer, requestLogServer, responsesStateServer), app.WithName("demo-server"))
 }
 
 func newWireApp(app2 *app.App, migrateJob *server.Migrate) *WireApp {
@@ -1,3 +1,8 @@
 package constant
 
 const ClientIPKey = "client_ip"
+
+// RequestIdKey 与 X-Request-Id 响应头一致的请求ID
+const RequestIdKey = "request_id"
+
+const RequestPathKey = "request_path"
@@ -6,3 +6,5 @@ const (
 	LinuxDoOAuth OAuthType = "linux_do"
 	Github                 = "github"
 )
+
+const AdminRole = "admin"
@@ -1,9 +1,23 @@
 package dto
 
+import "time"
+
 type ModelCheckResult struct {
 	ChannelId          string `json:"channelId"`
 	ModelName          string `json:"model"`
 	ConnectionDuration int64  `json:"connectionDuration"`
+	FirstTokenDuration int64  `json:"firstTokenDuration"`
 	TotalDuration      int64  `json:"totalDuration"`
+	StatusCode         int    `json:"statusCode"`
+	Capability         string `json:"capability"`
 	Status             int8   `json:"status"`
 }
+
+// CheckOptions 单次模型检查的参数，Capabilities 为手动声明的模型能力
+type CheckOptions struct {
+	Prompt       string
+	MaxTokens    int
+	Timeout      time.Duration
+	Source       string
+	Capabilities map[string]string
+}
@@ -5,9 +5,12 @@ type ChannelModelConf struct {
 	ChannelName     string
 	ChannelType     string
 	ChannelKey      string
+	ChannelKeyId    uint64
 	ChannelEndPoint string
 	ModelRecordId   uint64
 	ModelKey        string
 	ModelId         string
 	Weight          int
+	// ResponsesAPI 渠道是否支持原生 Responses API
+	ResponsesAPI bool
 }
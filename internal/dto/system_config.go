@@ -32,10 +32,33 @@ type LinuxDoOAuthConfig struct {
 
 type GithubOAuthConfig = LinuxDoOAuthConfig
 
+// ModelConfig LevelGroups 为用户等级到默认分组的映射，key为等级，用户未单独指定分组时生效
+// Check 开头的为定时检查配置，CheckInterval 单位分钟，CheckTimeout 单位秒，零值使用默认值
+// ModelCapabilities 手动声明模型能力(chat/embedding/image/tts/stt)，按名称无法识别时使用
+// ModelPrices 按请求的模型计费，用于统计费用，未配置的模型费用记为0
 type ModelConfig struct {
-	Id           uint64              `json:"id"`
-	ModelMapping map[string][]string `json:"modelMapping"`
-	CheckList    []string            `json:"checkList"`
+	Id                uint64                `json:"id"`
+	ModelMapping      map[string][]string   `json:"modelMapping"`
+	CheckList         []string              `json:"checkList"`
+	LevelGroups       map[string][]string   `json:"levelGroups"`
+	CheckInterval     int                   `json:"checkInterval"`
+	CheckConcurrency  int                   `json:"checkConcurrency"`
+	CheckTimeout      int                   `json:"checkTimeout"`
+	CheckPrompt       string                `json:"checkPrompt"`
+	CheckMaxTokens    int                   `json:"checkMaxTokens"`
+	ModelCapabilities map[string]string     `json:"modelCapabilities"`
+	ModelPrices       map[string]ModelPrice `json:"modelPrices"`
+}
+
+// ModelPrice 每百万token的价格
+type ModelPrice struct {
+	Input  float64 `json:"input" binding:"gte=0"`
+	Output float64 `json:"output" binding:"gte=0"`
+}
+
+// Cost 按token数计算费用
+func (p ModelPrice) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*p.Input + float64(completionTokens)*p.Output) / 1e6
 }
 
 type RegisterConfig struct {
@@ -47,3 +70,75 @@ type RegisterConfig struct {
 	AllowLinuxDoLogin       bool   `json:"allowLinuxDoLogin"`
 	AllowGithubLogin        bool   `json:"allowGithubLogin"`
 }
+
+// BodyCaptureConfig 请求体/响应体采集配置，Enable 为总开关
+// UserIds、ApiKeyIds 中的用户和key的请求全部采集，其余请求按 SampleRate(0~1) 随机采样
+// MaxBodySize 请求体和响应体各自最多保留的字节数，RetentionDays 采集内容保留天数，零值使用默认值
+// RedactPatterns 额外的脱敏正则，命中的内容替换为 [REDACTED]，邮箱、手机号、api key 始终脱敏
+type BodyCaptureConfig struct {
+	Id             uint64   `json:"id"`
+	Enable         bool     `json:"enable"`
+	SampleRate     float64  `json:"sampleRate" binding:"gte=0,lte=1"`
+	UserIds        []string `json:"userIds"`
+	ApiKeyIds      []string `json:"apiKeyIds"`
+	MaxBodySize    int      `json:"maxBodySize" binding:"gte=0"`
+	RetentionDays  int      `json:"retentionDays" binding:"gte=0"`
+	RedactPatterns []string `json:"redactPatterns"`
+}
+
+// RequestLogRetentionConfig 请求日志保留策略，Enable 关闭时定时任务不执行，手动触发不受影响
+// RetentionDays 明细日志保留天数，过期的日志按 BatchSize 分批物理删除，Archive 开启时先写入
+// ArchiveDir 下的 gzip 压缩 JSONL 文件，零值使用默认值
+type RequestLogRetentionConfig struct {
+	Id            uint64 `json:"id"`
+	Enable        bool   `json:"enable"`
+	RetentionDays int    `json:"retentionDays" binding:"gte=0"`
+	Archive       bool   `json:"archive"`
+	ArchiveDir    string `json:"archiveDir"`
+	BatchSize     int    `json:"batchSize" binding:"gte=0"`
+}
+
+// UsageReportConfig 每月用量报表，Enable 开启后每月初把上个月的用量发给 Recipients
+// Recipients 为空时发给所有设置了邮箱的管理员，LastSentMonth 为最近一次定时发送的月份，避免重复发送
+type UsageReportConfig struct {
+	Id            uint64   `json:"id"`
+	Enable        bool     `json:"enable"`
+	Recipients    []string `json:"recipients" binding:"dive,email"`
+	LastSentMonth string   `json:"lastSentMonth"`
+}
+
+// ResponsesConfig Responses API 配置，StateTTLHours 对话状态保留的小时数，超过后 previous_response_id 失效，零值使用默认值
+type ResponsesConfig struct {
+	Id            uint64 `json:"id"`
+	StateTTLHours int    `json:"stateTtlHours" binding:"gte=0"`
+}
+
+// AlertConfig 告警配置，Enable 关闭时告警只按原来的方式发邮件给管理员
+// DedupMinutes 同一事件(类型+对象)在该时间内只发送一次，RateLimitPerMinute 每个通道每分钟最多发送的条数，零值使用默认值
+type AlertConfig struct {
+	Id                 uint64      `json:"id"`
+	Enable             bool        `json:"enable"`
+	DedupMinutes       int         `json:"dedupMinutes" binding:"gte=0"`
+	RateLimitPerMinute int         `json:"rateLimitPerMinute" binding:"gte=0"`
+	Sinks              []AlertSink `json:"sinks" binding:"dive"`
+	Rules              []AlertRule `json:"rules" binding:"dive"`
+}
+
+// AlertSink 告警通道，Name 在配置内唯一，供规则引用
+// Type 为 webhook 时请求体带 HMAC-SHA256 签名，slack/dingtalk/feishu 使用对应机器人的消息格式，钉钉和飞书的 Secret 为加签密钥
+// Type 为 email 时发给 Recipients，为空时发给所有设置了邮箱的管理员
+type AlertSink struct {
+	Name       string   `json:"name" binding:"required"`
+	Type       string   `json:"type" binding:"required,oneof=webhook email slack dingtalk feishu"`
+	Enable     bool     `json:"enable"`
+	Url        string   `json:"url" binding:"omitempty,url"`
+	Secret     string   `json:"secret"`
+	Recipients []string `json:"recipients" binding:"dive,email"`
+}
+
+// AlertRule 事件发送到哪些通道，Event 为 * 时匹配所有没有单独配置的事件，Sinks 为通道名称
+type AlertRule struct {
+	Event  string   `json:"event" binding:"required"`
+	Enable bool     `json:"enable"`
+	Sinks  []string `json:"sinks"`
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/jiu-u/oai-api/internal/service"
+	"github.com/jiu-u/oai-api/pkg/protocol/anthropic"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"io"
+	"net/http"
+)
+
+// Messages Anthropic Messages 接口，转换为 OpenAI chat 请求转发后再把响应转换回来
+func (h *OAIHandler) Messages(ctx *gin.Context) {
+	var req anthropic.MessagesRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, anthropic.NewError(anthropic.ErrInvalidRequest, err.Error()))
+		return
+	}
+	// 提前转换一次，请求格式错误时返回 400 而不是进入转发
+	if _, err := anthropic.ToOpenAI(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, anthropic.NewError(anthropic.ErrInvalidRequest, err.Error()))
+		return
+	}
+	responseBody, _, err := h.oaiService.Messages(ctx, &req)
+	if err != nil {
+		status := service.RelayStatusCode(err)
+		ctx.JSON(status, anthropic.NewError(anthropic.ErrorType(status), err.Error()))
+		return
+	}
+	defer responseBody.Close()
+	if req.Stream {
+		writeMessagesStream(ctx, responseBody, req.Model)
+		return
+	}
+	body, err := io.ReadAll(responseBody)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, anthropic.NewError(anthropic.ErrAPI, err.Error()))
+		return
+	}
+	var chatResp openai.ChatResponse
+	if err = json.Unmarshal(body, &chatResp); err != nil {
+		ctx.JSON(http.StatusBadGateway, anthropic.NewError(anthropic.ErrAPI, "invalid upstream response: "+err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, anthropic.FromOpenAI(&chatResp, req.Model))
+}
+
+// writeMessagesStream 上游流中途出错时已经写出了响应头，只能发送 error 事件
+func writeMessagesStream(ctx *gin.Context, body io.Reader, model string) {
+	writeSSEHeader(ctx)
+	writer := anthropic.NewStreamWriter(ctx.Writer, model)
+	err := openai.ReadChatStream(body, writer.Chunk)
+	if err == nil {
+		err = writer.Finish()
+	}
+	// 客户端断开时不再写入
+	if err != nil && ctx.Request.Context().Err() == nil {
+		_ = writer.Error(anthropic.ErrAPI, err.Error())
+	}
+}
@@ -49,3 +49,22 @@ func (h *ApiKeyHandler) GetApiKey(ctx *gin.Context) {
 	}
 	apiV1.HandleSuccess(ctx, resp)
 }
+
+func (h *ApiKeyHandler) UpdateApiKeyGroup(ctx *gin.Context) {
+	userId := GetUserIdFromCtx(ctx)
+	if userId == 0 {
+		apiV1.HandleError(ctx, 500, errors.New("userId is required"), "userId is required")
+		return
+	}
+	req := new(apiV1.UpdateApiKeyGroupRequest)
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	err := h.svc.UpdateApiKeyGroup(ctx, userId, req)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, err, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(ctx, nil)
+}
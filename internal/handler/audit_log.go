@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	apiV1 "github.com/jiu-u/oai-api/api/v1"
+	"github.com/jiu-u/oai-api/internal/service"
+)
+
+type AuditLogHandler struct {
+	*Handler
+	svc service.AuditLogService
+}
+
+func NewAuditLogHandler(handler *Handler, svc service.AuditLogService) *AuditLogHandler {
+	return &AuditLogHandler{
+		Handler: handler,
+		svc:     svc,
+	}
+}
+
+func (h *AuditLogHandler) GetAuditLogs(ctx *gin.Context) {
+	req := new(apiV1.AuditLogsQuery)
+	if err := ctx.ShouldBindQuery(req); err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	resp, err := h.svc.GetAuditLogs(ctx, req)
+	if err != nil {
+		apiV1.HandleError(ctx, 0, err, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(ctx, resp)
+}
@@ -1,30 +1,52 @@
 package handler
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	apiV1 "github.com/jiu-u/oai-api/api/v1"
 	"github.com/jiu-u/oai-api/internal/service"
+	"go.uber.org/zap"
 	"strconv"
 )
 
 type ChannelHandler struct {
 	*Handler
-	svc      service.ChannelService
-	checkSvc service.ModelCheckService
+	svc        service.ChannelService
+	checkSvc   service.ModelCheckService
+	balanceSvc service.BalanceService
+	statSvc    service.ChannelStatService
+	auditSvc   service.AuditLogService
 }
 
 func NewChannelHandler(
 	handler *Handler,
 	svc service.ChannelService,
 	checkSvc service.ModelCheckService,
+	balanceSvc service.BalanceService,
+	statSvc service.ChannelStatService,
+	auditSvc service.AuditLogService,
 ) *ChannelHandler {
 	return &ChannelHandler{
-		Handler:  handler,
-		svc:      svc,
-		checkSvc: checkSvc,
+		Handler:    handler,
+		svc:        svc,
+		checkSvc:   checkSvc,
+		balanceSvc: balanceSvc,
+		statSvc:    statSvc,
+		auditSvc:   auditSvc,
 	}
 }
 
+// channelSnapshot 审计日志中的渠道快照，key 已经是掩码
+func (h *ChannelHandler) channelSnapshot(ctx *gin.Context, channelId uint64) any {
+	return auditSnapshot(ctx, func(ctx context.Context) (*apiV1.ChannelResponse, error) {
+		return h.svc.GetChannel(ctx, channelId)
+	})
+}
+
+func (h *ChannelHandler) recordAudit(ctx *gin.Context, action, targetType string, targetId uint64, before, after any) {
+	h.auditSvc.Record(ctx, newAuditEntry(ctx, action, targetType, strconv.FormatUint(targetId, 10), before, after))
+}
+
 func (h *ChannelHandler) GetChannels(ctx *gin.Context) {
 	req := new(apiV1.ChannelQueryRequest)
 	if err := ctx.ShouldBind(req); err != nil {
@@ -50,6 +72,7 @@ func (h *ChannelHandler) CreateChannel(ctx *gin.Context) {
 		apiV1.HandleError(ctx, 0, err, err.Error())
 		return
 	}
+	h.recordAudit(ctx, "channel.create", service.AuditTargetChannel, resp, nil, h.channelSnapshot(ctx, resp))
 	apiV1.HandleSuccess(ctx, strconv.FormatUint(resp, 10))
 }
 
@@ -64,11 +87,13 @@ func (h *ChannelHandler) DeleteChannel(ctx *gin.Context) {
 		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "channelId is invalid")
 		return
 	}
+	before := h.channelSnapshot(ctx, channelIdUint)
 	err = h.svc.DeleteChannel(ctx, channelIdUint)
 	if err != nil {
 		apiV1.HandleError(ctx, 0, err, err.Error())
 		return
 	}
+	h.recordAudit(ctx, "channel.delete", service.AuditTargetChannel, channelIdUint, before, nil)
 	apiV1.HandleSuccess(ctx, nil)
 }
 
@@ -107,11 +132,13 @@ func (h *ChannelHandler) UpdateChannel(ctx *gin.Context) {
 		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "channelId is invalid")
 		return
 	}
+	before := h.channelSnapshot(ctx, channelIdUint)
 	err = h.svc.UpdateChannel(ctx, channelIdUint, &req)
 	if err != nil {
 		apiV1.HandleError(ctx, 0, err, err.Error())
 		return
 	}
+	h.recordAudit(ctx, "channel.update", service.AuditTargetChannel, channelIdUint, before, h.channelSnapshot(ctx, channelIdUint))
 	apiV1.HandleSuccess(ctx, nil)
 }
 
@@ -131,11 +158,13 @@ func (h *ChannelHandler) UpdateChannelStatus(ctx *gin.Context) {
 		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "channelId is invalid")
 		return
 	}
+	before := h.channelSnapshot(ctx, channelIdUint)
 	err = h.svc.UpdateChannelStatus(ctx, channelIdUint, req.Status)
 	if err != nil {
 		apiV1.HandleError(ctx, 0, err, err.Error())
 		return
 	}
+	h.recordAudit(ctx, "channel.status", service.AuditTargetChannel, channelIdUint, before, h.channelSnapshot(ctx, channelIdUint))
 	apiV1.HandleSuccess(ctx, nil)
 }
 
@@ -165,3 +194,220 @@ func (h *ChannelHandler) CheckModel(ctx *gin.Context) {
 	}
 	apiV1.HandleSuccess(ctx, resp)
 }
+
+// BatchCheckModels 批量检查渠道模型，每个模型完成后通过SSE推送一次结果
+func (h *ChannelHandler) BatchCheckModels(ctx *gin.Context) {
+	channelIdUint, err := strconv.ParseUint(ctx.Param("channelId"), 10, 64)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "channelId is invalid")
+		return
+	}
+	var req apiV1.BatchCheckModelRequest
+	if ctx.Request.ContentLength > 0 {
+		if err = ctx.ShouldBindJSON(&req); err != nil {
+			apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+			return
+		}
+	}
+	// 禁用失败模型时记录审计日志，检查中途客户端断开时同样记录已经禁用的模型
+	var before any
+	if req.DisableFailed {
+		before = h.channelSnapshot(ctx, channelIdUint)
+	}
+	// 客户端断开后不再发起新的检查
+	results, err := h.checkSvc.CheckChannelModels(ctx.Request.Context(), channelIdUint, &req)
+	if err != nil {
+		apiV1.HandleError(ctx, 0, err, err.Error())
+		return
+	}
+	if req.DisableFailed {
+		defer func() {
+			h.recordAudit(ctx, "channel.models.check.batch", service.AuditTargetChannel, channelIdUint, before, h.channelSnapshot(ctx, channelIdUint))
+		}()
+	}
+	ctx.Writer.Header().Set("Content-Type", "text/event-stream")
+	ctx.Writer.Header().Set("Cache-Control", "no-cache")
+	ctx.Writer.Header().Set("Connection", "keep-alive")
+	ctx.Writer.Header().Set("X-Accel-Buffering", "no")
+	summary := apiV1.BatchCheckModelSummary{}
+	for result := range results {
+		summary.Total++
+		if result.Status == 1 {
+			summary.Success++
+		} else {
+			summary.Failed++
+		}
+		if result.Disabled {
+			summary.Disabled++
+		}
+		ctx.SSEvent("result", result)
+		ctx.Writer.Flush()
+	}
+	ctx.SSEvent("done", summary)
+	ctx.Writer.Flush()
+}
+
+func (h *ChannelHandler) GetCheckHistory(ctx *gin.Context) {
+	channelIdUint, err := strconv.ParseUint(ctx.Param("channelId"), 10, 64)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "channelId is invalid")
+		return
+	}
+	var req apiV1.ModelCheckHistoryRequest
+	if err = ctx.ShouldBindQuery(&req); err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	resp, err := h.checkSvc.GetCheckHistory(ctx, channelIdUint, &req)
+	if err != nil {
+		apiV1.HandleError(ctx, 0, err, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(ctx, resp)
+}
+
+func (h *ChannelHandler) RefreshBalance(ctx *gin.Context) {
+	channelIdUint, err := strconv.ParseUint(ctx.Param("channelId"), 10, 64)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "channelId is invalid")
+		return
+	}
+	// 余额低于阈值或恢复时会禁用或启用渠道及其模型
+	before := h.channelSnapshot(ctx, channelIdUint)
+	resp, err := h.balanceSvc.RefreshChannelBalance(ctx, channelIdUint)
+	if err != nil {
+		apiV1.HandleError(ctx, 0, err, err.Error())
+		return
+	}
+	h.recordAudit(ctx, "channel.balance.refresh", service.AuditTargetChannel, channelIdUint, before, h.channelSnapshot(ctx, channelIdUint))
+	apiV1.HandleSuccess(ctx, resp)
+}
+
+// RevealChannelKey 查看渠道明文key，仅管理员可用，每次调用都会记录
+func (h *ChannelHandler) RevealChannelKey(ctx *gin.Context) {
+	channelId := ctx.Param("channelId")
+	if channelId == "" {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "channelId is required")
+		return
+	}
+	channelIdUint, err := strconv.ParseUint(channelId, 10, 64)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "channelId is invalid")
+		return
+	}
+	resp, err := h.svc.RevealChannelKey(ctx, channelIdUint)
+	if err != nil {
+		apiV1.HandleError(ctx, 0, err, err.Error())
+		return
+	}
+	h.logger.WithContext(ctx).Warn("查看渠道key",
+		zap.Uint64("operator", GetUserIdFromCtx(ctx)),
+		zap.Uint64("channelId", channelIdUint),
+		zap.String("ip", ctx.ClientIP()),
+	)
+	h.recordAudit(ctx, "channel.key.reveal", service.AuditTargetChannel, channelIdUint, nil, nil)
+	apiV1.HandleSuccess(ctx, resp)
+}
+
+func (h *ChannelHandler) AddChannelKeys(ctx *gin.Context) {
+	channelIdUint, err := strconv.ParseUint(ctx.Param("channelId"), 10, 64)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "channelId is invalid")
+		return
+	}
+	var req apiV1.AddChannelKeysRequest
+	if err = ctx.ShouldBind(&req); err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	before := h.channelSnapshot(ctx, channelIdUint)
+	err = h.svc.AddChannelKeys(ctx, channelIdUint, req.APIKeys)
+	if err != nil {
+		apiV1.HandleError(ctx, 0, err, err.Error())
+		return
+	}
+	h.recordAudit(ctx, "channel.key.add", service.AuditTargetChannel, channelIdUint, before, h.channelSnapshot(ctx, channelIdUint))
+	apiV1.HandleSuccess(ctx, nil)
+}
+
+func (h *ChannelHandler) DeleteChannelKey(ctx *gin.Context) {
+	channelIdUint, err := strconv.ParseUint(ctx.Param("channelId"), 10, 64)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "channelId is invalid")
+		return
+	}
+	keyIdUint, err := strconv.ParseUint(ctx.Param("keyId"), 10, 64)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "keyId is invalid")
+		return
+	}
+	before := h.channelSnapshot(ctx, channelIdUint)
+	err = h.svc.DeleteChannelKey(ctx, channelIdUint, keyIdUint)
+	if err != nil {
+		apiV1.HandleError(ctx, 0, err, err.Error())
+		return
+	}
+	h.recordAudit(ctx, "channel.key.delete", service.AuditTargetChannelKey, keyIdUint, before, h.channelSnapshot(ctx, channelIdUint))
+	apiV1.HandleSuccess(ctx, nil)
+}
+
+func (h *ChannelHandler) UpdateChannelKeyStatus(ctx *gin.Context) {
+	channelIdUint, err := strconv.ParseUint(ctx.Param("channelId"), 10, 64)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "channelId is invalid")
+		return
+	}
+	keyIdUint, err := strconv.ParseUint(ctx.Param("keyId"), 10, 64)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "keyId is invalid")
+		return
+	}
+	var req apiV1.UpdateChannelKeyStatusRequest
+	if err = ctx.ShouldBind(&req); err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	before := h.channelSnapshot(ctx, channelIdUint)
+	err = h.svc.UpdateChannelKeyStatus(ctx, channelIdUint, keyIdUint, req.Status)
+	if err != nil {
+		apiV1.HandleError(ctx, 0, err, err.Error())
+		return
+	}
+	h.recordAudit(ctx, "channel.key.status", service.AuditTargetChannelKey, keyIdUint, before, h.channelSnapshot(ctx, channelIdUint))
+	apiV1.HandleSuccess(ctx, nil)
+}
+
+// GetChannelStats 所有渠道在统计窗口内的成功率、错误分类、耗时和token
+func (h *ChannelHandler) GetChannelStats(ctx *gin.Context) {
+	var req apiV1.ChannelStatsQuery
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	resp, err := h.statSvc.GetChannelStats(ctx, &req)
+	if err != nil {
+		apiV1.HandleError(ctx, 500, apiV1.ErrInternalServerError, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(ctx, resp)
+}
+
+// GetChannelModelStats 单个渠道按模型的统计
+func (h *ChannelHandler) GetChannelModelStats(ctx *gin.Context) {
+	channelIdUint, err := strconv.ParseUint(ctx.Param("channelId"), 10, 64)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "channelId is invalid")
+		return
+	}
+	var req apiV1.ChannelStatsQuery
+	if err = ctx.ShouldBindQuery(&req); err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	resp, err := h.statSvc.GetChannelModelStats(ctx, channelIdUint, &req)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(ctx, resp)
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/jiu-u/oai-api/internal/service"
+	"github.com/jiu-u/oai-api/pkg/protocol/gemini"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// GeminiModelAction Gemini 的 /models/{model}:generateContent 和 :streamGenerateContent 接口
+// 转换为 OpenAI chat 请求转发后再把响应转换回来
+func (h *OAIHandler) GeminiModelAction(ctx *gin.Context) {
+	modelId, action, ok := strings.Cut(ctx.Param("action"), ":")
+	if !ok || modelId == "" {
+		ctx.JSON(http.StatusNotFound, gemini.NewError(http.StatusNotFound, gemini.StatusNotFound, "unknown method"))
+		return
+	}
+	var stream bool
+	switch action {
+	case "generateContent":
+	case "streamGenerateContent":
+		stream = true
+	default:
+		ctx.JSON(http.StatusNotFound, gemini.NewError(http.StatusNotFound, gemini.StatusNotFound, "unsupported method: "+action))
+		return
+	}
+	var req gemini.GenerateContentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gemini.NewError(http.StatusBadRequest, gemini.StatusInvalidArgument, err.Error()))
+		return
+	}
+	// 提前转换一次，请求格式错误时返回 400 而不是进入转发
+	if _, err := gemini.ToOpenAI(modelId, &req, stream); err != nil {
+		ctx.JSON(http.StatusBadRequest, gemini.NewError(http.StatusBadRequest, gemini.StatusInvalidArgument, err.Error()))
+		return
+	}
+	responseBody, _, err := h.oaiService.GenerateContent(ctx, modelId, &req, stream)
+	if err != nil {
+		status := service.RelayStatusCode(err)
+		ctx.JSON(status, gemini.NewError(status, gemini.ErrorStatus(status), err.Error()))
+		return
+	}
+	defer responseBody.Close()
+	if stream {
+		writeGeminiStream(ctx, responseBody, modelId, ctx.Query("alt") == "sse")
+		return
+	}
+	body, err := io.ReadAll(responseBody)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gemini.NewError(http.StatusBadGateway, gemini.StatusInternal, err.Error()))
+		return
+	}
+	var chatResp openai.ChatResponse
+	if err = json.Unmarshal(body, &chatResp); err != nil {
+		ctx.JSON(http.StatusBadGateway, gemini.NewError(http.StatusBadGateway, gemini.StatusInternal, "invalid upstream response: "+err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, gemini.FromOpenAI(&chatResp, modelId))
+}
+
+// writeGeminiStream alt=sse 时为 SSE，否则为逐步写出的 json 数组
+func writeGeminiStream(ctx *gin.Context, body io.Reader, model string, sse bool) {
+	if sse {
+		writeSSEHeader(ctx)
+	} else {
+		ctx.Header("Content-Type", "application/json")
+		ctx.Status(http.StatusOK)
+	}
+	writer := gemini.NewStreamWriter(ctx.Writer, model, sse)
+	err := openai.ReadChatStream(body, writer.Chunk)
+	if err == nil {
+		err = writer.Finish()
+	}
+	// 客户端断开时不再写入
+	if err != nil && ctx.Request.Context().Err() == nil {
+		_ = writer.Error(gemini.StatusInternal, err.Error())
+	}
+}
@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
+	"github.com/jiu-u/oai-api/constant"
+	"github.com/jiu-u/oai-api/internal/service"
 	"github.com/jiu-u/oai-api/pkg/jwt"
 	"github.com/jiu-u/oai-api/pkg/log"
 )
@@ -31,3 +34,31 @@ func GetUserRoleFromCtx(ctx *gin.Context) string {
 	}
 	return v.(*jwt.MyCustomClaims).Role
 }
+
+// newAuditEntry 从请求中取操作人、IP 和请求ID
+func newAuditEntry(ctx *gin.Context, action, targetType, targetId string, before, after any) *service.AuditEntry {
+	entry := &service.AuditEntry{
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   targetId,
+		Before:     before,
+		After:      after,
+		Ip:         ctx.ClientIP(),
+		TraceId:    ctx.GetString(constant.RequestIdKey),
+	}
+	if v, exists := ctx.Get("claims"); exists {
+		claims := v.(*jwt.MyCustomClaims)
+		entry.ActorId = claims.UserId
+		entry.ActorName = claims.Username
+	}
+	return entry
+}
+
+// auditSnapshot 读取对象用于审计日志，读取失败(如尚未配置)时视为不存在
+func auditSnapshot[T any](ctx context.Context, get func(ctx context.Context) (T, error)) any {
+	v, err := get(ctx)
+	if err != nil {
+		return nil
+	}
+	return v
+}
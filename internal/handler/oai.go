@@ -13,12 +13,14 @@ import (
 
 type OAIHandler struct {
 	*Handler
-	oaiService service.OaiService
+	oaiService   service.OaiService
+	responsesSvc service.ResponsesService
 }
 
-func NewOAIHandler(oaiService service.OaiService) *OAIHandler {
+func NewOAIHandler(oaiService service.OaiService, responsesSvc service.ResponsesService) *OAIHandler {
 	return &OAIHandler{
-		oaiService: oaiService,
+		oaiService:   oaiService,
+		responsesSvc: responsesSvc,
 	}
 }
 
@@ -261,3 +263,11 @@ func (h *OAIHandler) ImageVariation(ctx *gin.Context) {
 	}
 	defaultRespHandle(ctx, responseBody, respHeader)
 }
+
+// writeSSEHeader 转换协议的流式响应在写出第一个事件前调用
+func writeSSEHeader(ctx *gin.Context) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Status(http.StatusOK)
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/jiu-u/oai-api/internal/service"
+	"github.com/jiu-u/oai-api/pkg/protocol/ollama"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"io"
+	"net/http"
+	"time"
+)
+
+// OllamaChat Ollama 的 /api/chat 接口，转换为 OpenAI chat 请求转发后再把响应转换回来
+func (h *OAIHandler) OllamaChat(ctx *gin.Context) {
+	start := time.Now()
+	var req ollama.ChatRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, ollama.NewError(err.Error()))
+		return
+	}
+	// 提前转换一次，请求格式错误时返回 400 而不是进入转发
+	if _, err := ollama.ChatToOpenAI(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, ollama.NewError(err.Error()))
+		return
+	}
+	responseBody, _, err := h.oaiService.OllamaChat(ctx, &req)
+	if err != nil {
+		ctx.JSON(service.RelayStatusCode(err), ollama.NewError(err.Error()))
+		return
+	}
+	defer responseBody.Close()
+	if req.IsStream() {
+		writeOllamaStream(ctx, responseBody, req.Model, false, start)
+		return
+	}
+	chatResp, ok := readChatResponse(ctx, responseBody)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, ollama.ChatFromOpenAI(chatResp, req.Model, start))
+}
+
+// OllamaGenerate Ollama 的 /api/generate 接口，prompt 转换为一条 user 消息
+func (h *OAIHandler) OllamaGenerate(ctx *gin.Context) {
+	start := time.Now()
+	var req ollama.GenerateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, ollama.NewError(err.Error()))
+		return
+	}
+	if _, err := ollama.GenerateToOpenAI(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, ollama.NewError(err.Error()))
+		return
+	}
+	responseBody, _, err := h.oaiService.OllamaGenerate(ctx, &req)
+	if err != nil {
+		ctx.JSON(service.RelayStatusCode(err), ollama.NewError(err.Error()))
+		return
+	}
+	defer responseBody.Close()
+	if req.IsStream() {
+		writeOllamaStream(ctx, responseBody, req.Model, true, start)
+		return
+	}
+	chatResp, ok := readChatResponse(ctx, responseBody)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, ollama.GenerateFromOpenAI(chatResp, req.Model, start))
+}
+
+// readChatResponse 读取上游的非流式响应，失败时直接写出 502
+func readChatResponse(ctx *gin.Context, responseBody io.Reader) (*openai.ChatResponse, bool) {
+	body, err := io.ReadAll(responseBody)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, ollama.NewError(err.Error()))
+		return nil, false
+	}
+	var chatResp openai.ChatResponse
+	if err = json.Unmarshal(body, &chatResp); err != nil {
+		ctx.JSON(http.StatusBadGateway, ollama.NewError("invalid upstream response: "+err.Error()))
+		return nil, false
+	}
+	return &chatResp, true
+}
+
+// writeOllamaStream 上游流中途出错时已经写出了响应头，只能写出一行 error
+func writeOllamaStream(ctx *gin.Context, body io.Reader, model string, generate bool, start time.Time) {
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Status(http.StatusOK)
+	writer := ollama.NewStreamWriter(ctx.Writer, model, generate, start)
+	err := openai.ReadChatStream(body, writer.Chunk)
+	if err == nil {
+		err = writer.Finish()
+	}
+	// 客户端断开时不再写入
+	if err != nil && ctx.Request.Context().Err() == nil {
+		_ = writer.Error(err.Error())
+	}
+}
+
+// OllamaEmbeddings Ollama 的 /api/embeddings 接口，转换为 OpenAI embeddings 请求
+func (h *OAIHandler) OllamaEmbeddings(ctx *gin.Context) {
+	var req ollama.EmbeddingsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, ollama.NewError(err.Error()))
+		return
+	}
+	reqBody, err := ollama.EmbeddingsToOpenAI(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, ollama.NewError(err.Error()))
+		return
+	}
+	responseBody, _, err := h.oaiService.EmbeddingsByBytes(ctx, reqBody, ollama.ModelId(req.Model))
+	if err != nil {
+		ctx.JSON(service.RelayStatusCode(err), ollama.NewError(err.Error()))
+		return
+	}
+	defer responseBody.Close()
+	body, err := io.ReadAll(responseBody)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, ollama.NewError(err.Error()))
+		return
+	}
+	resp, err := ollama.EmbeddingsFromOpenAI(body)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, ollama.NewError("invalid upstream response: "+err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// OllamaTags Ollama 的 /api/tags 接口，返回调用方可以使用的模型
+func (h *OAIHandler) OllamaTags(ctx *gin.Context) {
+	models, err := h.oaiService.Models(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, ollama.NewError(err.Error()))
+		return
+	}
+	modelIds := make([]string, 0, len(models.Data))
+	for _, model := range models.Data {
+		modelIds = append(modelIds, model.ID)
+	}
+	ctx.JSON(http.StatusOK, ollama.Tags(modelIds))
+}
@@ -2,22 +2,38 @@ package handler
 
 import (
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	apiV1 "github.com/jiu-u/oai-api/api/v1"
 	"github.com/jiu-u/oai-api/internal/service"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
 )
 
 type RequestLogHandler struct {
-	Handler *Handler
-	svc     service.RequestLogService
-	limit   int
+	Handler      *Handler
+	svc          service.RequestLogService
+	retentionSvc service.RequestLogRetentionService
+	statSvc      service.RequestLogStatService
+	reportSvc    service.UsageReportService
+	limit        int
 }
 
-func NewRequestLogHandler(handler *Handler, svc service.RequestLogService) *RequestLogHandler {
+func NewRequestLogHandler(
+	handler *Handler,
+	svc service.RequestLogService,
+	retentionSvc service.RequestLogRetentionService,
+	statSvc service.RequestLogStatService,
+	reportSvc service.UsageReportService,
+) *RequestLogHandler {
 	return &RequestLogHandler{
-		Handler: handler,
-		svc:     svc,
-		limit:   30,
+		Handler:      handler,
+		svc:          svc,
+		retentionSvc: retentionSvc,
+		statSvc:      statSvc,
+		reportSvc:    reportSvc,
+		limit:        30,
 	}
 }
 
@@ -36,6 +52,21 @@ func (h *RequestLogHandler) GetRequestLogs(ctx *gin.Context) {
 	apiV1.HandleSuccess(ctx, resp)
 }
 
+// GetRequestLogDetail 包含采集到的请求体和响应体
+func (h *RequestLogHandler) GetRequestLogDetail(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, "id is invalid")
+		return
+	}
+	resp, err := h.svc.GetRequestLogDetail(ctx, id)
+	if err != nil {
+		apiV1.HandleError(ctx, 404, apiV1.ErrNotFound, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(ctx, resp)
+}
+
 func (h *RequestLogHandler) GetUserRequestLogs(ctx *gin.Context) {
 	req := new(apiV1.RequestLogsQuery)
 	if err := ctx.ShouldBind(req); err != nil {
@@ -83,3 +114,143 @@ func (h *RequestLogHandler) GetRequestLogsUserRanking(ctx *gin.Context) {
 	}
 	apiV1.HandleSuccess(ctx, resp)
 }
+
+// PurgeRequestLogs 手动按保留策略清理过期日志，不受策略开关影响，返回本次删除和归档的数量
+func (h *RequestLogHandler) PurgeRequestLogs(ctx *gin.Context) {
+	resp, err := h.retentionSvc.PurgeExpired(ctx, false)
+	if errors.Is(err, service.ErrRequestLogPurgeRunning) {
+		apiV1.HandleError(ctx, 409, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		apiV1.HandleError(ctx, 500, apiV1.ErrInternalServerError, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(ctx, resp)
+}
+
+// GetUsageStats 按时间桶返回请求数、失败数、token、费用和耗时分位数，数据来自预聚合的统计表
+func (h *RequestLogHandler) GetUsageStats(ctx *gin.Context) {
+	req := new(apiV1.UsageStatsQuery)
+	if err := ctx.ShouldBind(req); err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	resp, err := h.statSvc.GetUsageStats(ctx, req)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(ctx, resp)
+}
+
+// GetMyRequestLogs 当前登录用户自己的请求日志
+func (h *RequestLogHandler) GetMyRequestLogs(ctx *gin.Context) {
+	req := new(apiV1.RequestLogsQuery)
+	if err := ctx.ShouldBind(req); err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	resp, err := h.svc.GetUserRequestLogs(ctx, GetUserIdFromCtx(ctx), req)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, err, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(ctx, resp)
+}
+
+func (h *RequestLogHandler) GetMyDailyUsage(ctx *gin.Context) {
+	req := new(apiV1.UserUsageQuery)
+	if err := ctx.ShouldBind(req); err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	resp, err := h.statSvc.GetUserDailyUsage(ctx, GetUserIdFromCtx(ctx), req)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(ctx, resp)
+}
+
+func (h *RequestLogHandler) GetMyUsageSummary(ctx *gin.Context) {
+	req := new(apiV1.UserUsageQuery)
+	if err := ctx.ShouldBind(req); err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	resp, err := h.statSvc.GetUserUsageSummary(ctx, GetUserIdFromCtx(ctx), req)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(ctx, resp)
+}
+
+// setExportHeader 按格式设置下载的文件名和类型
+func setExportHeader(ctx *gin.Context, name string, format string) {
+	if format == service.ExportFormatJSONL {
+		ctx.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	} else {
+		format = service.ExportFormatCSV
+		ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	}
+	filename := fmt.Sprintf("%s_%s.%s", name, time.Now().Format("20060102150405"), format)
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+}
+
+// handleExportError 还没有写出内容时返回错误信息，已经开始传输时只能记录日志并中断
+func (h *RequestLogHandler) handleExportError(ctx *gin.Context, err error) {
+	if !ctx.Writer.Written() {
+		ctx.Header("Content-Disposition", "")
+		ctx.Header("Content-Type", "")
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	h.Handler.logger.WithContext(ctx).Error("导出中断", zap.String("path", ctx.Request.URL.Path), zap.Error(err))
+	ctx.Abort()
+}
+
+// ExportRequestLogs 流式导出日志明细，过滤条件与列表一致
+func (h *RequestLogHandler) ExportRequestLogs(ctx *gin.Context) {
+	req := new(apiV1.RequestLogsExportQuery)
+	if err := ctx.ShouldBind(req); err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	setExportHeader(ctx, "request_logs", req.Format)
+	if err := h.reportSvc.ExportRequestLogs(ctx, req, ctx.Writer); err != nil {
+		h.handleExportError(ctx, err)
+	}
+}
+
+// ExportUsage 按用户、key、模型、渠道或天汇总的用量
+func (h *RequestLogHandler) ExportUsage(ctx *gin.Context) {
+	req := new(apiV1.UsageExportQuery)
+	if err := ctx.ShouldBind(req); err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	setExportHeader(ctx, "usage_by_"+req.GroupBy, req.Format)
+	if err := h.reportSvc.ExportUsage(ctx, req, ctx.Writer); err != nil {
+		h.handleExportError(ctx, err)
+	}
+}
+
+// SendUsageReport 立即发送某个月的用量报表，不受报表开关影响
+func (h *RequestLogHandler) SendUsageReport(ctx *gin.Context) {
+	req := new(apiV1.UsageReportRequest)
+	// 请求体可以为空，表示上个月
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBind(req); err != nil {
+			apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+			return
+		}
+	}
+	resp, err := h.reportSvc.SendMonthlyReport(ctx, req.Month, false)
+	if err != nil {
+		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(ctx, resp)
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jiu-u/oai-api/internal/service"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"github.com/jiu-u/oai-api/pkg/protocol/responses"
+	"io"
+	"net/http"
+)
+
+// Responses OpenAI Responses API，渠道支持时原样转发，否则转换为 chat completions 后再把响应转换回来
+// 两种方式都由网关保存对话状态，供后续请求的 previous_response_id 使用
+func (h *OAIHandler) Responses(ctx *gin.Context) {
+	raw, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, responses.NewError("invalid_request_error", err.Error()))
+		return
+	}
+	ctx.Request.Body = io.NopCloser(bytes.NewBuffer(raw))
+	var req responses.Request
+	if err = ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responses.NewError("invalid_request_error", err.Error()))
+		return
+	}
+	body, err := h.responsesSvc.Prepare(ctx, raw, &req)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrResponseStateNotFound) {
+			status = http.StatusNotFound
+		}
+		ctx.JSON(status, responses.NewError("invalid_request_error", err.Error()))
+		return
+	}
+	responseBody, _, err := h.responsesSvc.Relay(ctx, body)
+	if err != nil {
+		status := service.RelayStatusCode(err)
+		ctx.JSON(status, responses.NewError(responses.ErrorType(status), err.Error()))
+		return
+	}
+	defer responseBody.Close()
+	switch {
+	case req.Stream && body.UseNative:
+		writeSSEHeader(ctx)
+		// 上游中途断开时没有结束事件，final 为nil，不保存对话状态
+		final, _ := responses.CopyStream(ctx.Writer, responseBody)
+		h.responsesSvc.SaveState(ctx, body, final)
+	case req.Stream:
+		writeSSEHeader(ctx)
+		writer := responses.NewStreamWriter(ctx.Writer, &req, body.Id)
+		err = openai.ReadChatStream(responseBody, writer.Chunk)
+		if err == nil {
+			err = writer.Finish()
+		}
+		// 客户端断开时不再写入
+		if err != nil && ctx.Request.Context().Err() == nil {
+			_ = writer.Error(err.Error())
+		}
+		h.responsesSvc.SaveState(ctx, body, writer.Response())
+	default:
+		data, err := io.ReadAll(responseBody)
+		if err != nil {
+			ctx.JSON(http.StatusBadGateway, responses.NewError("server_error", err.Error()))
+			return
+		}
+		resp, err := parseResponsesBody(data, body)
+		if err != nil {
+			ctx.JSON(http.StatusBadGateway, responses.NewError("server_error", "invalid upstream response: "+err.Error()))
+			return
+		}
+		h.responsesSvc.SaveState(ctx, body, resp)
+		if body.UseNative {
+			ctx.Data(http.StatusOK, "application/json", data)
+			return
+		}
+		ctx.JSON(http.StatusOK, resp)
+	}
+}
+
+// parseResponsesBody 原生转发时上游返回的就是 Responses 格式，否则为 chat completions 格式
+func parseResponsesBody(data []byte, body *service.ResponsesRelayBody) (*responses.Response, error) {
+	if body.UseNative {
+		resp := new(responses.Response)
+		return resp, json.Unmarshal(data, resp)
+	}
+	var chatResp openai.ChatResponse
+	if err := json.Unmarshal(data, &chatResp); err != nil {
+		return nil, err
+	}
+	return responses.FromChat(&chatResp, body.Request, body.Id), nil
+}
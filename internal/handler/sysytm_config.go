@@ -9,16 +9,30 @@ import (
 
 type SystemConfigHandler struct {
 	*Handler
-	svc service.SystemConfigService
+	svc       service.SystemConfigService
+	notifySvc service.NotifyService
+	auditSvc  service.AuditLogService
 }
 
-func NewSystemConfigHandler(handler *Handler, svc service.SystemConfigService) *SystemConfigHandler {
+func NewSystemConfigHandler(
+	handler *Handler,
+	svc service.SystemConfigService,
+	notifySvc service.NotifyService,
+	auditSvc service.AuditLogService,
+) *SystemConfigHandler {
 	return &SystemConfigHandler{
-		Handler: handler,
-		svc:     svc,
+		Handler:   handler,
+		svc:       svc,
+		notifySvc: notifySvc,
+		auditSvc:  auditSvc,
 	}
 }
 
+// recordConfigAudit 配置读取接口返回的密钥已经是掩码
+func (h *SystemConfigHandler) recordConfigAudit(c *gin.Context, name string, before, after any) {
+	h.auditSvc.Record(c, newAuditEntry(c, "system."+name+".update", service.AuditTargetSystem, name, before, after))
+}
+
 func (h *SystemConfigHandler) SetEmailConfig(ctx *gin.Context) {
 	req := new(apiV1.EmailConfig)
 	if err := ctx.ShouldBind(req); err != nil {
@@ -26,11 +40,13 @@ func (h *SystemConfigHandler) SetEmailConfig(ctx *gin.Context) {
 		return
 	}
 
+	before := auditSnapshot(ctx, h.svc.GetEmailConfig)
 	err := h.svc.SetEmailConfig(ctx, req)
 	if err != nil {
 		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
 		return
 	}
+	h.recordConfigAudit(ctx, "email", before, auditSnapshot(ctx, h.svc.GetEmailConfig))
 	apiV1.HandleSuccess(ctx, nil)
 }
 
@@ -59,11 +75,13 @@ func (h *SystemConfigHandler) SetLinuxDoOAuthConfig(ctx *gin.Context) {
 		return
 	}
 
+	before := auditSnapshot(ctx, h.svc.GetLinuxDoOAuthConfig)
 	err := h.svc.SetLinuxDoOAuthConfig(ctx, req)
 	if err != nil {
 		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
 		return
 	}
+	h.recordConfigAudit(ctx, "linux-do", before, auditSnapshot(ctx, h.svc.GetLinuxDoOAuthConfig))
 	apiV1.HandleSuccess(ctx, nil)
 }
 
@@ -92,11 +110,13 @@ func (h *SystemConfigHandler) SetGithubOAuthConfig(ctx *gin.Context) {
 		return
 	}
 
+	before := auditSnapshot(ctx, h.svc.GetGithubOAuthConfig)
 	err := h.svc.SetGithubOAuthConfig(ctx, req)
 	if err != nil {
 		apiV1.HandleError(ctx, 400, apiV1.ErrBadRequest, err.Error())
 		return
 	}
+	h.recordConfigAudit(ctx, "github", before, auditSnapshot(ctx, h.svc.GetGithubOAuthConfig))
 	apiV1.HandleSuccess(ctx, nil)
 }
 
@@ -125,11 +145,13 @@ func (h *SystemConfigHandler) SetRegisterConfig(c *gin.Context) {
 		return
 	}
 
+	before := auditSnapshot(c, h.svc.GetRegisterConfig)
 	err := h.svc.SetRegisterConfig(c, req)
 	if err != nil {
 		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
 		return
 	}
+	h.recordConfigAudit(c, "register", before, auditSnapshot(c, h.svc.GetRegisterConfig))
 	apiV1.HandleSuccess(c, nil)
 }
 
@@ -148,11 +170,13 @@ func (h *SystemConfigHandler) SetModelConfig(c *gin.Context) {
 		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
 		return
 	}
+	before := auditSnapshot(c, h.svc.GetModelConfig)
 	err := h.svc.SetModelConfig(c, &req)
 	if err != nil {
 		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
 		return
 	}
+	h.recordConfigAudit(c, "model", before, auditSnapshot(c, h.svc.GetModelConfig))
 	apiV1.HandleSuccess(c, nil)
 }
 
@@ -164,3 +188,143 @@ func (h *SystemConfigHandler) GetModelConfig(c *gin.Context) {
 	}
 	apiV1.HandleSuccess(c, resp)
 }
+
+func (h *SystemConfigHandler) SetBodyCaptureConfig(c *gin.Context) {
+	req := new(apiV1.BodyCaptureConfig)
+	if err := c.ShouldBind(req); err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	before := auditSnapshot(c, h.svc.GetBodyCaptureConfig)
+	err := h.svc.SetBodyCaptureConfig(c, req)
+	if err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	h.recordConfigAudit(c, "capture", before, auditSnapshot(c, h.svc.GetBodyCaptureConfig))
+	apiV1.HandleSuccess(c, nil)
+}
+
+func (h *SystemConfigHandler) GetBodyCaptureConfig(c *gin.Context) {
+	resp, err := h.svc.GetBodyCaptureConfig(c)
+	if err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(c, resp)
+}
+
+func (h *SystemConfigHandler) SetRequestLogRetentionConfig(c *gin.Context) {
+	req := new(apiV1.RequestLogRetentionConfig)
+	if err := c.ShouldBind(req); err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	before := auditSnapshot(c, h.svc.GetRequestLogRetentionConfig)
+	err := h.svc.SetRequestLogRetentionConfig(c, req)
+	if err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	h.recordConfigAudit(c, "retention", before, auditSnapshot(c, h.svc.GetRequestLogRetentionConfig))
+	apiV1.HandleSuccess(c, nil)
+}
+
+func (h *SystemConfigHandler) GetRequestLogRetentionConfig(c *gin.Context) {
+	resp, err := h.svc.GetRequestLogRetentionConfig(c)
+	if err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(c, resp)
+}
+
+func (h *SystemConfigHandler) SetUsageReportConfig(c *gin.Context) {
+	req := new(apiV1.UsageReportConfig)
+	if err := c.ShouldBind(req); err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	before := auditSnapshot(c, h.svc.GetUsageReportConfig)
+	err := h.svc.SetUsageReportConfig(c, req)
+	if err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	h.recordConfigAudit(c, "report", before, auditSnapshot(c, h.svc.GetUsageReportConfig))
+	apiV1.HandleSuccess(c, nil)
+}
+
+func (h *SystemConfigHandler) GetUsageReportConfig(c *gin.Context) {
+	resp, err := h.svc.GetUsageReportConfig(c)
+	if err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(c, resp)
+}
+
+func (h *SystemConfigHandler) SetAlertConfig(c *gin.Context) {
+	req := new(apiV1.AlertConfig)
+	if err := c.ShouldBind(req); err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	before := auditSnapshot(c, h.svc.GetAlertConfig)
+	err := h.svc.SetAlertConfig(c, req)
+	if err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	h.recordConfigAudit(c, "alert", before, auditSnapshot(c, h.svc.GetAlertConfig))
+	apiV1.HandleSuccess(c, nil)
+}
+
+func (h *SystemConfigHandler) GetAlertConfig(c *gin.Context) {
+	resp, err := h.svc.GetAlertConfig(c)
+	if err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(c, resp)
+}
+
+func (h *SystemConfigHandler) SetResponsesConfig(c *gin.Context) {
+	req := new(apiV1.ResponsesConfig)
+	if err := c.ShouldBind(req); err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	before := auditSnapshot(c, h.svc.GetResponsesConfig)
+	err := h.svc.SetResponsesConfig(c, req)
+	if err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	h.recordConfigAudit(c, "responses", before, auditSnapshot(c, h.svc.GetResponsesConfig))
+	apiV1.HandleSuccess(c, nil)
+}
+
+func (h *SystemConfigHandler) GetResponsesConfig(c *gin.Context) {
+	resp, err := h.svc.GetResponsesConfig(c)
+	if err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(c, resp)
+}
+
+// TestAlert 使用已保存的配置发送，返回每个通道的发送结果
+func (h *SystemConfigHandler) TestAlert(c *gin.Context) {
+	req := new(apiV1.AlertTestRequest)
+	if err := c.ShouldBind(req); err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	resp, err := h.notifySvc.TestAlert(c, req.Sink)
+	if err != nil {
+		apiV1.HandleError(c, 400, apiV1.ErrBadRequest, err.Error())
+		return
+	}
+	apiV1.HandleSuccess(c, resp)
+}
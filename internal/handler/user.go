@@ -1,23 +1,38 @@
 package handler
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	v1 "github.com/jiu-u/oai-api/api/v1"
 	"github.com/jiu-u/oai-api/internal/service"
+	"strconv"
 )
 
 type UserHandler struct {
 	*Handler
-	svc service.UserService
+	svc      service.UserService
+	auditSvc service.AuditLogService
 }
 
-func NewUserHandler(handler *Handler, svc service.UserService) *UserHandler {
+func NewUserHandler(handler *Handler, svc service.UserService, auditSvc service.AuditLogService) *UserHandler {
 	return &UserHandler{
-		Handler: handler,
-		svc:     svc,
+		Handler:  handler,
+		svc:      svc,
+		auditSvc: auditSvc,
 	}
 }
 
+func (h *UserHandler) userSnapshot(ctx *gin.Context, userId uint64) any {
+	return auditSnapshot(ctx, func(ctx context.Context) (*v1.UserInfo, error) {
+		return h.svc.GetUserInfo(ctx, userId)
+	})
+}
+
+func (h *UserHandler) recordAudit(ctx *gin.Context, action string, userId uint64, before any) {
+	h.auditSvc.Record(ctx, newAuditEntry(ctx, action, service.AuditTargetUser, strconv.FormatUint(userId, 10),
+		before, h.userSnapshot(ctx, userId)))
+}
+
 func (h *UserHandler) GetCurrentUser(ctx *gin.Context) {
 	userId := GetUserIdFromCtx(ctx)
 	resp, err := h.svc.GetUserInfo(ctx, userId)
@@ -27,3 +42,67 @@ func (h *UserHandler) GetCurrentUser(ctx *gin.Context) {
 	}
 	v1.HandleSuccess(ctx, resp)
 }
+
+func (h *UserHandler) UpdateUserGroup(ctx *gin.Context) {
+	userId, err := strconv.ParseUint(ctx.Param("userId"), 10, 64)
+	if err != nil {
+		v1.HandleError(ctx, 400, v1.ErrBadRequest, "userId is invalid")
+		return
+	}
+	req := new(v1.UpdateUserGroupRequest)
+	if err = ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, 400, v1.ErrBadRequest, err.Error())
+		return
+	}
+	before := h.userSnapshot(ctx, userId)
+	err = h.svc.UpdateUserGroup(ctx, userId, req)
+	if err != nil {
+		v1.HandleError(ctx, 400, err, err.Error())
+		return
+	}
+	h.recordAudit(ctx, "user.group", userId, before)
+	v1.HandleSuccess(ctx, nil)
+}
+
+// UpdateUserCredit 设置用户的额度上限，用户可以在用量页面看到剩余额度
+func (h *UserHandler) UpdateUserCredit(ctx *gin.Context) {
+	userId, err := strconv.ParseUint(ctx.Param("userId"), 10, 64)
+	if err != nil {
+		v1.HandleError(ctx, 400, v1.ErrBadRequest, "userId is invalid")
+		return
+	}
+	req := new(v1.UpdateUserCreditRequest)
+	if err = ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, 400, v1.ErrBadRequest, err.Error())
+		return
+	}
+	before := h.userSnapshot(ctx, userId)
+	err = h.svc.UpdateUserCredit(ctx, userId, req)
+	if err != nil {
+		v1.HandleError(ctx, 400, err, err.Error())
+		return
+	}
+	h.recordAudit(ctx, "user.credit", userId, before)
+	v1.HandleSuccess(ctx, nil)
+}
+
+// BanUser 禁用用户并删除其api key
+func (h *UserHandler) BanUser(ctx *gin.Context) {
+	userId, err := strconv.ParseUint(ctx.Param("userId"), 10, 64)
+	if err != nil {
+		v1.HandleError(ctx, 400, v1.ErrBadRequest, "userId is invalid")
+		return
+	}
+	if userId == GetUserIdFromCtx(ctx) {
+		v1.HandleError(ctx, 400, v1.ErrBadRequest, "不能禁用自己")
+		return
+	}
+	before := h.userSnapshot(ctx, userId)
+	err = h.svc.BanUser(ctx, userId)
+	if err != nil {
+		v1.HandleError(ctx, 400, err, err.Error())
+		return
+	}
+	h.recordAudit(ctx, "user.ban", userId, before)
+	v1.HandleSuccess(ctx, nil)
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jiu-u/oai-api/constant"
+	"github.com/jiu-u/oai-api/pkg/jwt"
+	"github.com/jiu-u/oai-api/pkg/log"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// AdminMiddleware 需要放在 JwtMiddleware 之后
+func AdminMiddleware(logger *log.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, exists := ctx.Get("claims")
+		claims, ok := v.(*jwt.MyCustomClaims)
+		if !exists || !ok || claims.Role != constant.AdminRole {
+			logger.WithContext(ctx).Warn("permission denied", zap.Any("data", map[string]interface{}{
+				"url":    ctx.Request.URL,
+				"params": ctx.Params,
+			}))
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -4,19 +4,52 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/jiu-u/oai-api/internal/service"
 	"github.com/jiu-u/oai-api/pkg/log"
+	"go.uber.org/zap"
 	"net/http"
 	"strings"
 )
 
 func ApiKeyMiddleware(apiKeySvc service.ApiKeyService, logger *log.Logger) gin.HandlerFunc {
+	return apiKeyMiddleware(apiKeySvc, logger, false)
+}
+
+// QueryApiKeyMiddleware 额外接受 ?key= 参数中的 api key，只用于 Gemini 接口
+// url 中的 key 会出现在代理和访问日志中，其他接口不接受
+func QueryApiKeyMiddleware(apiKeySvc service.ApiKeyService, logger *log.Logger) gin.HandlerFunc {
+	return apiKeyMiddleware(apiKeySvc, logger, true)
+}
+
+func apiKeyMiddleware(apiKeySvc service.ApiKeyService, logger *log.Logger, allowQuery bool) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		apiKey := ctx.GetHeader("Authorization")
-		if apiKey == "" || !apiKeySvc.IsActiveApiKey(ctx, strings.TrimPrefix(apiKey, "Bearer ")) {
+		key := requestApiKey(ctx)
+		if key == "" && allowQuery {
+			key = ctx.Query("key")
+		}
+		if key == "" || !apiKeySvc.IsActiveApiKey(ctx, key) {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "api key is invalid"})
+			return
+		}
+		groups, err := apiKeySvc.GetApiKeyGroups(ctx, key)
+		if err != nil {
+			logger.WithContext(ctx).Warn("获取api key分组失败", zap.Error(err))
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "api key is invalid"})
 			return
 		}
-		key := strings.TrimPrefix(apiKey, "Bearer ")
 		ctx.Set("apiKey", key)
+		ctx.Set("groups", groups)
 		ctx.Next()
 	}
 }
+
+// requestApiKey 优先使用 Authorization，Anthropic 客户端使用 x-api-key，Gemini 客户端使用 x-goog-api-key
+func requestApiKey(ctx *gin.Context) string {
+	if apiKey := ctx.GetHeader("Authorization"); apiKey != "" {
+		return strings.TrimPrefix(apiKey, "Bearer ")
+	}
+	for _, header := range []string{"x-api-key", "x-goog-api-key"} {
+		if apiKey := ctx.GetHeader(header); apiKey != "" {
+			return apiKey
+		}
+	}
+	return ""
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// MetricsAuthMiddleware 校验抓取 /metrics 时携带的 Bearer token
+func MetricsAuthMiddleware(token string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		got := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -4,16 +4,58 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/jiu-u/oai-api/constant"
 	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/tracing"
 	"github.com/lithammer/shortuuid/v4"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"net/http"
 )
 
-func TraceMiddleware(logger *log.Logger) gin.HandlerFunc {
+// RequestIdHeader 返回给调用方的请求ID，反馈问题时提供该ID即可定位到日志和链路
+const RequestIdHeader = "X-Request-Id"
+
+// TraceMiddleware 解析 W3C traceparent 并创建入站span，traceId 同时写入日志和 X-Request-Id 响应头
+func TraceMiddleware(logger *log.Logger, tp *tracing.Tracing) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		Ip := ctx.ClientIP()
 		ctx.Set(constant.ClientIPKey, Ip)
-		traceId := shortuuid.New()
+		route := ctx.FullPath()
+		if route == "" {
+			route = ctx.Request.URL.Path
+		}
+		reqCtx := tp.Propagator.Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+		reqCtx, span := tp.Tracer.Start(reqCtx, ctx.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(ctx.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(ctx.Request.URL.Path),
+				semconv.ClientAddress(Ip),
+				semconv.UserAgentOriginal(ctx.Request.UserAgent()),
+			),
+		)
+		defer span.End()
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		// 未开启链路追踪且调用方没有带 traceparent 时，traceId 无效，退回到随机ID
+		traceId := span.SpanContext().TraceID().String()
+		if !span.SpanContext().TraceID().IsValid() {
+			traceId = shortuuid.New()
+		}
+		ctx.Header(RequestIdHeader, traceId)
+		ctx.Set(constant.RequestIdKey, traceId)
+		ctx.Set(constant.RequestPathKey, ctx.Request.URL.Path)
 		logger.WithValue(ctx, zap.String("traceId", traceId), zap.String("type", "request"))
 		ctx.Next()
+		status := ctx.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if len(ctx.Errors) > 0 {
+			span.RecordError(ctx.Errors.Last())
+		}
 	}
 }
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// AuditLog 管理操作的审计日志，只追加不修改，Before/After/Diff 为脱敏后的 json
+type AuditLog struct {
+	Id         uint64    `gorm:"primaryKey;autoIncrement:false;comment:主键ID" json:"id"`
+	ActorId    uint64    `gorm:"index;comment:操作人ID" json:"actorId"`
+	ActorName  string    `gorm:"size:255;comment:操作人用户名" json:"actorName"`
+	Action     string    `gorm:"size:64;index;comment:操作,如channel.create" json:"action"`
+	TargetType string    `gorm:"size:32;index:idx_audit_log_target;comment:对象类型" json:"targetType"`
+	TargetId   string    `gorm:"size:64;index:idx_audit_log_target;comment:对象ID" json:"targetId"`
+	Before     string    `gorm:"type:text;comment:修改前" json:"before"`
+	After      string    `gorm:"type:text;comment:修改后" json:"after"`
+	Diff       string    `gorm:"type:text;comment:变化的字段" json:"diff"`
+	Ip         string    `gorm:"size:39;comment:操作人IP" json:"ip"`
+	TraceId    string    `gorm:"size:64;index;comment:请求ID" json:"traceId"`
+	CreatedAt  time.Time `gorm:"index;comment:创建时间" json:"createdAt"`
+}
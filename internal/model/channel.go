@@ -8,25 +8,56 @@ import (
 	"time"
 )
 
+const (
+	BalanceActionDeprioritize int8 = 1
+	BalanceActionDisable      int8 = 2
+)
+
 type Channel struct {
-	Id        uint64                `gorm:"primaryKey;autoIncrement:false;comment:主键ID" json:"id"`
-	Name      string                `gorm:"size:100;not null;comment:渠道名称" json:"name"`
-	Type      string                `gorm:"size:50;not null;comment:渠道类型"`
-	EndPoint  string                `gorm:"size:255;not null;comment:基础URL"`
-	Balance   float64               `gorm:"comment:余额"`
-	APIKey    string                `gorm:"size:255;comment:访问令牌"`
-	HashId    string                `gorm:"size:64;uniqueIndex:idx_channel_hash_id;comment:哈希ID" json:"hashId"`
-	Status    int8                  `gorm:"default:1;comment:状态，1启用，2禁用"`
-	Models    []ChannelModel        `gorm:"foreignKey:ChannelId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-	CreatedAt time.Time             `gorm:"index;comment:创建时间" json:"createdAt"`
-	UpdatedAt time.Time             `gorm:"comment:更新时间" json:"updatedAt"`
-	DeletedAt soft_delete.DeletedAt `gorm:"index;uniqueIndex:idx_channel_hash_id;comment:删除时间" json:"deletedAt" `
+	Id               uint64                `gorm:"primaryKey;autoIncrement:false;comment:主键ID" json:"id"`
+	Name             string                `gorm:"size:100;not null;comment:渠道名称" json:"name"`
+	Type             string                `gorm:"size:50;not null;comment:渠道类型"`
+	EndPoint         string                `gorm:"size:255;not null;comment:基础URL"`
+	Balance          float64               `gorm:"comment:余额"`
+	APIKey           string                `gorm:"size:255;comment:访问令牌(已迁移至channel_keys)"`
+	HashId           string                `gorm:"size:64;uniqueIndex:idx_channel_hash_id;comment:哈希ID" json:"hashId"`
+	Status           int8                  `gorm:"default:1;comment:状态，1启用，2禁用"`
+	DisableReason    string                `gorm:"size:255;comment:自动禁用原因"`
+	Group            string                `gorm:"column:group_names;size:255;default:default;comment:渠道分组，多个用逗号分隔"`
+	BalanceURL       string                `gorm:"size:255;comment:自定义余额查询地址"`
+	BalancePath      string                `gorm:"size:100;comment:自定义余额字段路径"`
+	BalanceThreshold float64               `gorm:"default:0;comment:余额阈值,0不启用"`
+	BalanceAction    int8                  `gorm:"default:1;comment:余额低于阈值时的处理,1降权,2禁用"`
+	BalanceUpdatedAt *time.Time            `gorm:"comment:余额更新时间"`
+	ResponsesAPI     int8                  `gorm:"default:2;comment:是否支持原生Responses API，1支持，2不支持"`
+	Models           []ChannelModel        `gorm:"foreignKey:ChannelId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Keys             []ChannelKey          `gorm:"foreignKey:ChannelId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedAt        time.Time             `gorm:"index;comment:创建时间" json:"createdAt"`
+	UpdatedAt        time.Time             `gorm:"comment:更新时间" json:"updatedAt"`
+	DeletedAt        soft_delete.DeletedAt `gorm:"index;uniqueIndex:idx_channel_hash_id;comment:删除时间" json:"deletedAt" `
 }
 
 func (c *Channel) GenerateHashId() {
 	c.HashId = encrypte.Sha256Encode(fmt.Sprintf("%s%s%s", c.Type, c.EndPoint, c.APIKey))
 }
 
+// BalanceLow 是否配置了余额阈值且余额低于阈值
+func (c *Channel) BalanceLow() bool {
+	return c.BalanceThreshold > 0 && c.BalanceUpdatedAt != nil && c.Balance < c.BalanceThreshold
+}
+
+// InGroups 渠道是否属于 groups 中的任意一个分组
+func (c *Channel) InGroups(groups []string) bool {
+	for _, group := range ParseGroups(c.Group) {
+		for _, target := range groups {
+			if group == target {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (c *Channel) AfterUpdate(tx *gorm.DB) (err error) {
 	err = tx.Exec("update channels c set hash_id = SHA2(CONCAT(c.type,c.end_point,c.end_point),256) where id = ?", c.Id).Error
 	return err
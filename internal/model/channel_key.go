@@ -0,0 +1,30 @@
+package model
+
+import (
+	"github.com/jiu-u/oai-api/pkg/encrypte"
+	"gorm.io/plugin/soft_delete"
+	"time"
+)
+
+// ChannelKey 渠道下的上游key，一个渠道可以拥有多个key
+type ChannelKey struct {
+	Id            uint64                `gorm:"primaryKey;autoIncrement:false;comment:主键ID" json:"id"`
+	ChannelId     uint64                `gorm:"index;uniqueIndex:idx_channel_key_hash_id;comment:渠道ID" json:"channelId"`
+	Content       string                `gorm:"size:512;not null;comment:访问令牌(密文)" json:"-"`
+	HashId        string                `gorm:"size:64;uniqueIndex:idx_channel_key_hash_id;comment:明文key的哈希" json:"hashId"`
+	Status        int8                  `gorm:"default:1;index;comment:状态，1启用，2禁用" json:"status"`
+	ErrorCount    int32                 `gorm:"default:0;comment:连续错误次数" json:"errorCount"`
+	TotalCount    int64                 `gorm:"default:0;comment:总次数" json:"totalCount"`
+	Balance       float64               `gorm:"default:0;comment:余额" json:"balance"`
+	CoolDownUntil time.Time             `gorm:"comment:冷却截止时间" json:"coolDownUntil"`
+	LastUsedTime  time.Time             `gorm:"comment:最后一次使用时间" json:"lastUsedTime"`
+	DisableReason string                `gorm:"size:255;comment:禁用原因" json:"disableReason"`
+	CreatedAt     time.Time             `gorm:"index;comment:创建时间" json:"createdAt"`
+	UpdatedAt     time.Time             `gorm:"comment:更新时间" json:"updatedAt"`
+	DeletedAt     soft_delete.DeletedAt `gorm:"index;uniqueIndex:idx_channel_key_hash_id;comment:删除时间" json:"deletedAt" `
+}
+
+// GenerateHashId plainKey 为明文key，用于同一渠道下key去重
+func (k *ChannelKey) GenerateHashId(plainKey string) {
+	k.HashId = encrypte.Sha256Encode(plainKey)
+}
@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// ChannelStat 按小时预聚合的渠道模型统计，请求日志中的每次上游尝试累加一次
+// 与 ChannelModel 的 TotalCount/ErrorCount 不同，这里的计数不会被权重逻辑修改或重置
+type ChannelStat struct {
+	Id               uint64    `gorm:"primaryKey;autoIncrement:false;comment:主键ID" json:"id"`
+	BucketTime       time.Time `gorm:"not null;uniqueIndex:idx_channel_stat_bucket;comment:小时桶的开始时间" json:"bucketTime"`
+	ChannelId        uint64    `gorm:"not null;uniqueIndex:idx_channel_stat_bucket;comment:渠道ID" json:"channelId"`
+	ModelKey         string    `gorm:"type:varchar(128);not null;default:'';uniqueIndex:idx_channel_stat_bucket;comment:上游模型" json:"modelKey"`
+	Attempts         int64     `gorm:"default:0;comment:尝试次数" json:"attempts"`
+	Successes        int64     `gorm:"default:0;comment:成功次数" json:"successes"`
+	ErrRateLimit     int64     `gorm:"default:0;comment:限流(429)" json:"errRateLimit"`
+	ErrAuth          int64     `gorm:"default:0;comment:鉴权失败(401/403)" json:"errAuth"`
+	ErrQuota         int64     `gorm:"default:0;comment:额度不足" json:"errQuota"`
+	ErrModel         int64     `gorm:"default:0;comment:模型不可用" json:"errModel"`
+	ErrTimeout       int64     `gorm:"default:0;comment:超时" json:"errTimeout"`
+	ErrServer        int64     `gorm:"default:0;comment:上游5xx" json:"errServer"`
+	ErrClient        int64     `gorm:"default:0;comment:其他4xx" json:"errClient"`
+	ErrOther         int64     `gorm:"default:0;comment:网络等其他错误" json:"errOther"`
+	PromptTokens     int64     `gorm:"default:0;comment:输入token数" json:"promptTokens"`
+	CompletionTokens int64     `gorm:"default:0;comment:输出token数" json:"completionTokens"`
+	LatencyHistogram `gorm:"embedded"`
+}
+
+// Merge 累加另一条同一个桶的统计
+func (s *ChannelStat) Merge(o *ChannelStat) {
+	s.Attempts += o.Attempts
+	s.Successes += o.Successes
+	s.ErrRateLimit += o.ErrRateLimit
+	s.ErrAuth += o.ErrAuth
+	s.ErrQuota += o.ErrQuota
+	s.ErrModel += o.ErrModel
+	s.ErrTimeout += o.ErrTimeout
+	s.ErrServer += o.ErrServer
+	s.ErrClient += o.ErrClient
+	s.ErrOther += o.ErrOther
+	s.PromptTokens += o.PromptTokens
+	s.CompletionTokens += o.CompletionTokens
+	s.LatencyHistogram.Merge(&o.LatencyHistogram)
+}
@@ -0,0 +1,27 @@
+package model
+
+import "strings"
+
+// DefaultGroup 未指定分组的渠道和用户都属于默认分组
+const DefaultGroup = "default"
+
+// ParseGroups 解析逗号分隔的分组，去掉空白和重复项，空字符串解析为默认分组
+func ParseGroups(s string) []string {
+	groups := make([]string, 0)
+	set := make(map[string]struct{})
+	for _, group := range strings.Split(s, ",") {
+		group = strings.TrimSpace(group)
+		if group == "" {
+			continue
+		}
+		if _, ok := set[group]; ok {
+			continue
+		}
+		set[group] = struct{}{}
+		groups = append(groups, group)
+	}
+	if len(groups) == 0 {
+		groups = append(groups, DefaultGroup)
+	}
+	return groups
+}
@@ -0,0 +1,47 @@
+package model
+
+import "strings"
+
+// 模型能力，决定健康检查时使用哪种探测请求
+const (
+	CapabilityChat      = "chat"
+	CapabilityEmbedding = "embedding"
+	CapabilityImage     = "image"
+	CapabilityTTS       = "tts"
+	CapabilitySTT       = "stt"
+)
+
+// capabilityKeywords 按顺序匹配模型名称中的关键字，都不匹配时视为对话模型
+var capabilityKeywords = []struct {
+	capability string
+	keywords   []string
+}{
+	{CapabilityEmbedding, []string{"embedding", "embed", "bge-", "m3e"}},
+	{CapabilitySTT, []string{"whisper", "transcribe", "sensevoice"}},
+	{CapabilityTTS, []string{"tts", "cosyvoice", "fish-speech"}},
+	{CapabilityImage, []string{"dall-e", "gpt-image", "flux", "stable-diffusion", "sdxl", "kolors", "imagen"}},
+}
+
+func IsValidCapability(capability string) bool {
+	switch capability {
+	case CapabilityChat, CapabilityEmbedding, CapabilityImage, CapabilityTTS, CapabilitySTT:
+		return true
+	}
+	return false
+}
+
+// DetectModelCapability overrides 为管理员手动声明的模型能力，优先于按名称自动识别
+func DetectModelCapability(modelKey string, overrides map[string]string) string {
+	if capability, ok := overrides[modelKey]; ok && IsValidCapability(capability) {
+		return capability
+	}
+	name := strings.ToLower(modelKey)
+	for _, item := range capabilityKeywords {
+		for _, keyword := range item.keywords {
+			if strings.Contains(name, keyword) {
+				return item.capability
+			}
+		}
+	}
+	return CapabilityChat
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+const (
+	CheckSourceCron   = "cron"
+	CheckSourceManual = "manual"
+	CheckSourceBatch  = "batch"
+)
+
+// ModelCheckResult 每次模型检查的结果，耗时单位均为毫秒
+type ModelCheckResult struct {
+	Id                 uint64    `gorm:"primaryKey;autoIncrement:false;comment:主键ID" json:"id"`
+	ChannelId          uint64    `gorm:"index:idx_check_result_channel_model;comment:渠道ID" json:"channelId"`
+	ChannelKeyId       uint64    `gorm:"comment:渠道keyID" json:"channelKeyId"`
+	ModelRecordId      uint64    `gorm:"index;comment:渠道模型ID" json:"modelRecordId"`
+	ModelKey           string    `gorm:"size:128;index:idx_check_result_channel_model;comment:模型key" json:"modelKey"`
+	Source             string    `gorm:"size:20;comment:来源,cron定时,manual手动,batch批量" json:"source"`
+	Capability         string    `gorm:"size:20;comment:探测类型" json:"capability"`
+	Status             int8      `gorm:"comment:状态,1成功,2失败" json:"status"`
+	StatusCode         int       `gorm:"comment:上游http状态码" json:"statusCode"`
+	ConnectDuration    int64     `gorm:"comment:建立连接耗时" json:"connectDuration"`
+	FirstTokenDuration int64     `gorm:"comment:首字耗时" json:"firstTokenDuration"`
+	TotalDuration      int64     `gorm:"comment:总耗时" json:"totalDuration"`
+	ErrorDetail        string    `gorm:"type:text;comment:错误详情" json:"errorDetail"`
+	CreatedAt          time.Time `gorm:"index;comment:创建时间" json:"createdAt"`
+}
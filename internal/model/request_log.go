@@ -5,19 +5,47 @@ import (
 	"time"
 )
 
+const (
+	RequestLogStatusSuccess int8 = 1
+	RequestLogStatusFail    int8 = 2
+)
+
 type RequestLog struct {
-	Id               uint64                `gorm:"primaryKey;autoIncrement:false;comment:主键ID" json:"id"`
-	Model            string                `gorm:"type:varchar(128);comment:模型key"`
-	UserId           uint64                `gorm:"index;comment:用户id"`
-	Username         string                `gorm:"type:varchar(255);comment:用户名"`
-	Key              string                `gorm:"type:varchar(255);comment:api key"`
-	Ip               string                `gorm:"size:255;comment:ip"`
-	Email            string                `gorm:"size:255;comment:用户邮箱"`
-	Status           int8                  `gorm:"default:1;comment:状态"`
-	RetryTimes       int                   `gorm:"default:0;comment:重试次数"`
-	ChannelNameTrace string                `gorm:"size:255;comment:链式名称"`
-	ChannelIdTrace   string                `gorm:"size:255;comment:链式id"`
-	CreatedAt        time.Time             `gorm:"index;comment:创建时间" json:"createdAt"`
-	UpdatedAt        time.Time             `gorm:"comment:更新时间" json:"updatedAt"`
-	DeletedAt        soft_delete.DeletedAt `gorm:"index;comment:删除时间" json:"deletedAt" `
+	Id                uint64                `gorm:"primaryKey;autoIncrement:false;comment:主键ID" json:"id"`
+	RequestId         string                `gorm:"size:64;index;comment:请求ID,与X-Request-Id响应头一致"`
+	Model             string                `gorm:"type:varchar(128);comment:请求的模型"`
+	UpstreamModel     string                `gorm:"type:varchar(128);comment:最终转发给上游的模型"`
+	UserId            uint64                `gorm:"index;comment:用户id"`
+	Username          string                `gorm:"type:varchar(255);comment:用户名"`
+	Key               string                `gorm:"type:varchar(255);comment:api key"`
+	ApiKeyId          uint64                `gorm:"index;comment:api key id"`
+	Ip                string                `gorm:"size:255;comment:ip"`
+	Email             string                `gorm:"size:255;comment:用户邮箱"`
+	Path              string                `gorm:"size:255;comment:请求路径"`
+	RelayType         string                `gorm:"size:32;comment:中转类型"`
+	Stream            bool                  `gorm:"default:false;comment:是否流式请求"`
+	Status            int8                  `gorm:"default:1;comment:状态,1成功,2失败"`
+	RetryTimes        int                   `gorm:"default:0;comment:重试次数"`
+	TotalLatency      int64                 `gorm:"default:0;comment:总耗时(毫秒)"`
+	FirstTokenLatency int64                 `gorm:"default:0;comment:首字耗时(毫秒)"`
+	PromptTokens      int                   `gorm:"default:0;comment:输入token数"`
+	CompletionTokens  int                   `gorm:"default:0;comment:输出token数"`
+	TotalTokens       int                   `gorm:"default:0;comment:总token数"`
+	Cost              float64               `gorm:"default:0;comment:按模型价格计算的费用"`
+	Attempts          []RequestAttempt      `gorm:"type:text;serializer:json;comment:每次尝试的渠道、状态码和错误"`
+	CreatedAt         time.Time             `gorm:"index;comment:创建时间" json:"createdAt"`
+	UpdatedAt         time.Time             `gorm:"comment:更新时间" json:"updatedAt"`
+	DeletedAt         soft_delete.DeletedAt `gorm:"index;comment:删除时间" json:"deletedAt" `
+}
+
+// RequestAttempt 一次请求中对上游的单次尝试，未选到渠道时 ChannelId 为0
+type RequestAttempt struct {
+	ChannelId     uint64 `json:"channelId"`
+	ChannelName   string `json:"channelName"`
+	ChannelKeyId  uint64 `json:"channelKeyId"`
+	ModelRecordId uint64 `json:"modelRecordId"`
+	UpstreamModel string `json:"upstreamModel"`
+	StatusCode    int    `json:"statusCode"`
+	Error         string `json:"error,omitempty"`
+	Latency       int64  `json:"latency"`
 }
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// RequestLogBody 采样到的请求体和响应体，与 RequestLog 一对一，内容已经脱敏
+// 流式响应保存拼接后的完整消息，按 BodyCaptureConfig.RetentionDays 定期物理删除
+type RequestLogBody struct {
+	Id                uint64    `gorm:"primaryKey;autoIncrement:false;comment:主键ID" json:"id"`
+	RequestLogId      uint64    `gorm:"uniqueIndex;comment:请求日志id" json:"requestLogId"`
+	RequestBody       string    `gorm:"type:text;comment:请求体" json:"requestBody"`
+	ResponseBody      string    `gorm:"type:text;comment:响应体,流式响应为拼接后的消息" json:"responseBody"`
+	RequestTruncated  bool      `gorm:"default:false;comment:请求体是否被截断" json:"requestTruncated"`
+	ResponseTruncated bool      `gorm:"default:false;comment:响应体是否被截断" json:"responseTruncated"`
+	CreatedAt         time.Time `gorm:"index;comment:创建时间" json:"createdAt"`
+}
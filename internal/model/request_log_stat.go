@@ -0,0 +1,90 @@
+package model
+
+import "time"
+
+const (
+	StatPeriodMinute = "minute"
+	StatPeriodHour   = "hour"
+	StatPeriodDay    = "day"
+)
+
+// StatLatencyBounds 耗时直方图各个桶的上界(毫秒)，超过最后一个上界的记入 LatencyInf
+var StatLatencyBounds = []int64{100, 250, 500, 1000, 2500, 5000, 10000, 20000, 30000, 60000, 120000, 300000}
+
+// RequestLogStat 请求日志按时间桶预聚合的统计，每条日志写入时累加 minute/hour/day 三个粒度
+// 同一个桶内按 模型、渠道、用户、key 区分，统计查询只扫描这张表，不受明细日志清理的影响
+type RequestLogStat struct {
+	Id               uint64    `gorm:"primaryKey;autoIncrement:false;comment:主键ID" json:"id"`
+	Period           string    `gorm:"size:8;not null;uniqueIndex:idx_stat_bucket;comment:粒度,minute/hour/day" json:"period"`
+	BucketTime       time.Time `gorm:"not null;uniqueIndex:idx_stat_bucket;comment:时间桶的开始时间" json:"bucketTime"`
+	Model            string    `gorm:"type:varchar(128);not null;default:'';uniqueIndex:idx_stat_bucket;comment:请求的模型" json:"model"`
+	ChannelId        uint64    `gorm:"not null;default:0;uniqueIndex:idx_stat_bucket;comment:最后一次尝试的渠道" json:"channelId"`
+	UserId           uint64    `gorm:"not null;default:0;uniqueIndex:idx_stat_bucket;comment:用户id" json:"userId"`
+	ApiKeyId         uint64    `gorm:"not null;default:0;uniqueIndex:idx_stat_bucket;comment:api key id" json:"apiKeyId"`
+	Requests         int64     `gorm:"default:0;comment:请求数" json:"requests"`
+	Errors           int64     `gorm:"default:0;comment:失败数" json:"errors"`
+	PromptTokens     int64     `gorm:"default:0;comment:输入token数" json:"promptTokens"`
+	CompletionTokens int64     `gorm:"default:0;comment:输出token数" json:"completionTokens"`
+	Cost             float64   `gorm:"default:0;comment:费用" json:"cost"`
+	LatencyHistogram `gorm:"embedded"`
+}
+
+// Merge 累加另一条同一个桶的统计
+func (s *RequestLogStat) Merge(o *RequestLogStat) {
+	s.Requests += o.Requests
+	s.Errors += o.Errors
+	s.PromptTokens += o.PromptTokens
+	s.CompletionTokens += o.CompletionTokens
+	s.Cost += o.Cost
+	s.LatencyHistogram.Merge(&o.LatencyHistogram)
+}
+
+// LatencyHistogram 耗时直方图，嵌入到各个统计表中，列名不带前缀
+type LatencyHistogram struct {
+	LatencySum      int64 `gorm:"default:0;comment:总耗时之和(毫秒)" json:"latencySum"`
+	LatencyLe100    int64 `gorm:"default:0" json:"-"`
+	LatencyLe250    int64 `gorm:"default:0" json:"-"`
+	LatencyLe500    int64 `gorm:"default:0" json:"-"`
+	LatencyLe1000   int64 `gorm:"default:0" json:"-"`
+	LatencyLe2500   int64 `gorm:"default:0" json:"-"`
+	LatencyLe5000   int64 `gorm:"default:0" json:"-"`
+	LatencyLe10000  int64 `gorm:"default:0" json:"-"`
+	LatencyLe20000  int64 `gorm:"default:0" json:"-"`
+	LatencyLe30000  int64 `gorm:"default:0" json:"-"`
+	LatencyLe60000  int64 `gorm:"default:0" json:"-"`
+	LatencyLe120000 int64 `gorm:"default:0" json:"-"`
+	LatencyLe300000 int64 `gorm:"default:0" json:"-"`
+	LatencyInf      int64 `gorm:"default:0" json:"-"`
+}
+
+// LatencyBuckets 与 StatLatencyBounds 一一对应，最后一个为 LatencyInf
+func (s *LatencyHistogram) LatencyBuckets() []*int64 {
+	return []*int64{
+		&s.LatencyLe100, &s.LatencyLe250, &s.LatencyLe500, &s.LatencyLe1000,
+		&s.LatencyLe2500, &s.LatencyLe5000, &s.LatencyLe10000, &s.LatencyLe20000,
+		&s.LatencyLe30000, &s.LatencyLe60000, &s.LatencyLe120000, &s.LatencyLe300000,
+		&s.LatencyInf,
+	}
+}
+
+// ObserveLatency 把一次请求的耗时记入直方图
+func (s *LatencyHistogram) ObserveLatency(ms int64) {
+	s.LatencySum += ms
+	buckets := s.LatencyBuckets()
+	for i, bound := range StatLatencyBounds {
+		if ms <= bound {
+			*buckets[i]++
+			return
+		}
+	}
+	*buckets[len(buckets)-1]++
+}
+
+// Merge 累加另一个直方图
+func (s *LatencyHistogram) Merge(o *LatencyHistogram) {
+	s.LatencySum += o.LatencySum
+	dst, src := s.LatencyBuckets(), o.LatencyBuckets()
+	for i := range dst {
+		*dst[i] += *src[i]
+	}
+}
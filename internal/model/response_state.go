@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// ResponseState Responses API 的对话状态，previous_response_id 指向的响应保存之前的全部输入项和输出项
+// KeyHash 为创建时使用的 api key 的哈希，只有同一个 key 可以继续对话，过期后定期物理删除
+// Items 不指定列类型，由方言决定: MySQL 为 longtext(对话可能超过 text 的 64KB)，Postgres 和 SQLite 为 text
+type ResponseState struct {
+	Id        string    `gorm:"primaryKey;size:64;comment:响应ID" json:"id"`
+	KeyHash   string    `gorm:"size:64;index;comment:api key哈希" json:"keyHash"`
+	Model     string    `gorm:"size:100;comment:模型" json:"model"`
+	Items     string    `gorm:"comment:输入项和输出项,json数组" json:"items"`
+	ExpiresAt time.Time `gorm:"index;comment:过期时间" json:"expiresAt"`
+	CreatedAt time.Time `gorm:"comment:创建时间" json:"createdAt"`
+}
@@ -16,6 +16,8 @@ type User struct {
 	Status      int8                  `gorm:"default:1;index;comment:状态,1启用,2禁用" json:"status"`
 	Nickname    string                `gorm:"type:varchar(255);comment:昵称(可为空)" json:"nickname"`
 	Level       int                   `json:"level"`
+	Group       string                `gorm:"column:group_names;type:varchar(255);comment:用户分组，多个用逗号分隔，为空时按等级映射" json:"group"`
+	CreditLimit float64               `gorm:"default:0;comment:额度上限,按模型价格计算的费用,0不限制" json:"creditLimit"`
 	LastLoginAt time.Time             `json:"lastLoginAt"`
 	LastLoginIP string                `gorm:"type:varchar(39)" json:"lastLoginIP"`
 	CreatedAt   time.Time             `gorm:"index;comment:创建时间" json:"createdAt"`
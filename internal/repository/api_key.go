@@ -14,6 +14,7 @@ type ApiKeyRepository interface {
 	IsExist(ctx context.Context, apiKey string) (bool, error)
 	QueryItemByApiKey(ctx context.Context, apiKey string) (*model.ApiKey, error)
 	GetUserApiKey(ctx context.Context, userId uint64) (*model.ApiKey, error)
+	UpdateApiKeyGroup(ctx context.Context, userId uint64, group string) error
 }
 
 func NewApiKeyRepository(r *Repository) ApiKeyRepository {
@@ -76,3 +77,8 @@ func (r *apiKeyRepo) IsExist(ctx context.Context, apiKey string) (bool, error) {
 	}
 	return count > 0, nil
 }
+
+// UpdateApiKeyGroup group 允许为空，为空时使用用户分组
+func (r *apiKeyRepo) UpdateApiKeyGroup(ctx context.Context, userId uint64, group string) error {
+	return r.DB(ctx).Model(&model.ApiKey{}).Where("user_id = ?", userId).Update("group_names", group).Error
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	apiV1 "github.com/jiu-u/oai-api/api/v1"
+	"github.com/jiu-u/oai-api/internal/model"
+)
+
+// AuditLogRepository 审计日志只追加，不提供修改和删除
+type AuditLogRepository interface {
+	CreateAuditLog(ctx context.Context, log *model.AuditLog) error
+	FindAuditLogs(ctx context.Context, req *apiV1.AuditLogsQuery) ([]*model.AuditLog, int64, error)
+}
+
+func NewAuditLogRepository(r *Repository) AuditLogRepository {
+	return &auditLogRepository{Repository: r}
+}
+
+type auditLogRepository struct {
+	*Repository
+}
+
+func (r *auditLogRepository) CreateAuditLog(ctx context.Context, log *model.AuditLog) error {
+	return r.DB(ctx).Create(log).Error
+}
+
+func (r *auditLogRepository) FindAuditLogs(ctx context.Context, req *apiV1.AuditLogsQuery) ([]*model.AuditLog, int64, error) {
+	query := r.DB(ctx).Model(&model.AuditLog{})
+	if req.StartTime != "" && req.EndTime != "" {
+		query = query.Where("created_at BETWEEN ? AND ?", req.StartTime, req.EndTime)
+	}
+	if req.ActorId != "" {
+		query = query.Where("actor_id = ?", req.ActorId)
+	}
+	if req.Action != "" {
+		query = query.Where("action = ?", req.Action)
+	}
+	if req.TargetType != "" {
+		query = query.Where("target_type = ?", req.TargetType)
+	}
+	if req.TargetId != "" {
+		query = query.Where("target_id = ?", req.TargetId)
+	}
+	if req.TraceId != "" {
+		query = query.Where("trace_id = ?", req.TraceId)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var logs []*model.AuditLog
+	err := query.Offset((req.Page - 1) * req.PageSize).Limit(req.PageSize).Order("id desc").Find(&logs).Error
+	return logs, total, err
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/jiu-u/oai-api/internal/model"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"time"
 )
 
 type QueryOption func(*gorm.DB) *gorm.DB
@@ -65,6 +66,8 @@ type ChannelRepository interface {
 	FindAllChannelsByCondition(ctx context.Context, req *query.ChannelQueryRequest) ([]*model.Channel, int64, error)
 	ExistsChannel(ctx context.Context, channel *model.Channel) (bool, error)
 	UpdateChannel(ctx context.Context, channel *model.Channel) error
+	UpdateChannelStatus(ctx context.Context, id uint64, status int8, reason string) error
+	UpdateChannelBalance(ctx context.Context, id uint64, balance float64) error
 	DeleteChannelByID(ctx context.Context, id uint64) error
 	PermanentlyDeleteChannel(ctx context.Context, channel *model.Channel) error
 	//FindByCondition(ctx context.Context, options ...QueryOption) (*model.Channel, error)
@@ -125,7 +128,7 @@ func (r *channelRepository) CreateChannelIfNotExists(ctx context.Context, channe
 
 func (r *channelRepository) FindChannelById(ctx context.Context, id uint64) (*model.Channel, error) {
 	var channel model.Channel
-	err := r.DB(ctx).Model(&model.Channel{}).Preload("Models").First(&channel, id).Error
+	err := r.DB(ctx).Model(&model.Channel{}).Preload("Models").Preload("Keys").First(&channel, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, fmt.Errorf("channel with Id %d not found", id)
@@ -189,7 +192,7 @@ func (r *channelRepository) FindAllChannelsByCondition(ctx context.Context, req
 		return nil, 0, fmt.Errorf("error counting channels: %w", err)
 	}
 	// 设置分页
-	dbQuery = dbQuery.Offset((req.Page - 1) * req.PageSize).Limit(req.PageSize).Preload("Models")
+	dbQuery = dbQuery.Offset((req.Page - 1) * req.PageSize).Limit(req.PageSize).Preload("Models").Preload("Keys")
 	// 获取符合条件的总记录数
 	err = dbQuery.Order("id desc").Find(&channels).Error
 	if err != nil {
@@ -216,6 +219,24 @@ func (r *channelRepository) UpdateChannel(ctx context.Context, channel *model.Ch
 	return r.DB(ctx).Updates(channel).Error
 }
 
+func (r *channelRepository) UpdateChannelStatus(ctx context.Context, id uint64, status int8, reason string) error {
+	if status < 1 || status > 2 {
+		return errors.New("invalid status")
+	}
+	// UpdateColumns 不触发 AfterUpdate 钩子
+	return r.DB(ctx).Model(&model.Channel{}).Where("id = ?", id).UpdateColumns(map[string]any{
+		"status":         status,
+		"disable_reason": reason,
+	}).Error
+}
+
+func (r *channelRepository) UpdateChannelBalance(ctx context.Context, id uint64, balance float64) error {
+	return r.DB(ctx).Model(&model.Channel{}).Where("id = ?", id).UpdateColumns(map[string]any{
+		"balance":            balance,
+		"balance_updated_at": time.Now(),
+	}).Error
+}
+
 //func (r *channelRepository) UpdateByCondition(ctx context.Context, condition map[string]interface{}, channel *model.Channel) error {
 //	return r.DB(ctx).Where(condition).Updates(channel).Error
 //}
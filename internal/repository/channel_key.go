@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jiu-u/oai-api/internal/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+type ChannelKeyRepository interface {
+	CreateChannelKeyIfNotExists(ctx context.Context, channelKey *model.ChannelKey) error
+	FindChannelKeyById(ctx context.Context, id uint64) (*model.ChannelKey, error)
+	FindChannelKeysByChannelId(ctx context.Context, channelId uint64) ([]*model.ChannelKey, error)
+	FindUsefulChannelKeys(ctx context.Context, channelIds []uint64) ([]*model.ChannelKey, error)
+	CountEnabledChannelKeys(ctx context.Context, channelId uint64) (int64, error)
+
+	MarkChannelKeySuccess(ctx context.Context, id uint64) error
+	MarkChannelKeyFail(ctx context.Context, id uint64, coolDown time.Duration) error
+	UpdateChannelKeyStatus(ctx context.Context, id uint64, status int8, reason string) error
+	UpdateChannelKeyBalance(ctx context.Context, id uint64, balance float64) error
+
+	DeleteChannelKeyById(ctx context.Context, id uint64) error
+	DeleteChannelKeysByChannelId(ctx context.Context, channelId uint64) error
+}
+
+func NewChannelKeyRepository(repo *Repository) ChannelKeyRepository {
+	return &channelKeyRepository{
+		Repository: repo,
+	}
+}
+
+type channelKeyRepository struct {
+	*Repository
+}
+
+func (r *channelKeyRepository) CreateChannelKeyIfNotExists(ctx context.Context, channelKey *model.ChannelKey) error {
+	var temp model.ChannelKey
+	row := r.DB(ctx).Where("channel_id = ? and hash_id = ?", channelKey.ChannelId, channelKey.HashId).First(&temp)
+	if row.Error != nil {
+		if errors.Is(row.Error, gorm.ErrRecordNotFound) {
+			return r.DB(ctx).Create(channelKey).Error
+		}
+		return row.Error
+	}
+	channelKey.Id = temp.Id
+	return nil
+}
+
+func (r *channelKeyRepository) FindChannelKeyById(ctx context.Context, id uint64) (*model.ChannelKey, error) {
+	var channelKey model.ChannelKey
+	err := r.DB(ctx).First(&channelKey, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("channel key with Id %d not found", id)
+		}
+		return nil, fmt.Errorf("error fetching channel key: %w", err)
+	}
+	return &channelKey, nil
+}
+
+func (r *channelKeyRepository) FindChannelKeysByChannelId(ctx context.Context, channelId uint64) ([]*model.ChannelKey, error) {
+	var list []*model.ChannelKey
+	err := r.DB(ctx).Where("channel_id = ?", channelId).Order("created_at asc").Find(&list).Error
+	return list, err
+}
+
+// FindUsefulChannelKeys 查询启用且不在冷却期内的key
+func (r *channelKeyRepository) FindUsefulChannelKeys(ctx context.Context, channelIds []uint64) ([]*model.ChannelKey, error) {
+	var list []*model.ChannelKey
+	err := r.DB(ctx).
+		Where("channel_id in (?) and status = 1 and cool_down_until < ?", channelIds, time.Now()).
+		Find(&list).Error
+	return list, err
+}
+
+func (r *channelKeyRepository) CountEnabledChannelKeys(ctx context.Context, channelId uint64) (int64, error) {
+	var count int64
+	err := r.DB(ctx).Model(&model.ChannelKey{}).Where("channel_id = ? and status = 1", channelId).Count(&count).Error
+	return count, err
+}
+
+func (r *channelKeyRepository) MarkChannelKeySuccess(ctx context.Context, id uint64) error {
+	return r.DB(ctx).
+		Model(&model.ChannelKey{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"total_count":    gorm.Expr("total_count + ?", 1),
+			"error_count":    0,
+			"last_used_time": time.Now(),
+		}).Error
+}
+
+// MarkChannelKeyFail 连续错误次数+1，并进入冷却期，冷却时间随连续错误次数线性增长，最多10倍
+func (r *channelKeyRepository) MarkChannelKeyFail(ctx context.Context, id uint64, coolDown time.Duration) error {
+	var channelKey model.ChannelKey
+	err := r.DB(ctx).Select("id", "error_count").First(&channelKey, id).Error
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	times := min(channelKey.ErrorCount+1, 10)
+	return r.DB(ctx).
+		Model(&model.ChannelKey{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"total_count":     gorm.Expr("total_count + ?", 1),
+			"error_count":     gorm.Expr("error_count + ?", 1),
+			"last_used_time":  now,
+			"cool_down_until": now.Add(coolDown * time.Duration(times)),
+		}).Error
+}
+
+func (r *channelKeyRepository) UpdateChannelKeyStatus(ctx context.Context, id uint64, status int8, reason string) error {
+	if status < 1 || status > 2 {
+		return errors.New("invalid status")
+	}
+	updates := map[string]any{
+		"status":         status,
+		"disable_reason": reason,
+	}
+	if status == 1 {
+		// 手动启用时清空错误状态
+		updates["error_count"] = 0
+		updates["cool_down_until"] = time.Now()
+	}
+	return r.DB(ctx).Model(&model.ChannelKey{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (r *channelKeyRepository) UpdateChannelKeyBalance(ctx context.Context, id uint64, balance float64) error {
+	return r.DB(ctx).Model(&model.ChannelKey{}).Where("id = ?", id).Update("balance", balance).Error
+}
+
+func (r *channelKeyRepository) DeleteChannelKeyById(ctx context.Context, id uint64) error {
+	return r.DB(ctx).Where("id = ?", id).Delete(&model.ChannelKey{}).Error
+}
+
+func (r *channelKeyRepository) DeleteChannelKeysByChannelId(ctx context.Context, channelId uint64) error {
+	return r.DB(ctx).Where("channel_id = ?", channelId).Delete(&model.ChannelKey{}).Error
+}
@@ -23,6 +23,7 @@ type ChannelModelRepository interface {
 	FindCheckChannelModels(ctx context.Context, modelIds []string) ([]*model.ChannelModel, error)
 	FindAllChannelModels(ctx context.Context) ([]*model.ChannelModel, error)
 	FindAllChannelModelIds(ctx context.Context) ([]string, error)
+	CountChannelModels(ctx context.Context, modelIds []string) (int64, error)
 
 	InCrChannelModelWeight(ctx context.Context, id uint64) error
 	DecrChannelModelWeight(ctx context.Context, id uint64) error
@@ -30,6 +31,10 @@ type ChannelModelRepository interface {
 	UpdateChannelModel(ctx context.Context, channelModel *model.ChannelModel) error
 	ResetChannelModels(ctx context.Context, channelId uint64, channelModels []*model.ChannelModel) error
 	UpdateChannelModelsHardStatus(ctx context.Context, channelId uint64, status int8) error
+	DisableChannelModel(ctx context.Context, id uint64, reason string) error
+	DisableChannelModelsWithReason(ctx context.Context, channelId uint64, reason string) error
+	EnableChannelModelsByReason(ctx context.Context, channelId uint64, reasonPrefix string) error
+	UpdateChannelModelLatency(ctx context.Context, id uint64, firstToken, total int64) error
 
 	DeleteChannelModelByID(ctx context.Context, id uint64) error
 	DeleteChannelModelByChannelId(ctx context.Context, channelId uint64) error
@@ -82,7 +87,48 @@ func (r *channelModelRepository) UpdateChannelModelsHardStatus(ctx context.Conte
 	if status < 0 || status > 2 {
 		return errors.New("invalid status")
 	}
-	return r.DB(ctx).Model(&model.ChannelModel{}).Where("channel_id = ?", channelId).Update("hard_limit", status).Error
+	updates := map[string]any{
+		"hard_limit": status,
+	}
+	if status == 1 {
+		updates["disable_reason"] = ""
+	}
+	return r.DB(ctx).Model(&model.ChannelModel{}).Where("channel_id = ?", channelId).Updates(updates).Error
+}
+
+// DisableChannelModel 硬禁用渠道模型，RestoreChannelModel 不会恢复硬禁用的模型
+func (r *channelModelRepository) DisableChannelModel(ctx context.Context, id uint64, reason string) error {
+	return r.DB(ctx).Model(&model.ChannelModel{}).Where("id = ?", id).Updates(map[string]any{
+		"hard_limit":     2,
+		"disable_reason": reason,
+	}).Error
+}
+
+// DisableChannelModelsWithReason 硬禁用渠道下所有启用的模型并记录原因，已经禁用的模型保留原来的原因
+func (r *channelModelRepository) DisableChannelModelsWithReason(ctx context.Context, channelId uint64, reason string) error {
+	return r.DB(ctx).Model(&model.ChannelModel{}).Where("channel_id = ? and hard_limit = 1", channelId).Updates(map[string]any{
+		"hard_limit":     2,
+		"disable_reason": reason,
+	}).Error
+}
+
+// EnableChannelModelsByReason 只启用禁用原因以 reasonPrefix 开头的模型，其他原因禁用的模型保持禁用
+func (r *channelModelRepository) EnableChannelModelsByReason(ctx context.Context, channelId uint64, reasonPrefix string) error {
+	return r.DB(ctx).Model(&model.ChannelModel{}).
+		Where("channel_id = ? and hard_limit = 2 and disable_reason like ?", channelId, reasonPrefix+"%").
+		Updates(map[string]any{
+			"hard_limit":     1,
+			"disable_reason": "",
+		}).Error
+}
+
+// UpdateChannelModelLatency 新值权重为0.3，首次检查时直接使用新值
+func (r *channelModelRepository) UpdateChannelModelLatency(ctx context.Context, id uint64, firstToken, total int64) error {
+	return r.DB(ctx).Model(&model.ChannelModel{}).Where("id = ?", id).UpdateColumns(map[string]any{
+		"first_token_latency": gorm.Expr("CASE WHEN first_token_latency = 0 THEN ? ELSE ROUND(first_token_latency * 0.7 + ? * 0.3) END", firstToken, firstToken),
+		"total_latency":       gorm.Expr("CASE WHEN total_latency = 0 THEN ? ELSE ROUND(total_latency * 0.7 + ? * 0.3) END", total, total),
+		"last_check_time":     time.Now(),
+	}).Error
 }
 
 func (r *channelModelRepository) FindCheckChannelModels(ctx context.Context, modelIds []string) ([]*model.ChannelModel, error) {
@@ -128,6 +174,13 @@ func (r *channelModelRepository) FindUsefulChannelModels(ctx context.Context, mo
 	return list, err
 }
 
+// CountChannelModels 不区分状态，用于判断模型是否配置过
+func (r *channelModelRepository) CountChannelModels(ctx context.Context, modelIds []string) (int64, error) {
+	var count int64
+	err := r.DB(ctx).Model(&model.ChannelModel{}).Where("model_key in (?)", modelIds).Count(&count).Error
+	return count, err
+}
+
 func (r *channelModelRepository) FindAllChannelModels(ctx context.Context) ([]*model.ChannelModel, error) {
 	var list []*model.ChannelModel
 	err := r.DB(ctx).Model(&model.ChannelModel{}).Find(&list).Error
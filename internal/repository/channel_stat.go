@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/jiu-u/oai-api/internal/model"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+)
+
+// channelStatCounterColumns 渠道统计表中需要累加的列
+var channelStatCounterColumns = append([]string{
+	"attempts", "successes",
+	"err_rate_limit", "err_auth", "err_quota", "err_model",
+	"err_timeout", "err_server", "err_client", "err_other",
+	"prompt_tokens", "completion_tokens",
+}, latencyColumns...)
+
+// ChannelStatQuery 时间范围左闭右开，ChannelId 为0时查询所有渠道，ByModel 为 true 时按渠道和模型分组
+type ChannelStatQuery struct {
+	StartTime time.Time
+	EndTime   time.Time
+	ChannelId uint64
+	ByModel   bool
+}
+
+type ChannelStatRepository interface {
+	IncrChannelStats(ctx context.Context, stats []*model.ChannelStat) error
+	FindChannelStats(ctx context.Context, q *ChannelStatQuery) ([]*model.ChannelStat, error)
+}
+
+func NewChannelStatRepository(r *Repository) ChannelStatRepository {
+	return &channelStatRepository{Repository: r}
+}
+
+type channelStatRepository struct {
+	*Repository
+}
+
+func channelStatCounterValues(s *model.ChannelStat) []any {
+	values := []any{
+		s.Attempts, s.Successes,
+		s.ErrRateLimit, s.ErrAuth, s.ErrQuota, s.ErrModel,
+		s.ErrTimeout, s.ErrServer, s.ErrClient, s.ErrOther,
+		s.PromptTokens, s.CompletionTokens,
+	}
+	return append(values, latencyValues(&s.LatencyHistogram)...)
+}
+
+// IncrChannelStats 按 小时桶、渠道、模型 upsert，已存在的桶在原值上累加
+func (r *channelStatRepository) IncrChannelStats(ctx context.Context, stats []*model.ChannelStat) error {
+	for _, stat := range stats {
+		err := r.DB(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "bucket_time"}, {Name: "channel_id"}, {Name: "model_key"}},
+			DoUpdates: incrAssignments("channel_stats", channelStatCounterColumns, channelStatCounterValues(stat)),
+		}).Create(stat).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindChannelStats 汇总整个时间范围，每个渠道(或渠道模型)一行
+func (r *channelStatRepository) FindChannelStats(ctx context.Context, q *ChannelStatQuery) ([]*model.ChannelStat, error) {
+	groups := []string{"channel_id"}
+	if q.ByModel {
+		groups = append(groups, "model_key")
+	}
+	selects := append([]string{}, groups...)
+	for _, column := range channelStatCounterColumns {
+		selects = append(selects, fmt.Sprintf("SUM(%s) AS %s", column, column))
+	}
+	query := r.DB(ctx).Model(&model.ChannelStat{}).
+		Select(strings.Join(selects, ", ")).
+		Where("bucket_time >= ? AND bucket_time < ?", q.StartTime, q.EndTime)
+	if q.ChannelId != 0 {
+		query = query.Where("channel_id = ?", q.ChannelId)
+	}
+	var rows []*model.ChannelStat
+	err := query.Group(strings.Join(groups, ", ")).Find(&rows).Error
+	return rows, err
+}
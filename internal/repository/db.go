@@ -3,6 +3,7 @@ package repository
 import (
 	"github.com/glebarez/sqlite"
 	"github.com/jiu-u/oai-api/pkg/config"
+	"github.com/jiu-u/oai-api/pkg/tracing"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"os"
@@ -60,6 +61,10 @@ func NewDB(cfg *config.Config) *gorm.DB {
 		panic(err)
 	}
 	db = db.Debug()
+	// 写操作挂到当前请求的链路上
+	if err = db.Use(tracing.NewGormPlugin()); err != nil {
+		panic(err)
+	}
 
 	// Connection Pool config
 	sqlDB, err := db.DB()
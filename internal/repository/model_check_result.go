@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"github.com/jiu-u/oai-api/internal/model"
+	"time"
+)
+
+// ModelCheckSummary 一段时间内某个渠道模型的检查结果汇总，耗时单位为毫秒
+type ModelCheckSummary struct {
+	ChannelId   uint64
+	ModelKey    string
+	Total       int64
+	Successes   int64
+	AvgDuration float64
+}
+
+type ModelCheckResultRepository interface {
+	CreateModelCheckResult(ctx context.Context, result *model.ModelCheckResult) error
+	FindModelCheckResults(ctx context.Context, channelId uint64, modelKey string, limit int) ([]*model.ModelCheckResult, error)
+	SumModelCheckResults(ctx context.Context, since time.Time, channelId uint64) ([]*ModelCheckSummary, error)
+}
+
+func NewModelCheckResultRepository(repo *Repository) ModelCheckResultRepository {
+	return &modelCheckResultRepository{repo}
+}
+
+type modelCheckResultRepository struct {
+	*Repository
+}
+
+func (r *modelCheckResultRepository) CreateModelCheckResult(ctx context.Context, result *model.ModelCheckResult) error {
+	return r.DB(ctx).Create(result).Error
+}
+
+// FindModelCheckResults modelKey 为空时查询渠道下所有模型，按时间倒序
+func (r *modelCheckResultRepository) FindModelCheckResults(ctx context.Context, channelId uint64, modelKey string, limit int) ([]*model.ModelCheckResult, error) {
+	var list []*model.ModelCheckResult
+	query := r.DB(ctx).Where("channel_id = ?", channelId)
+	if modelKey != "" {
+		query = query.Where("model_key = ?", modelKey)
+	}
+	err := query.Order("created_at desc").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+// SumModelCheckResults 按渠道和模型汇总 since 之后的检查结果，channelId 为0时查询所有渠道
+func (r *modelCheckResultRepository) SumModelCheckResults(ctx context.Context, since time.Time, channelId uint64) ([]*ModelCheckSummary, error) {
+	var list []*ModelCheckSummary
+	query := r.DB(ctx).Model(&model.ModelCheckResult{}).
+		Select("channel_id, model_key, COUNT(*) AS total, "+
+			"SUM(CASE WHEN status = 1 THEN 1 ELSE 0 END) AS successes, "+
+			"AVG(total_duration) AS avg_duration").
+		Where("created_at >= ?", since)
+	if channelId != 0 {
+		query = query.Where("channel_id = ?", channelId)
+	}
+	err := query.Group("channel_id, model_key").Scan(&list).Error
+	return list, err
+}
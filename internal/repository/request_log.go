@@ -4,6 +4,8 @@ import (
 	"context"
 	apiV1 "github.com/jiu-u/oai-api/api/v1"
 	"github.com/jiu-u/oai-api/internal/model"
+	"gorm.io/gorm"
+	"time"
 )
 
 type RequestLogStatisticsQuery struct {
@@ -20,9 +22,17 @@ type UserCallCount struct {
 
 type RequestLogRepository interface {
 	CreateRequestLog(ctx context.Context, log *model.RequestLog) error
+	CreateRequestLogs(ctx context.Context, logs []*model.RequestLog) error
 	FindRequestLogs(ctx context.Context, req *apiV1.RequestLogsQuery) ([]*model.RequestLog, int64, error)
+	EachRequestLogs(ctx context.Context, req *apiV1.RequestLogsQuery, batchSize int, fn func(logs []*model.RequestLog) error) error
 	FindRequestLogsModelRanking(ctx context.Context, req *apiV1.RequestLogsRankingRequest) ([]*apiV1.RequestLogsModelRanking, error)
 	FindRequestLogsUserRanking(ctx context.Context, req *apiV1.RequestLogsRankingRequest) ([]*apiV1.RequestLogsUserRanking, error)
+	FindRequestLogById(ctx context.Context, id uint64) (*model.RequestLog, error)
+	CreateRequestLogBodies(ctx context.Context, bodies []*model.RequestLogBody) error
+	FindRequestLogBody(ctx context.Context, requestLogId uint64) (*model.RequestLogBody, error)
+	DeleteRequestLogBodiesBefore(ctx context.Context, before time.Time) (int64, error)
+	FindExpiredRequestLogs(ctx context.Context, before time.Time, limit int) ([]*model.RequestLog, error)
+	HardDeleteRequestLogs(ctx context.Context, ids []uint64) (int64, error)
 }
 
 func NewRequestLogRepository(repo *Repository) RequestLogRepository {
@@ -37,16 +47,14 @@ func (r *requestLogRepository) CreateRequestLog(ctx context.Context, log *model.
 	return r.DB(ctx).Create(log).Error
 }
 
+func (r *requestLogRepository) CreateRequestLogs(ctx context.Context, logs []*model.RequestLog) error {
+	return r.DB(ctx).CreateInBatches(logs, 100).Error
+}
+
 func (r *requestLogRepository) FindRequestLogs(ctx context.Context, req *apiV1.RequestLogsQuery) ([]*model.RequestLog, int64, error) {
 	var logs []*model.RequestLog
 	var err error
-	query := r.DB(ctx).Model(&model.RequestLog{})
-	if req.StartTime != "" && req.EndTime != "" {
-		query = query.Where("created_at BETWEEN ? AND ?", req.StartTime, req.EndTime)
-	}
-	if req.UserId != "" {
-		query = query.Where("user_id = ?", req.UserId)
-	}
+	query := requestLogFilter(r.DB(ctx).Model(&model.RequestLog{}), req)
 	var total int64
 	err = query.Count(&total).Error
 	if err != nil {
@@ -59,6 +67,32 @@ func (r *requestLogRepository) FindRequestLogs(ctx context.Context, req *apiV1.R
 	return logs, total, err
 }
 
+// requestLogFilter 列表和导出共用的过滤条件
+func requestLogFilter(query *gorm.DB, req *apiV1.RequestLogsQuery) *gorm.DB {
+	if req.StartTime != "" && req.EndTime != "" {
+		query = query.Where("created_at BETWEEN ? AND ?", req.StartTime, req.EndTime)
+	}
+	if req.UserId != "" {
+		query = query.Where("user_id = ?", req.UserId)
+	}
+	if req.Model != "" {
+		query = query.Where("model = ?", req.Model)
+	}
+	if req.ApiKeyId != "" {
+		query = query.Where("api_key_id = ?", req.ApiKeyId)
+	}
+	return query
+}
+
+// EachRequestLogs 按id顺序分批读取符合条件的日志，每批交给 fn 处理，不会一次把结果全部加载到内存，忽略分页参数
+func (r *requestLogRepository) EachRequestLogs(ctx context.Context, req *apiV1.RequestLogsQuery, batchSize int, fn func(logs []*model.RequestLog) error) error {
+	var logs []*model.RequestLog
+	return requestLogFilter(r.DB(ctx).Model(&model.RequestLog{}), req).
+		FindInBatches(&logs, batchSize, func(tx *gorm.DB, batch int) error {
+			return fn(logs)
+		}).Error
+}
+
 func (r *requestLogRepository) FindRequestLogsModelRanking(ctx context.Context, req *apiV1.RequestLogsRankingRequest) ([]*apiV1.RequestLogsModelRanking, error) {
 	var logs []*apiV1.RequestLogsModelRanking
 	q := r.DB(ctx).Model(&model.RequestLog{})
@@ -86,3 +120,53 @@ func (r *requestLogRepository) FindRequestLogsUserRanking(ctx context.Context, r
 	err := q.Find(&logs).Error
 	return logs, err
 }
+
+func (r *requestLogRepository) FindRequestLogById(ctx context.Context, id uint64) (*model.RequestLog, error) {
+	var log model.RequestLog
+	err := r.DB(ctx).Where("id = ?", id).First(&log).Error
+	if err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+func (r *requestLogRepository) CreateRequestLogBodies(ctx context.Context, bodies []*model.RequestLogBody) error {
+	return r.DB(ctx).CreateInBatches(bodies, 100).Error
+}
+
+func (r *requestLogRepository) FindRequestLogBody(ctx context.Context, requestLogId uint64) (*model.RequestLogBody, error) {
+	var body model.RequestLogBody
+	err := r.DB(ctx).Where("request_log_id = ?", requestLogId).First(&body).Error
+	if err != nil {
+		return nil, err
+	}
+	return &body, nil
+}
+
+// DeleteRequestLogBodiesBefore 物理删除采集时间早于 before 的内容
+func (r *requestLogRepository) DeleteRequestLogBodiesBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.DB(ctx).Where("created_at < ?", before).Delete(&model.RequestLogBody{})
+	return result.RowsAffected, result.Error
+}
+
+// FindExpiredRequestLogs 按id顺序取出一批早于 before 的日志，包含已软删除的
+func (r *requestLogRepository) FindExpiredRequestLogs(ctx context.Context, before time.Time, limit int) ([]*model.RequestLog, error) {
+	var logs []*model.RequestLog
+	err := r.DB(ctx).Unscoped().Where("created_at < ?", before).Order("id").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+// HardDeleteRequestLogs 按主键物理删除日志及其采集内容，每次只删一批，避免长时间锁表
+// 两次删除在同一个事务中，调用方已经开启事务时作为嵌套事务执行
+func (r *requestLogRepository) HardDeleteRequestLogs(ctx context.Context, ids []uint64) (int64, error) {
+	var deleted int64
+	err := r.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("request_log_id IN ?", ids).Delete(&model.RequestLogBody{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("id IN ?", ids).Delete(&model.RequestLog{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
+}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/jiu-u/oai-api/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+)
+
+// latencyColumns 耗时直方图的列，与 model.LatencyHistogram 对应
+var latencyColumns = []string{
+	"latency_sum",
+	"latency_le100", "latency_le250", "latency_le500", "latency_le1000",
+	"latency_le2500", "latency_le5000", "latency_le10000", "latency_le20000",
+	"latency_le30000", "latency_le60000", "latency_le120000", "latency_le300000",
+	"latency_inf",
+}
+
+// statCounterColumns 统计表中需要累加的列
+var statCounterColumns = append([]string{
+	"requests", "errors", "prompt_tokens", "completion_tokens", "cost",
+}, latencyColumns...)
+
+// statGroupColumns 统计查询可以分组的维度
+var statGroupColumns = map[string]string{
+	"model":   "model",
+	"channel": "channel_id",
+	"user":    "user_id",
+	"key":     "api_key_id",
+}
+
+// RequestLogStatQuery GroupBy 为空时不分组(day 仅用于 EachRequestLogStatGroup)，其余过滤条件为零值时不过滤
+type RequestLogStatQuery struct {
+	Period    string
+	StartTime time.Time
+	EndTime   time.Time
+	GroupBy   string
+	Model     string
+	ChannelId uint64
+	UserId    uint64
+	ApiKeyId  uint64
+}
+
+type RequestLogStatRepository interface {
+	IncrRequestLogStats(ctx context.Context, stats []*model.RequestLogStat) error
+	FindRequestLogStats(ctx context.Context, q *RequestLogStatQuery) ([]*model.RequestLogStat, error)
+	EachRequestLogStatGroup(ctx context.Context, q *RequestLogStatQuery, fn func(row *model.RequestLogStat) error) error
+	SumUserCost(ctx context.Context, userId uint64) (float64, error)
+	DeleteRequestLogStatsBefore(ctx context.Context, period string, before time.Time, limit int) (int64, error)
+}
+
+func NewRequestLogStatRepository(r *Repository) RequestLogStatRepository {
+	return &requestLogStatRepository{Repository: r}
+}
+
+type requestLogStatRepository struct {
+	*Repository
+}
+
+func latencyValues(h *model.LatencyHistogram) []any {
+	values := []any{h.LatencySum}
+	for _, bucket := range h.LatencyBuckets() {
+		values = append(values, *bucket)
+	}
+	return values
+}
+
+func statCounterValues(s *model.RequestLogStat) []any {
+	values := []any{s.Requests, s.Errors, s.PromptTokens, s.CompletionTokens, s.Cost}
+	return append(values, latencyValues(&s.LatencyHistogram)...)
+}
+
+// incrAssignments 冲突时在原值上累加，table 为表名，values 与 columns 一一对应
+func incrAssignments(table string, columns []string, values []any) clause.Set {
+	assignments := make(map[string]any, len(columns))
+	for i, column := range columns {
+		assignments[column] = gorm.Expr(fmt.Sprintf("%s.%s + ?", table, column), values[i])
+	}
+	return clause.Assignments(assignments)
+}
+
+// IncrRequestLogStats 按唯一索引 upsert，已存在的桶在原值上累加，mysql、postgres、sqlite 都支持
+func (r *requestLogStatRepository) IncrRequestLogStats(ctx context.Context, stats []*model.RequestLogStat) error {
+	for _, stat := range stats {
+		err := r.DB(ctx).Clauses(clause.OnConflict{
+			Columns: []clause.Column{
+				{Name: "period"}, {Name: "bucket_time"}, {Name: "model"},
+				{Name: "channel_id"}, {Name: "user_id"}, {Name: "api_key_id"},
+			},
+			DoUpdates: incrAssignments("request_log_stats", statCounterColumns, statCounterValues(stat)),
+		}).Create(stat).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindRequestLogStats 按时间桶和分组维度汇总，分组维度的值放在对应的字段中，其余维度为零值
+func (r *requestLogStatRepository) FindRequestLogStats(ctx context.Context, q *RequestLogStatQuery) ([]*model.RequestLogStat, error) {
+	selects := make([]string, 0, len(statCounterColumns)+2)
+	selects = append(selects, "bucket_time")
+	groups := []string{"bucket_time"}
+	if column, ok := statGroupColumns[q.GroupBy]; ok {
+		selects = append(selects, column)
+		groups = append(groups, column)
+	}
+	for _, column := range statCounterColumns {
+		selects = append(selects, fmt.Sprintf("SUM(%s) AS %s", column, column))
+	}
+	query := statFilter(r.DB(ctx).Model(&model.RequestLogStat{}).Select(strings.Join(selects, ", ")), q)
+	var rows []*model.RequestLogStat
+	err := query.Group(strings.Join(groups, ", ")).Order("bucket_time").Find(&rows).Error
+	return rows, err
+}
+
+func statFilter(query *gorm.DB, q *RequestLogStatQuery) *gorm.DB {
+	query = query.Where("period = ?", q.Period).
+		Where("bucket_time >= ? AND bucket_time < ?", q.StartTime, q.EndTime)
+	if q.Model != "" {
+		query = query.Where("model = ?", q.Model)
+	}
+	if q.ChannelId != 0 {
+		query = query.Where("channel_id = ?", q.ChannelId)
+	}
+	if q.UserId != 0 {
+		query = query.Where("user_id = ?", q.UserId)
+	}
+	if q.ApiKeyId != 0 {
+		query = query.Where("api_key_id = ?", q.ApiKeyId)
+	}
+	return query
+}
+
+// EachRequestLogStatGroup 汇总整个时间范围，每个分组一行，GroupBy 为 day 时按时间桶分组
+// 通过游标逐行读取交给 fn，分组很多时也不会一次全部加载到内存
+func (r *requestLogStatRepository) EachRequestLogStatGroup(ctx context.Context, q *RequestLogStatQuery, fn func(row *model.RequestLogStat) error) error {
+	column, ok := statGroupColumns[q.GroupBy]
+	if q.GroupBy == "day" {
+		column, ok = "bucket_time", true
+	}
+	if !ok {
+		return fmt.Errorf("unsupported groupBy: %s", q.GroupBy)
+	}
+	selects := make([]string, 0, len(statCounterColumns)+1)
+	selects = append(selects, column)
+	for _, c := range statCounterColumns {
+		selects = append(selects, fmt.Sprintf("SUM(%s) AS %s", c, c))
+	}
+	db := r.DB(ctx)
+	rows, err := statFilter(db.Model(&model.RequestLogStat{}).Select(strings.Join(selects, ", ")), q).
+		Group(column).Order(column).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		row := new(model.RequestLogStat)
+		if err = db.ScanRows(rows, row); err != nil {
+			return err
+		}
+		if err = fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// SumUserCost 用户全部历史费用，按天的统计不会被清理
+func (r *requestLogStatRepository) SumUserCost(ctx context.Context, userId uint64) (float64, error) {
+	var cost float64
+	err := r.DB(ctx).Model(&model.RequestLogStat{}).
+		Select("COALESCE(SUM(cost), 0)").
+		Where("period = ? AND user_id = ?", model.StatPeriodDay, userId).
+		Scan(&cost).Error
+	return cost, err
+}
+
+// DeleteRequestLogStatsBefore 删除某个粒度下 before 之前的时间桶，每次最多删除 limit 行，避免长时间锁表
+func (r *requestLogStatRepository) DeleteRequestLogStatsBefore(ctx context.Context, period string, before time.Time, limit int) (int64, error) {
+	var ids []uint64
+	err := r.DB(ctx).Model(&model.RequestLogStat{}).
+		Where("period = ? AND bucket_time < ?", period, before).
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	result := r.DB(ctx).Where("id IN ?", ids).Delete(&model.RequestLogStat{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"github.com/jiu-u/oai-api/internal/model"
+	"time"
+)
+
+type ResponseStateRepository interface {
+	CreateResponseState(ctx context.Context, state *model.ResponseState) error
+	// FindResponseState 已经过期的状态视为不存在
+	FindResponseState(ctx context.Context, id string) (*model.ResponseState, error)
+	DeleteExpiredResponseStates(ctx context.Context, before time.Time) (int64, error)
+}
+
+func NewResponseStateRepository(r *Repository) ResponseStateRepository {
+	return &responseStateRepository{Repository: r}
+}
+
+type responseStateRepository struct {
+	*Repository
+}
+
+func (r *responseStateRepository) CreateResponseState(ctx context.Context, state *model.ResponseState) error {
+	return r.DB(ctx).Create(state).Error
+}
+
+func (r *responseStateRepository) FindResponseState(ctx context.Context, id string) (*model.ResponseState, error) {
+	var state model.ResponseState
+	err := r.DB(ctx).Where("id = ? AND expires_at > ?", id, time.Now()).First(&state).Error
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (r *responseStateRepository) DeleteExpiredResponseStates(ctx context.Context, before time.Time) (int64, error) {
+	result := r.DB(ctx).Where("expires_at < ?", before).Delete(&model.ResponseState{})
+	return result.RowsAffected, result.Error
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"github.com/jiu-u/oai-api/internal/dto"
 	"github.com/jiu-u/oai-api/internal/model"
+	"github.com/jiu-u/oai-api/pkg/secret"
 )
 
 type SystemRepository interface {
@@ -21,14 +22,65 @@ type SystemRepository interface {
 	GetModelConfig(ctx context.Context) (*dto.ModelConfig, error)
 	SetRegisterConfig(ctx context.Context, cfg *dto.RegisterConfig) error
 	GetRegisterConfig(ctx context.Context) (*dto.RegisterConfig, error)
+	SetBodyCaptureConfig(ctx context.Context, cfg *dto.BodyCaptureConfig) error
+	GetBodyCaptureConfig(ctx context.Context) (*dto.BodyCaptureConfig, error)
+	SetRequestLogRetentionConfig(ctx context.Context, cfg *dto.RequestLogRetentionConfig) error
+	GetRequestLogRetentionConfig(ctx context.Context) (*dto.RequestLogRetentionConfig, error)
+	SetUsageReportConfig(ctx context.Context, cfg *dto.UsageReportConfig) error
+	GetUsageReportConfig(ctx context.Context) (*dto.UsageReportConfig, error)
+	SetResponsesConfig(ctx context.Context, cfg *dto.ResponsesConfig) error
+	GetResponsesConfig(ctx context.Context) (*dto.ResponsesConfig, error)
+	SetAlertConfig(ctx context.Context, cfg *dto.AlertConfig) error
+	GetAlertConfig(ctx context.Context) (*dto.AlertConfig, error)
 }
 
-func NewSystemRepository(r *Repository) SystemRepository {
-	return &systemRepository{r}
+func NewSystemRepository(r *Repository, cipher *secret.Cipher) SystemRepository {
+	return &systemRepository{
+		Repository: r,
+		cipher:     cipher,
+	}
 }
 
 type systemRepository struct {
 	*Repository
+	cipher *secret.Cipher
+}
+
+// marshalEmailConfig smtp密码加密后再存储
+func (r *systemRepository) marshalEmailConfig(cfg *dto.EmailConfig) ([]byte, error) {
+	stored := *cfg
+	password, err := r.cipher.Encrypt(cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+	stored.Password = password
+	return json.Marshal(stored)
+}
+
+// marshalOAuthConfig oauth client secret 加密后再存储
+func (r *systemRepository) marshalOAuthConfig(cfg *dto.LinuxDoOAuthConfig) ([]byte, error) {
+	stored := *cfg
+	clientSecret, err := r.cipher.Encrypt(cfg.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	stored.ClientSecret = clientSecret
+	return json.Marshal(stored)
+}
+
+// marshalAlertConfig 告警通道的签名密钥加密后再存储
+func (r *systemRepository) marshalAlertConfig(cfg *dto.AlertConfig) ([]byte, error) {
+	stored := *cfg
+	stored.Sinks = make([]dto.AlertSink, len(cfg.Sinks))
+	for i, sink := range cfg.Sinks {
+		secret, err := r.cipher.Encrypt(sink.Secret)
+		if err != nil {
+			return nil, err
+		}
+		sink.Secret = secret
+		stored.Sinks[i] = sink
+	}
+	return json.Marshal(stored)
 }
 
 func (r *systemRepository) SetEmailConfig(ctx context.Context, cfg *dto.EmailConfig) error {
@@ -41,7 +93,7 @@ func (r *systemRepository) SetEmailConfig(ctx context.Context, cfg *dto.EmailCon
 		return err
 	}
 
-	jsonStr, err := json.Marshal(cfg)
+	jsonStr, err := r.marshalEmailConfig(cfg)
 	if err != nil {
 		return err
 	}
@@ -59,7 +111,7 @@ func (r *systemRepository) SetEmailConfig(ctx context.Context, cfg *dto.EmailCon
 
 func (r *systemRepository) UpdateEmailConfig(ctx context.Context, cfg *dto.EmailConfig) error {
 	var err error
-	jsonStr, err := json.Marshal(cfg)
+	jsonStr, err := r.marshalEmailConfig(cfg)
 	if err != nil {
 		return err
 	}
@@ -85,6 +137,10 @@ func (r *systemRepository) GetEmailConfig(ctx context.Context) (*dto.EmailConfig
 	}
 	var emailCfg dto.EmailConfig
 	err = json.Unmarshal([]byte(systemConfig.Value), &emailCfg)
+	if err != nil {
+		return nil, err
+	}
+	emailCfg.Password, err = r.cipher.Decrypt(emailCfg.Password)
 	return &emailCfg, err
 }
 
@@ -101,7 +157,7 @@ func (r *systemRepository) SetLinuxDoOAuthConfig(ctx context.Context, cfg *dto.L
 		err = r.UpdateLinuxDoOAuthConfig(ctx, cfg)
 		return err
 	}
-	jsonStr, err := json.Marshal(cfg)
+	jsonStr, err := r.marshalOAuthConfig(cfg)
 	if err != nil {
 		return err
 	}
@@ -118,7 +174,7 @@ func (r *systemRepository) SetLinuxDoOAuthConfig(ctx context.Context, cfg *dto.L
 
 func (r *systemRepository) UpdateLinuxDoOAuthConfig(ctx context.Context, cfg *dto.LinuxDoOAuthConfig) error {
 	var err error
-	jsonStr, err := json.Marshal(cfg)
+	jsonStr, err := r.marshalOAuthConfig(cfg)
 	if err != nil {
 		return err
 	}
@@ -142,6 +198,10 @@ func (r *systemRepository) GetLinuxDoOAuthConfig(ctx context.Context) (*dto.Linu
 	}
 	var linuxDoCfg dto.LinuxDoOAuthConfig
 	err = json.Unmarshal([]byte(systemConfig.Value), &linuxDoCfg)
+	if err != nil {
+		return nil, err
+	}
+	linuxDoCfg.ClientSecret, err = r.cipher.Decrypt(linuxDoCfg.ClientSecret)
 	return &linuxDoCfg, err
 }
 
@@ -158,7 +218,7 @@ func (r *systemRepository) SetGithubOAuthConfig(ctx context.Context, cfg *dto.Gi
 		err = r.UpdateGithubOAuthConfig(ctx, cfg)
 		return err
 	}
-	jsonStr, err := json.Marshal(cfg)
+	jsonStr, err := r.marshalOAuthConfig(cfg)
 	if err != nil {
 		return err
 	}
@@ -175,7 +235,7 @@ func (r *systemRepository) SetGithubOAuthConfig(ctx context.Context, cfg *dto.Gi
 
 func (r *systemRepository) UpdateGithubOAuthConfig(ctx context.Context, cfg *dto.GithubOAuthConfig) error {
 	var err error
-	jsonStr, err := json.Marshal(cfg)
+	jsonStr, err := r.marshalOAuthConfig(cfg)
 	if err != nil {
 		return err
 	}
@@ -199,6 +259,10 @@ func (r *systemRepository) GetGithubOAuthConfig(ctx context.Context) (*dto.Githu
 	}
 	var linuxDoCfg dto.GithubOAuthConfig
 	err = json.Unmarshal([]byte(systemConfig.Value), &linuxDoCfg)
+	if err != nil {
+		return nil, err
+	}
+	linuxDoCfg.ClientSecret, err = r.cipher.Decrypt(linuxDoCfg.ClientSecret)
 	return &linuxDoCfg, err
 }
 
@@ -310,3 +374,272 @@ func (r *systemRepository) GetRegisterConfig(ctx context.Context) (*dto.Register
 	err = json.Unmarshal([]byte(systemConfig.Value), &registerCfg)
 	return &registerCfg, err
 }
+
+func (r *systemRepository) SetBodyCaptureConfig(ctx context.Context, cfg *dto.BodyCaptureConfig) error {
+	var err error
+	cfg2, err := r.GetBodyCaptureConfig(ctx)
+	if err == nil {
+		cfg.Id = cfg2.Id
+		err = r.UpdateBodyCaptureConfig(ctx, cfg)
+		return err
+	}
+	jsonStr, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	kv := &model.SystemConfig{
+		KeyName:     "body_capture_config",
+		Value:       string(jsonStr),
+		ConfigType:  "capture",
+		Description: "请求体/响应体采集",
+	}
+	kv.Id = cfg.Id
+	err = r.DB(ctx).Model(&model.SystemConfig{}).Create(kv).Error
+	return err
+}
+
+func (r *systemRepository) UpdateBodyCaptureConfig(ctx context.Context, cfg *dto.BodyCaptureConfig) error {
+	var err error
+	jsonStr, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	kv := &model.SystemConfig{
+		KeyName:     "body_capture_config",
+		Value:       string(jsonStr),
+		ConfigType:  "capture",
+		Description: "请求体/响应体采集",
+	}
+	kv.Id = cfg.Id
+	err = r.DB(ctx).Model(&kv).Updates(&kv).Error
+	return err
+}
+
+func (r *systemRepository) GetBodyCaptureConfig(ctx context.Context) (*dto.BodyCaptureConfig, error) {
+	var err error
+	var systemConfig model.SystemConfig
+	err = r.DB(ctx).Model(&systemConfig).Where("config_type = ? and key_name=?", "capture", "body_capture_config").First(&systemConfig).Error
+	if err != nil {
+		return nil, err
+	}
+	var captureCfg dto.BodyCaptureConfig
+	err = json.Unmarshal([]byte(systemConfig.Value), &captureCfg)
+	return &captureCfg, err
+}
+
+func (r *systemRepository) SetRequestLogRetentionConfig(ctx context.Context, cfg *dto.RequestLogRetentionConfig) error {
+	var err error
+	cfg2, err := r.GetRequestLogRetentionConfig(ctx)
+	if err == nil {
+		cfg.Id = cfg2.Id
+		err = r.UpdateRequestLogRetentionConfig(ctx, cfg)
+		return err
+	}
+	jsonStr, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	kv := &model.SystemConfig{
+		KeyName:     "request_log_retention",
+		Value:       string(jsonStr),
+		ConfigType:  "retention",
+		Description: "请求日志保留策略",
+	}
+	kv.Id = cfg.Id
+	err = r.DB(ctx).Model(&model.SystemConfig{}).Create(kv).Error
+	return err
+}
+
+func (r *systemRepository) UpdateRequestLogRetentionConfig(ctx context.Context, cfg *dto.RequestLogRetentionConfig) error {
+	var err error
+	jsonStr, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	kv := &model.SystemConfig{
+		KeyName:     "request_log_retention",
+		Value:       string(jsonStr),
+		ConfigType:  "retention",
+		Description: "请求日志保留策略",
+	}
+	kv.Id = cfg.Id
+	err = r.DB(ctx).Model(&kv).Updates(&kv).Error
+	return err
+}
+
+func (r *systemRepository) GetRequestLogRetentionConfig(ctx context.Context) (*dto.RequestLogRetentionConfig, error) {
+	var err error
+	var systemConfig model.SystemConfig
+	err = r.DB(ctx).Model(&systemConfig).Where("config_type = ? and key_name=?", "retention", "request_log_retention").First(&systemConfig).Error
+	if err != nil {
+		return nil, err
+	}
+	var retentionCfg dto.RequestLogRetentionConfig
+	err = json.Unmarshal([]byte(systemConfig.Value), &retentionCfg)
+	return &retentionCfg, err
+}
+
+func (r *systemRepository) SetUsageReportConfig(ctx context.Context, cfg *dto.UsageReportConfig) error {
+	var err error
+	cfg2, err := r.GetUsageReportConfig(ctx)
+	if err == nil {
+		cfg.Id = cfg2.Id
+		err = r.UpdateUsageReportConfig(ctx, cfg)
+		return err
+	}
+	jsonStr, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	kv := &model.SystemConfig{
+		KeyName:     "usage_report",
+		Value:       string(jsonStr),
+		ConfigType:  "report",
+		Description: "每月用量报表",
+	}
+	kv.Id = cfg.Id
+	err = r.DB(ctx).Model(&model.SystemConfig{}).Create(kv).Error
+	return err
+}
+
+func (r *systemRepository) UpdateUsageReportConfig(ctx context.Context, cfg *dto.UsageReportConfig) error {
+	var err error
+	jsonStr, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	kv := &model.SystemConfig{
+		KeyName:     "usage_report",
+		Value:       string(jsonStr),
+		ConfigType:  "report",
+		Description: "每月用量报表",
+	}
+	kv.Id = cfg.Id
+	err = r.DB(ctx).Model(&kv).Updates(&kv).Error
+	return err
+}
+
+func (r *systemRepository) GetUsageReportConfig(ctx context.Context) (*dto.UsageReportConfig, error) {
+	var err error
+	var systemConfig model.SystemConfig
+	err = r.DB(ctx).Model(&systemConfig).Where("config_type = ? and key_name=?", "report", "usage_report").First(&systemConfig).Error
+	if err != nil {
+		return nil, err
+	}
+	var reportCfg dto.UsageReportConfig
+	err = json.Unmarshal([]byte(systemConfig.Value), &reportCfg)
+	return &reportCfg, err
+}
+
+func (r *systemRepository) SetResponsesConfig(ctx context.Context, cfg *dto.ResponsesConfig) error {
+	var err error
+	cfg2, err := r.GetResponsesConfig(ctx)
+	if err == nil {
+		cfg.Id = cfg2.Id
+		err = r.UpdateResponsesConfig(ctx, cfg)
+		return err
+	}
+	jsonStr, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	kv := &model.SystemConfig{
+		KeyName:     "responses",
+		Value:       string(jsonStr),
+		ConfigType:  "responses",
+		Description: "Responses API 对话状态",
+	}
+	kv.Id = cfg.Id
+	err = r.DB(ctx).Model(&model.SystemConfig{}).Create(kv).Error
+	return err
+}
+
+func (r *systemRepository) UpdateResponsesConfig(ctx context.Context, cfg *dto.ResponsesConfig) error {
+	var err error
+	jsonStr, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	kv := &model.SystemConfig{
+		KeyName:     "responses",
+		Value:       string(jsonStr),
+		ConfigType:  "responses",
+		Description: "Responses API 对话状态",
+	}
+	kv.Id = cfg.Id
+	err = r.DB(ctx).Model(&kv).Updates(&kv).Error
+	return err
+}
+
+func (r *systemRepository) GetResponsesConfig(ctx context.Context) (*dto.ResponsesConfig, error) {
+	var err error
+	var systemConfig model.SystemConfig
+	err = r.DB(ctx).Model(&systemConfig).Where("config_type = ? and key_name=?", "responses", "responses").First(&systemConfig).Error
+	if err != nil {
+		return nil, err
+	}
+	var responsesCfg dto.ResponsesConfig
+	err = json.Unmarshal([]byte(systemConfig.Value), &responsesCfg)
+	return &responsesCfg, err
+}
+
+func (r *systemRepository) SetAlertConfig(ctx context.Context, cfg *dto.AlertConfig) error {
+	var err error
+	cfg2, err := r.GetAlertConfig(ctx)
+	if err == nil {
+		cfg.Id = cfg2.Id
+		err = r.UpdateAlertConfig(ctx, cfg)
+		return err
+	}
+	jsonStr, err := r.marshalAlertConfig(cfg)
+	if err != nil {
+		return err
+	}
+	kv := &model.SystemConfig{
+		KeyName:     "alert_config",
+		Value:       string(jsonStr),
+		ConfigType:  "alert",
+		Description: "告警通道和规则",
+	}
+	kv.Id = cfg.Id
+	err = r.DB(ctx).Model(&model.SystemConfig{}).Create(kv).Error
+	return err
+}
+
+func (r *systemRepository) UpdateAlertConfig(ctx context.Context, cfg *dto.AlertConfig) error {
+	var err error
+	jsonStr, err := r.marshalAlertConfig(cfg)
+	if err != nil {
+		return err
+	}
+	kv := &model.SystemConfig{
+		KeyName:     "alert_config",
+		Value:       string(jsonStr),
+		ConfigType:  "alert",
+		Description: "告警通道和规则",
+	}
+	kv.Id = cfg.Id
+	err = r.DB(ctx).Model(&kv).Updates(&kv).Error
+	return err
+}
+
+func (r *systemRepository) GetAlertConfig(ctx context.Context) (*dto.AlertConfig, error) {
+	var err error
+	var systemConfig model.SystemConfig
+	err = r.DB(ctx).Model(&systemConfig).Where("config_type = ? and key_name=?", "alert", "alert_config").First(&systemConfig).Error
+	if err != nil {
+		return nil, err
+	}
+	var alertCfg dto.AlertConfig
+	err = json.Unmarshal([]byte(systemConfig.Value), &alertCfg)
+	if err != nil {
+		return nil, err
+	}
+	for i := range alertCfg.Sinks {
+		alertCfg.Sinks[i].Secret, err = r.cipher.Decrypt(alertCfg.Sinks[i].Secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &alertCfg, nil
+}
@@ -16,6 +16,9 @@ type UserRepository interface {
 	FindUserById(ctx context.Context, id uint64) (*model.User, error)
 	FindOneForUpdate(ctx context.Context, id uint64) (*model.User, error)
 	UpdateOne(ctx context.Context, user *model.User) error
+	FindUsersByRole(ctx context.Context, role string) ([]*model.User, error)
+	UpdateUserGroup(ctx context.Context, id uint64, group string, level int) error
+	UpdateUserCreditLimit(ctx context.Context, id uint64, creditLimit float64) error
 	//FindAll(ctx context.Context) ([]*model.User, error)
 }
 
@@ -46,6 +49,12 @@ func (r *userRepo) FindUserByUsername(ctx context.Context, username string) (*mo
 	return &user, err
 }
 
+func (r *userRepo) FindUsersByRole(ctx context.Context, role string) ([]*model.User, error) {
+	var users []*model.User
+	err := r.DB(ctx).Where("role = ? and status = 1", role).Find(&users).Error
+	return users, err
+}
+
 func (r *userRepo) FindOneForUpdate(ctx context.Context, id uint64) (*model.User, error) {
 	var user model.User
 	err := r.DB(ctx).Set("gorm:query_option", "FOR UPDATE").First(&user, id).Error
@@ -76,3 +85,15 @@ func (r *userRepo) UpdateOne(ctx context.Context, user *model.User) error {
 	}
 	return r.DB(ctx).Updates(user).Error
 }
+
+// UpdateUserGroup group 允许为空，为空时按等级映射分组
+func (r *userRepo) UpdateUserGroup(ctx context.Context, id uint64, group string, level int) error {
+	return r.DB(ctx).Model(&model.User{}).Where("id = ?", id).UpdateColumns(map[string]any{
+		"group_names": group,
+		"level":       level,
+	}).Error
+}
+
+func (r *userRepo) UpdateUserCreditLimit(ctx context.Context, id uint64, creditLimit float64) error {
+	return r.DB(ctx).Model(&model.User{}).Where("id = ?", id).UpdateColumn("credit_limit", creditLimit).Error
+}
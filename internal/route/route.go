@@ -19,12 +19,14 @@ func SetupRoute(
 	channelHandler *handler.ChannelHandler,
 	requestLogHandler *handler.RequestLogHandler,
 	userHandler *handler.UserHandler,
+	auditLogHandler *handler.AuditLogHandler,
 	apiKeySvc service.ApiKeyService,
 	logger *log.Logger,
 	jwtJWT *jwt.JWT,
 ) {
 	v1Group := s.Group("/v1")
 	v1BetaGroup := s.Group("/v1beta")
+	ollamaGroup := s.Group("/api")
 	// 用户登录、注册、登出
 	routes.SetupAuthRoutes(v1Group, authHandler, sysConfigHandler, userHandler, jwtJWT, logger)
 	// 验证码发送
@@ -33,10 +35,18 @@ func SetupRoute(
 	routes.SetupSystemConfigRoutes(v1Group, sysConfigHandler, jwtJWT, logger)
 	// oai
 	routes.SetupOaiRoutes(v1Group, v1BetaGroup, apiKeyHandler, oaiHandler, apiKeySvc, logger)
+	// ollama
+	routes.SetupOllamaRoutes(ollamaGroup, oaiHandler, apiKeySvc, logger)
 	// channel
 	routes.SetupChannelRoutes(v1Group, channelHandler, jwtJWT, logger)
 	// request log
 	routes.SetupOaiReqLogRoutes(v1Group, requestLogHandler, jwtJWT, logger)
+	// 普通用户的用量
+	routes.SetupUsageRoutes(v1Group, requestLogHandler, jwtJWT, logger)
 	// api key
 	routes.SetupApiKeyRoutes(v1Group, apiKeyHandler, jwtJWT, logger)
+	// user
+	routes.SetupUserRoutes(v1Group, userHandler, jwtJWT, logger)
+	// 审计日志
+	routes.SetupAuditLogRoutes(v1Group, auditLogHandler, jwtJWT, logger)
 }
@@ -21,6 +21,7 @@ func SetupApiKeyRoutes(
 		keyGroup.GET("", apiKeyHandler.GetApiKey)
 		keyGroup.POST("/create", apiKeyHandler.ResetApiKey)
 		keyGroup.POST("/reset", apiKeyHandler.ResetApiKey)
+		keyGroup.PUT("/group", apiKeyHandler.UpdateApiKeyGroup)
 	}
 
 }
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jiu-u/oai-api/internal/handler"
+	"github.com/jiu-u/oai-api/internal/middleware"
+	"github.com/jiu-u/oai-api/pkg/jwt"
+	"github.com/jiu-u/oai-api/pkg/log"
+)
+
+// SetupAuditLogRoutes 管理操作的审计日志只读，仅管理员可用
+func SetupAuditLogRoutes(
+	v1 *gin.RouterGroup,
+	auditLogHandler *handler.AuditLogHandler,
+	jwtJWT *jwt.JWT,
+	logger *log.Logger,
+) {
+	auditGroup := v1.Group("/audit-logs")
+	auditGroup.Use(middleware.JwtMiddleware(jwtJWT, logger), middleware.AdminMiddleware(logger))
+	{
+		auditGroup.GET("", auditLogHandler.GetAuditLogs)
+	}
+}
@@ -19,14 +19,25 @@ func SetupChannelRoutes(
 	channelGroup.Use(middleware.JwtMiddleware(jwtJWT, logger))
 	{
 		channelGroup.GET("", channelHandler.GetChannels)
+		// 渠道和渠道模型的请求统计，来自请求日志和模型检查结果
+		channelGroup.GET("/stats", middleware.AdminMiddleware(logger), channelHandler.GetChannelStats)
 		channelGroup.GET("/:channelId", channelHandler.GetChannel)
-		channelGroup.POST("", channelHandler.CreateChannel)
-		channelGroup.PUT("/:channelId", channelHandler.UpdateChannel)
-		channelGroup.PUT("/:channelId/status", channelHandler.UpdateChannelStatus)
-		channelGroup.DELETE("/:channelId", channelHandler.DeleteChannel)
-		channelGroup.POST("/:channelId/models/check", channelHandler.CheckModel)
-		channelGroup.POST("/models/fetch", ImplementHandle)
-		
+		channelGroup.GET("/:channelId/stats", middleware.AdminMiddleware(logger), channelHandler.GetChannelModelStats)
+		// 修改渠道、key池和模型状态的接口只允许管理员调用
+		channelGroup.POST("", middleware.AdminMiddleware(logger), channelHandler.CreateChannel)
+		channelGroup.PUT("/:channelId", middleware.AdminMiddleware(logger), channelHandler.UpdateChannel)
+		channelGroup.PUT("/:channelId/status", middleware.AdminMiddleware(logger), channelHandler.UpdateChannelStatus)
+		channelGroup.DELETE("/:channelId", middleware.AdminMiddleware(logger), channelHandler.DeleteChannel)
+		channelGroup.POST("/:channelId/models/check", middleware.AdminMiddleware(logger), channelHandler.CheckModel)
+		channelGroup.GET("/:channelId/models/check/history", middleware.AdminMiddleware(logger), channelHandler.GetCheckHistory)
+		channelGroup.POST("/:channelId/models/check/batch", middleware.AdminMiddleware(logger), channelHandler.BatchCheckModels)
+		channelGroup.POST("/models/fetch", middleware.AdminMiddleware(logger), ImplementHandle)
+		channelGroup.POST("/:channelId/balance", middleware.AdminMiddleware(logger), channelHandler.RefreshBalance)
+		channelGroup.GET("/:channelId/key", middleware.AdminMiddleware(logger), channelHandler.RevealChannelKey)
+		channelGroup.POST("/:channelId/keys", middleware.AdminMiddleware(logger), channelHandler.AddChannelKeys)
+		channelGroup.DELETE("/:channelId/keys/:keyId", middleware.AdminMiddleware(logger), channelHandler.DeleteChannelKey)
+		channelGroup.PUT("/:channelId/keys/:keyId/status", middleware.AdminMiddleware(logger), channelHandler.UpdateChannelKeyStatus)
+
 		// 获取models
 		//channelGroup.POST("/:channelId/models", ImplementHandle)
 		// 设置models
@@ -21,6 +21,8 @@ func SetupOaiRoutes(
 	keyAuthMiddleware := middleware.ApiKeyMiddleware(apiKeySvc, logger)
 	r.Use(keyAuthMiddleware)
 	r2.Use(keyAuthMiddleware)
+	// Gemini 客户端可能把 api key 放在 ?key= 中，只有这个接口接受
+	v1beta.POST("/models/:action", middleware.QueryApiKeyMiddleware(apiKeySvc, logger), oaiHandler.GeminiModelAction)
 	// 注册中间件
 	{
 		r.POST("/chat/completions", oaiHandler.ChatCompletions)
@@ -33,6 +35,8 @@ func SetupOaiRoutes(
 		r.POST("/images/generations", oaiHandler.ImageGeneration)
 		r.POST("/images/edits", oaiHandler.ImageEdit)
 		r.POST("/images/variations", oaiHandler.ImageVariation)
+		r.POST("/messages", oaiHandler.Messages)
+		r.POST("/responses", oaiHandler.Responses)
 		r2.POST("/chat/completions", oaiHandler.ChatCompletionsByBytes)
 		r2.POST("/completions", oaiHandler.CompletionsByBytes)
 		r2.GET("/models", oaiHandler.Models)
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jiu-u/oai-api/internal/handler"
+	"github.com/jiu-u/oai-api/internal/middleware"
+	"github.com/jiu-u/oai-api/internal/service"
+	"github.com/jiu-u/oai-api/pkg/log"
+)
+
+// SetupOllamaRoutes Ollama 兼容接口，挂在 /api 下，按 Ollama 的路径注册
+func SetupOllamaRoutes(
+	api *gin.RouterGroup,
+	oaiHandler *handler.OAIHandler,
+	apiKeySvc service.ApiKeyService,
+	logger *log.Logger,
+) {
+	r := api.Group("/")
+	r.Use(middleware.ApiKeyMiddleware(apiKeySvc, logger))
+	{
+		r.POST("/chat", oaiHandler.OllamaChat)
+		r.POST("/generate", oaiHandler.OllamaGenerate)
+		r.POST("/embeddings", oaiHandler.OllamaEmbeddings)
+		r.GET("/tags", oaiHandler.OllamaTags)
+	}
+}
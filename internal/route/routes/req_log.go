@@ -14,8 +14,9 @@ func SetupOaiReqLogRoutes(
 	jwtJWT *jwt.JWT,
 	logger *log.Logger,
 ) {
+	// 可以查询任意用户的日志，仅管理员可用，普通用户使用 /usage
 	logsGroup := v1.Group("/oai-logs")
-	logsGroup.Use(middleware.JwtMiddleware(jwtJWT, logger))
+	logsGroup.Use(middleware.JwtMiddleware(jwtJWT, logger), middleware.AdminMiddleware(logger))
 	{
 		logsGroup.GET("", requestLogHandler.GetRequestLogs)
 		// 查询某个用户调用请求日志
@@ -24,6 +25,17 @@ func SetupOaiReqLogRoutes(
 		logsGroup.GET("/users-ranking", requestLogHandler.GetRequestLogsUserRanking)
 		// 模型调用次数排行
 		logsGroup.GET("/models-ranking", requestLogHandler.GetRequestLogsModelRanking)
+		// 按时间桶统计的用量，用于仪表盘
+		logsGroup.GET("/stats", requestLogHandler.GetUsageStats)
+		// 导出日志明细和按分组汇总的用量，csv 或 jsonl
+		logsGroup.GET("/export", requestLogHandler.ExportRequestLogs)
+		logsGroup.GET("/usage/export", requestLogHandler.ExportUsage)
+		// 手动发送某个月的用量报表
+		logsGroup.POST("/report", requestLogHandler.SendUsageReport)
+		// 日志详情，包含采集到的请求体和响应体
+		logsGroup.GET("/:id", requestLogHandler.GetRequestLogDetail)
+		// 手动清理过期日志
+		logsGroup.POST("/purge", requestLogHandler.PurgeRequestLogs)
 	}
 
 }
@@ -27,13 +27,30 @@ func SetupSystemConfigRoutes(
 	}
 	{
 		// need auth
-		needAuthGroup.POST("/register", sysConfigHandler.SetRegisterConfig)
-		needAuthGroup.POST("/email", sysConfigHandler.SetEmailConfig)
-		needAuthGroup.GET("/email", sysConfigHandler.GetEmailConfig)
-		needAuthGroup.POST("/linux-do", sysConfigHandler.SetLinuxDoOAuthConfig)
-		needAuthGroup.GET("/linux-do", sysConfigHandler.GetLinuxDoOAuthConfig)
-		needAuthGroup.POST("/github", sysConfigHandler.SetGithubOAuthConfig)
-		needAuthGroup.GET("/github", sysConfigHandler.GetGithubOAuthConfig)
-		needAuthGroup.POST("/model", sysConfigHandler.SetModelConfig)
+		// 注册、邮件和oauth配置包含smtp密码和client secret，只允许管理员读写
+		needAuthGroup.POST("/register", middleware.AdminMiddleware(logger), sysConfigHandler.SetRegisterConfig)
+		needAuthGroup.POST("/email", middleware.AdminMiddleware(logger), sysConfigHandler.SetEmailConfig)
+		needAuthGroup.GET("/email", middleware.AdminMiddleware(logger), sysConfigHandler.GetEmailConfig)
+		needAuthGroup.POST("/linux-do", middleware.AdminMiddleware(logger), sysConfigHandler.SetLinuxDoOAuthConfig)
+		needAuthGroup.GET("/linux-do", middleware.AdminMiddleware(logger), sysConfigHandler.GetLinuxDoOAuthConfig)
+		needAuthGroup.POST("/github", middleware.AdminMiddleware(logger), sysConfigHandler.SetGithubOAuthConfig)
+		needAuthGroup.GET("/github", middleware.AdminMiddleware(logger), sysConfigHandler.GetGithubOAuthConfig)
+		// 模型配置决定各等级可用的渠道分组和模型，只允许管理员修改
+		needAuthGroup.POST("/model", middleware.AdminMiddleware(logger), sysConfigHandler.SetModelConfig)
+		// 请求体/响应体采集配置，采集内容可能包含用户数据，只允许管理员修改
+		needAuthGroup.POST("/capture", middleware.AdminMiddleware(logger), sysConfigHandler.SetBodyCaptureConfig)
+		needAuthGroup.GET("/capture", middleware.AdminMiddleware(logger), sysConfigHandler.GetBodyCaptureConfig)
+		// 请求日志保留策略
+		needAuthGroup.POST("/retention", middleware.AdminMiddleware(logger), sysConfigHandler.SetRequestLogRetentionConfig)
+		needAuthGroup.GET("/retention", middleware.AdminMiddleware(logger), sysConfigHandler.GetRequestLogRetentionConfig)
+		// 每月用量报表的收件人
+		needAuthGroup.POST("/report", middleware.AdminMiddleware(logger), sysConfigHandler.SetUsageReportConfig)
+		needAuthGroup.GET("/report", middleware.AdminMiddleware(logger), sysConfigHandler.GetUsageReportConfig)
+		// 告警通道和规则
+		needAuthGroup.POST("/alert", middleware.AdminMiddleware(logger), sysConfigHandler.SetAlertConfig)
+		needAuthGroup.GET("/alert", middleware.AdminMiddleware(logger), sysConfigHandler.GetAlertConfig)
+		needAuthGroup.POST("/alert/test", middleware.AdminMiddleware(logger), sysConfigHandler.TestAlert)
+		needAuthGroup.POST("/responses", middleware.AdminMiddleware(logger), sysConfigHandler.SetResponsesConfig)
+		needAuthGroup.GET("/responses", middleware.AdminMiddleware(logger), sysConfigHandler.GetResponsesConfig)
 	}
 }
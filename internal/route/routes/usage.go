@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jiu-u/oai-api/internal/handler"
+	"github.com/jiu-u/oai-api/internal/middleware"
+	"github.com/jiu-u/oai-api/pkg/jwt"
+	"github.com/jiu-u/oai-api/pkg/log"
+)
+
+// SetupUsageRoutes 普通用户查看自己的用量，按登录用户过滤，不接受 userId 参数
+func SetupUsageRoutes(
+	v1 *gin.RouterGroup,
+	requestLogHandler *handler.RequestLogHandler,
+	jwtJWT *jwt.JWT,
+	logger *log.Logger,
+) {
+	usageGroup := v1.Group("/usage")
+	usageGroup.Use(middleware.JwtMiddleware(jwtJWT, logger))
+	{
+		// 自己的请求日志
+		usageGroup.GET("/logs", requestLogHandler.GetMyRequestLogs)
+		// 按天的用量
+		usageGroup.GET("/daily", requestLogHandler.GetMyDailyUsage)
+		// 按模型、按key汇总的用量和剩余额度
+		usageGroup.GET("/summary", requestLogHandler.GetMyUsageSummary)
+	}
+}
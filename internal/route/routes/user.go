@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jiu-u/oai-api/internal/handler"
+	"github.com/jiu-u/oai-api/internal/middleware"
+	"github.com/jiu-u/oai-api/pkg/jwt"
+	"github.com/jiu-u/oai-api/pkg/log"
+)
+
+func SetupUserRoutes(
+	v1 *gin.RouterGroup,
+	userHandler *handler.UserHandler,
+	jwtJWT *jwt.JWT,
+	logger *log.Logger,
+) {
+	// 用户管理仅管理员可用
+	userGroup := v1.Group("/users")
+	userGroup.Use(middleware.JwtMiddleware(jwtJWT, logger), middleware.AdminMiddleware(logger))
+	{
+		userGroup.PUT("/:userId/group", userHandler.UpdateUserGroup)
+		userGroup.PUT("/:userId/credit", userHandler.UpdateUserCredit)
+		userGroup.POST("/:userId/ban", userHandler.BanUser)
+	}
+}
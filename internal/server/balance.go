@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"github.com/jiu-u/oai-api/internal/service"
+	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/lithammer/shortuuid/v4"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// BalanceServer 定时刷新所有渠道的余额
+type BalanceServer struct {
+	balanceSvc service.BalanceService
+	logger     *log.Logger
+	Interval   time.Duration
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+func NewBalanceServer(balanceSvc service.BalanceService, logger *log.Logger) *BalanceServer {
+	return &BalanceServer{
+		balanceSvc: balanceSvc,
+		logger:     logger,
+		Interval:   60 * time.Minute,
+		stop:       make(chan struct{}),
+	}
+}
+
+func (b *BalanceServer) Start(ctx context.Context) error {
+	go func() {
+		ticker := time.NewTicker(b.Interval)
+		defer ticker.Stop()
+		for {
+			uid := shortuuid.New()
+			ctx := b.logger.WithValue(context.Background(), zap.String("traceId", uid), zap.String("type", "balance_cron"))
+			err := b.balanceSvc.RefreshAllBalances(ctx)
+			if err != nil {
+				b.logger.WithContext(ctx).Error("定时任务|余额|刷新失败", zap.Error(err))
+			}
+			select {
+			case <-ticker.C:
+			case <-b.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop 可以重复调用
+func (b *BalanceServer) Stop(ctx context.Context) error {
+	b.stopOnce.Do(func() {
+		close(b.stop)
+	})
+	return nil
+}
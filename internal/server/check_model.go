@@ -2,168 +2,161 @@ package server
 
 import (
 	"context"
-	adapterApi "github.com/jiu-u/oai-adapter/api"
 	"github.com/jiu-u/oai-api/internal/dto"
+	"github.com/jiu-u/oai-api/internal/model"
 	"github.com/jiu-u/oai-api/internal/repository"
 	"github.com/jiu-u/oai-api/internal/service"
 	"github.com/jiu-u/oai-api/pkg/log"
 	"github.com/lithammer/shortuuid/v4"
 	"go.uber.org/zap"
-	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	defaultCheckInterval    = 60 * time.Minute
+	defaultCheckConcurrency = 1
+	// maxCheckConcurrency 定时检查的最大并发数，避免配置过大时瞬间打满上游
+	maxCheckConcurrency = 16
+	// checkConfigRetryInterval 未配置检查列表时，隔一段时间重新读取配置
+	checkConfigRetryInterval = 30 * time.Second
+)
+
+// CheckModelServer 定时检查 ModelConfig.CheckList 中的模型，间隔、并发数、超时时间和提示词均可配置
 type CheckModelServer struct {
-	channelRepo      repository.ChannelRepository
 	channelModelRepo repository.ChannelModelRepository
 	lbSvc            service.LoadBalanceServiceBeta
+	checkSvc         service.ModelCheckService
 	logger           *log.Logger
 	systemConfigSvc  service.SystemConfigService
+	// ctx 在构造时创建，Start 和 Stop 可能在不同的goroutine中调用，不能在 Start 中赋值
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started atomic.Bool
+	done    chan struct{}
 }
 
 func NewCheckModelServer(
 	lbSvc service.LoadBalanceServiceBeta,
-	channelRepo repository.ChannelRepository,
+	checkSvc service.ModelCheckService,
 	channelModelRepo repository.ChannelModelRepository,
 	logger *log.Logger,
 	systemConfigSvc service.SystemConfigService,
 ) *CheckModelServer {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &CheckModelServer{
 		lbSvc:            lbSvc,
-		channelRepo:      channelRepo,
+		checkSvc:         checkSvc,
 		channelModelRepo: channelModelRepo,
 		logger:           logger,
 		systemConfigSvc:  systemConfigSvc,
+		ctx:              ctx,
+		cancel:           cancel,
+		done:             make(chan struct{}),
 	}
 }
 
 func (c *CheckModelServer) Start(ctx context.Context) error {
-	//return nil
-	return c.CheckModelChatStatus(ctx)
+	c.started.Store(true)
+	go c.CheckModelChatStatus(c.ctx)
+	return nil
 }
 
+// Stop 取消正在进行的检查，并等待本轮检查退出，未启动时直接返回
 func (c *CheckModelServer) Stop(ctx context.Context) error {
+	c.cancel()
+	if !c.started.Load() {
+		return nil
+	}
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 	return nil
 }
 
-func (c *CheckModelServer) CheckModelChatStatus(ctx context.Context) error {
-	task := make(chan string, 1)
-	go func() {
-		for _ = range task {
-			conf, err := c.systemConfigSvc.GetModelConfig(ctx)
-			if err != nil {
-				time.Sleep(3 * time.Second)
-				continue
-			}
-			if conf.CheckList == nil || len(conf.CheckList) == 0 {
-				time.Sleep(3 * time.Second)
-				continue
-			}
-			if conf.ModelMapping == nil {
-				conf.ModelMapping = make(map[string][]string)
+func (c *CheckModelServer) CheckModelChatStatus(ctx context.Context) {
+	defer close(c.done)
+	for {
+		wait := checkConfigRetryInterval
+		conf, err := c.systemConfigSvc.GetModelConfig(ctx)
+		if err == nil && len(conf.CheckList) > 0 {
+			c.checkRound(ctx, conf)
+			wait = defaultCheckInterval
+			if conf.CheckInterval > 0 {
+				wait = time.Duration(conf.CheckInterval) * time.Minute
 			}
-			modelMapping := conf.ModelMapping
-			checklist := conf.CheckList
-			uid := shortuuid.New()
-			ctx = c.logger.WithValue(context.Background(), zap.String("traceId", uid), zap.String("type", "check_cron"))
-			err = c.lbSvc.RecoverChannelModels(ctx)
-			if err != nil {
-				c.logger.WithContext(ctx).Error("定时检查|chat|模型恢复失败", zap.Error(err))
-			}
-			c.logger.WithContext(ctx).Info("一轮定时检查开始")
-			for _, modelId := range checklist {
-				modelIds := []string{modelId}
-				if _, ok := modelMapping[modelId]; ok {
-					modelIds = append(modelIds, modelMapping[modelId]...)
-				}
-				err := c.CheckModel(ctx, modelIds)
-				if err != nil {
-					c.logger.WithContext(ctx).Warn("定时检查|chat|"+modelId+"|失败", zap.Error(err))
-					continue
-				}
-				c.logger.WithContext(ctx).Info("定时检查|chat|" + modelId + "|完成")
-			}
-			c.logger.WithContext(ctx).Info("一轮定时检查完成")
-			time.Sleep(60 * time.Minute)
-			task <- "ok"
 		}
-	}()
-	task <- "ok"
-	return nil
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
 }
 
-func (c *CheckModelServer) CheckModel(ctx context.Context, modelIds []string) error {
-	list, err := c.channelModelRepo.FindCheckChannelModels(ctx, modelIds)
+func (c *CheckModelServer) checkRound(ctx context.Context, conf *dto.ModelConfig) {
+	uid := shortuuid.New()
+	ctx = c.logger.WithValue(ctx, zap.String("traceId", uid), zap.String("type", "check_cron"))
+	logger := c.logger.WithContext(ctx)
+	err := c.lbSvc.RecoverChannelModels(ctx)
 	if err != nil {
-		return err
+		logger.Error("定时检查|模型恢复失败", zap.Error(err))
 	}
-	logger := c.logger.WithContext(ctx)
-	for _, item := range list {
-		time.Sleep(5 * time.Second)
-		ctx = context.WithValue(ctx, "modelId", item.ModelKey)
-		zapLogger := logger.With(
-			zap.Uint64("channelId", item.ChannelId),
-			zap.String("modelKey", item.ModelKey),
-			zap.Uint64("modelRecordId", item.Id),
-		)
-		channel, err := c.channelRepo.FindChannelById(ctx, item.ChannelId)
-		if err != nil {
-			zapLogger.Error("定时检查|chat|数据库根据id获取channel失败", zap.Error(err))
-			continue
-		}
-		zapLogger = zapLogger.With(
-			zap.String("channelName", channel.Name),
-			zap.String("providerApiKey", channel.APIKey),
-		)
-		conf := &dto.ChannelModelConf{
-			ChannelId:       item.ChannelId,
-			ChannelName:     channel.Name,
-			ChannelType:     channel.Type,
-			ChannelKey:      channel.APIKey,
-			ChannelEndPoint: channel.EndPoint,
-			ModelRecordId:   item.Id,
-			ModelKey:        item.ModelKey,
-			Weight:          item.Weight,
-		}
-		adapterX, err := service.NewOAIAdapter(conf)
+	concurrency := defaultCheckConcurrency
+	if conf.CheckConcurrency > 0 {
+		concurrency = min(conf.CheckConcurrency, maxCheckConcurrency)
+	}
+	opts := service.NewCheckOptions(conf, model.CheckSourceCron)
+	logger.Info("一轮定时检查开始", zap.Int("concurrency", concurrency))
+	sem := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	for _, modelId := range conf.CheckList {
+		modelIds := append([]string{modelId}, conf.ModelMapping[modelId]...)
+		list, err := c.channelModelRepo.FindCheckChannelModels(ctx, modelIds)
 		if err != nil {
-			zapLogger.Warn("定时检查|chat|创建provider失败", zap.Error(err))
+			logger.Warn("定时检查|"+modelId+"|失败", zap.Error(err))
 			continue
 		}
-		body, _, err := adapterX.ChatCompletions(ctx, &adapterApi.ChatRequest{
-			Model: item.ModelKey,
-			Messages: []adapterApi.Message{
-				{
-					Role:    "user",
-					Content: []byte(`"hello,测试!"`),
-				},
-			},
-			Stream:    true,
-			MaxTokens: 10,
-		})
-		if err != nil {
-			if body != nil {
-				bodyDetail, err := io.ReadAll(body)
-				if err != nil {
-					zapLogger.Warn("定时检查|chat|对话请求失败|读取body失败", zap.Error(err))
-				} else {
-					zapLogger.Warn("定时检查|chat|对话请求失败", zap.Error(err), zap.String("detail", string(bodyDetail)))
-				}
-			} else {
-				zapLogger.Warn("定时检查|chat|对话请求失败", zap.Error(err), zap.String("detail", err.Error()))
-			}
-			// 标记模型不可用
-			err = c.lbSvc.FailCb(ctx, item.Id)
-			if err != nil {
-				zapLogger.Warn("定时检查|chat|更新模型状态失败", zap.Error(err))
+		for _, item := range list {
+			select {
+			case <-ctx.Done():
+				wg.Wait()
+				logger.Info("定时检查已取消")
+				return
+			case sem <- struct{}{}:
 			}
-			continue
+			wg.Add(1)
+			go func(item *model.ChannelModel) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				c.CheckModel(ctx, item, opts)
+			}(item)
 		}
-		err = c.lbSvc.SuccessCb(ctx, item.Id)
-		if err != nil {
-			zapLogger.Warn("定时检查|chat|更新模型状态失败", zap.Error(err))
+	}
+	wg.Wait()
+	logger.Info("一轮定时检查完成")
+}
+
+func (c *CheckModelServer) CheckModel(ctx context.Context, item *model.ChannelModel, opts *dto.CheckOptions) {
+	zapLogger := c.logger.WithContext(ctx).With(
+		zap.Uint64("channelId", item.ChannelId),
+		zap.String("modelKey", item.ModelKey),
+		zap.Uint64("modelRecordId", item.Id),
+	)
+	result, err := c.checkSvc.CheckChannelModel(ctx, item, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
 		}
-		zapLogger.Info("定时检查|chat|对话请求成功")
+		zapLogger.Warn("定时检查|探测请求失败", zap.Error(err))
+		return
 	}
-	return nil
+	zapLogger.Info("定时检查|探测请求成功",
+		zap.String("capability", result.Capability),
+		zap.Int64("firstTokenDuration", result.FirstTokenDuration),
+		zap.Int64("totalDuration", result.TotalDuration),
+	)
 }
@@ -9,7 +9,9 @@ import (
 	"github.com/jiu-u/oai-api/pkg/config"
 	"github.com/jiu-u/oai-api/pkg/jwt"
 	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/metrics"
 	"github.com/jiu-u/oai-api/pkg/server/http"
+	"github.com/jiu-u/oai-api/pkg/tracing"
 )
 
 func NewHTTPServer(
@@ -25,6 +27,9 @@ func NewHTTPServer(
 	sysConfigHandler *handler.SystemConfigHandler,
 	verificationHandler *handler.VerificationHandler,
 	channelHandler *handler.ChannelHandler,
+	auditLogHandler *handler.AuditLogHandler,
+	m *metrics.Metrics,
+	tp *tracing.Tracing,
 ) *http.Server {
 	//gin.SetMode(gin.DebugMode)
 	s := http.NewServer(
@@ -34,10 +39,14 @@ func NewHTTPServer(
 		http.WithServerPort(cfg.HTTP.Port),
 	)
 	s.Use(
-		middleware.TraceMiddleware(logger),
+		middleware.TraceMiddleware(logger, tp),
 		middleware.CORSMiddleware(),
 		middleware.SessionMiddleware(),
 	)
+	// 配置了token时业务端口也暴露指标，方便无法访问管理端口的部署方式
+	if cfg.Metrics.Token != "" {
+		s.GET("/metrics", middleware.MetricsAuthMiddleware(cfg.Metrics.Token), gin.WrapH(m.Handler()))
+	}
 	//s.Static("/assets", "./web/dist/assets")
 	//s.GET("/", func(ctx *gin.Context) {
 	//	ctx.File("./web/dist/index.html")
@@ -52,6 +61,7 @@ func NewHTTPServer(
 		channelHandler,
 		requestLogHandler,
 		userHandler,
+		auditLogHandler,
 		apiKeySvc,
 		logger,
 		jwt2,
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/jiu-u/oai-api/internal/middleware"
+	"github.com/jiu-u/oai-api/internal/model"
+	"github.com/jiu-u/oai-api/internal/repository"
+	"github.com/jiu-u/oai-api/pkg/config"
+	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/metrics"
+	"github.com/jiu-u/oai-api/pkg/server/http"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+const (
+	circuitClosed   = 0
+	circuitSoftOpen = 1
+	circuitHardOpen = 2
+)
+
+// MetricsServer 在独立的管理端口暴露 /metrics，未配置端口时不启动
+type MetricsServer struct {
+	srv    *http.Server
+	logger *log.Logger
+}
+
+func NewMetricsServer(
+	cfg *config.Config,
+	logger *log.Logger,
+	m *metrics.Metrics,
+	channelModelRepo repository.ChannelModelRepository,
+) *MetricsServer {
+	m.MustRegister(newChannelStateCollector(channelModelRepo, logger))
+	s := &MetricsServer{logger: logger}
+	if cfg.Metrics.Port <= 0 {
+		return s
+	}
+	engine := gin.New()
+	engine.Use(gin.Recovery())
+	handlers := []gin.HandlerFunc{gin.WrapH(m.Handler())}
+	if cfg.Metrics.Token != "" {
+		handlers = append([]gin.HandlerFunc{middleware.MetricsAuthMiddleware(cfg.Metrics.Token)}, handlers...)
+	}
+	engine.GET("/metrics", handlers...)
+	s.srv = http.NewServer(
+		engine,
+		logger,
+		http.WithServerHost(cfg.Metrics.Host),
+		http.WithServerPort(cfg.Metrics.Port),
+	)
+	return s
+}
+
+func (s *MetricsServer) Start(ctx context.Context) error {
+	if s.srv == nil {
+		return nil
+	}
+	return s.srv.Start(ctx)
+}
+
+func (s *MetricsServer) Stop(ctx context.Context) error {
+	if s.srv == nil {
+		return nil
+	}
+	return s.srv.Stop(ctx)
+}
+
+// channelStateCollector 抓取时从数据库读取渠道模型的熔断状态和权重
+type channelStateCollector struct {
+	channelModelRepo repository.ChannelModelRepository
+	logger           *log.Logger
+	circuitDesc      *prometheus.Desc
+	weightDesc       *prometheus.Desc
+}
+
+func newChannelStateCollector(channelModelRepo repository.ChannelModelRepository, logger *log.Logger) *channelStateCollector {
+	labels := []string{"channel", "model"}
+	return &channelStateCollector{
+		channelModelRepo: channelModelRepo,
+		logger:           logger,
+		circuitDesc: prometheus.NewDesc(
+			"oai_channel_model_circuit_state",
+			"渠道模型熔断状态，0正常，1软禁用(等待自动恢复)，2硬禁用",
+			labels, nil,
+		),
+		weightDesc: prometheus.NewDesc(
+			"oai_channel_model_weight",
+			"渠道模型当前的负载均衡权重",
+			labels, nil,
+		),
+	}
+}
+
+func (c *channelStateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.circuitDesc
+	ch <- c.weightDesc
+}
+
+func (c *channelStateCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	list, err := c.channelModelRepo.FindAllChannelModels(ctx)
+	if err != nil {
+		c.logger.Warn("指标|查询渠道模型失败", zap.Error(err))
+		return
+	}
+	for _, item := range list {
+		channel := strconv.FormatUint(item.ChannelId, 10)
+		ch <- prometheus.MustNewConstMetric(c.circuitDesc, prometheus.GaugeValue, circuitState(item), channel, item.ModelKey)
+		ch <- prometheus.MustNewConstMetric(c.weightDesc, prometheus.GaugeValue, float64(item.Weight), channel, item.ModelKey)
+	}
+}
+
+func circuitState(item *model.ChannelModel) float64 {
+	switch {
+	case item.HardLimit != 1:
+		return circuitHardOpen
+	case item.SoftLimit != 1:
+		return circuitSoftOpen
+	}
+	return circuitClosed
+}
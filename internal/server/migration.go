@@ -5,41 +5,110 @@ import (
 	"fmt"
 	"github.com/jiu-u/oai-api/internal/model"
 	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/secret"
+	"github.com/jiu-u/oai-api/pkg/sid"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"time"
 )
 
 type Migrate struct {
 	db     *gorm.DB
 	logger *log.Logger
+	sid    *sid.Sid
+	cipher *secret.Cipher
 }
 
-func NewMigrate(db *gorm.DB, logger *log.Logger) *Migrate {
+func NewMigrate(db *gorm.DB, logger *log.Logger, sid *sid.Sid, cipher *secret.Cipher) *Migrate {
 	return &Migrate{
 		db:     db,
 		logger: logger,
+		sid:    sid,
+		cipher: cipher,
 	}
 }
 func (m *Migrate) Start(ctx context.Context) error {
 	if err := m.db.AutoMigrate(
 		new(model.ChannelModel),
 		new(model.Channel),
+		new(model.ChannelKey),
+		new(model.ModelCheckResult),
 		//new(model.Model),
 		//new(model.Provider),
 		new(model.User),
 		new(model.ApiKey),
 		new(model.RequestLog),
+		new(model.RequestLogBody),
+		new(model.RequestLogStat),
+		new(model.ChannelStat),
 		new(model.SystemConfig),
 		new(model.AsyncTask),
 		new(model.UserAuthProvider),
+		new(model.AuditLog),
+		new(model.ResponseState),
 	); err != nil {
 		m.logger.Error("AutoMigrate error", zap.Error(err))
 		return err
 	}
 	m.logger.Info("AutoMigrate success")
+	if err := m.migrateChannelKeys(ctx); err != nil {
+		m.logger.Error("迁移渠道key失败", zap.Error(err))
+		return err
+	}
 	//os.Exit(0)
 	return nil
 }
+
+// migrateChannelKeys 将旧版本保存在 channels.api_key 中的key迁移到 channel_keys，
+// 复制后在同一事务中清空旧字段，避免明文或旧密钥加密的key继续留在 channels 表中
+func (m *Migrate) migrateChannelKeys(ctx context.Context) error {
+	var channels []*model.Channel
+	err := m.db.WithContext(ctx).Where("api_key <> ''").Find(&channels).Error
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	migrated := 0
+	for _, channel := range channels {
+		err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var keyCount int64
+			if err := tx.Model(new(model.ChannelKey)).Where("channel_id = ?", channel.Id).Count(&keyCount).Error; err != nil {
+				return err
+			}
+			// 已经有key的渠道只清空旧字段
+			if keyCount == 0 {
+				plainKey, err := m.cipher.Decrypt(channel.APIKey)
+				if err != nil {
+					return err
+				}
+				content, err := m.cipher.Encrypt(plainKey)
+				if err != nil {
+					return err
+				}
+				channelKey := &model.ChannelKey{
+					Id:            m.sid.GenUint64(),
+					ChannelId:     channel.Id,
+					Content:       content,
+					Status:        1,
+					CoolDownUntil: now,
+					LastUsedTime:  now,
+				}
+				channelKey.GenerateHashId(plainKey)
+				if err = tx.Create(channelKey).Error; err != nil {
+					return err
+				}
+				migrated++
+			}
+			// UpdateColumn 不触发 AfterUpdate 钩子
+			return tx.Model(new(model.Channel)).Where("id = ?", channel.Id).UpdateColumn("api_key", "").Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	m.logger.Info("迁移渠道key完成", zap.Int("count", migrated), zap.Int("cleared", len(channels)))
+	return nil
+}
 func (m *Migrate) Stop(ctx context.Context) error {
 	fmt.Println("AutoMigrate stop")
 	return nil
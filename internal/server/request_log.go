@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/jiu-u/oai-api/internal/service"
+	"github.com/jiu-u/oai-api/pkg/log"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// RequestLogServer 从队列中取出请求日志批量写入数据库，停止时写完队列中剩余的日志
+// 另起一个协程按 CleanInterval 清理过期的采集内容、超过保留天数的日志、超出查询范围的统计，不阻塞日志写入
+type RequestLogServer struct {
+	reqLogSvc     service.RequestLogService
+	captureSvc    service.BodyCaptureService
+	retentionSvc  service.RequestLogRetentionService
+	logger        *log.Logger
+	BatchSize     int
+	FlushInterval time.Duration
+	CleanInterval time.Duration
+	stop          chan struct{}
+	stopOnce      sync.Once
+	done          chan struct{}
+	cleanDone     chan struct{}
+}
+
+func NewRequestLogServer(
+	reqLogSvc service.RequestLogService,
+	captureSvc service.BodyCaptureService,
+	retentionSvc service.RequestLogRetentionService,
+	logger *log.Logger,
+) *RequestLogServer {
+	return &RequestLogServer{
+		reqLogSvc:     reqLogSvc,
+		captureSvc:    captureSvc,
+		retentionSvc:  retentionSvc,
+		logger:        logger,
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		CleanInterval: time.Hour,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+		cleanDone:     make(chan struct{}),
+	}
+}
+
+func (r *RequestLogServer) Start(ctx context.Context) error {
+	go r.run()
+	go r.runClean()
+	return nil
+}
+
+// Stop 需要放在 HTTP 服务之后停止，保证进行中的请求产生的日志也能写入，可以重复调用
+func (r *RequestLogServer) Stop(ctx context.Context) error {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	for _, done := range []chan struct{}{r.done, r.cleanDone} {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (r *RequestLogServer) run() {
+	defer close(r.done)
+	queue := r.reqLogSvc.RequestLogQueue()
+	batch := make([]*service.RequestLogReq, 0, r.BatchSize)
+	ticker := time.NewTicker(r.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case req := <-queue:
+			batch = append(batch, req)
+			if len(batch) >= r.BatchSize {
+				batch = r.flush(batch)
+			}
+		case <-ticker.C:
+			batch = r.flush(batch)
+		case <-r.stop:
+			for {
+				select {
+				case req := <-queue:
+					batch = append(batch, req)
+					if len(batch) >= r.BatchSize {
+						batch = r.flush(batch)
+					}
+				default:
+					r.flush(batch)
+					r.logger.Info("请求日志|队列已写完")
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *RequestLogServer) flush(batch []*service.RequestLogReq) []*service.RequestLogReq {
+	if dropped := r.reqLogSvc.TakeDroppedCount(); dropped > 0 {
+		r.logger.Warn("请求日志|日志被丢弃", zap.Int64("dropped", dropped))
+	}
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := r.reqLogSvc.CreateRequestLogs(ctx, batch); err != nil {
+		r.logger.Error("请求日志|批量写入失败", zap.Int("count", len(batch)), zap.Error(err))
+	}
+	return batch[:0]
+}
+
+// runClean 停止时取消正在进行的清理，已经删除的批次不受影响
+func (r *RequestLogServer) runClean() {
+	defer close(r.cleanDone)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-r.stop
+		cancel()
+	}()
+	ticker := time.NewTicker(r.CleanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.cleanExpiredBodies(ctx)
+			r.purgeExpiredLogs(ctx)
+			r.purgeExpiredStats(ctx)
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *RequestLogServer) purgeExpiredLogs(ctx context.Context) {
+	_, err := r.retentionSvc.PurgeExpired(ctx, true)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		r.logger.Error("请求日志|清理过期日志失败", zap.Error(err))
+	}
+}
+
+func (r *RequestLogServer) purgeExpiredStats(ctx context.Context) {
+	_, err := r.retentionSvc.PurgeExpiredStats(ctx)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		r.logger.Error("请求日志|清理过期统计失败", zap.Error(err))
+	}
+}
+
+func (r *RequestLogServer) cleanExpiredBodies(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	count, err := r.captureSvc.DeleteExpiredBodies(ctx)
+	if err != nil {
+		r.logger.Error("请求日志|清理过期的采集内容失败", zap.Error(err))
+		return
+	}
+	if count > 0 {
+		r.logger.Info("请求日志|已清理过期的采集内容", zap.Int64("count", count))
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"github.com/jiu-u/oai-api/internal/service"
+	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/lithammer/shortuuid/v4"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// ResponsesStateServer 定时清理过期的 Responses 对话状态
+type ResponsesStateServer struct {
+	responsesSvc service.ResponsesService
+	logger       *log.Logger
+	Interval     time.Duration
+	stop         chan struct{}
+	stopOnce     sync.Once
+}
+
+func NewResponsesStateServer(responsesSvc service.ResponsesService, logger *log.Logger) *ResponsesStateServer {
+	return &ResponsesStateServer{
+		responsesSvc: responsesSvc,
+		logger:       logger,
+		Interval:     time.Hour,
+		stop:         make(chan struct{}),
+	}
+}
+
+func (r *ResponsesStateServer) Start(ctx context.Context) error {
+	go func() {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.cleanExpiredStates()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop 可以重复调用
+func (r *ResponsesStateServer) Stop(ctx context.Context) error {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	return nil
+}
+
+func (r *ResponsesStateServer) cleanExpiredStates() {
+	uid := shortuuid.New()
+	ctx := r.logger.WithValue(context.Background(), zap.String("traceId", uid), zap.String("type", "responses_state_cron"))
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	count, err := r.responsesSvc.DeleteExpiredStates(ctx)
+	if err != nil {
+		r.logger.WithContext(ctx).Error("定时任务|Responses对话状态|清理失败", zap.Error(err))
+		return
+	}
+	if count > 0 {
+		r.logger.WithContext(ctx).Info("定时任务|Responses对话状态|已清理过期状态", zap.Int64("count", count))
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jiu-u/oai-api/internal/model"
+	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/secret"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// secretConfigFields SystemConfig 中需要加密的字段，key 为 config_type，嵌套字段用 . 分隔，数组中的每个元素都会处理
+var secretConfigFields = map[string][]string{
+	"email":  {"password"},
+	"oauth2": {"clientSecret"},
+	"alert":  {"sinks.secret"},
+}
+
+// RotateSecret 使用新的 security.secret.key 重新加密所有敏感字段
+// 旧密钥需要配置在 security.secret.previous_key 中，历史明文数据也会被加密
+type RotateSecret struct {
+	db     *gorm.DB
+	cipher *secret.Cipher
+	logger *log.Logger
+}
+
+func NewRotateSecret(db *gorm.DB, cipher *secret.Cipher, logger *log.Logger) *RotateSecret {
+	return &RotateSecret{
+		db:     db,
+		cipher: cipher,
+		logger: logger,
+	}
+}
+
+func (r *RotateSecret) Start(ctx context.Context) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		channelCount, err := r.rotateChannels(tx)
+		if err != nil {
+			r.logger.Error("渠道key重新加密失败", zap.Error(err))
+			return err
+		}
+		keyCount, err := r.rotateChannelKeys(tx)
+		if err != nil {
+			r.logger.Error("渠道key池重新加密失败", zap.Error(err))
+			return err
+		}
+		configCount, err := r.rotateSystemConfigs(tx)
+		if err != nil {
+			r.logger.Error("系统配置重新加密失败", zap.Error(err))
+			return err
+		}
+		r.logger.Info("密钥轮换完成", zap.Int("channels", channelCount), zap.Int("channelKeys", keyCount), zap.Int("systemConfigs", configCount))
+		return nil
+	})
+}
+
+func (r *RotateSecret) Stop(ctx context.Context) error {
+	return nil
+}
+
+func (r *RotateSecret) rotateChannels(tx *gorm.DB) (int, error) {
+	var channels []*model.Channel
+	count := 0
+	err := tx.Unscoped().Select("id", "api_key").FindInBatches(&channels, 100, func(batch *gorm.DB, _ int) error {
+		for _, channel := range channels {
+			apiKey, err := r.cipher.Rotate(channel.APIKey)
+			if err != nil {
+				return err
+			}
+			// UpdateColumn 不触发 AfterUpdate 钩子
+			err = tx.Unscoped().Model(&model.Channel{}).Where("id = ?", channel.Id).UpdateColumn("api_key", apiKey).Error
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	}).Error
+	return count, err
+}
+
+func (r *RotateSecret) rotateChannelKeys(tx *gorm.DB) (int, error) {
+	var keys []*model.ChannelKey
+	count := 0
+	err := tx.Unscoped().Select("id", "content").FindInBatches(&keys, 100, func(batch *gorm.DB, _ int) error {
+		for _, key := range keys {
+			content, err := r.cipher.Rotate(key.Content)
+			if err != nil {
+				return err
+			}
+			err = tx.Unscoped().Model(&model.ChannelKey{}).Where("id = ?", key.Id).UpdateColumn("content", content).Error
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	}).Error
+	return count, err
+}
+
+func (r *RotateSecret) rotateSystemConfigs(tx *gorm.DB) (int, error) {
+	count := 0
+	for configType, fields := range secretConfigFields {
+		var list []*model.SystemConfig
+		err := tx.Unscoped().Where("config_type = ?", configType).Find(&list).Error
+		if err != nil {
+			return count, err
+		}
+		for _, item := range list {
+			var value map[string]any
+			if err = json.Unmarshal([]byte(item.Value), &value); err != nil {
+				return count, err
+			}
+			for _, field := range fields {
+				if err = r.rotateField(value, strings.Split(field, ".")); err != nil {
+					return count, err
+				}
+			}
+			jsonStr, err := json.Marshal(value)
+			if err != nil {
+				return count, err
+			}
+			err = tx.Unscoped().Model(&model.SystemConfig{}).Where("id = ?", item.Id).UpdateColumn("value", string(jsonStr)).Error
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// rotateField 按路径找到字段重新加密，路径中间遇到数组时处理每个元素，字段不存在时跳过
+func (r *RotateSecret) rotateField(value any, path []string) error {
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			if err := r.rotateField(item, path); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		child, ok := v[path[0]]
+		if !ok {
+			return nil
+		}
+		if len(path) > 1 {
+			return r.rotateField(child, path[1:])
+		}
+		text, ok := child.(string)
+		if !ok {
+			return nil
+		}
+		rotated, err := r.cipher.Rotate(text)
+		if err != nil {
+			return err
+		}
+		v[path[0]] = rotated
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"github.com/jiu-u/oai-api/internal/service"
+	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/lithammer/shortuuid/v4"
+	"go.uber.org/zap"
+	"time"
+)
+
+// UsageReportServer 定时检查上个月的用量报表是否已经发送，每月只发送一次
+type UsageReportServer struct {
+	reportSvc service.UsageReportService
+	logger    *log.Logger
+	Interval  time.Duration
+	stop      chan struct{}
+}
+
+func NewUsageReportServer(reportSvc service.UsageReportService, logger *log.Logger) *UsageReportServer {
+	return &UsageReportServer{
+		reportSvc: reportSvc,
+		logger:    logger,
+		Interval:  60 * time.Minute,
+		stop:      make(chan struct{}),
+	}
+}
+
+func (u *UsageReportServer) Start(ctx context.Context) error {
+	go func() {
+		ticker := time.NewTicker(u.Interval)
+		defer ticker.Stop()
+		for {
+			uid := shortuuid.New()
+			ctx := u.logger.WithValue(context.Background(), zap.String("traceId", uid), zap.String("type", "usage_report_cron"))
+			_, err := u.reportSvc.SendMonthlyReport(ctx, "", true)
+			if err != nil {
+				u.logger.WithContext(ctx).Error("定时任务|用量报表|发送失败", zap.Error(err))
+			}
+			select {
+			case <-ticker.C:
+			case <-u.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (u *UsageReportServer) Stop(ctx context.Context) error {
+	close(u.stop)
+	return nil
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jiu-u/oai-api/internal/dto"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 告警事件类型，规则中的 event 使用这些值
+const (
+	AlertEventChannelDisabled         = "channel_disabled"
+	AlertEventChannelKeyDisabled      = "channel_key_disabled"
+	AlertEventChannelModelDisabled    = "channel_model_disabled"
+	AlertEventChannelModelSoftLimited = "channel_model_soft_limited"
+	AlertEventBalanceLow              = "balance_low"
+	AlertEventModelUnavailable        = "model_unavailable"
+	AlertEventTest                    = "test"
+)
+
+const (
+	AlertLevelWarning  = "warning"
+	AlertLevelCritical = "critical"
+)
+
+const (
+	alertSinkWebhook  = "webhook"
+	alertSinkEmail    = "email"
+	alertSinkSlack    = "slack"
+	alertSinkDingTalk = "dingtalk"
+	alertSinkFeishu   = "feishu"
+)
+
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// AlertField 告警内容中的一项，按顺序展示
+type AlertField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// AlertEvent Key 为事件涉及的对象，如渠道id，与 Type 一起用于去重
+type AlertEvent struct {
+	Type   string       `json:"type"`
+	Level  string       `json:"level"`
+	Key    string       `json:"key"`
+	Title  string       `json:"title"`
+	Fields []AlertField `json:"fields"`
+	Time   time.Time    `json:"time"`
+}
+
+func (e *AlertEvent) levelText() string {
+	if e.Level == AlertLevelCritical {
+		return "严重"
+	}
+	return "警告"
+}
+
+// Text 纯文本格式，用于 slack 和飞书
+func (e *AlertEvent) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s\n", e.levelText(), e.Title)
+	for _, field := range e.Fields {
+		fmt.Fprintf(&b, "%s: %s\n", field.Name, field.Value)
+	}
+	fmt.Fprintf(&b, "时间: %s", e.Time.Format(time.DateTime))
+	return b.String()
+}
+
+// Markdown 用于钉钉
+func (e *AlertEvent) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### [%s] %s\n\n", e.levelText(), e.Title)
+	for _, field := range e.Fields {
+		fmt.Fprintf(&b, "- **%s**: %s\n", field.Name, field.Value)
+	}
+	fmt.Fprintf(&b, "- **时间**: %s\n", e.Time.Format(time.DateTime))
+	return b.String()
+}
+
+// HTML 用于邮件，字段值会被转义
+func (e *AlertEvent) HTML() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<h3>[%s] %s</h3><p>", e.levelText(), html.EscapeString(e.Title))
+	for _, field := range e.Fields {
+		fmt.Fprintf(&b, "%s: %s<br>", html.EscapeString(field.Name), html.EscapeString(field.Value))
+	}
+	fmt.Fprintf(&b, "时间: %s</p>", e.Time.Format(time.DateTime))
+	return b.String()
+}
+
+type alertSink interface {
+	Send(ctx context.Context, event *AlertEvent) error
+}
+
+func hmacSHA256(key, message string) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// postAlert 发送 json 请求，非 2xx 时返回错误，返回响应体供各个机器人检查业务错误码
+func postAlert(ctx context.Context, target string, payload any, header map[string]string) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return postAlertBody(ctx, target, body, header)
+}
+
+func postAlertBody(ctx context.Context, target string, body []byte, header map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := alertClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%d %s: %s", resp.StatusCode, http.StatusText(resp.StatusCode), respBody)
+	}
+	return respBody, nil
+}
+
+// webhookSink 请求体为 AlertEvent 的 json，配置了 Secret 时
+// X-Alert-Signature 为 hex(HMAC-SHA256(secret, timestamp + "." + body))，timestamp 为 X-Alert-Timestamp 的值(秒)
+type webhookSink struct {
+	url    string
+	secret string
+}
+
+func (s *webhookSink) Send(ctx context.Context, event *AlertEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	header := make(map[string]string)
+	if s.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		header["X-Alert-Timestamp"] = timestamp
+		header["X-Alert-Signature"] = "sha256=" + hex.EncodeToString(hmacSHA256(s.secret, timestamp+"."+string(body)))
+	}
+	_, err = postAlertBody(ctx, s.url, body, header)
+	return err
+}
+
+type slackSink struct {
+	url string
+}
+
+func (s *slackSink) Send(ctx context.Context, event *AlertEvent) error {
+	_, err := postAlert(ctx, s.url, map[string]any{"text": event.Text()}, nil)
+	return err
+}
+
+// dingTalkSink 钉钉自定义机器人，配置了加签密钥时在 url 上附加 timestamp 和 sign
+type dingTalkSink struct {
+	url    string
+	secret string
+}
+
+func (s *dingTalkSink) Send(ctx context.Context, event *AlertEvent) error {
+	target := s.url
+	if s.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		sign := base64.StdEncoding.EncodeToString(hmacSHA256(s.secret, timestamp+"\n"+s.secret))
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + "timestamp=" + timestamp + "&sign=" + url.QueryEscape(sign)
+	}
+	respBody, err := postAlert(ctx, target, map[string]any{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": event.Title,
+			"text":  event.Markdown(),
+		},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err = json.Unmarshal(respBody, &resp); err == nil && resp.ErrCode != 0 {
+		return fmt.Errorf("钉钉返回错误: %d %s", resp.ErrCode, resp.ErrMsg)
+	}
+	return nil
+}
+
+// feishuSink 飞书自定义机器人，配置了签名校验时在请求体中附加 timestamp 和 sign
+type feishuSink struct {
+	url    string
+	secret string
+}
+
+func (s *feishuSink) Send(ctx context.Context, event *AlertEvent) error {
+	payload := map[string]any{
+		"msg_type": "text",
+		"content":  map[string]string{"text": event.Text()},
+	}
+	if s.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		payload["timestamp"] = timestamp
+		payload["sign"] = base64.StdEncoding.EncodeToString(hmacSHA256(timestamp+"\n"+s.secret, ""))
+	}
+	respBody, err := postAlert(ctx, s.url, payload, nil)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err = json.Unmarshal(respBody, &resp); err == nil && resp.Code != 0 {
+		return fmt.Errorf("飞书返回错误: %d %s", resp.Code, resp.Msg)
+	}
+	return nil
+}
+
+// emailSink 逐个发送，有收件人发送失败时返回最后一个错误
+type emailSink struct {
+	emailSvc   EmailService
+	recipients []string
+}
+
+func (s *emailSink) Send(ctx context.Context, event *AlertEvent) error {
+	if len(s.recipients) == 0 {
+		return errors.New("没有收件人")
+	}
+	var lastErr error
+	subject := fmt.Sprintf("[%s] %s", event.levelText(), event.Title)
+	for _, to := range s.recipients {
+		if err := s.emailSvc.SendEmail(ctx, to, subject, event.HTML()); err != nil {
+			lastErr = fmt.Errorf("%s: %w", to, err)
+		}
+	}
+	return lastErr
+}
+
+// matchAlertSinks 优先使用事件自己的规则，没有时使用 * 规则，规则关闭时不发送
+func matchAlertSinks(cfg *dto.AlertConfig, eventType string) []dto.AlertSink {
+	var rule *dto.AlertRule
+	for i := range cfg.Rules {
+		if cfg.Rules[i].Event == eventType {
+			rule = &cfg.Rules[i]
+			break
+		}
+		if cfg.Rules[i].Event == "*" && rule == nil {
+			rule = &cfg.Rules[i]
+		}
+	}
+	if rule == nil || !rule.Enable {
+		return nil
+	}
+	var sinks []dto.AlertSink
+	for _, name := range rule.Sinks {
+		for _, sink := range cfg.Sinks {
+			if sink.Name == name && sink.Enable {
+				sinks = append(sinks, sink)
+			}
+		}
+	}
+	return sinks
+}
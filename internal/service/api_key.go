@@ -5,11 +5,14 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	v1 "github.com/jiu-u/oai-api/api/v1"
 	"github.com/jiu-u/oai-api/internal/model"
 	"github.com/jiu-u/oai-api/internal/repository"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type ApiKeyService interface {
@@ -17,17 +20,21 @@ type ApiKeyService interface {
 	ResetApiKey(ctx context.Context, req *v1.ResetApiKeyRequest) (*v1.ResetApiKeyResponse, error)
 	IsActiveApiKey(ctx context.Context, key string) bool
 	GetUserApiKey(ctx context.Context, userId uint64) (*model.ApiKey, error)
+	GetApiKeyGroups(ctx context.Context, key string) ([]string, error)
+	UpdateApiKeyGroup(ctx context.Context, userId uint64, req *v1.UpdateApiKeyGroupRequest) error
 }
 
 func NewApiKeyService(
 	s *Service,
 	userRepo repository.UserRepository,
 	apiKeyRepo repository.ApiKeyRepository,
+	systemRepo repository.SystemRepository,
 ) ApiKeyService {
 	return &apiKeyService{
 		Service:    s,
 		userRepo:   userRepo,
 		apiKeyRepo: apiKeyRepo,
+		systemRepo: systemRepo,
 	}
 }
 
@@ -35,6 +42,7 @@ type apiKeyService struct {
 	*Service
 	userRepo   repository.UserRepository
 	apiKeyRepo repository.ApiKeyRepository
+	systemRepo repository.SystemRepository
 }
 
 func (s *apiKeyService) GetUserApiKey(ctx context.Context, userId uint64) (*model.ApiKey, error) {
@@ -46,6 +54,63 @@ func (s *apiKeyService) IsActiveApiKey(ctx context.Context, key string) bool {
 	return err == nil && exist
 }
 
+// GetApiKeyGroups 结果缓存1分钟，修改分组时主动清除
+func (s *apiKeyService) GetApiKeyGroups(ctx context.Context, key string) ([]string, error) {
+	if v, ok := s.Cache.Get(groupsCacheKey(key)); ok {
+		return v.([]string), nil
+	}
+	apiKey, err := s.apiKeyRepo.QueryItemByApiKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.getUserGroups(ctx, apiKey.UserId)
+	if err != nil {
+		return nil, err
+	}
+	groups = apiKeyGroups(apiKey, groups)
+	s.Cache.Set(groupsCacheKey(key), groups, time.Minute)
+	return groups, nil
+}
+
+func (s *apiKeyService) getUserGroups(ctx context.Context, userId uint64) ([]string, error) {
+	user, err := s.userRepo.FindUserById(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	var levelGroups map[string][]string
+	// 未配置模型配置时不影响分组解析
+	if cfg, err := s.systemRepo.GetModelConfig(ctx); err == nil {
+		levelGroups = cfg.LevelGroups
+	}
+	return userGroups(user, levelGroups), nil
+}
+
+// UpdateApiKeyGroup api key 只能限定在用户自己的分组内，group 为空时恢复为用户分组
+func (s *apiKeyService) UpdateApiKeyGroup(ctx context.Context, userId uint64, req *v1.UpdateApiKeyGroupRequest) error {
+	apiKey, err := s.apiKeyRepo.GetUserApiKey(ctx, userId)
+	if err != nil {
+		return err
+	}
+	group := normalizeGroup(req.Group)
+	if group != "" {
+		groups, err := s.getUserGroups(ctx, userId)
+		if err != nil {
+			return err
+		}
+		for _, item := range model.ParseGroups(group) {
+			if !slices.Contains(groups, item) {
+				return fmt.Errorf("无权使用分组: %s", item)
+			}
+		}
+	}
+	err = s.apiKeyRepo.UpdateApiKeyGroup(ctx, userId, group)
+	if err != nil {
+		return err
+	}
+	s.Cache.Delete(groupsCacheKey(apiKey.Content))
+	return nil
+}
+
 func (s *apiKeyService) CreateApiKey(ctx context.Context, req *v1.CreateApiKeyRequest) (*v1.CreateApiKeyResponse, error) {
 	userId, err := strconv.ParseUint(req.UserId, 10, 64)
 	if err != nil {
@@ -87,6 +152,12 @@ func (s *apiKeyService) ResetApiKey(ctx context.Context, req *v1.ResetApiKeyRequ
 		if user.Status != 1 {
 			return errors.New("用户已被禁用")
 		}
+		// 重置key时保留原key限定的分组
+		group := ""
+		if old, err := s.apiKeyRepo.GetUserApiKey(ctx, userId); err == nil {
+			group = old.Group
+			s.Cache.Delete(groupsCacheKey(old.Content))
+		}
 		err = s.apiKeyRepo.DeleteKeyByUserId(ctx, userId)
 		if err != nil {
 			return err
@@ -94,6 +165,7 @@ func (s *apiKeyService) ResetApiKey(ctx context.Context, req *v1.ResetApiKeyRequ
 		apiKey = &model.ApiKey{
 			UserId:  userId,
 			Content: GenerateOpenAIKey(),
+			Group:   group,
 		}
 		apiKey.Id = s.Sid.GenUint64()
 		err = s.apiKeyRepo.InsertOne(ctx, apiKey)
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	apiV1 "github.com/jiu-u/oai-api/api/v1"
+	"github.com/jiu-u/oai-api/internal/model"
+	"github.com/jiu-u/oai-api/internal/repository"
+	"github.com/jiu-u/oai-api/pkg/datautils"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 审计日志的对象类型
+const (
+	AuditTargetChannel    = "channel"
+	AuditTargetChannelKey = "channel_key"
+	AuditTargetSystem     = "system_config"
+	AuditTargetUser       = "user"
+)
+
+// AuditEntry Before/After 为操作前后的对象，nil 表示不存在(创建或删除)，记录前会脱敏
+type AuditEntry struct {
+	ActorId    uint64
+	ActorName  string
+	Action     string
+	TargetType string
+	TargetId   string
+	Before     any
+	After      any
+	Ip         string
+	TraceId    string
+}
+
+type AuditLogService interface {
+	// Record 写入失败只记录日志，不影响已经完成的操作
+	Record(ctx context.Context, entry *AuditEntry)
+	GetAuditLogs(ctx context.Context, req *apiV1.AuditLogsQuery) (*apiV1.AuditLogsResponse, error)
+}
+
+func NewAuditLogService(s *Service, repo repository.AuditLogRepository) AuditLogService {
+	return &auditLogService{
+		Service: s,
+		repo:    repo,
+	}
+}
+
+type auditLogService struct {
+	*Service
+	repo repository.AuditLogRepository
+}
+
+func (s *auditLogService) Record(ctx context.Context, entry *AuditEntry) {
+	before := auditSnapshot(entry.Before)
+	after := auditSnapshot(entry.After)
+	log := &model.AuditLog{
+		Id:         s.Sid.GenUint64(),
+		ActorId:    entry.ActorId,
+		ActorName:  entry.ActorName,
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetId:   entry.TargetId,
+		Before:     auditJSON(before),
+		After:      auditJSON(after),
+		Diff:       auditJSON(auditDiff(before, after)),
+		Ip:         entry.Ip,
+		TraceId:    entry.TraceId,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.repo.CreateAuditLog(ctx, log); err != nil {
+		s.Logger.WithContext(ctx).Error("写入审计日志失败", zap.String("action", entry.Action),
+			zap.String("targetId", entry.TargetId), zap.Uint64("actorId", entry.ActorId), zap.Error(err))
+	}
+}
+
+func (s *auditLogService) GetAuditLogs(ctx context.Context, req *apiV1.AuditLogsQuery) (*apiV1.AuditLogsResponse, error) {
+	logs, total, err := s.repo.FindAuditLogs(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]apiV1.AuditLogItem, 0, len(logs))
+	for _, log := range logs {
+		list = append(list, apiV1.AuditLogItem{
+			Id:         strconv.FormatUint(log.Id, 10),
+			ActorId:    strconv.FormatUint(log.ActorId, 10),
+			ActorName:  log.ActorName,
+			Action:     log.Action,
+			TargetType: log.TargetType,
+			TargetId:   log.TargetId,
+			Before:     rawAuditJSON(log.Before),
+			After:      rawAuditJSON(log.After),
+			Diff:       rawAuditJSON(log.Diff),
+			Ip:         log.Ip,
+			TraceId:    log.TraceId,
+			CreatedAt:  log.CreatedAt.Format(time.DateTime),
+		})
+	}
+	return &apiV1.AuditLogsResponse{
+		List:     list,
+		Total:    int(total),
+		Page:     req.Page,
+		PageSize: req.PageSize,
+	}, nil
+}
+
+// auditSnapshot 转成通用的 json 结构并脱敏，对象通过 json tag 决定字段名
+func auditSnapshot(v any) any {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out any
+	if err = json.Unmarshal(data, &out); err != nil {
+		return nil
+	}
+	return maskAuditValue(out, false)
+}
+
+// isAuditSecretField 字段名包含这些关键字时值按密钥处理
+func isAuditSecretField(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "key", "keys", "apikey", "apikeys", "api_key", "content":
+		return true
+	}
+	return strings.Contains(name, "password") || strings.Contains(name, "secret") || strings.Contains(name, "token")
+}
+
+// maskAuditValue secret 只作用于字符串和字符串数组，嵌套对象按自己的字段名重新判断
+func maskAuditValue(v any, secret bool) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			val[k] = maskAuditValue(item, isAuditSecretField(k))
+		}
+		return val
+	case []any:
+		for i, item := range val {
+			val[i] = maskAuditValue(item, secret)
+		}
+		return val
+	case string:
+		if secret && !datautils.IsMaskedSecret(val) {
+			return datautils.MaskSecret(val)
+		}
+	}
+	return v
+}
+
+// auditDiff 按字段路径比较，数组整体比较，只保留变化的字段
+func auditDiff(before, after any) map[string]map[string]any {
+	b := make(map[string]any)
+	a := make(map[string]any)
+	flattenAudit("", before, b)
+	flattenAudit("", after, a)
+	paths := make(map[string]struct{}, len(a)+len(b))
+	for k := range b {
+		paths[k] = struct{}{}
+	}
+	for k := range a {
+		paths[k] = struct{}{}
+	}
+	diff := make(map[string]map[string]any)
+	for k := range paths {
+		if auditJSON(b[k]) == auditJSON(a[k]) {
+			continue
+		}
+		diff[k] = map[string]any{"before": b[k], "after": a[k]}
+	}
+	return diff
+}
+
+func flattenAudit(prefix string, v any, out map[string]any) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		if v != nil || prefix != "" {
+			out[prefix] = v
+		}
+		return
+	}
+	for k, item := range obj {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		flattenAudit(path, item, out)
+	}
+}
+
+func auditJSON(v any) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func rawAuditJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return json.RawMessage(s)
+}
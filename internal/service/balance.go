@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	v1 "github.com/jiu-u/oai-api/api/v1"
+	"github.com/jiu-u/oai-api/internal/model"
+	"github.com/jiu-u/oai-api/internal/repository"
+	"github.com/jiu-u/oai-api/pkg/balance"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// balanceDisablePrefix 因余额不足被禁用的渠道，余额恢复后会自动启用
+const balanceDisablePrefix = "余额不足"
+
+type BalanceService interface {
+	RefreshChannelBalance(ctx context.Context, channelId uint64) (*v1.ChannelBalanceResponse, error)
+	RefreshAllBalances(ctx context.Context) error
+}
+
+func NewBalanceService(
+	s *Service,
+	channelRepo repository.ChannelRepository,
+	channelModelRepo repository.ChannelModelRepository,
+	channelKeyRepo repository.ChannelKeyRepository,
+	loadSvc LoadBalanceServiceBeta,
+	notifySvc NotifyService,
+) BalanceService {
+	return &balanceService{
+		Service:          s,
+		channelRepo:      channelRepo,
+		channelModelRepo: channelModelRepo,
+		channelKeyRepo:   channelKeyRepo,
+		loadSvc:          loadSvc,
+		notifySvc:        notifySvc,
+	}
+}
+
+type balanceService struct {
+	*Service
+	channelRepo      repository.ChannelRepository
+	channelModelRepo repository.ChannelModelRepository
+	channelKeyRepo   repository.ChannelKeyRepository
+	loadSvc          LoadBalanceServiceBeta
+	notifySvc        NotifyService
+}
+
+// newBalanceFetcher 配置了自定义地址时优先使用自定义地址
+func newBalanceFetcher(channel *model.Channel) (balance.Fetcher, error) {
+	if channel.BalanceURL != "" {
+		return &balance.JSONPathFetcher{URL: channel.BalanceURL, Path: channel.BalancePath}, nil
+	}
+	switch channel.Type {
+	case "openai", "oaiNoModels":
+		return &balance.OpenAIFetcher{}, nil
+	case "siliconflow", "siliconflowFree":
+		return &balance.SiliconFlowFetcher{}, nil
+	}
+	return nil, balance.ErrNotSupported
+}
+
+// RefreshChannelBalance 查询渠道下所有启用key的余额，渠道余额为各key余额之和
+func (s *balanceService) RefreshChannelBalance(ctx context.Context, channelId uint64) (*v1.ChannelBalanceResponse, error) {
+	channel, err := s.channelRepo.FindChannelById(ctx, channelId)
+	if err != nil {
+		return nil, err
+	}
+	fetcher, err := newBalanceFetcher(channel)
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.ChannelBalanceResponse{
+		Keys: make([]v1.ChannelKeyBalanceResult, 0, len(channel.Keys)),
+	}
+	succ := 0
+	var lastErr error
+	for _, key := range channel.Keys {
+		if key.Status != 1 {
+			continue
+		}
+		result := v1.ChannelKeyBalanceResult{Id: strconv.FormatUint(key.Id, 10)}
+		amount, err := s.fetchKeyBalance(ctx, fetcher, channel, &key)
+		if err != nil {
+			lastErr = err
+			result.Error = err.Error()
+			resp.Keys = append(resp.Keys, result)
+			continue
+		}
+		succ++
+		result.Balance = amount
+		resp.Balance += amount
+		resp.Keys = append(resp.Keys, result)
+	}
+	if succ == 0 {
+		if lastErr == nil {
+			lastErr = errors.New("no available channel key")
+		}
+		return nil, fmt.Errorf("查询余额失败: %w", lastErr)
+	}
+	err = s.channelRepo.UpdateChannelBalance(ctx, channelId, resp.Balance)
+	if err != nil {
+		return nil, err
+	}
+	resp.UpdatedAt = time.Now()
+	channel.Balance = resp.Balance
+	channel.BalanceUpdatedAt = &resp.UpdatedAt
+	if err = s.applyBalanceThreshold(ctx, channel); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *balanceService) fetchKeyBalance(ctx context.Context, fetcher balance.Fetcher, channel *model.Channel, key *model.ChannelKey) (float64, error) {
+	apiKey, err := s.Cipher.Decrypt(key.Content)
+	if err != nil {
+		return 0, err
+	}
+	amount, err := fetcher.Fetch(ctx, channel.EndPoint, apiKey)
+	if err != nil {
+		return 0, err
+	}
+	err = s.channelKeyRepo.UpdateChannelKeyBalance(ctx, key.Id, amount)
+	if err != nil {
+		return 0, err
+	}
+	return amount, nil
+}
+
+// applyBalanceThreshold 降权在负载均衡选择渠道时生效，这里只处理禁用以及余额恢复后的自动启用
+func (s *balanceService) applyBalanceThreshold(ctx context.Context, channel *model.Channel) error {
+	low := channel.BalanceLow()
+	switch {
+	case low && channel.Status == 1 && channel.BalanceAction == model.BalanceActionDisable:
+		reason := fmt.Sprintf("%s: %.4f < %.4f", balanceDisablePrefix, channel.Balance, channel.BalanceThreshold)
+		err := s.updateChannelStatus(ctx, channel.Id, 2, reason)
+		if err != nil {
+			return err
+		}
+		_ = s.loadSvc.RemoveChannel(ctx, channel.Id)
+		s.notifySvc.Alert(ctx, &AlertEvent{
+			Type:   AlertEventChannelDisabled,
+			Level:  AlertLevelCritical,
+			Key:    strconv.FormatUint(channel.Id, 10),
+			Title:  "渠道已因余额不足被禁用",
+			Fields: balanceAlertFields(channel, reason),
+		})
+		return nil
+	case low && channel.Status == 1:
+		reason := fmt.Sprintf("%s: %.4f < %.4f", balanceDisablePrefix, channel.Balance, channel.BalanceThreshold)
+		s.notifySvc.Alert(ctx, &AlertEvent{
+			Type:   AlertEventBalanceLow,
+			Level:  AlertLevelWarning,
+			Key:    strconv.FormatUint(channel.Id, 10),
+			Title:  "渠道余额不足",
+			Fields: balanceAlertFields(channel, reason),
+		})
+	case !low && channel.Status == 2 && strings.HasPrefix(channel.DisableReason, balanceDisablePrefix):
+		err := s.updateChannelStatus(ctx, channel.Id, 1, "")
+		if err != nil {
+			return err
+		}
+		channel.Status = 1
+		channel.DisableReason = ""
+		s.Logger.WithContext(ctx).Info("渠道余额恢复，自动启用", zap.Uint64("channelId", channel.Id), zap.Float64("balance", channel.Balance))
+	}
+	if channel.Status == 1 {
+		// 更新负载均衡缓存中的余额，用于降权
+		_ = s.loadSvc.AddChannel(ctx, channel)
+	}
+	return nil
+}
+
+func balanceAlertFields(channel *model.Channel, reason string) []AlertField {
+	return []AlertField{
+		{Name: "渠道", Value: fmt.Sprintf("%s(%d)", channel.Name, channel.Id)},
+		{Name: "原因", Value: reason},
+	}
+}
+
+// updateChannelStatus 渠道模型的禁用原因同样记录为余额不足，恢复时只启用因余额不足禁用的模型
+// 因 404 等原因硬禁用的模型保持禁用
+func (s *balanceService) updateChannelStatus(ctx context.Context, channelId uint64, status int8, reason string) error {
+	return s.Tm.Transaction(ctx, func(ctx context.Context) error {
+		err := s.channelRepo.UpdateChannelStatus(ctx, channelId, status, reason)
+		if err != nil {
+			return err
+		}
+		if status == 1 {
+			return s.channelModelRepo.EnableChannelModelsByReason(ctx, channelId, balanceDisablePrefix)
+		}
+		return s.channelModelRepo.DisableChannelModelsWithReason(ctx, channelId, reason)
+	})
+}
+
+func (s *balanceService) RefreshAllBalances(ctx context.Context) error {
+	channels, err := s.channelRepo.FindAllChannels(ctx)
+	if err != nil {
+		return err
+	}
+	logger := s.Logger.WithContext(ctx)
+	succ := 0
+	for _, channel := range channels {
+		if _, err := newBalanceFetcher(channel); err != nil {
+			continue
+		}
+		_, err = s.RefreshChannelBalance(ctx, channel.Id)
+		if err != nil {
+			logger.Warn("定时任务|余额|查询失败", zap.Uint64("channelId", channel.Id), zap.String("channelName", channel.Name), zap.Error(err))
+			continue
+		}
+		succ++
+	}
+	logger.Info("定时任务|余额|查询完成", zap.Int("total", len(channels)), zap.Int("success", succ))
+	return nil
+}
@@ -0,0 +1,525 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/jiu-u/oai-api/internal/dto"
+	"github.com/jiu-u/oai-api/internal/model"
+	"github.com/jiu-u/oai-api/internal/repository"
+	"go.uber.org/zap"
+	"maps"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// bodyCaptureCacheKey 采集配置缓存，修改配置时删除
+	bodyCaptureCacheKey         = "bodyCaptureSettings"
+	defaultCaptureBodySize      = 16 * 1024
+	maxCaptureBodySize          = 60 * 1024 // mysql 的 text 最多64KB
+	defaultCaptureRetentionDays = 7
+	// sseMaxLineSize 单行SSE数据的上限，超过时丢弃该行
+	sseMaxLineSize = 1024 * 1024
+)
+
+type redactRule struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// builtinRedactRules 始终生效的脱敏规则，key 规则放在最前面，避免被手机号规则拆开
+var builtinRedactRules = []redactRule{
+	{regexp.MustCompile(`\b(?:sk|ak|rk)-[A-Za-z0-9_\-]{16,}`), "[KEY]"},
+	{regexp.MustCompile(`AIza[0-9A-Za-z_\-]{35}`), "[KEY]"},
+	{regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._\-]{16,}`), "Bearer [KEY]"},
+	{regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	{regexp.MustCompile(`(?:\+?86[\s\-]?)?\b1[3-9]\d{9}\b`), "[PHONE]"},
+	{regexp.MustCompile(`\+\d{1,3}[\s\-]?\d{3,4}[\s\-]?\d{3,4}[\s\-]?\d{0,4}\b`), "[PHONE]"},
+}
+
+type redactor struct {
+	rules []redactRule
+}
+
+// newRedactor 在内置规则之后追加自定义规则，正则无效时返回错误
+func newRedactor(patterns []string) (*redactor, error) {
+	r := &redactor{rules: builtinRedactRules}
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, redactRule{re: re, repl: "[REDACTED]"})
+	}
+	return r, nil
+}
+
+func (r *redactor) Redact(s string) string {
+	for _, rule := range r.rules {
+		s = rule.re.ReplaceAllString(s, rule.repl)
+	}
+	return s
+}
+
+type BodyCaptureService interface {
+	// NewCapture 按配置判断当前请求是否采集，不采集时返回nil
+	NewCapture(ctx context.Context, req any, relayType RelayType) *BodyCapture
+	// DeleteExpiredBodies 删除超过保留天数的采集内容
+	DeleteExpiredBodies(ctx context.Context) (int64, error)
+}
+
+func NewBodyCaptureService(
+	s *Service,
+	systemRepo repository.SystemRepository,
+	apiKeyRepo repository.ApiKeyRepository,
+	reqLogRepo repository.RequestLogRepository,
+) BodyCaptureService {
+	return &bodyCaptureService{
+		Service:    s,
+		systemRepo: systemRepo,
+		apiKeyRepo: apiKeyRepo,
+		reqLogRepo: reqLogRepo,
+	}
+}
+
+type bodyCaptureService struct {
+	*Service
+	systemRepo repository.SystemRepository
+	apiKeyRepo repository.ApiKeyRepository
+	reqLogRepo repository.RequestLogRepository
+}
+
+// captureSettings 采集配置解析后的结果，按 bodyCaptureCacheKey 缓存
+type captureSettings struct {
+	cfg           *dto.BodyCaptureConfig
+	redactor      *redactor
+	userIds       map[string]struct{}
+	apiKeyIds     map[string]struct{}
+	maxSize       int
+	retentionDays int
+}
+
+func toIdSet(ids []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set
+}
+
+// loadSettings 未配置或读取失败时视为关闭，同样缓存，避免每个请求都查库
+func (s *bodyCaptureService) loadSettings(ctx context.Context) *captureSettings {
+	if v, ok := s.Cache.Get(bodyCaptureCacheKey); ok {
+		return v.(*captureSettings)
+	}
+	cfg, err := s.systemRepo.GetBodyCaptureConfig(ctx)
+	if err != nil {
+		cfg = &dto.BodyCaptureConfig{}
+	}
+	rd, err := newRedactor(cfg.RedactPatterns)
+	if err != nil {
+		s.Logger.WithContext(ctx).Warn("采集配置|脱敏正则无效，只使用内置规则", zap.Error(err))
+		rd = &redactor{rules: builtinRedactRules}
+	}
+	settings := &captureSettings{
+		cfg:           cfg,
+		redactor:      rd,
+		userIds:       toIdSet(cfg.UserIds),
+		apiKeyIds:     toIdSet(cfg.ApiKeyIds),
+		maxSize:       cfg.MaxBodySize,
+		retentionDays: cfg.RetentionDays,
+	}
+	if settings.maxSize <= 0 {
+		settings.maxSize = defaultCaptureBodySize
+	}
+	settings.maxSize = min(settings.maxSize, maxCaptureBodySize)
+	if settings.retentionDays <= 0 {
+		settings.retentionDays = defaultCaptureRetentionDays
+	}
+	s.Cache.Set(bodyCaptureCacheKey, settings, time.Minute)
+	return settings
+}
+
+func captureApiKeyCacheKey(apiKey string) string {
+	return "captureApiKey:" + apiKey
+}
+
+// optedIn 当前请求的用户或key是否在采集名单中
+func (s *bodyCaptureService) optedIn(ctx context.Context, settings *captureSettings) bool {
+	if len(settings.userIds) == 0 && len(settings.apiKeyIds) == 0 {
+		return false
+	}
+	apiKey, err := GetApiKey(ctx)
+	if err != nil {
+		return false
+	}
+	var item *model.ApiKey
+	if v, ok := s.Cache.Get(captureApiKeyCacheKey(apiKey)); ok {
+		item = v.(*model.ApiKey)
+	} else {
+		item, err = s.apiKeyRepo.QueryItemByApiKey(ctx, apiKey)
+		if err != nil {
+			return false
+		}
+		s.Cache.Set(captureApiKeyCacheKey(apiKey), item, 5*time.Minute)
+	}
+	if _, ok := settings.apiKeyIds[strconv.FormatUint(item.Id, 10)]; ok {
+		return true
+	}
+	_, ok := settings.userIds[strconv.FormatUint(item.UserId, 10)]
+	return ok
+}
+
+func (s *bodyCaptureService) NewCapture(ctx context.Context, req any, relayType RelayType) *BodyCapture {
+	settings := s.loadSettings(ctx)
+	if !settings.cfg.Enable {
+		return nil
+	}
+	if !s.optedIn(ctx, settings) && (settings.cfg.SampleRate <= 0 || rand.Float64() >= settings.cfg.SampleRate) {
+		return nil
+	}
+	c := &BodyCapture{
+		maxSize:  settings.maxSize,
+		redactor: settings.redactor,
+	}
+	c.request, c.requestTruncated = captureRequestBody(req, relayType, settings.maxSize)
+	return c
+}
+
+func (s *bodyCaptureService) DeleteExpiredBodies(ctx context.Context) (int64, error) {
+	settings := s.loadSettings(ctx)
+	before := time.Now().AddDate(0, 0, -settings.retentionDays)
+	return s.reqLogRepo.DeleteRequestLogBodiesBefore(ctx, before)
+}
+
+// captureRequestBody multipart 请求带有文件，只记录说明
+func captureRequestBody(req any, relayType RelayType, maxSize int) (string, bool) {
+	switch relayType {
+	case RelayTranscriptions, RelayTranslations, RelayImageEdit, RelayImageVariations:
+		return "[multipart 请求体不记录]", false
+	}
+	var body []byte
+	switch r := req.(type) {
+	case []byte:
+		body = r
+	case *ResponsesRelayBody:
+		// 记录包含之前对话的完整请求
+		body = r.Native
+	default:
+		var err error
+		body, err = json.Marshal(req)
+		if err != nil {
+			return "[请求体序列化失败]", false
+		}
+	}
+	return truncateUTF8(string(body), maxSize)
+}
+
+// truncateUTF8 按字节截断，不切开多字节字符
+func truncateUTF8(s string, maxSize int) (string, bool) {
+	if len(s) <= maxSize {
+		return s, false
+	}
+	cut := maxSize
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut], true
+}
+
+// BodyCapture 一次请求的采集内容，请求体在创建时取得，响应体由 relayBody 在读取时写入
+// 所有方法都可以在nil上调用，不采集的请求不需要额外判断
+type BodyCapture struct {
+	maxSize           int
+	redactor          *redactor
+	request           string
+	requestTruncated  bool
+	response          bytes.Buffer
+	responseTruncated bool
+	// skipResponse 非空时不记录响应体，保存这段说明
+	skipResponse string
+	sse          *sseAssembler
+}
+
+// StartResponse 拿到上游响应头后调用，二进制响应不记录，SSE 响应拼接成完整消息
+func (c *BodyCapture) StartResponse(header http.Header, stream bool) {
+	if c == nil {
+		return
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	switch {
+	case strings.Contains(contentType, "event-stream") || (stream && contentType == ""):
+		c.sse = newSSEAssembler(c.maxSize)
+	case contentType != "" && !strings.Contains(contentType, "json") && !strings.HasPrefix(contentType, "text/"):
+		c.skipResponse = "[" + contentType + " 响应不记录]"
+	}
+}
+
+func (c *BodyCapture) Write(p []byte) {
+	if c == nil || c.skipResponse != "" {
+		return
+	}
+	if c.sse != nil {
+		c.sse.Write(p)
+		return
+	}
+	if c.responseTruncated {
+		return
+	}
+	if remain := c.maxSize - c.response.Len(); len(p) > remain {
+		p = p[:remain]
+		c.responseTruncated = true
+	}
+	c.response.Write(p)
+}
+
+// Result 脱敏后生成待写入的记录，RequestLogId 在写日志时填入
+func (c *BodyCapture) Result() *model.RequestLogBody {
+	if c == nil {
+		return nil
+	}
+	response := c.response.String()
+	responseTruncated := c.responseTruncated
+	switch {
+	case c.skipResponse != "":
+		response = c.skipResponse
+	case c.sse != nil:
+		response, responseTruncated = c.sse.Message()
+	default:
+		// 按字节截断时可能切开了最后一个字符
+		response = strings.ToValidUTF8(response, "")
+	}
+	request, reqTruncated := truncateUTF8(c.redactor.Redact(c.request), c.maxSize)
+	response, respTruncated := truncateUTF8(c.redactor.Redact(response), c.maxSize)
+	return &model.RequestLogBody{
+		RequestBody:       request,
+		ResponseBody:      response,
+		RequestTruncated:  c.requestTruncated || reqTruncated,
+		ResponseTruncated: responseTruncated || respTruncated,
+	}
+}
+
+// sseChunk chat/completions 流式响应的一个chunk，只解析拼接消息需要的字段
+type sseChunk struct {
+	Id      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index int    `json:"index"`
+		Text  string `json:"text"`
+		Delta struct {
+			Role             string `json:"role"`
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+			ToolCalls        []struct {
+				Index    int    `json:"index"`
+				Id       string `json:"id"`
+				Type     string `json:"type"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage json.RawMessage `json:"usage"`
+}
+
+type assembledToolCall struct {
+	Id       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type assembledMessage struct {
+	Role             string               `json:"role"`
+	Content          string               `json:"content"`
+	ReasoningContent string               `json:"reasoning_content,omitempty"`
+	ToolCalls        []*assembledToolCall `json:"tool_calls,omitempty"`
+}
+
+type assembledChoice struct {
+	Index        int               `json:"index"`
+	Text         string            `json:"text,omitempty"`
+	Message      *assembledMessage `json:"message,omitempty"`
+	FinishReason string            `json:"finish_reason,omitempty"`
+}
+
+type sseChoice struct {
+	text         strings.Builder
+	role         string
+	content      strings.Builder
+	reasoning    strings.Builder
+	toolCalls    map[int]*assembledToolCall
+	toolArgs     map[int]*strings.Builder
+	finishReason string
+}
+
+// sseAssembler 把流式响应的 delta 拼接成非流式响应的格式，无法识别的格式保留原文
+type sseAssembler struct {
+	maxSize   int
+	size      int
+	truncated bool
+	line      []byte
+	raw       bytes.Buffer
+	id        string
+	model     string
+	choices   map[int]*sseChoice
+	usage     json.RawMessage
+}
+
+func newSSEAssembler(maxSize int) *sseAssembler {
+	return &sseAssembler{
+		maxSize: maxSize,
+		choices: make(map[int]*sseChoice),
+	}
+}
+
+func (a *sseAssembler) Write(p []byte) {
+	if remain := a.maxSize - a.raw.Len(); remain > 0 {
+		a.raw.Write(p[:min(len(p), remain)])
+	}
+	a.line = append(a.line, p...)
+	for {
+		idx := bytes.IndexByte(a.line, '\n')
+		if idx < 0 {
+			break
+		}
+		a.parseLine(a.line[:idx])
+		a.line = a.line[idx+1:]
+	}
+	if len(a.line) > sseMaxLineSize {
+		a.line = nil
+		a.truncated = true
+	}
+}
+
+func (a *sseAssembler) parseLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, []byte("data:")) {
+		return
+	}
+	payload := bytes.TrimSpace(line[len("data:"):])
+	if len(payload) == 0 || bytes.Equal(payload, []byte("[DONE]")) {
+		return
+	}
+	var chunk sseChunk
+	if err := json.Unmarshal(payload, &chunk); err != nil {
+		return
+	}
+	if chunk.Id != "" {
+		a.id = chunk.Id
+	}
+	if chunk.Model != "" {
+		a.model = chunk.Model
+	}
+	if len(chunk.Usage) > 0 && !bytes.Equal(chunk.Usage, []byte("null")) {
+		a.usage = chunk.Usage
+	}
+	for _, c := range chunk.Choices {
+		choice, ok := a.choices[c.Index]
+		if !ok {
+			choice = &sseChoice{
+				toolCalls: make(map[int]*assembledToolCall),
+				toolArgs:  make(map[int]*strings.Builder),
+			}
+			a.choices[c.Index] = choice
+		}
+		if c.Delta.Role != "" {
+			choice.role = c.Delta.Role
+		}
+		if c.FinishReason != "" {
+			choice.finishReason = c.FinishReason
+		}
+		a.append(&choice.text, c.Text)
+		a.append(&choice.content, c.Delta.Content)
+		a.append(&choice.reasoning, c.Delta.ReasoningContent)
+		for _, tc := range c.Delta.ToolCalls {
+			call, ok := choice.toolCalls[tc.Index]
+			if !ok {
+				call = new(assembledToolCall)
+				choice.toolCalls[tc.Index] = call
+				choice.toolArgs[tc.Index] = new(strings.Builder)
+			}
+			if tc.Id != "" {
+				call.Id = tc.Id
+			}
+			if tc.Type != "" {
+				call.Type = tc.Type
+			}
+			if tc.Function.Name != "" {
+				call.Function.Name = tc.Function.Name
+			}
+			a.append(choice.toolArgs[tc.Index], tc.Function.Arguments)
+		}
+	}
+}
+
+// append 拼接的内容总长度超过 maxSize 后不再追加
+func (a *sseAssembler) append(b *strings.Builder, s string) {
+	if s == "" || a.truncated {
+		return
+	}
+	if a.size+len(s) > a.maxSize {
+		a.truncated = true
+		return
+	}
+	a.size += len(s)
+	b.WriteString(s)
+}
+
+// Message 返回拼接后的消息，没有解析到任何 choice 时返回原文
+func (a *sseAssembler) Message() (string, bool) {
+	if len(a.line) > 0 {
+		a.parseLine(a.line)
+		a.line = nil
+	}
+	if len(a.choices) == 0 {
+		return strings.ToValidUTF8(a.raw.String(), ""), a.raw.Len() >= a.maxSize
+	}
+	choices := make([]*assembledChoice, 0, len(a.choices))
+	for _, index := range slices.Sorted(maps.Keys(a.choices)) {
+		c := a.choices[index]
+		item := &assembledChoice{
+			Index:        index,
+			Text:         c.text.String(),
+			FinishReason: c.finishReason,
+		}
+		if c.role != "" || c.content.Len() > 0 || c.reasoning.Len() > 0 || len(c.toolCalls) > 0 {
+			item.Message = &assembledMessage{
+				Role:             c.role,
+				Content:          c.content.String(),
+				ReasoningContent: c.reasoning.String(),
+			}
+			for _, i := range slices.Sorted(maps.Keys(c.toolCalls)) {
+				call := c.toolCalls[i]
+				call.Function.Arguments = c.toolArgs[i].String()
+				item.Message.ToolCalls = append(item.Message.ToolCalls, call)
+			}
+		}
+		choices = append(choices, item)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(struct {
+		Id      string             `json:"id,omitempty"`
+		Model   string             `json:"model,omitempty"`
+		Choices []*assembledChoice `json:"choices"`
+		Usage   json.RawMessage    `json:"usage,omitempty"`
+	}{a.id, a.model, choices, a.usage})
+	return strings.TrimSuffix(buf.String(), "\n"), a.truncated
+}
@@ -2,13 +2,16 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	v1 "github.com/jiu-u/oai-api/api/v1"
 	"github.com/jiu-u/oai-api/internal/dto/query"
 	"github.com/jiu-u/oai-api/internal/model"
 	"github.com/jiu-u/oai-api/internal/repository"
+	"github.com/jiu-u/oai-api/pkg/datautils"
 	"go.uber.org/zap"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,18 +22,24 @@ type ChannelService interface {
 	GetChannel(ctx context.Context, channelId uint64) (*v1.ChannelResponse, error)
 	UpdateChannel(ctx context.Context, channelId uint64, req *v1.UpdateChannelRequest) error
 	UpdateChannelStatus(ctx context.Context, channelId uint64, status int8) error
+	RevealChannelKey(ctx context.Context, channelId uint64) (*v1.RevealChannelKeyResponse, error)
+	AddChannelKeys(ctx context.Context, channelId uint64, apiKeys []string) error
+	DeleteChannelKey(ctx context.Context, channelId uint64, keyId uint64) error
+	UpdateChannelKeyStatus(ctx context.Context, channelId uint64, keyId uint64, status int8) error
 }
 
 func NewChannelService(
 	srv *Service,
 	repo repository.ChannelRepository,
 	channelModelRepo repository.ChannelModelRepository,
+	channelKeyRepo repository.ChannelKeyRepository,
 	loadSvc LoadBalanceServiceBeta,
 ) ChannelService {
 	return &channelService{
 		Service:          srv,
 		repo:             repo,
 		channelModelRepo: channelModelRepo,
+		channelKeyRepo:   channelKeyRepo,
 		loadSvc:          loadSvc,
 	}
 }
@@ -39,24 +48,59 @@ type channelService struct {
 	*Service
 	repo             repository.ChannelRepository
 	channelModelRepo repository.ChannelModelRepository
+	channelKeyRepo   repository.ChannelKeyRepository
 	loadSvc          LoadBalanceServiceBeta
 }
 
+// mergeApiKeys 合并单个key与key列表，去掉空值、掩码值和重复值
+func mergeApiKeys(apiKey string, apiKeys []string) []string {
+	result := make([]string, 0, len(apiKeys)+1)
+	set := make(map[string]struct{})
+	for _, key := range append([]string{apiKey}, apiKeys...) {
+		key = strings.TrimSpace(key)
+		if key == "" || datautils.IsMaskedSecret(key) {
+			continue
+		}
+		if _, ok := set[key]; ok {
+			continue
+		}
+		set[key] = struct{}{}
+		result = append(result, key)
+	}
+	return result
+}
+
 func (s *channelService) CreateChannel(ctx context.Context, req *v1.CreateChannelRequest) (uint64, error) {
+	apiKeys := mergeApiKeys(req.APIKey, req.APIKeys)
+	if len(apiKeys) == 0 {
+		return 0, errors.New("apiKey is required")
+	}
 	id := s.Sid.GenUint64()
 	channel := &model.Channel{
-		Name:     req.Name,
-		Type:     req.Type,
-		EndPoint: req.EndPoint,
-		APIKey:   req.APIKey,
+		Name:             req.Name,
+		Type:             req.Type,
+		EndPoint:         req.EndPoint,
+		APIKey:           apiKeys[0],
+		Group:            normalizeGroup(req.Group),
+		BalanceURL:       req.BalanceURL,
+		BalancePath:      req.BalancePath,
+		BalanceThreshold: req.BalanceThreshold,
+		BalanceAction:    req.BalanceAction,
+		ResponsesAPI:     req.ResponsesAPI,
 	}
 	channel.GenerateHashId()
 	channel.Id = id
+	// key 统一保存在 channel_keys 中
+	channel.APIKey = ""
 	err := s.Tm.Transaction(ctx, func(ctx context.Context) error {
 		err := s.repo.CreateChannel(ctx, channel)
 		if err != nil {
 			return fmt.Errorf("create channel failed: %s", err)
 		}
+		err = s.createChannelKeys(ctx, channel.Id, apiKeys)
+		if err != nil {
+			return fmt.Errorf("create channel key failed: %s", err)
+		}
 		for _, modelId := range req.Models {
 			newId := s.Sid.GenUint64()
 			newModel := &model.ChannelModel{
@@ -94,19 +138,7 @@ func (s *channelService) GetChannels(ctx context.Context, req *query.ChannelQuer
 	resp.PageSize = int64(req.PageSize)
 	resp.List = make([]v1.ChannelResponse, len(channels))
 	for idx, channel := range channels {
-		resp.List[idx] = v1.ChannelResponse{
-			Id:       strconv.FormatUint(channel.Id, 10),
-			Name:     channel.Name,
-			Type:     channel.Type,
-			Balance:  channel.Balance,
-			EndPoint: channel.EndPoint,
-			APIKey:   channel.APIKey,
-			Models:   make([]string, len(channel.Models)),
-			Status:   channel.Status,
-		}
-		for jdx, modelX := range channel.Models {
-			resp.List[idx].Models[jdx] = modelX.ModelKey
-		}
+		resp.List[idx] = s.toChannelResponse(channel)
 	}
 	return resp, nil
 }
@@ -122,6 +154,10 @@ func (s *channelService) DeleteChannel(ctx context.Context, channelId uint64) er
 		if err != nil {
 			return err
 		}
+		err = s.channelKeyRepo.DeleteChannelKeysByChannelId(ctx, channelId)
+		if err != nil {
+			return err
+		}
 		return nil
 	})
 	if err != nil {
@@ -139,17 +175,7 @@ func (s *channelService) GetChannel(ctx context.Context, channelId uint64) (*v1.
 		if err != nil {
 			return err
 		}
-		resp.Models = make([]string, len(channel.Models))
-		for idx, modelX := range channel.Models {
-			resp.Models[idx] = modelX.ModelKey
-		}
-		resp.Id = strconv.FormatUint(channel.Id, 10)
-		resp.Status = channel.Status
-		resp.Name = channel.Name
-		resp.Type = channel.Type
-		resp.Balance = channel.Balance
-		resp.EndPoint = channel.EndPoint
-		resp.APIKey = channel.APIKey
+		resp = s.toChannelResponse(channel)
 		return nil
 	})
 	if err != nil {
@@ -161,20 +187,31 @@ func (s *channelService) GetChannel(ctx context.Context, channelId uint64) (*v1.
 func (s *channelService) UpdateChannel(ctx context.Context, channelId uint64, req *v1.UpdateChannelRequest) error {
 	var err error
 	var channelX *model.Channel
+	// 前端回传的掩码会被忽略，新的key追加到key池中
+	apiKeys := mergeApiKeys(req.APIKey, req.APIKeys)
 	err = s.Tm.Transaction(ctx, func(ctx context.Context) error {
 		channelX = &model.Channel{
-			Name:     req.Name,
-			Type:     req.Type,
-			EndPoint: req.EndPoint,
-			APIKey:   req.APIKey,
-			Status:   req.Status,
-			Models:   nil,
+			Name:             req.Name,
+			Type:             req.Type,
+			EndPoint:         req.EndPoint,
+			Status:           req.Status,
+			Group:            normalizeGroup(req.Group),
+			BalanceURL:       req.BalanceURL,
+			BalancePath:      req.BalancePath,
+			BalanceThreshold: req.BalanceThreshold,
+			BalanceAction:    req.BalanceAction,
+			ResponsesAPI:     req.ResponsesAPI,
+			Models:           nil,
 		}
 		channelX.Id = channelId
 		err = s.repo.UpdateChannel(ctx, channelX)
 		if err != nil {
 			return err
 		}
+		err = s.createChannelKeys(ctx, channelId, apiKeys)
+		if err != nil {
+			return err
+		}
 		channelModels := make([]*model.ChannelModel, len(req.Models))
 		for idx, modelKey := range req.Models {
 			id := s.Sid.GenUint64()
@@ -195,6 +232,11 @@ func (s *channelService) UpdateChannel(ctx context.Context, channelId uint64, re
 			}
 		}
 		if req.Status > 0 && req.Status < 3 {
+			// 手动修改状态时清空自动禁用原因
+			err = s.repo.UpdateChannelStatus(ctx, channelId, req.Status, "")
+			if err != nil {
+				return err
+			}
 			err = s.channelModelRepo.UpdateChannelModelsHardStatus(ctx, channelId, req.Status)
 			if err != nil {
 				return err
@@ -205,6 +247,11 @@ func (s *channelService) UpdateChannel(ctx context.Context, channelId uint64, re
 	if err != nil {
 		return err
 	}
+	// 重新读取完整的channel，避免负载均衡缓存中只有部分字段
+	channelX, err = s.repo.FindChannelById(ctx, channelId)
+	if err != nil {
+		return err
+	}
 	if channelX.Status == 1 {
 		_ = s.loadSvc.AddChannel(ctx, channelX)
 	} else if channelX.Status == 2 {
@@ -218,3 +265,157 @@ func (s *channelService) UpdateChannelStatus(ctx context.Context, channelId uint
 		Status: status,
 	})
 }
+
+func (s *channelService) RevealChannelKey(ctx context.Context, channelId uint64) (*v1.RevealChannelKeyResponse, error) {
+	channel, err := s.repo.FindChannelById(ctx, channelId)
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.RevealChannelKeyResponse{
+		Keys: s.toKeyResponses(channel.Keys, false),
+	}
+	if len(resp.Keys) > 0 {
+		resp.APIKey = resp.Keys[0].APIKey
+	}
+	return resp, nil
+}
+
+func (s *channelService) AddChannelKeys(ctx context.Context, channelId uint64, apiKeys []string) error {
+	apiKeys = mergeApiKeys("", apiKeys)
+	if len(apiKeys) == 0 {
+		return errors.New("apiKeys is required")
+	}
+	if _, err := s.repo.FindChannelById(ctx, channelId); err != nil {
+		return err
+	}
+	return s.Tm.Transaction(ctx, func(ctx context.Context) error {
+		return s.createChannelKeys(ctx, channelId, apiKeys)
+	})
+}
+
+func (s *channelService) DeleteChannelKey(ctx context.Context, channelId uint64, keyId uint64) error {
+	if _, err := s.findChannelKey(ctx, channelId, keyId); err != nil {
+		return err
+	}
+	return s.channelKeyRepo.DeleteChannelKeyById(ctx, keyId)
+}
+
+func (s *channelService) UpdateChannelKeyStatus(ctx context.Context, channelId uint64, keyId uint64, status int8) error {
+	if _, err := s.findChannelKey(ctx, channelId, keyId); err != nil {
+		return err
+	}
+	reason := ""
+	if status == 2 {
+		reason = "手动禁用"
+	}
+	return s.channelKeyRepo.UpdateChannelKeyStatus(ctx, keyId, status, reason)
+}
+
+func (s *channelService) findChannelKey(ctx context.Context, channelId uint64, keyId uint64) (*model.ChannelKey, error) {
+	key, err := s.channelKeyRepo.FindChannelKeyById(ctx, keyId)
+	if err != nil {
+		return nil, err
+	}
+	if key.ChannelId != channelId {
+		return nil, fmt.Errorf("channel key with Id %d not found", keyId)
+	}
+	return key, nil
+}
+
+// createChannelKeys apiKeys 为明文，加密后写入，同一渠道下重复的key会被跳过
+func (s *channelService) createChannelKeys(ctx context.Context, channelId uint64, apiKeys []string) error {
+	now := time.Now()
+	for _, apiKey := range apiKeys {
+		content, err := s.Cipher.Encrypt(apiKey)
+		if err != nil {
+			return err
+		}
+		channelKey := &model.ChannelKey{
+			Id:            s.Sid.GenUint64(),
+			ChannelId:     channelId,
+			Content:       content,
+			Status:        1,
+			CoolDownUntil: now,
+			LastUsedTime:  now,
+		}
+		channelKey.GenerateHashId(apiKey)
+		err = s.channelKeyRepo.CreateChannelKeyIfNotExists(ctx, channelKey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *channelService) toChannelResponse(channel *model.Channel) v1.ChannelResponse {
+	resp := v1.ChannelResponse{
+		Id:               strconv.FormatUint(channel.Id, 10),
+		Name:             channel.Name,
+		Type:             channel.Type,
+		Balance:          channel.Balance,
+		EndPoint:         channel.EndPoint,
+		Keys:             s.toKeyResponses(channel.Keys, true),
+		Models:           make([]string, len(channel.Models)),
+		DisabledModels:   disabledModels(channel.Models),
+		ModelLatencies:   make([]v1.ModelLatency, len(channel.Models)),
+		Status:           channel.Status,
+		DisableReason:    channel.DisableReason,
+		Group:            channel.Group,
+		BalanceURL:       channel.BalanceURL,
+		BalancePath:      channel.BalancePath,
+		BalanceThreshold: channel.BalanceThreshold,
+		BalanceAction:    channel.BalanceAction,
+		BalanceUpdatedAt: channel.BalanceUpdatedAt,
+		ResponsesAPI:     channel.ResponsesAPI,
+	}
+	if len(resp.Keys) > 0 {
+		resp.APIKey = resp.Keys[0].APIKey
+	}
+	for idx, modelX := range channel.Models {
+		resp.Models[idx] = modelX.ModelKey
+		resp.ModelLatencies[idx] = v1.ModelLatency{
+			Model:             modelX.ModelKey,
+			FirstTokenLatency: modelX.FirstTokenLatency,
+			TotalLatency:      modelX.TotalLatency,
+		}
+	}
+	return resp
+}
+
+// disabledModels 返回被硬禁用的模型及原因
+func disabledModels(models []model.ChannelModel) map[string]string {
+	result := make(map[string]string)
+	for _, modelX := range models {
+		if modelX.HardLimit == 2 {
+			result[modelX.ModelKey] = modelX.DisableReason
+		}
+	}
+	return result
+}
+
+// toKeyResponses masked 为 true 时返回掩码后的key
+func (s *channelService) toKeyResponses(keys []model.ChannelKey, masked bool) []v1.ChannelKeyResponse {
+	list := make([]v1.ChannelKeyResponse, len(keys))
+	for idx, key := range keys {
+		apiKey, err := s.Cipher.Decrypt(key.Content)
+		if err != nil {
+			s.Logger.Warn("渠道key解密失败", zap.Uint64("keyId", key.Id), zap.Error(err))
+			apiKey = ""
+		}
+		if masked {
+			apiKey = datautils.MaskSecret(apiKey)
+		}
+		list[idx] = v1.ChannelKeyResponse{
+			Id:            strconv.FormatUint(key.Id, 10),
+			APIKey:        apiKey,
+			Status:        key.Status,
+			ErrorCount:    key.ErrorCount,
+			TotalCount:    key.TotalCount,
+			Balance:       key.Balance,
+			CoolDownUntil: key.CoolDownUntil,
+			LastUsedTime:  key.LastUsedTime,
+			DisableReason: key.DisableReason,
+		}
+	}
+	return list
+}
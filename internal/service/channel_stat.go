@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"errors"
+	apiV1 "github.com/jiu-u/oai-api/api/v1"
+	"github.com/jiu-u/oai-api/internal/model"
+	"github.com/jiu-u/oai-api/internal/repository"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const defaultChannelStatWindow = "24h"
+
+// channelStatWindows 可选的统计窗口，统计按小时预聚合，窗口的开始时间向前对齐到整点
+var channelStatWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+type ChannelStatService interface {
+	// AccumulateRequestLogs 把一批日志中每次上游尝试累加到渠道模型的小时统计中
+	AccumulateRequestLogs(ctx context.Context, logs []*model.RequestLog) error
+	// GetChannelStats 所有渠道在统计窗口内的汇总
+	GetChannelStats(ctx context.Context, req *apiV1.ChannelStatsQuery) (*apiV1.ChannelStatsResponse, error)
+	// GetChannelModelStats 单个渠道的汇总和按模型的明细
+	GetChannelModelStats(ctx context.Context, channelId uint64, req *apiV1.ChannelStatsQuery) (*apiV1.ChannelModelStatsResponse, error)
+}
+
+func NewChannelStatService(
+	s *Service,
+	repo repository.ChannelStatRepository,
+	checkRepo repository.ModelCheckResultRepository,
+	channelRepo repository.ChannelRepository,
+) ChannelStatService {
+	return &channelStatService{
+		Service:     s,
+		repo:        repo,
+		checkRepo:   checkRepo,
+		channelRepo: channelRepo,
+	}
+}
+
+type channelStatService struct {
+	*Service
+	repo        repository.ChannelStatRepository
+	checkRepo   repository.ModelCheckResultRepository
+	channelRepo repository.ChannelRepository
+}
+
+type channelStatKey struct {
+	bucket    time.Time
+	channelId uint64
+	modelKey  string
+}
+
+// newAttemptStat 成功的尝试记录 token 和该次尝试的耗时，不包含之前失败的尝试，失败的尝试只按错误类型计数
+func newAttemptStat(log *model.RequestLog, attempt model.RequestAttempt, success bool) *model.ChannelStat {
+	stat := &model.ChannelStat{
+		ChannelId: attempt.ChannelId,
+		ModelKey:  attempt.UpstreamModel,
+		Attempts:  1,
+	}
+	if success {
+		stat.Successes = 1
+		stat.PromptTokens = int64(log.PromptTokens)
+		stat.CompletionTokens = int64(log.CompletionTokens)
+		stat.ObserveLatency(attempt.Latency)
+		return stat
+	}
+	switch classifyAttemptError(attempt.StatusCode, attempt.Error) {
+	case attemptErrRateLimit:
+		stat.ErrRateLimit = 1
+	case attemptErrAuth:
+		stat.ErrAuth = 1
+	case attemptErrQuota:
+		stat.ErrQuota = 1
+	case attemptErrModel:
+		stat.ErrModel = 1
+	case attemptErrTimeout:
+		stat.ErrTimeout = 1
+	case attemptErrServer:
+		stat.ErrServer = 1
+	case attemptErrClient:
+		stat.ErrClient = 1
+	default:
+		stat.ErrOther = 1
+	}
+	return stat
+}
+
+// AccumulateRequestLogs 没有选到渠道的尝试不计入，成功的请求只有最后一次尝试是成功的
+func (s *channelStatService) AccumulateRequestLogs(ctx context.Context, logs []*model.RequestLog) error {
+	merged := make(map[channelStatKey]*model.ChannelStat)
+	var stats []*model.ChannelStat
+	for _, log := range logs {
+		createdAt := log.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		bucket := statBucketTime(createdAt, model.StatPeriodHour)
+		for i, attempt := range log.Attempts {
+			if attempt.ChannelId == 0 {
+				continue
+			}
+			success := log.Status == model.RequestLogStatusSuccess && i == len(log.Attempts)-1
+			item := newAttemptStat(log, attempt, success)
+			key := channelStatKey{bucket: bucket, channelId: item.ChannelId, modelKey: item.ModelKey}
+			if stat, ok := merged[key]; ok {
+				stat.Merge(item)
+				continue
+			}
+			item.Id = s.Sid.GenUint64()
+			item.BucketTime = bucket
+			merged[key] = item
+			stats = append(stats, item)
+		}
+	}
+	if len(stats) == 0 {
+		return nil
+	}
+	return s.repo.IncrChannelStats(ctx, stats)
+}
+
+// channelStatRange 返回窗口名称和对齐到整点的时间范围
+func channelStatRange(window string) (string, time.Time, time.Time) {
+	if window == "" {
+		window = defaultChannelStatWindow
+	}
+	now := time.Now()
+	start := statBucketTime(now.Add(-channelStatWindows[window]), model.StatPeriodHour)
+	end := statBucketTime(now, model.StatPeriodHour).Add(time.Hour)
+	return window, start, end
+}
+
+func toChannelStatsItem(row *model.ChannelStat) apiV1.ChannelStatsItem {
+	item := apiV1.ChannelStatsItem{
+		ChannelId: strconv.FormatUint(row.ChannelId, 10),
+		ModelKey:  row.ModelKey,
+		Attempts:  row.Attempts,
+		Successes: row.Successes,
+		Failures:  row.Attempts - row.Successes,
+		Errors: apiV1.ChannelErrorBreakdown{
+			RateLimit: row.ErrRateLimit,
+			Auth:      row.ErrAuth,
+			Quota:     row.ErrQuota,
+			Model:     row.ErrModel,
+			Timeout:   row.ErrTimeout,
+			Server:    row.ErrServer,
+			Client:    row.ErrClient,
+			Other:     row.ErrOther,
+		},
+		PromptTokens:     row.PromptTokens,
+		CompletionTokens: row.CompletionTokens,
+	}
+	if row.Attempts > 0 {
+		item.SuccessRate = float64(row.Successes) / float64(row.Attempts)
+	}
+	// 耗时只统计成功的尝试
+	if row.Successes > 0 {
+		item.AvgLatency = row.LatencySum / row.Successes
+	}
+	item.P95Latency = latencyPercentile(histogramCounts(&row.LatencyHistogram), 0.95)
+	return item
+}
+
+// applyCheckSummary 累加检查结果，平均耗时按检查次数加权
+func applyCheckSummary(item *apiV1.ChannelStatsItem, summary *repository.ModelCheckSummary) {
+	if summary.Total == 0 {
+		return
+	}
+	durationSum := float64(item.CheckAvgLatency*item.Checks) + summary.AvgDuration*float64(summary.Total)
+	item.Checks += summary.Total
+	item.CheckSuccesses += summary.Successes
+	item.CheckSuccessRate = float64(item.CheckSuccesses) / float64(item.Checks)
+	item.CheckAvgLatency = int64(durationSum / float64(item.Checks))
+}
+
+func (s *channelStatService) GetChannelStats(ctx context.Context, req *apiV1.ChannelStatsQuery) (*apiV1.ChannelStatsResponse, error) {
+	window, start, end := channelStatRange(req.Window)
+	channels, err := s.channelRepo.FindAllChannels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.repo.FindChannelStats(ctx, &repository.ChannelStatQuery{StartTime: start, EndTime: end})
+	if err != nil {
+		return nil, err
+	}
+	checks, err := s.checkRepo.SumModelCheckResults(ctx, start, 0)
+	if err != nil {
+		return nil, err
+	}
+	rowMp := make(map[uint64]*model.ChannelStat, len(rows))
+	for _, row := range rows {
+		rowMp[row.ChannelId] = row
+	}
+	items := make(map[uint64]*apiV1.ChannelStatsItem, len(channels))
+	list := make([]apiV1.ChannelStatsItem, len(channels))
+	for i, channel := range channels {
+		row, ok := rowMp[channel.Id]
+		if !ok {
+			row = &model.ChannelStat{ChannelId: channel.Id}
+		}
+		list[i] = toChannelStatsItem(row)
+		list[i].ChannelName = channel.Name
+		items[channel.Id] = &list[i]
+	}
+	for _, check := range checks {
+		if item, ok := items[check.ChannelId]; ok {
+			applyCheckSummary(item, check)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Attempts > list[j].Attempts
+	})
+	return &apiV1.ChannelStatsResponse{
+		Window:    window,
+		StartTime: start.Format(time.DateTime),
+		List:      list,
+	}, nil
+}
+
+func (s *channelStatService) GetChannelModelStats(ctx context.Context, channelId uint64, req *apiV1.ChannelStatsQuery) (*apiV1.ChannelModelStatsResponse, error) {
+	window, start, end := channelStatRange(req.Window)
+	channel, err := s.channelRepo.FindChannelById(ctx, channelId)
+	if err != nil {
+		return nil, errors.New("渠道不存在")
+	}
+	rows, err := s.repo.FindChannelStats(ctx, &repository.ChannelStatQuery{
+		StartTime: start,
+		EndTime:   end,
+		ChannelId: channelId,
+		ByModel:   true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	checks, err := s.checkRepo.SumModelCheckResults(ctx, start, channelId)
+	if err != nil {
+		return nil, err
+	}
+	total := &model.ChannelStat{ChannelId: channelId}
+	models := make(map[string]*apiV1.ChannelStatsItem, len(rows))
+	var keys []string
+	for _, row := range rows {
+		total.Merge(row)
+		item := toChannelStatsItem(row)
+		item.ChannelName = channel.Name
+		models[row.ModelKey] = &item
+		keys = append(keys, row.ModelKey)
+	}
+	summary := toChannelStatsItem(total)
+	summary.ChannelName = channel.Name
+	// 只有检查记录没有请求的模型也要列出
+	for _, check := range checks {
+		item, ok := models[check.ModelKey]
+		if !ok {
+			empty := toChannelStatsItem(&model.ChannelStat{ChannelId: channelId, ModelKey: check.ModelKey})
+			empty.ChannelName = channel.Name
+			item = &empty
+			models[check.ModelKey] = item
+			keys = append(keys, check.ModelKey)
+		}
+		applyCheckSummary(item, check)
+		applyCheckSummary(&summary, check)
+	}
+	list := make([]apiV1.ChannelStatsItem, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, *models[key])
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Attempts != list[j].Attempts {
+			return list[i].Attempts > list[j].Attempts
+		}
+		return list[i].ModelKey < list[j].ModelKey
+	})
+	return &apiV1.ChannelModelStatsResponse{
+		Window:    window,
+		StartTime: start.Format(time.DateTime),
+		Summary:   summary,
+		Models:    list,
+	}, nil
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"github.com/jiu-u/oai-api/internal/model"
+	"strconv"
+	"strings"
+)
+
+// groupsCacheKey api key 对应分组的缓存key
+func groupsCacheKey(apiKey string) string {
+	return "api_key_groups:" + apiKey
+}
+
+// GetGroups 获取调用方可用的渠道分组，返回nil表示不按分组过滤，如模型检查等内部调用
+func GetGroups(ctx context.Context) []string {
+	groups, ok := ctx.Value("groups").([]string)
+	if !ok {
+		return nil
+	}
+	return groups
+}
+
+// normalizeGroup 规范化逗号分隔的分组，空字符串保持为空
+func normalizeGroup(group string) string {
+	if strings.TrimSpace(group) == "" {
+		return ""
+	}
+	return strings.Join(model.ParseGroups(group), ",")
+}
+
+// userGroups 用户单独指定的分组优先，其次按等级映射，都没有时为默认分组
+func userGroups(user *model.User, levelGroups map[string][]string) []string {
+	if strings.TrimSpace(user.Group) != "" {
+		return model.ParseGroups(user.Group)
+	}
+	if groups, ok := levelGroups[strconv.Itoa(user.Level)]; ok && len(groups) > 0 {
+		return model.ParseGroups(strings.Join(groups, ","))
+	}
+	return []string{model.DefaultGroup}
+}
+
+// apiKeyGroups api key 限定了分组时只能使用与用户分组的交集
+func apiKeyGroups(apiKey *model.ApiKey, groups []string) []string {
+	if strings.TrimSpace(apiKey.Group) == "" {
+		return groups
+	}
+	result := make([]string, 0)
+	for _, group := range model.ParseGroups(apiKey.Group) {
+		for _, target := range groups {
+			if group == target {
+				result = append(result, group)
+				break
+			}
+		}
+	}
+	return result
+}
@@ -3,11 +3,18 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/jiu-u/oai-api/internal/dto"
 	"github.com/jiu-u/oai-api/internal/model"
 	"github.com/jiu-u/oai-api/internal/repository"
+	"github.com/jiu-u/oai-api/pkg/array"
+	"github.com/jiu-u/oai-api/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"math/rand"
+	"net/http"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -16,34 +23,56 @@ type LoadBalanceServiceBeta interface {
 	AddChannel(ctx context.Context, channel *model.Channel) error
 	RemoveChannel(ctx context.Context, id uint64) error
 	NextChannel(ctx context.Context, modelId string) (*dto.ChannelModelConf, error)
-	SuccessCb(ctx context.Context, modelRecordId uint64) error
-	FailCb(ctx context.Context, modelRecordId uint64) error
+	SuccessCb(ctx context.Context, conf *dto.ChannelModelConf) error
+	FailCb(ctx context.Context, conf *dto.ChannelModelConf, upstreamErr error) error
+	PickChannelKey(ctx context.Context, channelId uint64) (*model.ChannelKey, error)
 	ChangeModelMapping(ctx context.Context, modelMapping map[string][]string)
 	RecoverChannelModels(ctx context.Context) error
-	GetModelMappingKeys() []string
+	GetModelMapping() map[string][]string
+	IsConfiguredModel(ctx context.Context, modelId string) bool
+	FindGroupModelIds(ctx context.Context, groups []string) ([]string, error)
 }
 
-func NewLoadBalanceServiceBeta(service *Service, channelRepo repository.ChannelRepository, channelModelRepo repository.ChannelModelRepository) LoadBalanceServiceBeta {
+func NewLoadBalanceServiceBeta(
+	service *Service,
+	channelRepo repository.ChannelRepository,
+	channelModelRepo repository.ChannelModelRepository,
+	channelKeyRepo repository.ChannelKeyRepository,
+	notifySvc NotifyService,
+) LoadBalanceServiceBeta {
 	return &loadBalanceServiceBeta{
 		Service:          service,
 		channelRepo:      channelRepo,
 		channelModelRepo: channelModelRepo,
+		channelKeyRepo:   channelKeyRepo,
+		notifySvc:        notifySvc,
 		ChannelMap:       make(map[uint64]*model.Channel),
 		ModelMapping:     make(map[string][]string),
 		RecoverInterval:  5 * time.Minute,
+		KeyCoolDown:      30 * time.Second,
 		once:             &sync.Once{},
 		mu:               &sync.RWMutex{},
 	}
 }
 
+const (
+	// modelUnavailableCacheKey 模型不可用告警的检查间隔，后面拼接模型名
+	modelUnavailableCacheKey = "modelUnavailable_"
+	// configuredModelsCacheKey 渠道中配置的模型集合，缓存一分钟
+	configuredModelsCacheKey = "configuredModelIds"
+)
+
 type loadBalanceServiceBeta struct {
 	*Service
 	mu               *sync.RWMutex
 	channelRepo      repository.ChannelRepository
 	channelModelRepo repository.ChannelModelRepository
+	channelKeyRepo   repository.ChannelKeyRepository
+	notifySvc        NotifyService
 	ChannelMap       map[uint64]*model.Channel
 	ModelMapping     map[string][]string
 	RecoverInterval  time.Duration
+	KeyCoolDown      time.Duration
 	once             *sync.Once
 }
 
@@ -75,7 +104,26 @@ func (s *loadBalanceServiceBeta) loadProviderData() {
 	s.ChannelMap = mp
 }
 
+// NextChannel 每次选择渠道都记录一个span，便于排查请求为什么落到了某个渠道
 func (s *loadBalanceServiceBeta) NextChannel(ctx context.Context, modelId string) (*dto.ChannelModelConf, error) {
+	ctx, span := tracing.Start(ctx, "loadbalance.NextChannel", trace.WithAttributes(attribute.String("relay.model", modelId)))
+	defer span.End()
+	conf, err := s.nextChannel(ctx, modelId)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.Int64("channel.id", int64(conf.ChannelId)),
+		attribute.String("channel.name", conf.ChannelName),
+		attribute.Int64("channel.key_id", int64(conf.ChannelKeyId)),
+		attribute.String("relay.upstream_model", conf.ModelKey),
+		attribute.Int("channel.weight", conf.Weight),
+	)
+	return conf, nil
+}
+
+func (s *loadBalanceServiceBeta) nextChannel(ctx context.Context, modelId string) (*dto.ChannelModelConf, error) {
 	s.once.Do(s.loadProviderData)
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -84,21 +132,40 @@ func (s *loadBalanceServiceBeta) NextChannel(ctx context.Context, modelId string
 	result, err := s.channelModelRepo.FindUsefulChannelModels(ctx, models)
 	if err != nil || len(result) == 0 {
 		s.Logger.WithContext(ctx).Warn("no available provider", zap.Error(err))
+		if err == nil {
+			s.alertModelUnavailable(ctx, modelId, models)
+		}
+		return nil, errors.New("no available provider")
+	}
+	// 过滤掉没有可用key的渠道
+	keyMap, err := s.findUsefulKeys(ctx, array.Map(result, func(item *model.ChannelModel) uint64 {
+		return item.ChannelId
+	}))
+	if err != nil {
+		s.Logger.WithContext(ctx).Warn("find channel keys failed", zap.Error(err))
 		return nil, errors.New("no available provider")
 	}
+	// 只在调用方有权使用的分组内选择渠道
+	groups := GetGroups(ctx)
+	result = array.Filter(result, func(item *model.ChannelModel) bool {
+		return len(keyMap[item.ChannelId]) > 0 && s.channelInGroups(item.ChannelId, groups)
+	})
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("loadbalance.candidates", len(result)))
 	// 随机负载均衡
 	// 随机选择一个channel
 	totalWeight := 0
-	for _, item := range result {
-		totalWeight += item.Weight
+	weights := make([]int, len(result))
+	for i, item := range result {
+		weights[i] = s.effectiveWeight(item)
+		totalWeight += weights[i]
 	}
 	if totalWeight == 0 {
 		return nil, errors.New("no available provider")
 	}
 	idx := 0
 	randomWeight := rand.Intn(totalWeight)
-	for i, item := range result {
-		randomWeight -= item.Weight
+	for i := range result {
+		randomWeight -= weights[i]
 		if randomWeight < 0 {
 			idx = i
 			break
@@ -109,26 +176,228 @@ func (s *loadBalanceServiceBeta) NextChannel(ctx context.Context, modelId string
 	if channel == nil {
 		return nil, errors.New("channel is nil")
 	}
+	// 渠道内随机选择一个可用key
+	keys := keyMap[selected.ChannelId]
+	key := keys[rand.Intn(len(keys))]
 	return &dto.ChannelModelConf{
 		ChannelId:       selected.ChannelId,
 		ChannelName:     channel.Name,
 		ChannelType:     channel.Type,
-		ChannelKey:      channel.APIKey,
+		ChannelKey:      key.Content,
+		ChannelKeyId:    key.Id,
 		ChannelEndPoint: channel.EndPoint,
 		ModelRecordId:   selected.Id,
 		ModelKey:        selected.ModelKey,
 		ModelId:         selected.ModelKey,
 		Weight:          selected.Weight,
+		ResponsesAPI:    channel.ResponsesAPI == 1,
 	}, nil
 
 }
 
-func (s *loadBalanceServiceBeta) SuccessCb(ctx context.Context, modelRecordId uint64) error {
-	return s.channelModelRepo.InCrChannelModelWeight(ctx, modelRecordId)
+// channelInGroups groups 为nil时不按分组过滤
+func (s *loadBalanceServiceBeta) channelInGroups(channelId uint64, groups []string) bool {
+	if groups == nil {
+		return true
+	}
+	channel := s.ChannelMap[channelId]
+	return channel != nil && channel.InGroups(groups)
+}
+
+// FindGroupModelIds 查询分组内渠道可用的模型，groups 为nil时返回所有可用模型
+func (s *loadBalanceServiceBeta) FindGroupModelIds(ctx context.Context, groups []string) ([]string, error) {
+	if groups == nil {
+		return s.channelModelRepo.FindAllChannelModelIds(ctx)
+	}
+	s.once.Do(s.loadProviderData)
+	list, err := s.channelModelRepo.FindAllChannelModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	modelIds := make([]string, 0)
+	set := make(map[string]struct{})
+	for _, item := range list {
+		if item.SoftLimit != 1 || item.HardLimit != 1 || !s.channelInGroups(item.ChannelId, groups) {
+			continue
+		}
+		if _, ok := set[item.ModelKey]; ok {
+			continue
+		}
+		set[item.ModelKey] = struct{}{}
+		modelIds = append(modelIds, item.ModelKey)
+	}
+	return modelIds, nil
+}
+
+// effectiveWeight 余额低于阈值且配置为降权的渠道，权重降为1
+func (s *loadBalanceServiceBeta) effectiveWeight(item *model.ChannelModel) int {
+	channel := s.ChannelMap[item.ChannelId]
+	if channel != nil && item.Weight > 1 && channel.BalanceAction == model.BalanceActionDeprioritize && channel.BalanceLow() {
+		return 1
+	}
+	return item.Weight
+}
+
+func (s *loadBalanceServiceBeta) findUsefulKeys(ctx context.Context, channelIds []uint64) (map[uint64][]*model.ChannelKey, error) {
+	keyMap := make(map[uint64][]*model.ChannelKey)
+	if len(channelIds) == 0 {
+		return keyMap, nil
+	}
+	keys, err := s.channelKeyRepo.FindUsefulChannelKeys(ctx, channelIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		keyMap[key.ChannelId] = append(keyMap[key.ChannelId], key)
+	}
+	return keyMap, nil
+}
+
+// alertModelUnavailable 只对配置过的模型告警，用户随意填写的模型名不会触发
+// 同一个模型一分钟内只检查一次，避免没有渠道的模型每次请求都查库和告警
+func (s *loadBalanceServiceBeta) alertModelUnavailable(ctx context.Context, modelId string, models []string) {
+	cacheKey := modelUnavailableCacheKey + modelId
+	if _, ok := s.Cache.Get(cacheKey); ok {
+		return
+	}
+	s.Cache.Set(cacheKey, struct{}{}, time.Minute)
+	count, err := s.channelModelRepo.CountChannelModels(ctx, models)
+	if err != nil || count == 0 {
+		return
+	}
+	s.notifySvc.Alert(ctx, &AlertEvent{
+		Type:  AlertEventModelUnavailable,
+		Level: AlertLevelCritical,
+		Key:   modelId,
+		Title: "模型的所有渠道均不可用",
+		Fields: []AlertField{
+			{Name: "模型", Value: modelId},
+			{Name: "渠道模型数", Value: strconv.FormatInt(count, 10)},
+		},
+	})
+}
+
+// PickChannelKey 为指定渠道挑选一个可用key，供模型检查等不经过NextChannel的场景使用
+func (s *loadBalanceServiceBeta) PickChannelKey(ctx context.Context, channelId uint64) (*model.ChannelKey, error) {
+	keyMap, err := s.findUsefulKeys(ctx, []uint64{channelId})
+	if err != nil {
+		return nil, err
+	}
+	keys := keyMap[channelId]
+	if len(keys) == 0 {
+		return nil, errors.New("no available channel key")
+	}
+	return keys[rand.Intn(len(keys))], nil
+}
+
+func (s *loadBalanceServiceBeta) SuccessCb(ctx context.Context, conf *dto.ChannelModelConf) error {
+	err := s.channelModelRepo.InCrChannelModelWeight(ctx, conf.ModelRecordId)
+	if err != nil {
+		return err
+	}
+	return s.channelKeyRepo.MarkChannelKeySuccess(ctx, conf.ChannelKeyId)
 }
 
-func (s *loadBalanceServiceBeta) FailCb(ctx context.Context, modelRecordId uint64) error {
-	return s.channelModelRepo.DecrChannelModelWeight(ctx, modelRecordId)
+// FailCb 临时错误降低模型权重并让key冷却，致命错误直接硬禁用key、渠道或渠道模型
+func (s *loadBalanceServiceBeta) FailCb(ctx context.Context, conf *dto.ChannelModelConf, upstreamErr error) error {
+	level, reason := ClassifyUpstreamError(upstreamErr)
+	switch level {
+	case UpstreamErrKeyFatal:
+		return s.disableChannelKey(ctx, conf, reason, upstreamErr)
+	case UpstreamErrModelFatal:
+		err := s.channelModelRepo.DisableChannelModel(ctx, conf.ModelRecordId, reason)
+		if err != nil {
+			return err
+		}
+		s.notifySvc.Alert(ctx, &AlertEvent{
+			Type:   AlertEventChannelModelDisabled,
+			Level:  AlertLevelCritical,
+			Key:    strconv.FormatUint(conf.ModelRecordId, 10),
+			Title:  "渠道模型已被自动禁用",
+			Fields: disableAlertFields(conf, reason, upstreamErr),
+		})
+		return nil
+	}
+	coolDown := s.KeyCoolDown
+	if UpstreamStatusCode(upstreamErr) == http.StatusTooManyRequests {
+		coolDown = 2 * s.KeyCoolDown
+	}
+	err := s.channelKeyRepo.MarkChannelKeyFail(ctx, conf.ChannelKeyId, coolDown)
+	if err != nil {
+		return err
+	}
+	err = s.channelModelRepo.DecrChannelModelWeight(ctx, conf.ModelRecordId)
+	if err != nil {
+		return err
+	}
+	channelModel, err := s.channelModelRepo.FindChannelModelById(ctx, conf.ModelRecordId)
+	if err == nil && channelModel.SoftLimit == 2 {
+		s.notifySvc.Alert(ctx, &AlertEvent{
+			Type:   AlertEventChannelModelSoftLimited,
+			Level:  AlertLevelWarning,
+			Key:    strconv.FormatUint(conf.ModelRecordId, 10),
+			Title:  "渠道模型连续失败，已被暂时停用",
+			Fields: disableAlertFields(conf, reason, upstreamErr),
+		})
+	}
+	return nil
+}
+
+// disableChannelKey 禁用key，渠道下没有启用的key时硬禁用整个渠道
+func (s *loadBalanceServiceBeta) disableChannelKey(ctx context.Context, conf *dto.ChannelModelConf, reason string, upstreamErr error) error {
+	err := s.channelKeyRepo.UpdateChannelKeyStatus(ctx, conf.ChannelKeyId, 2, reason)
+	if err != nil {
+		return err
+	}
+	count, err := s.channelKeyRepo.CountEnabledChannelKeys(ctx, conf.ChannelId)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		s.notifySvc.Alert(ctx, &AlertEvent{
+			Type:   AlertEventChannelKeyDisabled,
+			Level:  AlertLevelCritical,
+			Key:    strconv.FormatUint(conf.ChannelKeyId, 10),
+			Title:  "渠道key已被自动禁用",
+			Fields: disableAlertFields(conf, reason, upstreamErr),
+		})
+		return nil
+	}
+	err = s.Tm.Transaction(ctx, func(ctx context.Context) error {
+		err := s.channelRepo.UpdateChannelStatus(ctx, conf.ChannelId, 2, "所有key已失效: "+reason)
+		if err != nil {
+			return err
+		}
+		return s.channelModelRepo.UpdateChannelModelsHardStatus(ctx, conf.ChannelId, 2)
+	})
+	if err != nil {
+		return err
+	}
+	_ = s.RemoveChannel(ctx, conf.ChannelId)
+	s.notifySvc.Alert(ctx, &AlertEvent{
+		Type:   AlertEventChannelDisabled,
+		Level:  AlertLevelCritical,
+		Key:    strconv.FormatUint(conf.ChannelId, 10),
+		Title:  "渠道已被自动禁用",
+		Fields: disableAlertFields(conf, "所有key已失效: "+reason, upstreamErr),
+	})
+	return nil
+}
+
+func disableAlertFields(conf *dto.ChannelModelConf, reason string, upstreamErr error) []AlertField {
+	detail := upstreamErr.Error()
+	if len(detail) > 500 {
+		detail = detail[:500]
+	}
+	return []AlertField{
+		{Name: "渠道", Value: fmt.Sprintf("%s(%d)", conf.ChannelName, conf.ChannelId)},
+		{Name: "key", Value: strconv.FormatUint(conf.ChannelKeyId, 10)},
+		{Name: "模型", Value: conf.ModelKey},
+		{Name: "原因", Value: reason},
+		{Name: "上游错误", Value: detail},
+	}
 }
 
 func (s *loadBalanceServiceBeta) ChangeModelMapping(ctx context.Context, modelMapping map[string][]string) {
@@ -141,12 +410,38 @@ func (s *loadBalanceServiceBeta) RecoverChannelModels(ctx context.Context) error
 	return s.channelModelRepo.RestoreChannelModel(ctx)
 }
 
-func (s *loadBalanceServiceBeta) GetModelMappingKeys() []string {
+// GetModelMapping 返回模型映射的副本，key为别名，value为实际请求的模型
+func (s *loadBalanceServiceBeta) GetModelMapping() map[string][]string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	keys := make([]string, 0, len(s.ModelMapping))
-	for k := range s.ModelMapping {
-		keys = append(keys, k)
+	mapping := make(map[string][]string, len(s.ModelMapping))
+	for k, v := range s.ModelMapping {
+		mapping[k] = append([]string(nil), v...)
+	}
+	return mapping
+}
+
+// IsConfiguredModel 模型是否在渠道或模型映射中配置过，用于限制指标 model 标签的取值
+func (s *loadBalanceServiceBeta) IsConfiguredModel(ctx context.Context, modelId string) bool {
+	s.mu.RLock()
+	_, ok := s.ModelMapping[modelId]
+	s.mu.RUnlock()
+	if ok {
+		return true
+	}
+	if v, ok := s.Cache.Get(configuredModelsCacheKey); ok {
+		_, ok = v.(map[string]struct{})[modelId]
+		return ok
+	}
+	modelIds, err := s.channelModelRepo.FindAllChannelModelIds(ctx)
+	if err != nil {
+		return false
+	}
+	set := make(map[string]struct{}, len(modelIds))
+	for _, id := range modelIds {
+		set[id] = struct{}{}
 	}
-	return keys
+	s.Cache.Set(configuredModelsCacheKey, set, time.Minute)
+	_, ok = set[modelId]
+	return ok
 }
@@ -2,32 +2,93 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	adapterApi "github.com/jiu-u/oai-adapter/api"
+	v1 "github.com/jiu-u/oai-api/api/v1"
 	"github.com/jiu-u/oai-api/internal/dto"
 	"github.com/jiu-u/oai-api/internal/model"
 	"github.com/jiu-u/oai-api/internal/repository"
 	"go.uber.org/zap"
-	"io"
+	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	defaultCheckPrompt    = "hello,测试!"
+	defaultCheckMaxTokens = 10
+	defaultCheckTimeout   = 30 * time.Second
+	// maxCheckErrorDetail 检查记录中错误详情的最大长度
+	maxCheckErrorDetail = 2000
+	// 批量检查的默认并发数和最大并发数
+	defaultBatchCheckConcurrency = 4
+	maxBatchCheckConcurrency     = 16
+)
+
+// CheckProbeError 探测请求已经发到上游并失败，区别于挑选key、查询渠道等检查前的错误
+type CheckProbeError struct {
+	Err        error
+	StatusCode int
+}
+
+func (e *CheckProbeError) Error() string {
+	return "请求失败: " + e.Err.Error()
+}
+
+func (e *CheckProbeError) Unwrap() error {
+	return e.Err
+}
+
+// modelAtFault 失败是否归因于模型本身: 模型不存在(已由 FailCb 禁用)、不可重试的4xx或上游返回了无效的响应
+// 限流、5xx、超时、网络错误以及key失效都不算，不应该禁用模型
+func (e *CheckProbeError) modelAtFault() bool {
+	level, _ := ClassifyUpstreamError(e)
+	switch level {
+	case UpstreamErrModelFatal:
+		return true
+	case UpstreamErrKeyFatal:
+		return false
+	}
+	msg := strings.ToLower(e.Err.Error())
+	for _, keyword := range timeoutKeywords {
+		if strings.Contains(msg, keyword) {
+			return false
+		}
+	}
+	switch {
+	case e.StatusCode == http.StatusOK:
+		return true
+	case e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests:
+		return false
+	}
+	return e.StatusCode >= 400 && e.StatusCode < 500
+}
+
 type ModelCheckService interface {
-	CheckModel(ctx context.Context, conf *dto.ChannelModelConf) (*dto.ModelCheckResult, error)
+	CheckModel(ctx context.Context, conf *dto.ChannelModelConf, opts *dto.CheckOptions) (*dto.ModelCheckResult, error)
 	CheckModel2(ctx context.Context, channelId uint64, modelId string) (*dto.ModelCheckResult, error)
+	CheckChannelModel(ctx context.Context, item *model.ChannelModel, opts *dto.CheckOptions) (*dto.ModelCheckResult, error)
+	GetCheckOptions(ctx context.Context, source string) *dto.CheckOptions
+	GetCheckHistory(ctx context.Context, channelId uint64, req *v1.ModelCheckHistoryRequest) ([]v1.ModelCheckRecord, error)
+	CheckChannelModels(ctx context.Context, channelId uint64, req *v1.BatchCheckModelRequest) (<-chan v1.BatchCheckModelResult, error)
 }
 
 func NewModelCheckService(
 	s *Service,
 	channelRepo repository.ChannelRepository,
 	channelModelRepo repository.ChannelModelRepository,
+	checkResultRepo repository.ModelCheckResultRepository,
+	systemRepo repository.SystemRepository,
 	lbSvc LoadBalanceServiceBeta,
 ) ModelCheckService {
 	return &modelCheckService{
 		Service:          s,
 		channelRepo:      channelRepo,
 		channelModelRepo: channelModelRepo,
+		checkResultRepo:  checkResultRepo,
+		systemRepo:       systemRepo,
 		lbSvc:            lbSvc,
 	}
 }
@@ -37,13 +98,43 @@ type modelCheckService struct {
 	lbSvc            LoadBalanceServiceBeta
 	channelRepo      repository.ChannelRepository
 	channelModelRepo repository.ChannelModelRepository
+	checkResultRepo  repository.ModelCheckResultRepository
+	systemRepo       repository.SystemRepository
 }
 
-func (s *modelCheckService) CheckModel2(ctx context.Context, channelId uint64, modelId string) (*dto.ModelCheckResult, error) {
-	channelX, err := s.channelRepo.FindChannelById(ctx, channelId)
+// NewCheckOptions 根据模型配置生成检查参数，未配置的项使用默认值
+func NewCheckOptions(cfg *dto.ModelConfig, source string) *dto.CheckOptions {
+	opts := &dto.CheckOptions{
+		Prompt:    defaultCheckPrompt,
+		MaxTokens: defaultCheckMaxTokens,
+		Timeout:   defaultCheckTimeout,
+		Source:    source,
+	}
+	if cfg == nil {
+		return opts
+	}
+	if cfg.CheckPrompt != "" {
+		opts.Prompt = cfg.CheckPrompt
+	}
+	if cfg.CheckMaxTokens > 0 {
+		opts.MaxTokens = cfg.CheckMaxTokens
+	}
+	if cfg.CheckTimeout > 0 {
+		opts.Timeout = time.Duration(cfg.CheckTimeout) * time.Second
+	}
+	opts.Capabilities = cfg.ModelCapabilities
+	return opts
+}
+
+func (s *modelCheckService) GetCheckOptions(ctx context.Context, source string) *dto.CheckOptions {
+	cfg, err := s.systemRepo.GetModelConfig(ctx)
 	if err != nil {
-		return nil, err
+		return NewCheckOptions(nil, source)
 	}
+	return NewCheckOptions(cfg, source)
+}
+
+func (s *modelCheckService) CheckModel2(ctx context.Context, channelId uint64, modelId string) (*dto.ModelCheckResult, error) {
 	modelX, err := s.channelModelRepo.ExistsChannelModel(ctx, &model.ChannelModel{
 		ChannelId: channelId,
 		ModelKey:  modelId,
@@ -51,67 +142,212 @@ func (s *modelCheckService) CheckModel2(ctx context.Context, channelId uint64, m
 	if err != nil {
 		return nil, err
 	}
+	if modelX == nil {
+		return nil, fmt.Errorf("渠道下不存在模型: %s", modelId)
+	}
+	return s.CheckChannelModel(ctx, modelX, s.GetCheckOptions(ctx, model.CheckSourceManual))
+}
+
+// CheckChannelModel 为渠道模型挑选一个可用key后进行检查
+func (s *modelCheckService) CheckChannelModel(ctx context.Context, item *model.ChannelModel, opts *dto.CheckOptions) (*dto.ModelCheckResult, error) {
+	channelX, err := s.channelRepo.FindChannelById(ctx, item.ChannelId)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.lbSvc.PickChannelKey(ctx, item.ChannelId)
+	if err != nil {
+		return nil, err
+	}
 	conf := &dto.ChannelModelConf{
-		ChannelId:       channelId,
+		ChannelId:       item.ChannelId,
 		ChannelName:     channelX.Name,
 		ChannelType:     channelX.Type,
-		ChannelKey:      channelX.APIKey,
+		ChannelKey:      key.Content,
+		ChannelKeyId:    key.Id,
 		ChannelEndPoint: channelX.EndPoint,
-		ModelRecordId:   modelX.Id,
-		ModelKey:        modelId,
-		ModelId:         modelId,
-		Weight:          10,
+		ModelRecordId:   item.Id,
+		ModelKey:        item.ModelKey,
+		ModelId:         item.ModelKey,
+		Weight:          item.Weight,
 	}
-	return s.CheckModel(ctx, conf)
+	return s.CheckModel(ctx, conf, opts)
 }
 
-func (s *modelCheckService) CheckModel(ctx context.Context, conf *dto.ChannelModelConf) (*dto.ModelCheckResult, error) {
-	startTime := time.Now()
-	adapterX, err := NewOAIAdapter(conf)
+// CheckModel 按模型能力选择探测请求，每次检查都会记录到 model_check_results
+// ctx 被取消时（如服务停止）不记录结果，也不更新模型状态
+func (s *modelCheckService) CheckModel(ctx context.Context, conf *dto.ChannelModelConf, opts *dto.CheckOptions) (*dto.ModelCheckResult, error) {
+	if opts == nil {
+		opts = NewCheckOptions(nil, model.CheckSourceManual)
+	}
+	adapterX, err := NewOAIAdapter(conf, s.Cipher)
 	if err != nil {
 		return nil, fmt.Errorf("创建provider失败: %s", err.Error())
 	}
-	body, _, err := adapterX.ChatCompletions(ctx, &adapterApi.ChatRequest{
-		Model: conf.ModelKey,
-		Messages: []adapterApi.Message{
-			{
-				Role:    "user",
-				Content: []byte(`"hello,测试!"`),
-			},
-		},
-		Stream:    true,
-		MaxTokens: 10,
-	})
-	if err != nil {
-		go func() {
-			err := s.lbSvc.FailCb(ctx, conf.ModelRecordId)
-			if err != nil {
-				s.Logger.Warn("failCb失败", zap.Error(err))
-			}
-		}()
-		if body != nil {
-			bodyDetail, err2 := io.ReadAll(body)
-			if err2 == nil {
-				err = fmt.Errorf("请求失败: %s", string(bodyDetail))
-				return nil, err
-			}
-		}
-		return nil, fmt.Errorf("请求失败: %s", err.Error())
-
+	record := &model.ModelCheckResult{
+		Id:            s.Sid.GenUint64(),
+		ChannelId:     conf.ChannelId,
+		ChannelKeyId:  conf.ChannelKeyId,
+		ModelRecordId: conf.ModelRecordId,
+		ModelKey:      conf.ModelKey,
+		Source:        opts.Source,
+		Capability:    model.DetectModelCapability(conf.ModelKey, opts.Capabilities),
 	}
-	defer body.Close()
-	duration := time.Since(startTime)
-	go func() {
-		err := s.lbSvc.SuccessCb(ctx, conf.ModelRecordId)
-		if err != nil {
-			s.Logger.Warn("successCb失败", zap.Error(err))
+	probeErr := s.probe(ctx, adapterX, conf, opts, record)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if probeErr != nil {
+		record.Status = 2
+		record.ErrorDetail, _ = truncateUTF8(probeErr.Error(), maxCheckErrorDetail)
+		if record.StatusCode == 0 {
+			record.StatusCode = UpstreamStatusCode(probeErr)
 		}
-	}()
+		s.saveCheckResult(ctx, record)
+		checkErr := &CheckProbeError{Err: probeErr, StatusCode: record.StatusCode}
+		// 标记模型不可用，探测确认的致命错误会直接禁用
+		if err := s.lbSvc.FailCb(ctx, conf, checkErr); err != nil {
+			s.Logger.WithContext(ctx).Warn("failCb失败", zap.Error(err))
+		}
+		return nil, checkErr
+	}
+	record.Status = 1
+	s.saveCheckResult(ctx, record)
+	err = s.channelModelRepo.UpdateChannelModelLatency(ctx, conf.ModelRecordId, record.FirstTokenDuration, record.TotalDuration)
+	if err != nil {
+		s.Logger.WithContext(ctx).Warn("更新模型延迟失败", zap.Error(err))
+	}
+	if err := s.lbSvc.SuccessCb(ctx, conf); err != nil {
+		s.Logger.WithContext(ctx).Warn("successCb失败", zap.Error(err))
+	}
 	return &dto.ModelCheckResult{
 		ChannelId:          strconv.FormatUint(conf.ChannelId, 10),
 		ModelName:          conf.ModelKey,
-		ConnectionDuration: int64(duration.Milliseconds()),
-		TotalDuration:      int64(duration.Milliseconds()),
+		ConnectionDuration: record.ConnectDuration,
+		FirstTokenDuration: record.FirstTokenDuration,
+		TotalDuration:      record.TotalDuration,
+		StatusCode:         record.StatusCode,
+		Capability:         record.Capability,
 		Status:             1,
 	}, nil
 }
+
+func (s *modelCheckService) saveCheckResult(ctx context.Context, record *model.ModelCheckResult) {
+	record.CreatedAt = time.Now()
+	if err := s.checkResultRepo.CreateModelCheckResult(ctx, record); err != nil {
+		s.Logger.WithContext(ctx).Warn("保存模型检查结果失败", zap.Error(err))
+	}
+}
+
+func (s *modelCheckService) GetCheckHistory(ctx context.Context, channelId uint64, req *v1.ModelCheckHistoryRequest) ([]v1.ModelCheckRecord, error) {
+	limit := req.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	list, err := s.checkResultRepo.FindModelCheckResults(ctx, channelId, req.Model, limit)
+	if err != nil {
+		return nil, err
+	}
+	resp := make([]v1.ModelCheckRecord, len(list))
+	for idx, item := range list {
+		resp[idx] = v1.ModelCheckRecord{
+			Id:                 strconv.FormatUint(item.Id, 10),
+			ChannelKeyId:       strconv.FormatUint(item.ChannelKeyId, 10),
+			Model:              item.ModelKey,
+			Source:             item.Source,
+			Capability:         item.Capability,
+			Status:             item.Status,
+			StatusCode:         item.StatusCode,
+			ConnectDuration:    item.ConnectDuration,
+			FirstTokenDuration: item.FirstTokenDuration,
+			TotalDuration:      item.TotalDuration,
+			ErrorDetail:        item.ErrorDetail,
+			CreatedAt:          item.CreatedAt,
+		}
+	}
+	return resp, nil
+}
+
+// CheckChannelModels 并发检查渠道下的模型，结果按完成顺序写入返回的channel，全部完成后关闭
+// ctx 取消后不再发起新的检查
+func (s *modelCheckService) CheckChannelModels(ctx context.Context, channelId uint64, req *v1.BatchCheckModelRequest) (<-chan v1.BatchCheckModelResult, error) {
+	channelX, err := s.channelRepo.FindChannelById(ctx, channelId)
+	if err != nil {
+		return nil, err
+	}
+	modelMap := make(map[string]*model.ChannelModel, len(channelX.Models))
+	for idx := range channelX.Models {
+		modelMap[channelX.Models[idx].ModelKey] = &channelX.Models[idx]
+	}
+	modelKeys := req.Models
+	if len(modelKeys) == 0 {
+		modelKeys = make([]string, 0, len(channelX.Models))
+		for _, item := range channelX.Models {
+			modelKeys = append(modelKeys, item.ModelKey)
+		}
+	}
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchCheckConcurrency
+	}
+	concurrency = min(concurrency, maxBatchCheckConcurrency)
+	opts := s.GetCheckOptions(ctx, model.CheckSourceBatch)
+	results := make(chan v1.BatchCheckModelResult, len(modelKeys))
+	go func() {
+		defer close(results)
+		sem := make(chan struct{}, concurrency)
+		wg := sync.WaitGroup{}
+		for _, modelKey := range modelKeys {
+			item, ok := modelMap[modelKey]
+			if !ok {
+				results <- v1.BatchCheckModelResult{Model: modelKey, Status: 2, Error: fmt.Sprintf("渠道下不存在模型: %s", modelKey)}
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				wg.Wait()
+				return
+			case sem <- struct{}{}:
+			}
+			wg.Add(1)
+			go func(item *model.ChannelModel) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results <- s.batchCheckModel(ctx, item, opts, req.DisableFailed)
+			}(item)
+		}
+		wg.Wait()
+	}()
+	return results, nil
+}
+
+func (s *modelCheckService) batchCheckModel(ctx context.Context, item *model.ChannelModel, opts *dto.CheckOptions, disableFailed bool) v1.BatchCheckModelResult {
+	result := v1.BatchCheckModelResult{
+		Model:      item.ModelKey,
+		Capability: model.DetectModelCapability(item.ModelKey, opts.Capabilities),
+	}
+	checkResult, err := s.CheckChannelModel(ctx, item, opts)
+	if err == nil {
+		result.Status = 1
+		result.ConnectionDuration = checkResult.ConnectionDuration
+		result.FirstTokenDuration = checkResult.FirstTokenDuration
+		result.TotalDuration = checkResult.TotalDuration
+		return result
+	}
+	result.Status = 2
+	result.Error = err.Error()
+	// 只禁用探测失败且归因于模型的，挑选key失败、查库失败和取消检查时不禁用
+	var probeErr *CheckProbeError
+	if !disableFailed || ctx.Err() != nil || !errors.As(err, &probeErr) || !probeErr.modelAtFault() {
+		return result
+	}
+	reason := "批量检查失败: " + result.Error
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	if err = s.channelModelRepo.DisableChannelModel(ctx, item.Id, strings.ToValidUTF8(reason, "")); err != nil {
+		s.Logger.WithContext(ctx).Warn("批量检查|禁用模型失败", zap.Uint64("modelRecordId", item.Id), zap.Error(err))
+		return result
+	}
+	result.Disabled = true
+	return result
+}
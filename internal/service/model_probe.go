@@ -0,0 +1,260 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/bytedance/sonic"
+	adapter "github.com/jiu-u/oai-adapter"
+	adapterApi "github.com/jiu-u/oai-adapter/api"
+	"github.com/jiu-u/oai-api/internal/dto"
+	"github.com/jiu-u/oai-api/internal/model"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	probeEmbeddingInput = "hi"
+	probeSpeechInput    = "hi"
+	probeImagePrompt    = "a small red dot"
+	// probeAudioSampleRate 探测语音识别时生成1秒16kHz单声道静音wav
+	probeAudioSampleRate = 16000
+)
+
+type probeFunc func(ctx context.Context) (io.ReadCloser, http.Header, error)
+
+// probe 按 record.Capability 发送最小的探测请求并读完响应，耗时记录到 record 中
+// 连接耗时为收到响应头的时间，上游返回的错误body会作为错误详情
+func (s *modelCheckService) probe(ctx context.Context, adapterX adapter.Adapter, conf *dto.ChannelModelConf, opts *dto.CheckOptions, record *model.ModelCheckResult) error {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	call, err := newProbeFunc(adapterX, conf, opts, record.Capability)
+	if err != nil {
+		return err
+	}
+	startTime := time.Now()
+	body, _, err := call(ctx)
+	record.ConnectDuration = time.Since(startTime).Milliseconds()
+	if err != nil {
+		record.StatusCode = UpstreamStatusCode(err)
+		if body != nil {
+			defer body.Close()
+			bodyDetail, err2 := io.ReadAll(body)
+			if err2 == nil && len(bodyDetail) > 0 {
+				return fmt.Errorf("%s: %s", err.Error(), string(bodyDetail))
+			}
+		}
+		return err
+	}
+	defer body.Close()
+	record.StatusCode = http.StatusOK
+	if record.Capability == model.CapabilityChat {
+		err = readProbeStream(body, startTime, record)
+	} else {
+		err = readProbeBody(body, startTime, record)
+	}
+	record.TotalDuration = time.Since(startTime).Milliseconds()
+	return err
+}
+
+// probeStreamChunk 只解析探测需要的字段，reasoning_content 为部分推理模型返回的思考内容
+type probeStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// readProbeStream 逐行解析SSE，首字耗时为收到第一段非空内容的时间
+// 流中没有任何内容也没有结束原因时认为不是一次有效的对话补全
+func readProbeStream(body io.Reader, startTime time.Time, record *model.ModelCheckResult) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	finished := false
+	raw := new(bytes.Buffer)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			raw.Write(line)
+			continue
+		}
+		data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+		if bytes.Equal(data, []byte("[DONE]")) {
+			break
+		}
+		var chunk probeStreamChunk
+		if err := sonic.Unmarshal(data, &chunk); err != nil {
+			continue
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("流中返回错误: %s", chunk.Error.Message)
+		}
+		for _, choice := range chunk.Choices {
+			if record.FirstTokenDuration == 0 && (choice.Delta.Content != "" || choice.Delta.ReasoningContent != "") {
+				record.FirstTokenDuration = time.Since(startTime).Milliseconds()
+			}
+			if choice.FinishReason != "" {
+				finished = true
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取响应失败: %w", err)
+	}
+	if record.FirstTokenDuration > 0 || finished {
+		return nil
+	}
+	if raw.Len() > 0 {
+		detail := raw.String()
+		if len(detail) > 500 {
+			detail = detail[:500]
+		}
+		return fmt.Errorf("响应不是有效的流式对话补全: %s", detail)
+	}
+	return errors.New("响应中没有对话内容")
+}
+
+// readProbeBody 非流式请求的首字耗时为收到第一个字节的时间
+func readProbeBody(body io.Reader, startTime time.Time, record *model.ModelCheckResult) error {
+	buf := make([]byte, 4096)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 && record.FirstTokenDuration == 0 {
+			record.FirstTokenDuration = time.Since(startTime).Milliseconds()
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("读取响应失败: %w", err)
+		}
+	}
+	if record.FirstTokenDuration == 0 {
+		return errors.New("响应内容为空")
+	}
+	return nil
+}
+
+func newProbeFunc(adapterX adapter.Adapter, conf *dto.ChannelModelConf, opts *dto.CheckOptions, capability string) (probeFunc, error) {
+	switch capability {
+	case model.CapabilityEmbedding:
+		return func(ctx context.Context) (io.ReadCloser, http.Header, error) {
+			return adapterX.Embeddings(ctx, &adapterApi.EmbeddingRequest{
+				Model: conf.ModelKey,
+				Input: probeEmbeddingInput,
+			})
+		}, nil
+	case model.CapabilityTTS:
+		return func(ctx context.Context) (io.ReadCloser, http.Header, error) {
+			return adapterX.CreateSpeech(ctx, &adapterApi.SpeechRequest{
+				Model:          conf.ModelKey,
+				Input:          probeSpeechInput,
+				Text:           probeSpeechInput,
+				Voice:          "alloy",
+				ResponseFormat: "mp3",
+			})
+		}, nil
+	case model.CapabilitySTT:
+		file, err := newMemoryFileHeader("file", "probe.wav", silentWav(time.Second))
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (io.ReadCloser, http.Header, error) {
+			return adapterX.Transcriptions(ctx, &adapterApi.TranscriptionRequest{
+				File:  file,
+				Model: conf.ModelKey,
+			})
+		}, nil
+	case model.CapabilityImage:
+		return func(ctx context.Context) (io.ReadCloser, http.Header, error) {
+			return adapterX.CreateImage(ctx, &adapterApi.CreateImageRequest{
+				Prompt: probeImagePrompt,
+				Model:  conf.ModelKey,
+				N:      1,
+				Size:   smallestImageSize(conf.ModelKey),
+			})
+		}, nil
+	}
+	content, err := sonic.Marshal(opts.Prompt)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) (io.ReadCloser, http.Header, error) {
+		return adapterX.ChatCompletions(ctx, &adapterApi.ChatRequest{
+			Model: conf.ModelKey,
+			Messages: []adapterApi.Message{
+				{
+					Role:    "user",
+					Content: content,
+				},
+			},
+			Stream:    true,
+			MaxTokens: opts.MaxTokens,
+		})
+	}, nil
+}
+
+// smallestImageSize 只有 dall-e-2 支持 256x256，其他模型最小为 1024x1024
+func smallestImageSize(modelKey string) string {
+	if strings.Contains(strings.ToLower(modelKey), "dall-e-2") {
+		return "256x256"
+	}
+	return "1024x1024"
+}
+
+// silentWav 生成指定时长的16位单声道静音wav
+func silentWav(duration time.Duration) []byte {
+	dataSize := uint32(probeAudioSampleRate * 2 * duration / time.Second)
+	buf := new(bytes.Buffer)
+	buf.WriteString("RIFF")
+	_ = binary.Write(buf, binary.LittleEndian, 36+dataSize)
+	buf.WriteString("WAVEfmt ")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(16))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(1))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(1))
+	_ = binary.Write(buf, binary.LittleEndian, uint32(probeAudioSampleRate))
+	_ = binary.Write(buf, binary.LittleEndian, uint32(probeAudioSampleRate*2))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(2))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	_ = binary.Write(buf, binary.LittleEndian, dataSize)
+	buf.Write(make([]byte, dataSize))
+	return buf.Bytes()
+}
+
+// newMemoryFileHeader 适配器的上传接口需要 multipart.FileHeader，这里在内存中构造一个
+func newMemoryFileHeader(field, filename string, data []byte) (*multipart.FileHeader, error) {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = part.Write(data); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	form, err := multipart.NewReader(body, writer.Boundary()).ReadForm(int64(len(data)) + 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	files := form.File[field]
+	if len(files) == 0 {
+		return nil, errors.New("构造上传文件失败")
+	}
+	return files[0], nil
+}
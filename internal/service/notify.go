@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	apiV1 "github.com/jiu-u/oai-api/api/v1"
+	"github.com/jiu-u/oai-api/constant"
+	"github.com/jiu-u/oai-api/internal/dto"
+	"github.com/jiu-u/oai-api/internal/repository"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	// alertConfigCacheKey 告警配置缓存，修改配置时删除
+	alertConfigCacheKey       = "alertConfig"
+	defaultAlertDedupMinutes  = 30
+	defaultAlertRatePerMinute = 10
+)
+
+type NotifyService interface {
+	// Alert 记录日志并按告警规则异步发送，同一事件在去重时间内只发送一次
+	Alert(ctx context.Context, event *AlertEvent)
+	// TestAlert 同步向指定通道发送测试告警，sinkName 为空时发送到所有启用的通道，不受去重和限流影响
+	TestAlert(ctx context.Context, sinkName string) ([]apiV1.AlertTestResult, error)
+}
+
+func NewNotifyService(
+	s *Service,
+	userRepo repository.UserRepository,
+	systemRepo repository.SystemRepository,
+	emailSvc EmailService,
+) NotifyService {
+	return &notifyService{
+		Service:    s,
+		userRepo:   userRepo,
+		systemRepo: systemRepo,
+		emailSvc:   emailSvc,
+	}
+}
+
+type notifyService struct {
+	*Service
+	userRepo   repository.UserRepository
+	systemRepo repository.SystemRepository
+	emailSvc   EmailService
+}
+
+// loadConfig 未配置或读取失败时视为关闭，同样缓存
+func (s *notifyService) loadConfig(ctx context.Context) *dto.AlertConfig {
+	if v, ok := s.Cache.Get(alertConfigCacheKey); ok {
+		return v.(*dto.AlertConfig)
+	}
+	cfg, err := s.systemRepo.GetAlertConfig(ctx)
+	if err != nil {
+		cfg = &dto.AlertConfig{}
+	}
+	s.Cache.Set(alertConfigCacheKey, cfg, time.Minute)
+	return cfg
+}
+
+func (s *notifyService) Alert(ctx context.Context, event *AlertEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Level == "" {
+		event.Level = AlertLevelWarning
+	}
+	cfg := s.loadConfig(ctx)
+	dedup := cfg.DedupMinutes
+	if dedup <= 0 {
+		dedup = defaultAlertDedupMinutes
+	}
+	// Add 在key已存在时返回错误，去重时间内的重复事件直接丢弃，也不写日志
+	if err := s.Cache.Add("alertDedup:"+event.Type+":"+event.Key, struct{}{}, time.Duration(dedup)*time.Minute); err != nil {
+		return
+	}
+	s.Logger.WithContext(ctx).Warn("告警", zap.String("type", event.Type), zap.String("key", event.Key), zap.String("content", event.Text()))
+	go func() {
+		ctx := context.Background()
+		if !cfg.Enable {
+			// 未启用告警配置时保持原来的行为，只把严重事件发邮件给管理员
+			if event.Level == AlertLevelCritical {
+				s.notifyAdmins(ctx, event)
+			}
+			return
+		}
+		for _, sinkCfg := range matchAlertSinks(cfg, event.Type) {
+			if !s.allowSink(cfg, sinkCfg.Name) {
+				s.Logger.Warn("告警通道超过频率限制，丢弃", zap.String("sink", sinkCfg.Name), zap.String("type", event.Type))
+				continue
+			}
+			if err := s.send(ctx, sinkCfg, event); err != nil {
+				s.Logger.Warn("发送告警失败", zap.String("sink", sinkCfg.Name), zap.Error(err))
+			}
+		}
+	}()
+}
+
+// allowSink 每个通道按自然分钟计数
+func (s *notifyService) allowSink(cfg *dto.AlertConfig, name string) bool {
+	limit := cfg.RateLimitPerMinute
+	if limit <= 0 {
+		limit = defaultAlertRatePerMinute
+	}
+	key := fmt.Sprintf("alertRate:%s:%d", name, time.Now().Unix()/60)
+	_ = s.Cache.Add(key, 0, 2*time.Minute)
+	n, err := s.Cache.IncrementInt(key, 1)
+	return err == nil && n <= limit
+}
+
+func (s *notifyService) TestAlert(ctx context.Context, sinkName string) ([]apiV1.AlertTestResult, error) {
+	cfg, err := s.systemRepo.GetAlertConfig(ctx)
+	if err != nil {
+		return nil, errors.New("未配置告警通道")
+	}
+	event := &AlertEvent{
+		Type:  AlertEventTest,
+		Level: AlertLevelWarning,
+		Key:   "test",
+		Title: "测试告警",
+		Fields: []AlertField{
+			{Name: "说明", Value: "这是一条测试告警，收到说明通道配置正确"},
+		},
+		Time: time.Now(),
+	}
+	var results []apiV1.AlertTestResult
+	for _, sinkCfg := range cfg.Sinks {
+		if sinkName == "" && !sinkCfg.Enable || sinkName != "" && sinkCfg.Name != sinkName {
+			continue
+		}
+		result := apiV1.AlertTestResult{Sink: sinkCfg.Name, Success: true}
+		if err = s.send(ctx, sinkCfg, event); err != nil {
+			result.Success = false
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return nil, errors.New("告警通道不存在或未启用")
+	}
+	return results, nil
+}
+
+func (s *notifyService) send(ctx context.Context, cfg dto.AlertSink, event *AlertEvent) error {
+	sink, err := s.newSink(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	return sink.Send(ctx, event)
+}
+
+func (s *notifyService) newSink(ctx context.Context, cfg dto.AlertSink) (alertSink, error) {
+	switch cfg.Type {
+	case alertSinkWebhook:
+		return &webhookSink{url: cfg.Url, secret: cfg.Secret}, nil
+	case alertSinkSlack:
+		return &slackSink{url: cfg.Url}, nil
+	case alertSinkDingTalk:
+		return &dingTalkSink{url: cfg.Url, secret: cfg.Secret}, nil
+	case alertSinkFeishu:
+		return &feishuSink{url: cfg.Url, secret: cfg.Secret}, nil
+	case alertSinkEmail:
+		recipients := cfg.Recipients
+		if len(recipients) == 0 {
+			emails, err := s.adminEmails(ctx)
+			if err != nil {
+				return nil, err
+			}
+			recipients = emails
+		}
+		return &emailSink{emailSvc: s.emailSvc, recipients: recipients}, nil
+	}
+	return nil, fmt.Errorf("不支持的告警通道类型: %s", cfg.Type)
+}
+
+func (s *notifyService) adminEmails(ctx context.Context) ([]string, error) {
+	admins, err := s.userRepo.FindUsersByRole(ctx, constant.AdminRole)
+	if err != nil {
+		return nil, err
+	}
+	var emails []string
+	for _, admin := range admins {
+		if admin.Email != nil && *admin.Email != "" {
+			emails = append(emails, *admin.Email)
+		}
+	}
+	return emails, nil
+}
+
+// notifyAdmins 给所有配置了邮箱的管理员发送邮件
+func (s *notifyService) notifyAdmins(ctx context.Context, event *AlertEvent) {
+	emails, err := s.adminEmails(ctx)
+	if err != nil {
+		s.Logger.Warn("查询管理员失败", zap.Error(err))
+		return
+	}
+	if len(emails) == 0 {
+		return
+	}
+	sink := &emailSink{emailSvc: s.emailSvc, recipients: emails}
+	if err = sink.Send(ctx, event); err != nil {
+		s.Logger.Warn("发送管理员通知邮件失败", zap.Error(err))
+	}
+}
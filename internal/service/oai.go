@@ -1,6 +1,7 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"github.com/bytedance/sonic"
@@ -8,13 +9,23 @@ import (
 	adapterApi "github.com/jiu-u/oai-adapter/api"
 	apiV1 "github.com/jiu-u/oai-api/api/v1"
 	"github.com/jiu-u/oai-api/internal/dto"
+	"github.com/jiu-u/oai-api/internal/model"
 	"github.com/jiu-u/oai-api/internal/repository"
 	adapterV1 "github.com/jiu-u/oai-api/pkg/adapter/api/v1"
 	"github.com/jiu-u/oai-api/pkg/array"
+	"github.com/jiu-u/oai-api/pkg/metrics"
+	"github.com/jiu-u/oai-api/pkg/protocol/anthropic"
+	"github.com/jiu-u/oai-api/pkg/protocol/gemini"
+	"github.com/jiu-u/oai-api/pkg/protocol/ollama"
+	"github.com/jiu-u/oai-api/pkg/secret"
+	"github.com/jiu-u/oai-api/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"io"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type RelayType int
@@ -34,8 +45,44 @@ const (
 	RelayEmbeddingByBytes
 	RelaySpeechByBytes
 	RelayImageByBytes
+	// RelayMessages Anthropic Messages 请求转换后的 chat 请求体
+	RelayMessages
+	// RelayGemini Gemini generateContent 请求转换后的 chat 请求体
+	RelayGemini
+	// RelayOllama Ollama chat、generate 请求转换后的 chat 请求体
+	RelayOllama
+	// RelayResponses Responses API 请求，按渠道原样转发或转换为 chat 请求体
+	RelayResponses
 )
 
+var relayTypeNames = map[RelayType]string{
+	RelayChat:              "chat",
+	RelayCompletion:        "completion",
+	RelayEmbedding:         "embedding",
+	RelaySpeech:            "speech",
+	RelayTranscriptions:    "transcriptions",
+	RelayTranslations:      "translations",
+	RelayImage:             "image",
+	RelayImageEdit:         "image_edit",
+	RelayImageVariations:   "image_variations",
+	RelayChatByBytes:       "chat_bytes",
+	RelayCompletionByBytes: "completion_bytes",
+	RelayEmbeddingByBytes:  "embedding_bytes",
+	RelaySpeechByBytes:     "speech_bytes",
+	RelayImageByBytes:      "image_bytes",
+	RelayMessages:          "messages",
+	RelayGemini:            "gemini",
+	RelayOllama:            "ollama",
+	RelayResponses:         "responses",
+}
+
+func (t RelayType) String() string {
+	if name, ok := relayTypeNames[t]; ok {
+		return name
+	}
+	return strconv.Itoa(int(t))
+}
+
 type OaiService interface {
 	RelayRequest(ctx context.Context, req any, modelId string, relayType RelayType) (io.ReadCloser, http.Header, error)
 	ChatCompletions(ctx context.Context, req *adapterApi.ChatRequest) (io.ReadCloser, http.Header, error)
@@ -53,6 +100,10 @@ type OaiService interface {
 	CreateImageByBytes(ctx context.Context, req []byte, modelId string) (io.ReadCloser, http.Header, error)
 	CreateImageEdit(ctx context.Context, req *adapterApi.EditImageRequest) (io.ReadCloser, http.Header, error)
 	ImageVariations(ctx context.Context, req *adapterApi.CreateImageVariationRequest) (io.ReadCloser, http.Header, error)
+	Messages(ctx context.Context, req *anthropic.MessagesRequest) (io.ReadCloser, http.Header, error)
+	GenerateContent(ctx context.Context, modelId string, req *gemini.GenerateContentRequest, stream bool) (io.ReadCloser, http.Header, error)
+	OllamaChat(ctx context.Context, req *ollama.ChatRequest) (io.ReadCloser, http.Header, error)
+	OllamaGenerate(ctx context.Context, req *ollama.GenerateRequest) (io.ReadCloser, http.Header, error)
 }
 
 func NewOaiService(
@@ -60,6 +111,8 @@ func NewOaiService(
 	load LoadBalanceServiceBeta,
 	reqLogSvc RequestLogService,
 	channelModelRepo repository.ChannelModelRepository,
+	metrics *metrics.Metrics,
+	captureSvc BodyCaptureService,
 ) OaiService {
 	return &oaiService{
 		Service:          svc,
@@ -67,6 +120,8 @@ func NewOaiService(
 		N:                3,
 		reqLogSvc:        reqLogSvc,
 		channelModelRepo: channelModelRepo,
+		metrics:          metrics,
+		captureSvc:       captureSvc,
 	}
 }
 
@@ -76,6 +131,8 @@ type oaiService struct {
 	N                int
 	channelModelRepo repository.ChannelModelRepository
 	reqLogSvc        RequestLogService
+	metrics          *metrics.Metrics
+	captureSvc       BodyCaptureService
 }
 
 var typeMp = map[string]adapter.AdapterType{
@@ -86,13 +143,18 @@ var typeMp = map[string]adapter.AdapterType{
 	"siliconflowFree": adapter.SiliconFlowFree,
 }
 
-func NewOAIAdapter(conf *dto.ChannelModelConf) (adapter.Adapter, error) {
+// NewOAIAdapter conf.ChannelKey 为数据库中的密文，只在这里解密
+func NewOAIAdapter(conf *dto.ChannelModelConf, cipher *secret.Cipher) (adapter.Adapter, error) {
 	if _, exist := typeMp[conf.ChannelType]; !exist {
 		return nil, errors.New("invalid provider type")
 	}
+	apiKey, err := cipher.Decrypt(conf.ChannelKey)
+	if err != nil {
+		return nil, err
+	}
 	cfg := &adapter.AdapterConfig{
 		AdapterType:  typeMp[conf.ChannelType],
-		ApiKey:       conf.ChannelKey,
+		ApiKey:       apiKey,
 		EndPoint:     conf.ChannelEndPoint,
 		ManualModels: nil,
 		ProxyURL:     nil,
@@ -101,43 +163,39 @@ func NewOAIAdapter(conf *dto.ChannelModelConf) (adapter.Adapter, error) {
 	return adapter2, nil
 }
 
-func (s *oaiService) GoLogReq(ctx context.Context, trace *RequestLogReq) {
-	go s.LogReq(ctx, trace)
-}
-
-func (s *oaiService) LogReq(ctx context.Context, trace *RequestLogReq) {
+// EnqueueLogReq 在当前请求中取出key、ip等信息后放入日志队列，避免请求结束后ctx被复用
+func (s *oaiService) EnqueueLogReq(ctx context.Context, trace *RequestLogReq) {
 	apiKey, err := GetApiKey(ctx)
 	if err != nil {
 		return
 	}
-	req := trace
-	req.Key = apiKey
-	req.Ip = GetClientIp(ctx)
-	err = s.reqLogSvc.CreateRequestLog(ctx, req)
-	if err != nil {
-		s.Logger.Warn("创建请求日志失败", zap.Error(err))
-	}
+	trace.Key = apiKey
+	trace.Ip = GetClientIp(ctx)
+	trace.Path = GetRequestPath(ctx)
+	trace.RequestId = GetRequestId(ctx)
+	// 队列满时丢弃，丢弃数量由 RequestLogServer 汇总打印
+	s.reqLogSvc.EnqueueRequestLog(trace)
 }
 
 func GetApiKey(ctx context.Context) (string, error) {
-	apiKey := ctx.Value("apiKey")
+	apiKey, _ := ctx.Value("apiKey").(string)
 	if apiKey == "" {
 		return "", errors.New("api key is empty")
 	}
-	return apiKey.(string), nil
+	return apiKey, nil
 }
 
-func (s *oaiService) SuccessCb(ctx context.Context, modelRecordId uint64) {
+func (s *oaiService) SuccessCb(ctx context.Context, conf *dto.ChannelModelConf) {
 	go func() {
-		err := s.load.SuccessCb(ctx, modelRecordId)
+		err := s.load.SuccessCb(ctx, conf)
 		if err != nil {
 			s.Logger.Warn("successCb失败", zap.Error(err))
 		}
 	}()
 }
 
-func (s *oaiService) FailCb(ctx context.Context, modelRecordId uint64) {
-	err := s.load.FailCb(ctx, modelRecordId)
+func (s *oaiService) FailCb(ctx context.Context, conf *dto.ChannelModelConf, upstreamErr error) {
+	err := s.load.FailCb(ctx, conf, upstreamErr)
 	if err != nil {
 		s.Logger.Warn("failCb失败", zap.Error(err))
 	}
@@ -148,42 +206,179 @@ func (s *oaiService) RelayRequest(ctx context.Context, req any, modelId string,
 	if reqModelId == "" {
 		return nil, nil, errors.New("modelId is empty")
 	}
+	start := time.Now()
+	// 指标标签只使用配置过的模型名，避免调用方随意填写模型名产生大量时间序列
+	metricModel := reqModelId
+	if !s.load.IsConfiguredModel(ctx, reqModelId) {
+		metricModel = metrics.UnknownModel
+	}
+	doneInFlight := s.metrics.IncInFlight(metricModel, relayType.String())
 	logger := s.Logger.WithContext(ctx)
-	trace := new(RequestLogReq)
+	trace := &RequestLogReq{
+		Model:     reqModelId,
+		RelayType: relayType.String(),
+		Stream:    isStreamRequest(req),
+	}
+	capture := s.captureSvc.NewCapture(ctx, req, relayType)
+	// lastStatus 最后一次上游返回的状态码，全部失败时用于确定返回给调用方的错误
+	lastStatus := 0
 	for i := range s.N {
 		trace.RetryTimes = i
+		if i > 0 {
+			s.metrics.ObserveRetry(metricModel, relayType.String())
+		}
 		zapLogger := logger.With(
 			zap.String("reqModelId", reqModelId),
-			zap.String("relayType", strconv.Itoa(int(relayType))),
+			zap.String("relayType", relayType.String()),
 			zap.Int("loop_times", i),
 		)
 		conf, err := s.load.NextChannel(ctx, reqModelId)
 		if err != nil {
 			zapLogger.Warn("获取provider失败", zap.Error(err))
+			trace.Attempts = append(trace.Attempts, model.RequestAttempt{Error: "选择渠道失败: " + err.Error()})
 			continue
 		}
-		trace.Model = conf.ModelKey
-		trace.ChannelNames += conf.ChannelName + ","
-		trace.ChannelIds += strconv.FormatUint(conf.ModelRecordId, 10) + ","
-		adapterX, err := NewOAIAdapter(conf)
+		trace.UpstreamModel = conf.ModelKey
+		attempt := model.RequestAttempt{
+			ChannelId:     conf.ChannelId,
+			ChannelName:   conf.ChannelName,
+			ChannelKeyId:  conf.ChannelKeyId,
+			ModelRecordId: conf.ModelRecordId,
+			UpstreamModel: conf.ModelKey,
+		}
+		labels := metrics.RelayLabels{
+			Model:         metricModel,
+			UpstreamModel: conf.ModelKey,
+			Channel:       strconv.FormatUint(conf.ChannelId, 10),
+			RelayType:     relayType.String(),
+		}
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		if err != nil {
 			zapLogger.Warn("获取provider失败", zap.Error(err))
+			attempt.Error = "创建适配器失败: " + err.Error()
+			trace.Attempts = append(trace.Attempts, attempt)
+			continue
+		}
+		if body, ok := req.(*ResponsesRelayBody); ok && !body.choose(conf, adapterX) {
+			attempt.Error = "渠道不支持原生 Responses API，请求中的内置工具无法转换"
+			trace.Attempts = append(trace.Attempts, attempt)
 			continue
 		}
-		resp, respHeader, err := s.DoRelayRequest(ctx, req, conf.ModelKey, relayType, adapterX)
+		attemptStart := time.Now()
+		attemptCtx, span := tracing.Start(ctx, "relay.attempt", oteltrace.WithAttributes(
+			attribute.Int("relay.attempt", i),
+			attribute.String("relay.type", relayType.String()),
+			attribute.String("relay.model", reqModelId),
+			attribute.String("relay.upstream_model", conf.ModelKey),
+			attribute.Int64("channel.id", int64(conf.ChannelId)),
+			attribute.String("channel.name", conf.ChannelName),
+			attribute.String("channel.type", conf.ChannelType),
+			attribute.Int64("channel.key_id", int64(conf.ChannelKeyId)),
+		))
+		resp, respHeader, err := s.DoRelayRequest(attemptCtx, req, conf.ModelKey, relayType, adapterX)
+		attempt.Latency = time.Since(attemptStart).Milliseconds()
+		if err != nil {
+			span.SetAttributes(attribute.Int("relay.upstream_status", UpstreamStatusCode(err)))
+			tracing.RecordError(span, err)
+		}
+		span.End()
 		if err == nil {
 			zapLogger.Info("获取response成功", zap.Error(err))
-			s.SuccessCb(ctx, conf.ModelRecordId)
-			trace.Status = 1
-			s.GoLogReq(ctx, trace)
-			return resp, respHeader, nil
-		}
+			s.metrics.ObserveUpstreamStatus(labels, http.StatusOK)
+			s.SuccessCb(ctx, conf)
+			attempt.StatusCode = http.StatusOK
+			trace.Attempts = append(trace.Attempts, attempt)
+			trace.Status = model.RequestLogStatusSuccess
+			// 响应体读取完毕后再统计耗时、token并写入请求日志
+			capture.StartResponse(respHeader, trace.Stream)
+			return newRelayBody(resp, start, trace.Stream, capture, func(stats *RelayStats) {
+				doneInFlight()
+				s.metrics.ObserveRequest(labels, true, stats.Total, stats.FirstByte)
+				s.metrics.ObserveTokens(labels, stats.PromptTokens, stats.CompletionTokens)
+				trace.TotalLatency = stats.Total.Milliseconds()
+				trace.FirstTokenLatency = stats.FirstToken.Milliseconds()
+				trace.PromptTokens = stats.PromptTokens
+				trace.CompletionTokens = stats.CompletionTokens
+				trace.Body = capture.Result()
+				s.EnqueueLogReq(ctx, trace)
+			}), respHeader, nil
+		}
+		zapLogger.Warn("获取response失败", zap.Uint64("channelKeyId", conf.ChannelKeyId), zap.Error(err))
+		s.metrics.ObserveUpstreamStatus(labels, UpstreamStatusCode(err))
+		attempt.StatusCode = UpstreamStatusCode(err)
+		lastStatus = attempt.StatusCode
+		attempt.Error = truncateError(err, 1000)
+		trace.Attempts = append(trace.Attempts, attempt)
 		// 标记模型不可用
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 	}
-	trace.Status = 2
-	s.GoLogReq(ctx, trace)
-	return nil, nil, errors.New("all provider failed.please try again later")
+	trace.Status = model.RequestLogStatusFail
+	trace.TotalLatency = time.Since(start).Milliseconds()
+	trace.Body = capture.Result()
+	s.EnqueueLogReq(ctx, trace)
+	doneInFlight()
+	s.metrics.ObserveRequest(metrics.RelayLabels{Model: metricModel, RelayType: relayType.String()}, false, time.Since(start), 0)
+	return nil, nil, newRelayError(lastStatus, metricModel == metrics.UnknownModel, reqModelId)
+}
+
+// RelayError 所有渠道都失败时返回，各协议的入口按 StatusCode 转换为对应的错误类型
+type RelayError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *RelayError) Error() string {
+	return e.Message
+}
+
+// newRelayError 模型未配置时为404，最后一次上游返回400、404、429时沿用
+// key失效、5xx、网络错误和没有可用渠道都不是调用方的问题，统一为503
+func newRelayError(lastStatus int, unknownModel bool, modelId string) *RelayError {
+	switch {
+	case unknownModel || lastStatus == http.StatusNotFound:
+		return &RelayError{StatusCode: http.StatusNotFound, Message: "model not found: " + modelId}
+	case lastStatus == http.StatusTooManyRequests:
+		return &RelayError{StatusCode: http.StatusTooManyRequests, Message: "upstream rate limited, please try again later"}
+	case lastStatus == http.StatusBadRequest:
+		return &RelayError{StatusCode: http.StatusBadRequest, Message: "upstream rejected the request"}
+	}
+	return &RelayError{StatusCode: http.StatusServiceUnavailable, Message: "all provider failed.please try again later"}
+}
+
+// RelayStatusCode 转发失败时返回给调用方的状态码，请求转换失败等其他错误为500
+func RelayStatusCode(err error) int {
+	var relayErr *RelayError
+	if errors.As(err, &relayErr) {
+		return relayErr.StatusCode
+	}
+	return http.StatusInternalServerError
+}
+
+// isStreamRequest 原样转发的请求体只解析 stream 字段
+func isStreamRequest(req any) bool {
+	switch r := req.(type) {
+	case *adapterApi.ChatRequest:
+		return r.Stream
+	case *adapterApi.CompletionsRequest:
+		return r.Stream
+	case *ResponsesRelayBody:
+		return r.Request.Stream
+	case []byte:
+		var body struct {
+			Stream bool `json:"stream"`
+		}
+		_ = sonic.Unmarshal(r, &body)
+		return body.Stream
+	}
+	return false
+}
+
+func truncateError(err error, max int) string {
+	msg := err.Error()
+	if len(msg) > max {
+		return msg[:max]
+	}
+	return msg
 }
 
 func (s *oaiService) DoRelayRequest(ctx context.Context, reqBody any, modelId string, relayType RelayType, ad adapter.Adapter) (io.ReadCloser, http.Header, error) {
@@ -195,7 +390,7 @@ func (s *oaiService) DoRelayRequest(ctx context.Context, reqBody any, modelId st
 		}
 		req.Model = modelId
 		return ad.ChatCompletions(ctx, req)
-	case RelayChatByBytes:
+	case RelayChatByBytes, RelayMessages, RelayGemini, RelayOllama:
 		req, ok := reqBody.([]byte)
 		if !ok {
 			return nil, nil, errors.New("invalid request body")
@@ -205,6 +400,23 @@ func (s *oaiService) DoRelayRequest(ctx context.Context, reqBody any, modelId st
 			return nil, nil, err
 		}
 		return ad.ChatCompletionsByBytes(ctx, req)
+	case RelayResponses:
+		body, ok := reqBody.(*ResponsesRelayBody)
+		if !ok {
+			return nil, nil, errors.New("invalid request body")
+		}
+		if !body.UseNative {
+			req, err := changeBytesModelId(body.Chat, modelId)
+			if err != nil {
+				return nil, nil, err
+			}
+			return ad.ChatCompletionsByBytes(ctx, req)
+		}
+		req, err := changeBytesModelId(body.Native, modelId)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ad.(nativeRequester).DoJsonRequest(ctx, http.MethodPost, body.endPoint+"/v1/responses", bytes.NewReader(req))
 	case RelayCompletion:
 		req, ok := reqBody.(*adapterApi.CompletionsRequest)
 		if !ok {
@@ -314,7 +526,7 @@ func (s *oaiService) ChatCompletions2Archive(ctx context.Context, req *adapterAp
 			s.Logger.Warn("获取provider失败", zap.String("modelId", reqModelId), zap.Error(err))
 			continue
 		}
-		adapterX, err := NewOAIAdapter(conf)
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		//newProvider, err := NewOAIProvider(conf)
 		if err != nil {
 			s.Logger.Warn("创建provider失败", zap.String("modelId", reqModelId), zap.Error(err))
@@ -323,7 +535,7 @@ func (s *oaiService) ChatCompletions2Archive(ctx context.Context, req *adapterAp
 		req.Model = conf.ModelKey
 		resp, respHeader, err := adapterX.ChatCompletions(ctx, req)
 		if err == nil {
-			s.SuccessCb(ctx, conf.ModelRecordId)
+			s.SuccessCb(ctx, conf)
 			//s.GoLogReq(ctx, conf.ModelKey, 1)
 			return resp, respHeader, nil
 		}
@@ -336,7 +548,7 @@ func (s *oaiService) ChatCompletions2Archive(ctx context.Context, req *adapterAp
 			zap.String("detail", string(detail)),
 			zap.Error(err))
 		// 标记模型不可用
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 		s.Logger.Warn("更新状态失败",
 			zap.String("modelId", conf.ModelKey),
 			zap.String("provider", strconv.FormatUint(conf.ChannelId, 10)),
@@ -353,7 +565,7 @@ func (s *oaiService) ChatCompletionsByBytes2Archive(ctx context.Context, req []b
 			continue
 		}
 
-		adapterX, err := NewOAIAdapter(conf)
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		if err != nil {
 			s.Logger.Warn("创建provider失败", zap.String("modelId", modelId), zap.Error(err))
 			continue
@@ -361,19 +573,20 @@ func (s *oaiService) ChatCompletionsByBytes2Archive(ctx context.Context, req []b
 		req, err = changeBytesModelId(req, conf.ModelId)
 		resp, respHeader, err := adapterX.ChatCompletionsByBytes(ctx, req)
 		if err == nil {
-			s.SuccessCb(ctx, conf.ModelRecordId)
+			s.SuccessCb(ctx, conf)
 			// s.GoLogReq(ctx, conf.ModelId, 1)
 			return resp, respHeader, nil
 		}
 		// 标记模型不可用
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 	}
 	//s.GoLogReq(ctx, modelId, 2)
 	return nil, nil, errors.New("no service available")
 }
 
 func (s *oaiService) Models(ctx context.Context) (*apiV1.ModelResponse, error) {
-	modelIds, err := s.channelModelRepo.FindAllChannelModelIds(ctx)
+	// 只返回调用方所在分组能访问到的模型
+	modelIds, err := s.load.FindGroupModelIds(ctx, GetGroups(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -388,15 +601,22 @@ func (s *oaiService) Models(ctx context.Context) (*apiV1.ModelResponse, error) {
 			Created: 0,
 		}
 	})
-	list := s.load.GetModelMappingKeys()
-	for _, modelId := range list {
-		if _, ok := modelSet[modelId]; !ok {
-			resp.Data = append(resp.Data, adapterV1.Model{
-				ID:      modelId,
-				Object:  "model",
-				Created: 0,
-			})
+	// 别名只在映射的目标模型对调用方可用时返回
+	for alias, targets := range s.load.GetModelMapping() {
+		if _, ok := modelSet[alias]; ok {
+			continue
+		}
+		if !array.Some(targets, func(target string) bool {
+			_, ok := modelSet[target]
+			return ok
+		}) {
+			continue
 		}
+		resp.Data = append(resp.Data, adapterV1.Model{
+			ID:      alias,
+			Object:  "model",
+			Created: 0,
+		})
 	}
 	return resp, nil
 }
@@ -408,7 +628,7 @@ func (s *oaiService) Completions2Archive(ctx context.Context, req *adapterApi.Co
 		if err != nil {
 			continue
 		}
-		adapterX, err := NewOAIAdapter(conf)
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		if err != nil {
 			s.Logger.Warn("创建provider失败", zap.String("modelId", reqModelId), zap.Error(err))
 			continue
@@ -416,12 +636,12 @@ func (s *oaiService) Completions2Archive(ctx context.Context, req *adapterApi.Co
 		req.Model = conf.ModelId
 		resp, respHeader, err := adapterX.Completions(ctx, req)
 		if err == nil {
-			s.SuccessCb(ctx, conf.ModelRecordId)
+			s.SuccessCb(ctx, conf)
 			// s.GoLogReq(ctx, conf.ModelId, 1)
 			return resp, respHeader, nil
 		}
 		// 标记模型不可用
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 	}
 	//s.GoLogReq(ctx, reqModelId, 2)
 	return nil, nil, errors.New("no service available")
@@ -433,7 +653,7 @@ func (s *oaiService) CompletionsByBytes2Archive(ctx context.Context, req []byte,
 		if err != nil {
 			continue
 		}
-		adapterX, err := NewOAIAdapter(conf)
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		if err != nil {
 			s.Logger.Warn("创建provider失败", zap.String("modelId", modelId), zap.Error(err))
 			continue
@@ -441,12 +661,12 @@ func (s *oaiService) CompletionsByBytes2Archive(ctx context.Context, req []byte,
 		req, err = changeBytesModelId(req, conf.ModelId)
 		resp, respHeader, err := adapterX.CompletionsByBytes(ctx, req)
 		if err == nil {
-			s.SuccessCb(ctx, conf.ModelRecordId)
+			s.SuccessCb(ctx, conf)
 			// s.GoLogReq(ctx, conf.ModelId, 1)
 			return resp, respHeader, nil
 		}
 		// 标记模型不可用
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 	}
 	//s.GoLogReq(ctx, modelId, 2)
 	return nil, nil, errors.New("no service available")
@@ -459,7 +679,7 @@ func (s *oaiService) Embeddings2Archive(ctx context.Context, req *adapterApi.Emb
 		if err != nil {
 			continue
 		}
-		adapterX, err := NewOAIAdapter(conf)
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		if err != nil {
 			s.Logger.Warn("创建provider失败", zap.String("modelId", reqModelId), zap.Error(err))
 			continue
@@ -467,12 +687,12 @@ func (s *oaiService) Embeddings2Archive(ctx context.Context, req *adapterApi.Emb
 		req.Model = conf.ModelId
 		resp, respHeader, err := adapterX.Embeddings(ctx, req)
 		if err == nil {
-			s.SuccessCb(ctx, conf.ModelRecordId)
+			s.SuccessCb(ctx, conf)
 			// s.GoLogReq(ctx, conf.ModelId, 1)
 			return resp, respHeader, nil
 		}
 		// 标记模型不可用
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 	}
 	//s.GoLogReq(ctx, reqModelId, 2)
 	return nil, nil, errors.New("no service available")
@@ -484,7 +704,7 @@ func (s *oaiService) EmbeddingsByBytes2Archive(ctx context.Context, req []byte,
 		if err != nil {
 			continue
 		}
-		adapterX, err := NewOAIAdapter(conf)
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		if err != nil {
 			s.Logger.Warn("创建provider失败", zap.String("modelId", modelId), zap.Error(err))
 			continue
@@ -496,7 +716,7 @@ func (s *oaiService) EmbeddingsByBytes2Archive(ctx context.Context, req []byte,
 			return resp, respHeader, nil
 		}
 		// 标记模型不可用
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 	}
 	//s.GoLogReq(ctx, modelId, 2)
 	return nil, nil, errors.New("no service available")
@@ -509,7 +729,7 @@ func (s *oaiService) CreateSpeech2Archive(ctx context.Context, req *adapterApi.S
 		if err != nil {
 			continue
 		}
-		adapterX, err := NewOAIAdapter(conf)
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		if err != nil {
 			s.Logger.Warn("创建provider失败", zap.String("modelId", reqModelId), zap.Error(err))
 			continue
@@ -517,12 +737,12 @@ func (s *oaiService) CreateSpeech2Archive(ctx context.Context, req *adapterApi.S
 		req.Model = conf.ModelId
 		resp, respHeader, err := adapterX.CreateSpeech(ctx, req)
 		if err == nil {
-			s.SuccessCb(ctx, conf.ModelRecordId)
+			s.SuccessCb(ctx, conf)
 			// s.GoLogReq(ctx, conf.ModelId, 1)
 			return resp, respHeader, nil
 		}
 		// 标记模型不可用
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 	}
 	//s.GoLogReq(ctx, reqModelId, 2)
 	return nil, nil, errors.New("no service available")
@@ -534,7 +754,7 @@ func (s *oaiService) CreateSpeechByBytes2Archive(ctx context.Context, req []byte
 		if err != nil {
 			continue
 		}
-		adapterX, err := NewOAIAdapter(conf)
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		if err != nil {
 			s.Logger.Warn("创建provider失败", zap.String("modelId", modelId), zap.Error(err))
 			continue
@@ -546,7 +766,7 @@ func (s *oaiService) CreateSpeechByBytes2Archive(ctx context.Context, req []byte
 			return resp, respHeader, nil
 		}
 		// 标记模型不可用
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 	}
 	//s.GoLogReq(ctx, modelId, 2)
 	return nil, nil, errors.New("no service available")
@@ -559,7 +779,7 @@ func (s *oaiService) Transcriptions2Archive(ctx context.Context, req *adapterApi
 		if err != nil {
 			continue
 		}
-		adapterX, err := NewOAIAdapter(conf)
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		if err != nil {
 			s.Logger.Warn("创建provider失败", zap.String("modelId", reqModelId), zap.Error(err))
 			continue
@@ -567,12 +787,12 @@ func (s *oaiService) Transcriptions2Archive(ctx context.Context, req *adapterApi
 		req.Model = conf.ModelId
 		resp, respHeader, err := adapterX.Transcriptions(ctx, req)
 		if err == nil {
-			s.SuccessCb(ctx, conf.ModelRecordId)
+			s.SuccessCb(ctx, conf)
 			// s.GoLogReq(ctx, conf.ModelId, 1)
 			return resp, respHeader, nil
 		}
 		// 标记模型不可用
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 	}
 	//s.GoLogReq(ctx, reqModelId, 2)
 	return nil, nil, errors.New("no service available")
@@ -585,7 +805,7 @@ func (s *oaiService) Translations2Archive(ctx context.Context, req *adapterApi.T
 		if err != nil {
 			continue
 		}
-		adapterX, err := NewOAIAdapter(conf)
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		if err != nil {
 			s.Logger.Warn("创建provider失败", zap.String("modelId", reqModelId), zap.Error(err))
 			continue
@@ -593,12 +813,12 @@ func (s *oaiService) Translations2Archive(ctx context.Context, req *adapterApi.T
 		req.Model = conf.ModelId
 		resp, respHeader, err := adapterX.Translations(ctx, req)
 		if err == nil {
-			s.SuccessCb(ctx, conf.ModelRecordId)
+			s.SuccessCb(ctx, conf)
 			// s.GoLogReq(ctx, conf.ModelId, 1)
 			return resp, respHeader, nil
 		}
 		// 标记模型不可用
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 	}
 	//s.GoLogReq(ctx, reqModelId, 2)
 	return nil, nil, errors.New("no service available")
@@ -611,7 +831,7 @@ func (s *oaiService) CreateImage2Archive(ctx context.Context, req *adapterApi.Cr
 		if err != nil {
 			continue
 		}
-		adapterX, err := NewOAIAdapter(conf)
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		if err != nil {
 			s.Logger.Warn("创建provider失败", zap.String("modelId", reqModelId), zap.Error(err))
 			continue
@@ -619,12 +839,12 @@ func (s *oaiService) CreateImage2Archive(ctx context.Context, req *adapterApi.Cr
 		req.Model = conf.ModelId
 		resp, respHeader, err := adapterX.CreateImage(ctx, req)
 		if err == nil {
-			s.SuccessCb(ctx, conf.ModelRecordId)
+			s.SuccessCb(ctx, conf)
 			// s.GoLogReq(ctx, conf.ModelId, 1)
 			return resp, respHeader, nil
 		}
 		// 标记模型不可用
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 	}
 	//s.GoLogReq(ctx, reqModelId, 2)
 	return nil, nil, errors.New("no service available")
@@ -636,7 +856,7 @@ func (s *oaiService) CreateImageByBytes2Archive(ctx context.Context, req []byte,
 		if err != nil {
 			continue
 		}
-		adapterX, err := NewOAIAdapter(conf)
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		if err != nil {
 			s.Logger.Warn("创建provider失败", zap.String("modelId", modelId), zap.Error(err))
 			continue
@@ -648,7 +868,7 @@ func (s *oaiService) CreateImageByBytes2Archive(ctx context.Context, req []byte,
 			return resp, respHeader, nil
 		}
 		// 标记模型不可用
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 	}
 	//s.GoLogReq(ctx, modelId, 2)
 	return nil, nil, errors.New("no service available")
@@ -661,7 +881,7 @@ func (s *oaiService) CreateImageEdit2Archive(ctx context.Context, req *adapterAp
 		if err != nil {
 			continue
 		}
-		adapterX, err := NewOAIAdapter(conf)
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		if err != nil {
 			s.Logger.Warn("创建provider失败", zap.String("modelId", reqModelId), zap.Error(err))
 			continue
@@ -669,11 +889,11 @@ func (s *oaiService) CreateImageEdit2Archive(ctx context.Context, req *adapterAp
 		req.Model = conf.ModelId
 		resp, respHeader, err := adapterX.CreateImageEdit(ctx, req)
 		if err == nil {
-			s.SuccessCb(ctx, conf.ModelRecordId)
+			s.SuccessCb(ctx, conf)
 			// s.GoLogReq(ctx, conf.ModelId, 1)
 			return resp, respHeader, nil
 		}
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 	}
 	//s.GoLogReq(ctx, reqModelId, 2)
 	return nil, nil, errors.New("no service available")
@@ -686,7 +906,7 @@ func (s *oaiService) ImageVariations2Archive(ctx context.Context, req *adapterAp
 		if err != nil {
 			continue
 		}
-		adapterX, err := NewOAIAdapter(conf)
+		adapterX, err := NewOAIAdapter(conf, s.Cipher)
 		if err != nil {
 			s.Logger.Warn("创建provider失败", zap.String("modelId", reqModelId), zap.Error(err))
 			continue
@@ -694,11 +914,11 @@ func (s *oaiService) ImageVariations2Archive(ctx context.Context, req *adapterAp
 		req.Model = conf.ModelId
 		resp, respHeader, err := adapterX.ImageVariations(ctx, req)
 		if err == nil {
-			s.SuccessCb(ctx, conf.ModelRecordId)
+			s.SuccessCb(ctx, conf)
 			// s.GoLogReq(ctx, conf.ModelId, 1)
 			return resp, respHeader, nil
 		}
-		s.FailCb(ctx, conf.ModelRecordId)
+		s.FailCb(ctx, conf, err)
 	}
 	//s.GoLogReq(ctx, reqModelId, 2)
 	return nil, nil, errors.New("no service available")
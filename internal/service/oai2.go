@@ -2,7 +2,12 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	adapterApi "github.com/jiu-u/oai-adapter/api"
+	"github.com/jiu-u/oai-api/pkg/protocol/anthropic"
+	"github.com/jiu-u/oai-api/pkg/protocol/gemini"
+	"github.com/jiu-u/oai-api/pkg/protocol/ollama"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
 	"io"
 	"net/http"
 )
@@ -62,3 +67,55 @@ func (s *oaiService) CreateImageEdit(ctx context.Context, req *adapterApi.EditIm
 func (s *oaiService) ImageVariations(ctx context.Context, req *adapterApi.CreateImageVariationRequest) (io.ReadCloser, http.Header, error) {
 	return s.RelayRequest(ctx, req, req.Model, RelayImageVariations)
 }
+
+// Messages 转换为 OpenAI chat 请求后转发，响应由调用方转换回 Anthropic 格式
+func (s *oaiService) Messages(ctx context.Context, req *anthropic.MessagesRequest) (io.ReadCloser, http.Header, error) {
+	chatReq, err := anthropic.ToOpenAI(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.RelayRequest(ctx, body, req.Model, RelayMessages)
+}
+
+// GenerateContent 转换为 OpenAI chat 请求后转发，modelId 来自请求路径
+func (s *oaiService) GenerateContent(ctx context.Context, modelId string, req *gemini.GenerateContentRequest, stream bool) (io.ReadCloser, http.Header, error) {
+	chatReq, err := gemini.ToOpenAI(modelId, req, stream)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.RelayRequest(ctx, body, modelId, RelayGemini)
+}
+
+// OllamaChat 转换为 OpenAI chat 请求后转发，响应由调用方转换回 Ollama 格式
+func (s *oaiService) OllamaChat(ctx context.Context, req *ollama.ChatRequest) (io.ReadCloser, http.Header, error) {
+	chatReq, err := ollama.ChatToOpenAI(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.relayOllama(ctx, chatReq)
+}
+
+// OllamaGenerate 转换为只有一轮对话的 OpenAI chat 请求后转发
+func (s *oaiService) OllamaGenerate(ctx context.Context, req *ollama.GenerateRequest) (io.ReadCloser, http.Header, error) {
+	chatReq, err := ollama.GenerateToOpenAI(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.relayOllama(ctx, chatReq)
+}
+
+func (s *oaiService) relayOllama(ctx context.Context, chatReq *openai.ChatRequest) (io.ReadCloser, http.Header, error) {
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.RelayRequest(ctx, body, chatReq.Model, RelayOllama)
+}
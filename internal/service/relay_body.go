@@ -0,0 +1,122 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// relayTailSize 保留响应体末尾的字节数，usage 出现在非流式响应的末尾或流式响应的最后一个chunk中
+const relayTailSize = 8 * 1024
+
+// tokenFields 流式响应中携带生成内容的字段，第一次出现非空值即为首字
+var tokenFields = [][]byte{[]byte(`"content"`), []byte(`"reasoning_content"`), []byte(`"text"`)}
+
+// RelayStats 响应体读取完毕后统计到的耗时和token消耗，非流式响应的首字耗时等于首字节耗时
+type RelayStats struct {
+	FirstByte        time.Duration
+	FirstToken       time.Duration
+	Total            time.Duration
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// relayBody 包装上游响应体，记录首字节耗时，并在关闭时从响应末尾解析 usage
+type relayBody struct {
+	io.ReadCloser
+	start   time.Time
+	stream  bool
+	stats   RelayStats
+	tail    []byte
+	once    sync.Once
+	capture *BodyCapture
+	onClose func(stats *RelayStats)
+}
+
+// newRelayBody capture 为nil时不采集响应体
+func newRelayBody(body io.ReadCloser, start time.Time, stream bool, capture *BodyCapture, onClose func(stats *RelayStats)) *relayBody {
+	return &relayBody{
+		ReadCloser: body,
+		start:      start,
+		stream:     stream,
+		capture:    capture,
+		onClose:    onClose,
+	}
+}
+
+func (b *relayBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if b.stats.FirstByte == 0 {
+			b.stats.FirstByte = time.Since(b.start)
+		}
+		if b.stats.FirstToken == 0 && (!b.stream || containsToken(p[:n])) {
+			b.stats.FirstToken = time.Since(b.start)
+		}
+		b.tail = append(b.tail, p[:n]...)
+		if len(b.tail) > relayTailSize {
+			b.tail = append(b.tail[:0], b.tail[len(b.tail)-relayTailSize:]...)
+		}
+		b.capture.Write(p[:n])
+	}
+	return n, err
+}
+
+func (b *relayBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.stats.Total = time.Since(b.start)
+		b.stats.PromptTokens, b.stats.CompletionTokens = parseUsage(b.tail)
+		b.onClose(&b.stats)
+	})
+	return err
+}
+
+// containsToken 判断SSE数据中是否已经出现生成的内容，跨Read边界的字段会被漏掉，只会让首字耗时略微偏大
+func containsToken(chunk []byte) bool {
+	for _, field := range tokenFields {
+		rest := chunk
+		for {
+			idx := bytes.Index(rest, field)
+			if idx < 0 {
+				break
+			}
+			rest = rest[idx+len(field):]
+			value := bytes.TrimLeft(rest, " :")
+			if len(value) >= 2 && value[0] == '"' && value[1] != '"' {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseUsage 从响应末尾找到最后一个 usage 字段并解析，流式响应中前面的chunk的 usage 一般为null
+func parseUsage(tail []byte) (promptTokens, completionTokens int) {
+	idx := bytes.LastIndex(tail, []byte(`"usage"`))
+	if idx < 0 {
+		return 0, 0
+	}
+	rest := tail[idx+len(`"usage"`):]
+	colon := bytes.IndexByte(rest, ':')
+	if colon < 0 {
+		return 0, 0
+	}
+	// Responses API 的 usage 使用 input_tokens 和 output_tokens
+	var usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		InputTokens      int `json:"input_tokens"`
+		OutputTokens     int `json:"output_tokens"`
+	}
+	// Decoder 只解析 usage 对应的值，忽略后面的内容
+	if err := json.NewDecoder(bytes.NewReader(rest[colon+1:])).Decode(&usage); err != nil {
+		return 0, 0
+	}
+	if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		return usage.InputTokens, usage.OutputTokens
+	}
+	return usage.PromptTokens, usage.CompletionTokens
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseUsage(t *testing.T) {
+	tests := []struct {
+		name       string
+		tail       string
+		prompt     int
+		completion int
+	}{
+		{"no usage", `data: {"choices":[]}`, 0, 0},
+		{"chat completion", `{"id":"1","usage":{"prompt_tokens":12,"completion_tokens":34,"total_tokens":46}}`, 12, 34},
+		{
+			"stream last chunk",
+			"data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}],\"usage\":null}\n\n" +
+				"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":7}}\n\n" +
+				"data: [DONE]\n\n",
+			5, 7,
+		},
+		{"stream null usage", "data: {\"choices\":[],\"usage\":null}\n\ndata: [DONE]\n\n", 0, 0},
+		{
+			"responses api",
+			"event: response.completed\ndata: {\"response\":{\"usage\":{\"input_tokens\":8,\"output_tokens\":9,\"total_tokens\":17}}}\n\n",
+			8, 9,
+		},
+		{"truncated", `{"usage":{"prompt_tokens":1`, 0, 0},
+		{"no colon", `"usage"`, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt, completion := parseUsage([]byte(tt.tail))
+			if prompt != tt.prompt || completion != tt.completion {
+				t.Fatalf("parseUsage() = %d, %d, want %d, %d", prompt, completion, tt.prompt, tt.completion)
+			}
+		})
+	}
+}
+
+func TestContainsToken(t *testing.T) {
+	tests := []struct {
+		chunk string
+		want  bool
+	}{
+		{`data: {"choices":[{"delta":{"role":"assistant","content":""}}]}`, false},
+		{`data: {"choices":[{"delta":{"content":"你"}}]}`, true},
+		{`data: {"choices":[{"delta":{"reasoning_content": "想"}}]}`, true},
+		{`data: {"type":"response.output_text.delta","text":"a"}`, true},
+		{`data: {"choices":[{"delta":{"content":null}}]}`, false},
+	}
+	for _, tt := range tests {
+		if got := containsToken([]byte(tt.chunk)); got != tt.want {
+			t.Errorf("containsToken(%q) = %v, want %v", tt.chunk, got, tt.want)
+		}
+	}
+}
+
+func TestRelayBodyStreamUsage(t *testing.T) {
+	// 末尾超过 relayTailSize 时只保留最后的内容，usage 仍然可以解析
+	padding := "data: {\"choices\":[{\"delta\":{\"content\":\"" + strings.Repeat("x", relayTailSize) + "\"}}]}\n\n"
+	stream := padding + "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":4}}\n\ndata: [DONE]\n\n"
+	var stats *RelayStats
+	body := newRelayBody(io.NopCloser(strings.NewReader(stream)), time.Now(), true, nil, func(s *RelayStats) {
+		stats = s
+	})
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		t.Fatal(err)
+	}
+	_ = body.Close()
+	_ = body.Close()
+	if stats == nil {
+		t.Fatal("onClose not called")
+	}
+	if stats.PromptTokens != 3 || stats.CompletionTokens != 4 {
+		t.Fatalf("usage = %d, %d, want 3, 4", stats.PromptTokens, stats.CompletionTokens)
+	}
+	if stats.FirstByte == 0 || stats.FirstToken == 0 {
+		t.Fatalf("first byte/token not recorded: %+v", stats)
+	}
+}
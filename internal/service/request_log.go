@@ -3,25 +3,49 @@ package service
 import (
 	"context"
 	apiV1 "github.com/jiu-u/oai-api/api/v1"
+	"github.com/jiu-u/oai-api/internal/dto"
 	"github.com/jiu-u/oai-api/internal/model"
 	"github.com/jiu-u/oai-api/internal/repository"
 	"github.com/jiu-u/oai-api/pkg/array"
+	"github.com/jiu-u/oai-api/pkg/metrics"
+	"go.uber.org/zap"
 	"strconv"
+	"sync/atomic"
+	"time"
 )
 
 type RequestLogReq struct {
-	Model        string
-	Ip           string
-	Status       int8
-	Key          string
-	RetryTimes   int
-	ChannelNames string
-	ChannelIds   string
+	RequestId         string
+	Model             string
+	UpstreamModel     string
+	Ip                string
+	Path              string
+	RelayType         string
+	Stream            bool
+	Status            int8
+	Key               string
+	RetryTimes        int
+	TotalLatency      int64
+	FirstTokenLatency int64
+	PromptTokens      int
+	CompletionTokens  int
+	Attempts          []model.RequestAttempt
+	// Body 采集到的请求体和响应体，未采样时为nil
+	Body *model.RequestLogBody
 }
 
+// requestLogQueueSize 请求日志队列长度，队列满时直接丢弃，不阻塞中转请求
+const requestLogQueueSize = 4096
+
 type RequestLogService interface {
 	CreateRequestLog(ctx context.Context, req *RequestLogReq) error
+	EnqueueRequestLog(req *RequestLogReq) bool
+	RequestLogQueue() <-chan *RequestLogReq
+	CreateRequestLogs(ctx context.Context, reqs []*RequestLogReq) error
+	TakeDroppedCount() int64
 	GetRequestLogs(ctx context.Context, req *apiV1.RequestLogsQuery) (*apiV1.RequestLogsResponse, error)
+	GetRequestLogDetail(ctx context.Context, id uint64) (*apiV1.RequestLogDetail, error)
+	GetUserRequestLogs(ctx context.Context, userId uint64, req *apiV1.RequestLogsQuery) (*apiV1.RequestLogsResponse, error)
 	GetRequestLogsModelRanking(ctx context.Context, req *apiV1.RequestLogsRankingRequest) (*apiV1.RequestLogsModelRankingResponse, error)
 	GetRequestLogsUserRanking(ctx context.Context, req *apiV1.RequestLogsRankingRequest) (*apiV1.RequestLogsUserRankingResponse, error)
 }
@@ -31,49 +55,225 @@ func NewRequestLogService(
 	userRepo repository.UserRepository,
 	repo repository.RequestLogRepository,
 	apiKeyRepo repository.ApiKeyRepository,
+	systemRepo repository.SystemRepository,
+	statSvc RequestLogStatService,
+	channelStatSvc ChannelStatService,
+	metrics *metrics.Metrics,
 ) RequestLogService {
 	return &requestLogService{
-		Service:    s,
-		userRepo:   userRepo,
-		repo:       repo,
-		apiKeyRepo: apiKeyRepo,
+		Service:        s,
+		userRepo:       userRepo,
+		repo:           repo,
+		apiKeyRepo:     apiKeyRepo,
+		systemRepo:     systemRepo,
+		statSvc:        statSvc,
+		channelStatSvc: channelStatSvc,
+		metrics:        metrics,
+		queue:          make(chan *RequestLogReq, requestLogQueueSize),
 	}
 }
 
 type requestLogService struct {
 	*Service
-	userRepo   repository.UserRepository
-	repo       repository.RequestLogRepository
-	apiKeyRepo repository.ApiKeyRepository
+	userRepo       repository.UserRepository
+	repo           repository.RequestLogRepository
+	apiKeyRepo     repository.ApiKeyRepository
+	systemRepo     repository.SystemRepository
+	statSvc        RequestLogStatService
+	channelStatSvc ChannelStatService
+	metrics        *metrics.Metrics
+	queue          chan *RequestLogReq
+	dropped        atomic.Int64
+}
+
+// requestLogUser 写日志时需要的用户信息，按 api key 缓存
+type requestLogUser struct {
+	UserId   uint64
+	Username string
+	Email    string
+	ApiKeyId uint64
+}
+
+func requestLogUserCacheKey(apiKey string) string {
+	return "reqLogUser:" + apiKey
+}
+
+// EnqueueRequestLog 把日志放入队列，由 RequestLogServer 批量写入，队列满时丢弃并计数
+func (r *requestLogService) EnqueueRequestLog(req *RequestLogReq) bool {
+	select {
+	case r.queue <- req:
+		return true
+	default:
+		r.dropped.Add(1)
+		r.metrics.ObserveRequestLogDropped()
+		return false
+	}
+}
+
+func (r *requestLogService) RequestLogQueue() <-chan *RequestLogReq {
+	return r.queue
+}
+
+// TakeDroppedCount 返回上次调用以来丢弃的日志条数，包括队列已满和写入失败丢弃的
+func (r *requestLogService) TakeDroppedCount() int64 {
+	return r.dropped.Swap(0)
+}
+
+func (r *requestLogService) findRequestLogUser(ctx context.Context, apiKey string) (*requestLogUser, error) {
+	if v, ok := r.Cache.Get(requestLogUserCacheKey(apiKey)); ok {
+		return v.(*requestLogUser), nil
+	}
+	apiKeyItem, err := r.apiKeyRepo.QueryItemByApiKey(ctx, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.userRepo.FindUserById(ctx, apiKeyItem.UserId)
+	if err != nil {
+		return nil, err
+	}
+	item := &requestLogUser{
+		UserId:   user.Id,
+		Username: user.Username,
+		ApiKeyId: apiKeyItem.Id,
+	}
+	if user.Email != nil {
+		item.Email = *user.Email
+	}
+	r.Cache.Set(requestLogUserCacheKey(apiKey), item, 5*time.Minute)
+	return item, nil
 }
 
 func (r *requestLogService) CreateRequestLog(ctx context.Context, req *RequestLogReq) error {
-	apiKeyItem, err := r.apiKeyRepo.QueryItemByApiKey(ctx, req.Key)
+	reqLog, err := r.newRequestLog(ctx, req, r.loadModelPrices(ctx))
 	if err != nil {
 		return err
 	}
-	userId := apiKeyItem.UserId
-	id := r.Sid.GenUint64()
-	user, err := r.userRepo.FindUserById(ctx, userId)
-	if err != nil {
+	if err = r.repo.CreateRequestLog(ctx, reqLog); err != nil {
 		return err
 	}
-	reqLog := &model.RequestLog{
-		Model:            req.Model,
-		UserId:           userId,
-		Username:         user.Username,
-		Ip:               req.Ip,
-		Status:           req.Status,
-		Key:              req.Key,
-		RetryTimes:       req.RetryTimes,
-		ChannelNameTrace: req.ChannelNames,
-		ChannelIdTrace:   req.ChannelIds,
+	r.accumulateStats(ctx, []*model.RequestLog{reqLog})
+	if body := r.newRequestLogBody(req, reqLog); body != nil {
+		return r.repo.CreateRequestLogBodies(ctx, []*model.RequestLogBody{body})
 	}
-	if user.Email != nil {
-		reqLog.Email = *user.Email
+	return nil
+}
+
+// loadModelPrices 每批日志读取一次模型价格，读取失败时费用记为0
+func (r *requestLogService) loadModelPrices(ctx context.Context) map[string]dto.ModelPrice {
+	cfg, err := r.systemRepo.GetModelConfig(ctx)
+	if err != nil {
+		return nil
+	}
+	return cfg.ModelPrices
+}
+
+// accumulateStats 统计失败不影响日志写入，只打印日志
+func (r *requestLogService) accumulateStats(ctx context.Context, logs []*model.RequestLog) {
+	if err := r.statSvc.AccumulateRequestLogs(ctx, logs); err != nil {
+		r.Logger.WithContext(ctx).Error("请求日志|累加统计失败", zap.Int("count", len(logs)), zap.Error(err))
+	}
+	if err := r.channelStatSvc.AccumulateRequestLogs(ctx, logs); err != nil {
+		r.Logger.WithContext(ctx).Error("请求日志|累加渠道统计失败", zap.Int("count", len(logs)), zap.Error(err))
 	}
-	reqLog.Id = id
-	return r.repo.CreateRequestLog(ctx, reqLog)
+}
+
+// CreateRequestLogs 批量写入，找不到用户的日志跳过，不影响同一批的其他日志
+func (r *requestLogService) CreateRequestLogs(ctx context.Context, reqs []*RequestLogReq) error {
+	logs := make([]*model.RequestLog, 0, len(reqs))
+	var bodies []*model.RequestLogBody
+	prices := r.loadModelPrices(ctx)
+	for _, req := range reqs {
+		reqLog, err := r.newRequestLog(ctx, req, prices)
+		if err != nil {
+			r.Logger.WithContext(ctx).Warn("请求日志|查询用户失败", zap.String("requestId", req.RequestId), zap.Error(err))
+			continue
+		}
+		logs = append(logs, reqLog)
+		if body := r.newRequestLogBody(req, reqLog); body != nil {
+			bodies = append(bodies, body)
+		}
+	}
+	if len(logs) == 0 {
+		return nil
+	}
+	if err := r.repo.CreateRequestLogs(ctx, logs); err != nil {
+		r.Logger.WithContext(ctx).Warn("请求日志|批量写入失败，逐条重试", zap.Int("count", len(logs)), zap.Error(err))
+		logs, bodies = r.createRequestLogsOneByOne(ctx, logs, bodies)
+		if len(logs) == 0 {
+			return err
+		}
+	}
+	r.accumulateStats(ctx, logs)
+	if len(bodies) == 0 {
+		return nil
+	}
+	return r.repo.CreateRequestLogBodies(ctx, bodies)
+}
+
+// createRequestLogsOneByOne 逐条写入，仍然失败的日志计入丢弃数，返回写入成功的日志和对应的采集内容
+func (r *requestLogService) createRequestLogsOneByOne(ctx context.Context, logs []*model.RequestLog, bodies []*model.RequestLogBody) ([]*model.RequestLog, []*model.RequestLogBody) {
+	bodyMap := make(map[uint64]*model.RequestLogBody, len(bodies))
+	for _, body := range bodies {
+		bodyMap[body.RequestLogId] = body
+	}
+	created := make([]*model.RequestLog, 0, len(logs))
+	createdBodies := make([]*model.RequestLogBody, 0, len(bodies))
+	for _, reqLog := range logs {
+		if err := r.repo.CreateRequestLog(ctx, reqLog); err != nil {
+			r.Logger.WithContext(ctx).Error("请求日志|写入失败，日志被丢弃", zap.String("requestId", reqLog.RequestId), zap.Error(err))
+			r.dropped.Add(1)
+			r.metrics.ObserveRequestLogDropped()
+			continue
+		}
+		created = append(created, reqLog)
+		if body, ok := bodyMap[reqLog.Id]; ok {
+			createdBodies = append(createdBodies, body)
+		}
+	}
+	return created, createdBodies
+}
+
+// newRequestLogBody 采集内容与日志一对一，使用日志生成的id关联
+func (r *requestLogService) newRequestLogBody(req *RequestLogReq, reqLog *model.RequestLog) *model.RequestLogBody {
+	if req.Body == nil {
+		return nil
+	}
+	body := req.Body
+	body.Id = r.Sid.GenUint64()
+	body.RequestLogId = reqLog.Id
+	return body
+}
+
+func (r *requestLogService) newRequestLog(ctx context.Context, req *RequestLogReq, prices map[string]dto.ModelPrice) (*model.RequestLog, error) {
+	user, err := r.findRequestLogUser(ctx, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	reqLog := &model.RequestLog{
+		RequestId:         req.RequestId,
+		Model:             req.Model,
+		UpstreamModel:     req.UpstreamModel,
+		UserId:            user.UserId,
+		Username:          user.Username,
+		Email:             user.Email,
+		Ip:                req.Ip,
+		Path:              req.Path,
+		RelayType:         req.RelayType,
+		Stream:            req.Stream,
+		Status:            req.Status,
+		Key:               req.Key,
+		ApiKeyId:          user.ApiKeyId,
+		RetryTimes:        req.RetryTimes,
+		TotalLatency:      req.TotalLatency,
+		FirstTokenLatency: req.FirstTokenLatency,
+		PromptTokens:      req.PromptTokens,
+		CompletionTokens:  req.CompletionTokens,
+		TotalTokens:       req.PromptTokens + req.CompletionTokens,
+		Cost:              prices[req.Model].Cost(req.PromptTokens, req.CompletionTokens),
+		Attempts:          req.Attempts,
+	}
+	reqLog.Id = r.Sid.GenUint64()
+	return reqLog, nil
 }
 
 func (r *requestLogService) GetRequestLogs(ctx context.Context, req *apiV1.RequestLogsQuery) (*apiV1.RequestLogsResponse, error) {
@@ -87,25 +287,82 @@ func (r *requestLogService) GetRequestLogs(ctx context.Context, req *apiV1.Reque
 		Page:     req.Page,
 		PageSize: req.PageSize,
 	}
-	temp := array.Map(list, func(item *model.RequestLog) apiV1.RequestLogItem {
-		return apiV1.RequestLogItem{
-			Id:               strconv.FormatUint(item.Id, 10),
-			Model:            item.Model,
-			UserId:           strconv.FormatUint(item.UserId, 10),
-			Username:         item.Username,
-			Email:            item.Email,
-			Ip:               item.Ip,
-			Status:           item.Status,
-			RetryTimes:       item.RetryTimes,
-			CreatedAt:        item.CreatedAt.Format("2006-01-02 15:04:05"),
-			ChannelNameTrace: item.ChannelNameTrace,
-			ChannelIdTrace:   item.ChannelIdTrace,
+	resp.List = array.Map(list, toRequestLogItem)
+	return resp, nil
+}
+
+// GetUserRequestLogs 只返回当前用户的日志，不返回每次尝试的渠道信息
+func (r *requestLogService) GetUserRequestLogs(ctx context.Context, userId uint64, req *apiV1.RequestLogsQuery) (*apiV1.RequestLogsResponse, error) {
+	req.UserId = strconv.FormatUint(userId, 10)
+	resp, err := r.GetRequestLogs(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for i := range resp.List {
+		resp.List[i].Attempts = nil
+	}
+	return resp, nil
+}
+
+// GetRequestLogDetail 日志详情，采集了请求体/响应体时一起返回，采集内容已过期或未采样时 Body 为空
+func (r *requestLogService) GetRequestLogDetail(ctx context.Context, id uint64) (*apiV1.RequestLogDetail, error) {
+	item, err := r.repo.FindRequestLogById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	resp := &apiV1.RequestLogDetail{RequestLogItem: toRequestLogItem(item)}
+	body, err := r.repo.FindRequestLogBody(ctx, id)
+	if err == nil {
+		resp.Body = &apiV1.RequestLogBody{
+			RequestBody:       body.RequestBody,
+			ResponseBody:      body.ResponseBody,
+			RequestTruncated:  body.RequestTruncated,
+			ResponseTruncated: body.ResponseTruncated,
+			CreatedAt:         body.CreatedAt.Format("2006-01-02 15:04:05"),
 		}
-	})
-	resp.List = temp
+	}
 	return resp, nil
 }
 
+func toRequestLogItem(item *model.RequestLog) apiV1.RequestLogItem {
+	return apiV1.RequestLogItem{
+		Id:                strconv.FormatUint(item.Id, 10),
+		RequestId:         item.RequestId,
+		Model:             item.Model,
+		UpstreamModel:     item.UpstreamModel,
+		UserId:            strconv.FormatUint(item.UserId, 10),
+		Username:          item.Username,
+		Email:             item.Email,
+		ApiKeyId:          strconv.FormatUint(item.ApiKeyId, 10),
+		Ip:                item.Ip,
+		Path:              item.Path,
+		RelayType:         item.RelayType,
+		Stream:            item.Stream,
+		Status:            item.Status,
+		RetryTimes:        item.RetryTimes,
+		TotalLatency:      item.TotalLatency,
+		FirstTokenLatency: item.FirstTokenLatency,
+		PromptTokens:      item.PromptTokens,
+		CompletionTokens:  item.CompletionTokens,
+		TotalTokens:       item.TotalTokens,
+		Cost:              item.Cost,
+		Attempts:          array.Map(item.Attempts, toRequestLogAttempt),
+		CreatedAt:         item.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func toRequestLogAttempt(item model.RequestAttempt) apiV1.RequestLogAttempt {
+	return apiV1.RequestLogAttempt{
+		ChannelId:     strconv.FormatUint(item.ChannelId, 10),
+		ChannelName:   item.ChannelName,
+		ChannelKeyId:  strconv.FormatUint(item.ChannelKeyId, 10),
+		UpstreamModel: item.UpstreamModel,
+		StatusCode:    item.StatusCode,
+		Error:         item.Error,
+		Latency:       item.Latency,
+	}
+}
+
 func (r *requestLogService) GetRequestLogsModelRanking(ctx context.Context, req *apiV1.RequestLogsRankingRequest) (*apiV1.RequestLogsModelRankingResponse, error) {
 	resp := new(apiV1.RequestLogsModelRankingResponse)
 	list, err := r.repo.FindRequestLogsModelRanking(ctx, req)
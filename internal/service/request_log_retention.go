@@ -0,0 +1,234 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	apiV1 "github.com/jiu-u/oai-api/api/v1"
+	"github.com/jiu-u/oai-api/internal/dto"
+	"github.com/jiu-u/oai-api/internal/model"
+	"github.com/jiu-u/oai-api/internal/repository"
+	"github.com/jiu-u/oai-api/pkg/array"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRequestLogRetentionDays = 30
+	defaultRequestLogArchiveDir    = "./data/archive/request_logs"
+	defaultRequestLogPurgeBatch    = 1000
+	// requestLogPurgePause 每批之间的间隔，给正常的日志写入让出锁
+	requestLogPurgePause = 200 * time.Millisecond
+)
+
+var ErrRequestLogPurgeRunning = errors.New("请求日志清理任务正在运行")
+
+type RequestLogRetentionService interface {
+	// PurgeExpired 清理过期的请求日志，scheduled 为 true 表示定时任务调用，保留策略未开启时跳过
+	PurgeExpired(ctx context.Context, scheduled bool) (*apiV1.RequestLogPurgeResult, error)
+	// PurgeExpiredStats 清理超过查询范围的 minute/hour 统计，返回删除的行数
+	PurgeExpiredStats(ctx context.Context) (int64, error)
+}
+
+func NewRequestLogRetentionService(
+	s *Service,
+	systemRepo repository.SystemRepository,
+	repo repository.RequestLogRepository,
+	statRepo repository.RequestLogStatRepository,
+) RequestLogRetentionService {
+	return &requestLogRetentionService{
+		Service:    s,
+		systemRepo: systemRepo,
+		repo:       repo,
+		statRepo:   statRepo,
+	}
+}
+
+type requestLogRetentionService struct {
+	*Service
+	systemRepo repository.SystemRepository
+	repo       repository.RequestLogRepository
+	statRepo   repository.RequestLogStatRepository
+	running    atomic.Bool
+}
+
+// loadRetentionConfig 未配置时使用默认值，且定时任务不执行
+func (s *requestLogRetentionService) loadRetentionConfig(ctx context.Context) *dto.RequestLogRetentionConfig {
+	cfg, err := s.systemRepo.GetRequestLogRetentionConfig(ctx)
+	if err != nil {
+		cfg = &dto.RequestLogRetentionConfig{}
+	}
+	if cfg.RetentionDays <= 0 {
+		cfg.RetentionDays = defaultRequestLogRetentionDays
+	}
+	if cfg.ArchiveDir == "" {
+		cfg.ArchiveDir = defaultRequestLogArchiveDir
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultRequestLogPurgeBatch
+	}
+	return cfg
+}
+
+// PurgeExpired 按id顺序分批处理，每批先归档再在独立事务中删除，中途失败时已处理的批次不会回滚
+func (s *requestLogRetentionService) PurgeExpired(ctx context.Context, scheduled bool) (*apiV1.RequestLogPurgeResult, error) {
+	cfg := s.loadRetentionConfig(ctx)
+	before := time.Now().AddDate(0, 0, -cfg.RetentionDays)
+	resp := &apiV1.RequestLogPurgeResult{
+		Before: before.Format("2006-01-02 15:04:05"),
+	}
+	if scheduled && !cfg.Enable {
+		resp.Skipped = true
+		return resp, nil
+	}
+	if !s.running.CompareAndSwap(false, true) {
+		return nil, ErrRequestLogPurgeRunning
+	}
+	defer s.running.Store(false)
+
+	start := time.Now()
+	logger := s.Logger.WithContext(ctx)
+	var archive *requestLogArchive
+	defer func() {
+		if archive == nil {
+			return
+		}
+		if err := archive.Close(); err != nil {
+			logger.Error("请求日志清理|关闭归档文件失败", zap.String("file", archive.path), zap.Error(err))
+		}
+	}()
+	for {
+		if err := ctx.Err(); err != nil {
+			return resp, err
+		}
+		logs, err := s.repo.FindExpiredRequestLogs(ctx, before, cfg.BatchSize)
+		if err != nil {
+			return resp, err
+		}
+		if len(logs) == 0 {
+			break
+		}
+		if cfg.Archive {
+			if archive == nil {
+				archive, err = openRequestLogArchive(cfg.ArchiveDir, start)
+				if err != nil {
+					return resp, err
+				}
+				resp.ArchiveFile = archive.path
+			}
+			if err = archive.Write(logs); err != nil {
+				return resp, err
+			}
+			resp.Archived += int64(len(logs))
+		}
+		ids := array.Map(logs, func(item *model.RequestLog) uint64 {
+			return item.Id
+		})
+		deleted, err := s.repo.HardDeleteRequestLogs(ctx, ids)
+		if err != nil {
+			return resp, err
+		}
+		resp.Deleted += deleted
+		resp.Batches++
+		resp.Duration = time.Since(start).Milliseconds()
+		if len(logs) < cfg.BatchSize {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case <-time.After(requestLogPurgePause):
+		}
+	}
+	resp.Duration = time.Since(start).Milliseconds()
+	if resp.Deleted > 0 {
+		logger.Info("请求日志清理|完成",
+			zap.String("before", resp.Before),
+			zap.Int64("deleted", resp.Deleted),
+			zap.Int64("archived", resp.Archived),
+			zap.String("archiveFile", resp.ArchiveFile),
+		)
+	}
+	return resp, nil
+}
+
+// PurgeExpiredStats 按 statMaxRange 清理 minute/hour 统计，超出范围的桶不会再被查询，不受保留策略开关影响
+// day 统计用于累计费用和报表，不清理
+func (s *requestLogRetentionService) PurgeExpiredStats(ctx context.Context) (int64, error) {
+	var total int64
+	for _, period := range []string{model.StatPeriodMinute, model.StatPeriodHour} {
+		before := time.Now().Add(-statMaxRange[period])
+		for {
+			deleted, err := s.statRepo.DeleteRequestLogStatsBefore(ctx, period, before, defaultRequestLogPurgeBatch)
+			total += deleted
+			if err != nil {
+				return total, err
+			}
+			if deleted < defaultRequestLogPurgeBatch {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return total, ctx.Err()
+			case <-time.After(requestLogPurgePause):
+			}
+		}
+	}
+	if total > 0 {
+		s.Logger.WithContext(ctx).Info("请求日志清理|已清理过期的统计", zap.Int64("deleted", total))
+	}
+	return total, nil
+}
+
+// requestLogArchive 一次清理对应一个 gzip 压缩的 JSONL 文件，每行一条日志，格式与导出接口相同
+type requestLogArchive struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+func openRequestLogArchive(dir string, now time.Time) (*requestLogArchive, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("request_logs_%s.jsonl.gz", now.Format("20060102T150405")))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	return &requestLogArchive{
+		path: path,
+		file: file,
+		gz:   gz,
+		enc:  json.NewEncoder(gz),
+	}, nil
+}
+
+// Write 写完一批后立即 Flush，保证删除前这批日志已经落到文件中
+// 使用与导出相同的格式，不包含调用方的 api key
+func (a *requestLogArchive) Write(logs []*model.RequestLog) error {
+	for _, item := range logs {
+		if err := a.enc.Encode(toRequestLogItem(item)); err != nil {
+			return err
+		}
+	}
+	if err := a.gz.Flush(); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+func (a *requestLogArchive) Close() error {
+	if err := a.gz.Close(); err != nil {
+		_ = a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"errors"
+	apiV1 "github.com/jiu-u/oai-api/api/v1"
+	"github.com/jiu-u/oai-api/internal/model"
+	"github.com/jiu-u/oai-api/internal/repository"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// statMaxRange 各粒度单次查询允许的最大时间范围，避免一次返回过多的点
+var statMaxRange = map[string]time.Duration{
+	model.StatPeriodMinute: 48 * time.Hour,
+	model.StatPeriodHour:   93 * 24 * time.Hour,
+	model.StatPeriodDay:    3 * 366 * 24 * time.Hour,
+}
+
+var statPeriods = []string{model.StatPeriodMinute, model.StatPeriodHour, model.StatPeriodDay}
+
+type RequestLogStatService interface {
+	// AccumulateRequestLogs 把一批新写入的日志累加到 minute/hour/day 三个粒度的统计中
+	AccumulateRequestLogs(ctx context.Context, logs []*model.RequestLog) error
+	GetUsageStats(ctx context.Context, req *apiV1.UsageStatsQuery) (*apiV1.UsageStatsResponse, error)
+	// GetUserDailyUsage 当前用户按天的用量
+	GetUserDailyUsage(ctx context.Context, userId uint64, req *apiV1.UserUsageQuery) (*apiV1.UsageStatsResponse, error)
+	// GetUserUsageSummary 当前用户按模型、按key汇总的用量和剩余额度
+	GetUserUsageSummary(ctx context.Context, userId uint64, req *apiV1.UserUsageQuery) (*apiV1.UserUsageSummary, error)
+}
+
+func NewRequestLogStatService(
+	s *Service,
+	repo repository.RequestLogStatRepository,
+	userRepo repository.UserRepository,
+) RequestLogStatService {
+	return &requestLogStatService{
+		Service:  s,
+		repo:     repo,
+		userRepo: userRepo,
+	}
+}
+
+type requestLogStatService struct {
+	*Service
+	repo     repository.RequestLogStatRepository
+	userRepo repository.UserRepository
+}
+
+// statBucketTime 按本地时区取时间桶的开始时间
+func statBucketTime(t time.Time, period string) time.Time {
+	switch period {
+	case model.StatPeriodMinute:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location())
+	case model.StatPeriodHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+}
+
+// requestLogChannelId 取最后一次选到渠道的尝试，成功的请求即为实际响应的渠道
+func requestLogChannelId(log *model.RequestLog) uint64 {
+	for i := len(log.Attempts) - 1; i >= 0; i-- {
+		if log.Attempts[i].ChannelId != 0 {
+			return log.Attempts[i].ChannelId
+		}
+	}
+	return 0
+}
+
+type statBucketKey struct {
+	period    string
+	bucket    time.Time
+	model     string
+	channelId uint64
+	userId    uint64
+	apiKeyId  uint64
+}
+
+// AccumulateRequestLogs 先在内存中按桶合并，再逐个桶 upsert，减少同一批日志对同一行的重复更新
+func (s *requestLogStatService) AccumulateRequestLogs(ctx context.Context, logs []*model.RequestLog) error {
+	merged := make(map[statBucketKey]*model.RequestLogStat)
+	var stats []*model.RequestLogStat
+	for _, log := range logs {
+		item := &model.RequestLogStat{
+			Model:            log.Model,
+			ChannelId:        requestLogChannelId(log),
+			UserId:           log.UserId,
+			ApiKeyId:         log.ApiKeyId,
+			Requests:         1,
+			PromptTokens:     int64(log.PromptTokens),
+			CompletionTokens: int64(log.CompletionTokens),
+			Cost:             log.Cost,
+		}
+		if log.Status != model.RequestLogStatusSuccess {
+			item.Errors = 1
+		}
+		item.ObserveLatency(log.TotalLatency)
+		createdAt := log.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		for _, period := range statPeriods {
+			key := statBucketKey{
+				period:    period,
+				bucket:    statBucketTime(createdAt, period),
+				model:     item.Model,
+				channelId: item.ChannelId,
+				userId:    item.UserId,
+				apiKeyId:  item.ApiKeyId,
+			}
+			if stat, ok := merged[key]; ok {
+				stat.Merge(item)
+				continue
+			}
+			stat := *item
+			stat.Id = s.Sid.GenUint64()
+			stat.Period = period
+			stat.BucketTime = key.bucket
+			merged[key] = &stat
+			stats = append(stats, &stat)
+		}
+	}
+	if len(stats) == 0 {
+		return nil
+	}
+	return s.repo.IncrRequestLogStats(ctx, stats)
+}
+
+func parseStatId(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// parseStatRange 统计查询的时间范围，左闭右开
+func parseStatRange(start, end string) (time.Time, time.Time, error) {
+	startTime, err := time.ParseInLocation(time.DateTime, start, time.Local)
+	if err != nil {
+		return startTime, startTime, errors.New("startTime 格式应为 2006-01-02 15:04:05")
+	}
+	endTime, err := time.ParseInLocation(time.DateTime, end, time.Local)
+	if err != nil {
+		return startTime, endTime, errors.New("endTime 格式应为 2006-01-02 15:04:05")
+	}
+	if !endTime.After(startTime) {
+		return startTime, endTime, errors.New("endTime 需要晚于 startTime")
+	}
+	return startTime, endTime, nil
+}
+
+func (s *requestLogStatService) GetUsageStats(ctx context.Context, req *apiV1.UsageStatsQuery) (*apiV1.UsageStatsResponse, error) {
+	startTime, endTime, err := parseStatRange(req.StartTime, req.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	if endTime.Sub(startTime) > statMaxRange[req.Interval] {
+		return nil, errors.New("时间范围过大，请使用更大的统计粒度")
+	}
+	q := &repository.RequestLogStatQuery{
+		Period:    req.Interval,
+		StartTime: startTime,
+		EndTime:   endTime,
+		GroupBy:   req.GroupBy,
+		Model:     req.Model,
+	}
+	if q.ChannelId, err = parseStatId(req.ChannelId); err != nil {
+		return nil, errors.New("channelId is invalid")
+	}
+	if q.UserId, err = parseStatId(req.UserId); err != nil {
+		return nil, errors.New("userId is invalid")
+	}
+	if q.ApiKeyId, err = parseStatId(req.ApiKeyId); err != nil {
+		return nil, errors.New("apiKeyId is invalid")
+	}
+	rows, err := s.repo.FindRequestLogStats(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	seriesMp := make(map[string]*apiV1.UsageStatsSeries)
+	var seriesList []*apiV1.UsageStatsSeries
+	for _, row := range rows {
+		group := statGroupKey(row, req.GroupBy)
+		series, ok := seriesMp[group]
+		if !ok {
+			series = &apiV1.UsageStatsSeries{Group: group}
+			seriesMp[group] = series
+			seriesList = append(seriesList, series)
+		}
+		series.Requests += row.Requests
+		series.Points = append(series.Points, toUsageStatsPoint(row))
+	}
+	// 请求数多的分组排在前面
+	sort.SliceStable(seriesList, func(i, j int) bool {
+		return seriesList[i].Requests > seriesList[j].Requests
+	})
+	resp := &apiV1.UsageStatsResponse{
+		Interval: req.Interval,
+		GroupBy:  req.GroupBy,
+		Series:   make([]apiV1.UsageStatsSeries, 0, len(seriesList)),
+	}
+	for _, series := range seriesList {
+		resp.Series = append(resp.Series, *series)
+	}
+	return resp, nil
+}
+
+func (s *requestLogStatService) GetUserDailyUsage(ctx context.Context, userId uint64, req *apiV1.UserUsageQuery) (*apiV1.UsageStatsResponse, error) {
+	return s.GetUsageStats(ctx, &apiV1.UsageStatsQuery{
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+		Interval:  model.StatPeriodDay,
+		UserId:    strconv.FormatUint(userId, 10),
+	})
+}
+
+func (s *requestLogStatService) GetUserUsageSummary(ctx context.Context, userId uint64, req *apiV1.UserUsageQuery) (*apiV1.UserUsageSummary, error) {
+	startTime, endTime, err := parseStatRange(req.StartTime, req.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	resp := new(apiV1.UserUsageSummary)
+	for _, groupBy := range []string{"model", "key"} {
+		rows, err := s.repo.FindRequestLogStats(ctx, &repository.RequestLogStatQuery{
+			Period:    model.StatPeriodDay,
+			StartTime: startTime,
+			EndTime:   endTime,
+			GroupBy:   groupBy,
+			UserId:    userId,
+		})
+		if err != nil {
+			return nil, err
+		}
+		items := sumUsageBreakdown(rows, groupBy)
+		if groupBy == "model" {
+			resp.Models = items
+		} else {
+			resp.Keys = items
+		}
+	}
+	user, err := s.userRepo.FindUserById(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	used, err := s.repo.SumUserCost(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	resp.Credit = apiV1.UserCredit{
+		Unlimited: user.CreditLimit <= 0,
+		Limit:     user.CreditLimit,
+		Used:      used,
+	}
+	if !resp.Credit.Unlimited {
+		resp.Credit.Remaining = max(user.CreditLimit-used, 0)
+	}
+	return resp, nil
+}
+
+// sumUsageBreakdown 把按天分组的结果汇总成每个分组一行，按请求数从多到少排序
+func sumUsageBreakdown(rows []*model.RequestLogStat, groupBy string) []apiV1.UsageBreakdownItem {
+	mp := make(map[string]*apiV1.UsageBreakdownItem)
+	var list []*apiV1.UsageBreakdownItem
+	for _, row := range rows {
+		name := statGroupKey(row, groupBy)
+		item, ok := mp[name]
+		if !ok {
+			item = &apiV1.UsageBreakdownItem{Name: name}
+			mp[name] = item
+			list = append(list, item)
+		}
+		item.Requests += row.Requests
+		item.Errors += row.Errors
+		item.PromptTokens += row.PromptTokens
+		item.CompletionTokens += row.CompletionTokens
+		item.TotalTokens += row.PromptTokens + row.CompletionTokens
+		item.Cost += row.Cost
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Requests > list[j].Requests
+	})
+	resp := make([]apiV1.UsageBreakdownItem, 0, len(list))
+	for _, item := range list {
+		resp = append(resp, *item)
+	}
+	return resp
+}
+
+func statGroupKey(row *model.RequestLogStat, groupBy string) string {
+	switch groupBy {
+	case "model":
+		return row.Model
+	case "channel":
+		return strconv.FormatUint(row.ChannelId, 10)
+	case "user":
+		return strconv.FormatUint(row.UserId, 10)
+	case "key":
+		return strconv.FormatUint(row.ApiKeyId, 10)
+	}
+	return ""
+}
+
+func toUsageStatsPoint(row *model.RequestLogStat) apiV1.UsageStatsPoint {
+	point := apiV1.UsageStatsPoint{
+		Time:             row.BucketTime.In(time.Local).Format(time.DateTime),
+		Requests:         row.Requests,
+		Errors:           row.Errors,
+		PromptTokens:     row.PromptTokens,
+		CompletionTokens: row.CompletionTokens,
+		TotalTokens:      row.PromptTokens + row.CompletionTokens,
+		Cost:             row.Cost,
+	}
+	if row.Requests > 0 {
+		point.AvgLatency = row.LatencySum / row.Requests
+	}
+	counts := histogramCounts(&row.LatencyHistogram)
+	point.P50Latency = latencyPercentile(counts, 0.5)
+	point.P95Latency = latencyPercentile(counts, 0.95)
+	return point
+}
+
+func histogramCounts(h *model.LatencyHistogram) []int64 {
+	buckets := h.LatencyBuckets()
+	counts := make([]int64, len(buckets))
+	for i, bucket := range buckets {
+		counts[i] = *bucket
+	}
+	return counts
+}
+
+// latencyPercentile 从直方图估算分位数，在命中的桶内线性插值，落在最后一个桶时返回最大的上界
+func latencyPercentile(counts []int64, q float64) int64 {
+	var total int64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var cum int64
+	for i, c := range counts {
+		if c == 0 || float64(cum+c) < rank {
+			cum += c
+			continue
+		}
+		if i >= len(model.StatLatencyBounds) {
+			return model.StatLatencyBounds[len(model.StatLatencyBounds)-1]
+		}
+		var lower int64
+		if i > 0 {
+			lower = model.StatLatencyBounds[i-1]
+		}
+		upper := model.StatLatencyBounds[i]
+		return lower + int64(float64(upper-lower)*(rank-float64(cum))/float64(c))
+	}
+	return model.StatLatencyBounds[len(model.StatLatencyBounds)-1]
+}
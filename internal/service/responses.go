@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	adapter "github.com/jiu-u/oai-adapter"
+	"github.com/jiu-u/oai-api/internal/dto"
+	"github.com/jiu-u/oai-api/internal/model"
+	"github.com/jiu-u/oai-api/internal/repository"
+	"github.com/jiu-u/oai-api/pkg/encrypte"
+	"github.com/jiu-u/oai-api/pkg/protocol/responses"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// responsesConfigCacheKey Responses 配置缓存，修改配置时删除
+	responsesConfigCacheKey      = "responsesConfig"
+	defaultResponseStateTTLHours = 24
+)
+
+// ErrResponseStateNotFound previous_response_id 不存在、已过期或不属于当前 api key
+var ErrResponseStateNotFound = errors.New("previous response not found")
+
+// ResponsesRelayBody 一次 Responses 请求的两种请求体，每次重试按选中的渠道是否支持原生 Responses API 选择
+// 转发成功后 UseNative 为最后一次实际使用的方式，调用方据此解析响应
+type ResponsesRelayBody struct {
+	Request *responses.Request
+	// Id 转换为 chat completions 时使用的响应 id，原生转发时使用上游返回的 id
+	Id string
+	// Items 之前的对话加上本次的输入项，保存对话状态时在后面追加输出项
+	Items     []responses.InputItem
+	Native    []byte
+	Chat      []byte
+	UseNative bool
+	endPoint  string
+}
+
+// nativeRequester 可以直接请求上游任意接口的适配器，OpenAI 类型的渠道支持
+type nativeRequester interface {
+	DoJsonRequest(ctx context.Context, Method string, url string, body io.Reader) (io.ReadCloser, http.Header, error)
+}
+
+// choose 渠道支持原生 Responses API 且适配器可以直接请求时原样转发，否则转换为 chat completions
+// 请求中有无法转换的内置工具时 Chat 为nil，渠道不支持原生转发时返回false，跳过该渠道
+func (b *ResponsesRelayBody) choose(conf *dto.ChannelModelConf, ad adapter.Adapter) bool {
+	_, ok := ad.(nativeRequester)
+	b.UseNative = conf.ResponsesAPI && ok
+	b.endPoint = conf.ChannelEndPoint
+	return b.UseNative || b.Chat != nil
+}
+
+type ResponsesService interface {
+	// Prepare 取出 previous_response_id 对应的对话并生成两种请求体，raw 为原始请求体
+	Prepare(ctx context.Context, raw []byte, req *responses.Request) (*ResponsesRelayBody, error)
+	Relay(ctx context.Context, body *ResponsesRelayBody) (io.ReadCloser, http.Header, error)
+	// SaveState 保存本次响应后的对话状态，请求的 store 为 false 或响应失败时不保存
+	SaveState(ctx context.Context, body *ResponsesRelayBody, resp *responses.Response)
+	DeleteExpiredStates(ctx context.Context) (int64, error)
+}
+
+func NewResponsesService(
+	s *Service,
+	oaiService OaiService,
+	stateRepo repository.ResponseStateRepository,
+	systemRepo repository.SystemRepository,
+) ResponsesService {
+	return &responsesService{
+		Service:    s,
+		oaiService: oaiService,
+		stateRepo:  stateRepo,
+		systemRepo: systemRepo,
+	}
+}
+
+type responsesService struct {
+	*Service
+	oaiService OaiService
+	stateRepo  repository.ResponseStateRepository
+	systemRepo repository.SystemRepository
+}
+
+func (s *responsesService) Prepare(ctx context.Context, raw []byte, req *responses.Request) (*ResponsesRelayBody, error) {
+	input, err := responses.ParseInput(req.Input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	var items []responses.InputItem
+	if req.PreviousResponseId != "" {
+		items, err = s.loadState(ctx, req.PreviousResponseId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	items = append(items, input...)
+	body := &ResponsesRelayBody{
+		Request: req,
+		Id:      responses.NewId("resp"),
+		Items:   items,
+	}
+	if body.Native, err = responses.NativeBody(raw, items); err != nil {
+		return nil, err
+	}
+	// 只有内置工具等无法转换的内容时只能发给原生支持的渠道，其余转换错误直接返回
+	chatReq, err := responses.ToChat(req, items)
+	if err != nil && !hasBuiltinTools(req) {
+		return nil, err
+	}
+	if err == nil {
+		if body.Chat, err = json.Marshal(chatReq); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+func hasBuiltinTools(req *responses.Request) bool {
+	for _, tool := range req.Tools {
+		if tool.Type != "function" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *responsesService) loadState(ctx context.Context, id string) ([]responses.InputItem, error) {
+	apiKey, err := GetApiKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.stateRepo.FindResponseState(ctx, id)
+	if err != nil || state.KeyHash != encrypte.Sha256Encode(apiKey) {
+		return nil, fmt.Errorf("%w: %s", ErrResponseStateNotFound, id)
+	}
+	var items []responses.InputItem
+	if err = json.Unmarshal([]byte(state.Items), &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (s *responsesService) Relay(ctx context.Context, body *ResponsesRelayBody) (io.ReadCloser, http.Header, error) {
+	return s.oaiService.RelayRequest(ctx, body, body.Request.Model, RelayResponses)
+}
+
+func (s *responsesService) SaveState(ctx context.Context, body *ResponsesRelayBody, resp *responses.Response) {
+	if !body.Request.ShouldStore() || resp == nil || resp.Id == "" || resp.Status == responses.StatusFailed {
+		return
+	}
+	logger := s.Logger.WithContext(ctx)
+	apiKey, err := GetApiKey(ctx)
+	if err != nil {
+		return
+	}
+	items, err := json.Marshal(append(body.Items, responses.OutputToInput(resp.Output)...))
+	if err != nil {
+		logger.Warn("Responses|序列化对话状态失败", zap.Error(err))
+		return
+	}
+	ttl := time.Duration(s.stateTTLHours(ctx)) * time.Hour
+	err = s.stateRepo.CreateResponseState(ctx, &model.ResponseState{
+		Id:        resp.Id,
+		KeyHash:   encrypte.Sha256Encode(apiKey),
+		Model:     body.Request.Model,
+		Items:     string(items),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		logger.Warn("Responses|保存对话状态失败", zap.String("responseId", resp.Id), zap.Error(err))
+	}
+}
+
+// stateTTLHours 未配置时使用默认值，配置缓存一分钟
+func (s *responsesService) stateTTLHours(ctx context.Context) int {
+	if v, ok := s.Cache.Get(responsesConfigCacheKey); ok {
+		return v.(int)
+	}
+	hours := defaultResponseStateTTLHours
+	if cfg, err := s.systemRepo.GetResponsesConfig(ctx); err == nil && cfg.StateTTLHours > 0 {
+		hours = cfg.StateTTLHours
+	}
+	s.Cache.Set(responsesConfigCacheKey, hours, time.Minute)
+	return hours
+}
+
+func (s *responsesService) DeleteExpiredStates(ctx context.Context) (int64, error) {
+	return s.stateRepo.DeleteExpiredResponseStates(ctx, time.Now())
+}
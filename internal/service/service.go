@@ -7,6 +7,7 @@ import (
 	"github.com/jiu-u/oai-api/pkg/cache"
 	"github.com/jiu-u/oai-api/pkg/jwt"
 	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/secret"
 	"github.com/jiu-u/oai-api/pkg/sid"
 )
 
@@ -16,6 +17,7 @@ type Service struct {
 	Logger *log.Logger
 	Jwt    *jwt.JWT
 	Cache  *cache.Cache
+	Cipher *secret.Cipher
 }
 
 func NewService(
@@ -24,6 +26,7 @@ func NewService(
 	logger *log.Logger,
 	jwt *jwt.JWT,
 	cache *cache.Cache,
+	cipher *secret.Cipher,
 ) *Service {
 	return &Service{
 		Sid:    sid,
@@ -31,6 +34,7 @@ func NewService(
 		Logger: logger,
 		Jwt:    jwt,
 		Cache:  cache,
+		Cipher: cipher,
 	}
 }
 
@@ -42,3 +46,13 @@ func GetClientIp(ctx context.Context) string {
 	}
 	return str
 }
+
+func GetRequestId(ctx context.Context) string {
+	str, _ := ctx.Value(constant.RequestIdKey).(string)
+	return str
+}
+
+func GetRequestPath(ctx context.Context) string {
+	str, _ := ctx.Value(constant.RequestPathKey).(string)
+	return str
+}
@@ -1,9 +1,11 @@
 package service
 
 import (
+	"fmt"
 	apiV1 "github.com/jiu-u/oai-api/api/v1"
 	"github.com/jiu-u/oai-api/internal/dto"
 	"github.com/jiu-u/oai-api/internal/repository"
+	"github.com/jiu-u/oai-api/pkg/datautils"
 	"golang.org/x/net/context"
 	"sync/atomic"
 )
@@ -23,6 +25,16 @@ type SystemConfigService interface {
 	InitSystemConfig(ctx context.Context) error
 	GetModelConfig(ctx context.Context) (*dto.ModelConfig, error)
 	SetModelConfig(ctx context.Context, cfg *dto.ModelConfig) error
+	GetBodyCaptureConfig(ctx context.Context) (*dto.BodyCaptureConfig, error)
+	SetBodyCaptureConfig(ctx context.Context, cfg *dto.BodyCaptureConfig) error
+	GetRequestLogRetentionConfig(ctx context.Context) (*dto.RequestLogRetentionConfig, error)
+	SetRequestLogRetentionConfig(ctx context.Context, cfg *dto.RequestLogRetentionConfig) error
+	GetUsageReportConfig(ctx context.Context) (*dto.UsageReportConfig, error)
+	SetUsageReportConfig(ctx context.Context, cfg *dto.UsageReportConfig) error
+	GetAlertConfig(ctx context.Context) (*dto.AlertConfig, error)
+	SetAlertConfig(ctx context.Context, cfg *dto.AlertConfig) error
+	GetResponsesConfig(ctx context.Context) (*dto.ResponsesConfig, error)
+	SetResponsesConfig(ctx context.Context, cfg *dto.ResponsesConfig) error
 }
 
 func NewSystemConfigService(s *Service, repo repository.SystemRepository) SystemConfigService {
@@ -40,7 +52,14 @@ type systemConfigService struct {
 }
 
 func (s *systemConfigService) SetEmailConfig(ctx context.Context, cfg *apiV1.EmailConfig) error {
-
+	if datautils.IsMaskedSecret(cfg.Password) {
+		// 前端回传的掩码，沿用原密码
+		old, err := s.repo.GetEmailConfig(ctx)
+		if err != nil {
+			return err
+		}
+		cfg.Password = old.Password
+	}
 	cfg.Id = s.Sid.GenUint64()
 	err := s.Tm.Transaction(ctx, func(ctx context.Context) error {
 		err := s.repo.SetEmailConfig(ctx, cfg)
@@ -51,7 +70,11 @@ func (s *systemConfigService) SetEmailConfig(ctx context.Context, cfg *apiV1.Ema
 
 func (s *systemConfigService) GetEmailConfig(ctx context.Context) (*apiV1.EmailConfig, error) {
 	resp, err := s.repo.GetEmailConfig(ctx)
-	return resp, err
+	if err != nil {
+		return nil, err
+	}
+	resp.Password = datautils.MaskSecret(resp.Password)
+	return resp, nil
 }
 
 func (s *systemConfigService) IsEmailServiceAvailable(ctx context.Context) (bool, error) {
@@ -60,6 +83,13 @@ func (s *systemConfigService) IsEmailServiceAvailable(ctx context.Context) (bool
 }
 
 func (s *systemConfigService) SetLinuxDoOAuthConfig(ctx context.Context, cfg *apiV1.LinuxDoOAuthConfig) error {
+	if datautils.IsMaskedSecret(cfg.ClientSecret) {
+		old, err := s.repo.GetLinuxDoOAuthConfig(ctx)
+		if err != nil {
+			return err
+		}
+		cfg.ClientSecret = old.ClientSecret
+	}
 	id := s.Sid.GenUint64()
 	cfg.Id = id
 	err := s.repo.SetLinuxDoOAuthConfig(ctx, cfg)
@@ -67,7 +97,12 @@ func (s *systemConfigService) SetLinuxDoOAuthConfig(ctx context.Context, cfg *ap
 }
 
 func (s *systemConfigService) GetLinuxDoOAuthConfig(ctx context.Context) (*apiV1.LinuxDoOAuthConfig, error) {
-	return s.repo.GetLinuxDoOAuthConfig(ctx)
+	resp, err := s.repo.GetLinuxDoOAuthConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp.ClientSecret = datautils.MaskSecret(resp.ClientSecret)
+	return resp, nil
 }
 
 func (s *systemConfigService) IsLinuxDoOAuthAvailable(ctx context.Context) (bool, error) {
@@ -75,13 +110,25 @@ func (s *systemConfigService) IsLinuxDoOAuthAvailable(ctx context.Context) (bool
 }
 
 func (s *systemConfigService) SetGithubOAuthConfig(ctx context.Context, cfg *apiV1.GithubOAuthConfig) error {
+	if datautils.IsMaskedSecret(cfg.ClientSecret) {
+		old, err := s.repo.GetGithubOAuthConfig(ctx)
+		if err != nil {
+			return err
+		}
+		cfg.ClientSecret = old.ClientSecret
+	}
 	cfg.Id = s.Sid.GenUint64()
 	err := s.repo.SetGithubOAuthConfig(ctx, cfg)
 	return err
 }
 
 func (s *systemConfigService) GetGithubOAuthConfig(ctx context.Context) (*apiV1.GithubOAuthConfig, error) {
-	return s.repo.GetGithubOAuthConfig(ctx)
+	resp, err := s.repo.GetGithubOAuthConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp.ClientSecret = datautils.MaskSecret(resp.ClientSecret)
+	return resp, nil
 }
 
 func (s *systemConfigService) IsGithubOAuthAvailable(ctx context.Context) (bool, error) {
@@ -143,3 +190,154 @@ func (s *systemConfigService) SetModelConfig(ctx context.Context, cfg *dto.Model
 	})
 	return err
 }
+
+// GetBodyCaptureConfig 未配置时返回默认值，即不采集
+func (s *systemConfigService) GetBodyCaptureConfig(ctx context.Context) (*dto.BodyCaptureConfig, error) {
+	resp, err := s.repo.GetBodyCaptureConfig(ctx)
+	if err != nil {
+		return &dto.BodyCaptureConfig{
+			MaxBodySize:   defaultCaptureBodySize,
+			RetentionDays: defaultCaptureRetentionDays,
+		}, nil
+	}
+	return resp, nil
+}
+
+// SetBodyCaptureConfig 校验脱敏正则后保存，并清掉采集配置缓存使其立即生效
+func (s *systemConfigService) SetBodyCaptureConfig(ctx context.Context, cfg *dto.BodyCaptureConfig) error {
+	if _, err := newRedactor(cfg.RedactPatterns); err != nil {
+		return fmt.Errorf("脱敏正则无效: %w", err)
+	}
+	if cfg.MaxBodySize > maxCaptureBodySize {
+		return fmt.Errorf("maxBodySize 不能超过 %d", maxCaptureBodySize)
+	}
+	err := s.Tm.Transaction(ctx, func(ctx context.Context) error {
+		cfg.Id = s.Sid.GenUint64()
+		return s.repo.SetBodyCaptureConfig(ctx, cfg)
+	})
+	if err != nil {
+		return err
+	}
+	s.Cache.Delete(bodyCaptureCacheKey)
+	return nil
+}
+
+// GetRequestLogRetentionConfig 未配置时返回默认值，即不自动清理
+func (s *systemConfigService) GetRequestLogRetentionConfig(ctx context.Context) (*dto.RequestLogRetentionConfig, error) {
+	resp, err := s.repo.GetRequestLogRetentionConfig(ctx)
+	if err != nil {
+		return &dto.RequestLogRetentionConfig{
+			RetentionDays: defaultRequestLogRetentionDays,
+			ArchiveDir:    defaultRequestLogArchiveDir,
+			BatchSize:     defaultRequestLogPurgeBatch,
+		}, nil
+	}
+	return resp, nil
+}
+
+func (s *systemConfigService) SetRequestLogRetentionConfig(ctx context.Context, cfg *dto.RequestLogRetentionConfig) error {
+	return s.Tm.Transaction(ctx, func(ctx context.Context) error {
+		cfg.Id = s.Sid.GenUint64()
+		return s.repo.SetRequestLogRetentionConfig(ctx, cfg)
+	})
+}
+
+// GetUsageReportConfig 未配置时返回默认值，即不发送
+func (s *systemConfigService) GetUsageReportConfig(ctx context.Context) (*dto.UsageReportConfig, error) {
+	resp, err := s.repo.GetUsageReportConfig(ctx)
+	if err != nil {
+		return &dto.UsageReportConfig{}, nil
+	}
+	return resp, nil
+}
+
+// SetUsageReportConfig 最近一次发送的月份由定时任务维护，保存时沿用原值
+func (s *systemConfigService) SetUsageReportConfig(ctx context.Context, cfg *dto.UsageReportConfig) error {
+	return s.Tm.Transaction(ctx, func(ctx context.Context) error {
+		cfg.LastSentMonth = ""
+		if old, err := s.repo.GetUsageReportConfig(ctx); err == nil {
+			cfg.LastSentMonth = old.LastSentMonth
+		}
+		cfg.Id = s.Sid.GenUint64()
+		return s.repo.SetUsageReportConfig(ctx, cfg)
+	})
+}
+
+// GetAlertConfig 未配置时返回默认值，即只给管理员发邮件，通道密钥以掩码返回
+func (s *systemConfigService) GetAlertConfig(ctx context.Context) (*dto.AlertConfig, error) {
+	resp, err := s.repo.GetAlertConfig(ctx)
+	if err != nil {
+		return &dto.AlertConfig{
+			DedupMinutes:       defaultAlertDedupMinutes,
+			RateLimitPerMinute: defaultAlertRatePerMinute,
+		}, nil
+	}
+	for i := range resp.Sinks {
+		resp.Sinks[i].Secret = datautils.MaskSecret(resp.Sinks[i].Secret)
+	}
+	return resp, nil
+}
+
+// SetAlertConfig 通道名称必须唯一且规则只能引用已有通道，回传掩码的密钥按通道名称沿用原值
+func (s *systemConfigService) SetAlertConfig(ctx context.Context, cfg *dto.AlertConfig) error {
+	names := make(map[string]struct{}, len(cfg.Sinks))
+	for _, sink := range cfg.Sinks {
+		if _, ok := names[sink.Name]; ok {
+			return fmt.Errorf("告警通道名称重复: %s", sink.Name)
+		}
+		if sink.Type != alertSinkEmail && sink.Url == "" {
+			return fmt.Errorf("告警通道 %s 缺少 url", sink.Name)
+		}
+		names[sink.Name] = struct{}{}
+	}
+	for _, rule := range cfg.Rules {
+		for _, name := range rule.Sinks {
+			if _, ok := names[name]; !ok {
+				return fmt.Errorf("告警规则 %s 引用了不存在的通道: %s", rule.Event, name)
+			}
+		}
+	}
+	err := s.Tm.Transaction(ctx, func(ctx context.Context) error {
+		old, err := s.repo.GetAlertConfig(ctx)
+		oldSecrets := make(map[string]string)
+		if err == nil {
+			for _, sink := range old.Sinks {
+				oldSecrets[sink.Name] = sink.Secret
+			}
+		}
+		for i := range cfg.Sinks {
+			if datautils.IsMaskedSecret(cfg.Sinks[i].Secret) {
+				cfg.Sinks[i].Secret = oldSecrets[cfg.Sinks[i].Name]
+			}
+		}
+		cfg.Id = s.Sid.GenUint64()
+		return s.repo.SetAlertConfig(ctx, cfg)
+	})
+	if err != nil {
+		return err
+	}
+	s.Cache.Delete(alertConfigCacheKey)
+	return nil
+}
+
+// GetResponsesConfig 未配置时返回默认值
+func (s *systemConfigService) GetResponsesConfig(ctx context.Context) (*dto.ResponsesConfig, error) {
+	resp, err := s.repo.GetResponsesConfig(ctx)
+	if err != nil {
+		return &dto.ResponsesConfig{StateTTLHours: defaultResponseStateTTLHours}, nil
+	}
+	return resp, nil
+}
+
+// SetResponsesConfig 保存后清掉配置缓存，新的保留时间只影响之后保存的对话
+func (s *systemConfigService) SetResponsesConfig(ctx context.Context, cfg *dto.ResponsesConfig) error {
+	err := s.Tm.Transaction(ctx, func(ctx context.Context) error {
+		cfg.Id = s.Sid.GenUint64()
+		return s.repo.SetResponsesConfig(ctx, cfg)
+	})
+	if err != nil {
+		return err
+	}
+	s.Cache.Delete(responsesConfigCacheKey)
+	return nil
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type UpstreamErrorLevel int
+
+const (
+	// UpstreamErrTransient 临时错误，如超时、限流、5xx，重试或冷却后可能恢复
+	UpstreamErrTransient UpstreamErrorLevel = iota
+	// UpstreamErrKeyFatal key失效，如鉴权失败、额度耗尽
+	UpstreamErrKeyFatal
+	// UpstreamErrModelFatal 模型在该渠道下不可用，如模型被下架
+	UpstreamErrModelFatal
+)
+
+// quotaKeywords 上游错误体的 error.code/error.type 包含这些关键字时认为key的额度已经耗尽
+var quotaKeywords = []string{
+	"insufficient_quota",
+	"quota_exceeded",
+	"insufficient_balance",
+	"billing_not_active",
+}
+
+// modelKeywords 上游错误体的 error.code/error.type 包含这些关键字时认为模型已不可用
+var modelKeywords = []string{
+	"model_not_found",
+	"model_not_supported",
+	"unsupported_model",
+}
+
+// UpstreamStatusCode 从适配器返回的错误中解析上游http状态码，格式为 "401 Unauthorized: detail"
+func UpstreamStatusCode(err error) int {
+	var probeErr *CheckProbeError
+	if errors.As(err, &probeErr) {
+		err = probeErr.Err
+	}
+	if err == nil {
+		return 0
+	}
+	msg := err.Error()
+	if len(msg) < 3 {
+		return 0
+	}
+	code, err := strconv.Atoi(msg[:3])
+	if err != nil {
+		return 0
+	}
+	return code
+}
+
+// upstreamErrorBody 只取错误体中的结构化字段，message 可能回显用户输入，不参与判断
+type upstreamErrorBody struct {
+	Error json.RawMessage `json:"error"`
+	Code  any             `json:"code"`
+	Type  string          `json:"type"`
+}
+
+type upstreamErrorDetail struct {
+	Code   any    `json:"code"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+// upstreamErrorCodes 解析 "401 Unauthorized: {json}" 中错误体的 code、type 字段，返回小写形式
+// 错误体不是json对象时返回空，不会去匹配原始文本
+func upstreamErrorCodes(err error) []string {
+	_, body, ok := strings.Cut(err.Error(), ": ")
+	if !ok {
+		return nil
+	}
+	body = strings.TrimSpace(body)
+	if !strings.HasPrefix(body, "{") {
+		return nil
+	}
+	var errBody upstreamErrorBody
+	if json.NewDecoder(strings.NewReader(body)).Decode(&errBody) != nil {
+		return nil
+	}
+	codes := []string{fmtErrorCode(errBody.Code), errBody.Type}
+	var detail upstreamErrorDetail
+	if len(errBody.Error) > 0 && json.Unmarshal(errBody.Error, &detail) == nil {
+		codes = append(codes, fmtErrorCode(detail.Code), detail.Type, detail.Status)
+	}
+	result := make([]string, 0, len(codes))
+	for _, code := range codes {
+		if code != "" {
+			result = append(result, strings.ToLower(code))
+		}
+	}
+	return result
+}
+
+func fmtErrorCode(code any) string {
+	switch v := code.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// matchErrorCode 返回第一个被错误码包含的关键字
+func matchErrorCode(codes []string, keywords []string) string {
+	for _, code := range codes {
+		for _, keyword := range keywords {
+			if strings.Contains(code, keyword) {
+				return keyword
+			}
+		}
+	}
+	return ""
+}
+
+// ClassifyUpstreamError 将上游错误分为临时错误和致命错误，致命错误会附带禁用原因
+// 转发请求的内容由调用方决定，400/403/404 可能是请求本身造成的，只冷却不禁用；
+// 只有 401/402 和错误体中的额度错误码会禁用key。探测请求(CheckProbeError)由网关构造，
+// 失败才能确定归因于key或模型，403/404 和模型错误码会禁用key或模型
+func ClassifyUpstreamError(err error) (UpstreamErrorLevel, string) {
+	if err == nil {
+		return UpstreamErrTransient, ""
+	}
+	var probeErr *CheckProbeError
+	probe := errors.As(err, &probeErr)
+	if probe {
+		err = probeErr.Err
+	}
+	switch UpstreamStatusCode(err) {
+	case http.StatusUnauthorized:
+		return UpstreamErrKeyFatal, "鉴权失败(401)"
+	case http.StatusPaymentRequired:
+		return UpstreamErrKeyFatal, "额度不足(402)"
+	case http.StatusForbidden:
+		if probe {
+			return UpstreamErrKeyFatal, "无访问权限(403)"
+		}
+		return UpstreamErrTransient, ""
+	case http.StatusNotFound:
+		if probe {
+			return UpstreamErrModelFatal, "模型不存在(404)"
+		}
+		return UpstreamErrTransient, ""
+	case http.StatusBadRequest:
+		if !probe {
+			return UpstreamErrTransient, ""
+		}
+	}
+	codes := upstreamErrorCodes(err)
+	if keyword := matchErrorCode(codes, quotaKeywords); keyword != "" {
+		return UpstreamErrKeyFatal, "额度不足(" + keyword + ")"
+	}
+	if !probe {
+		return UpstreamErrTransient, ""
+	}
+	if keyword := matchErrorCode(codes, modelKeywords); keyword != "" {
+		return UpstreamErrModelFatal, "模型不可用(" + keyword + ")"
+	}
+	return UpstreamErrTransient, ""
+}
+
+const (
+	attemptErrRateLimit = "rate_limit"
+	attemptErrAuth      = "auth"
+	attemptErrQuota     = "quota"
+	attemptErrModel     = "model"
+	attemptErrTimeout   = "timeout"
+	attemptErrServer    = "server"
+	attemptErrClient    = "client"
+	attemptErrOther     = "other"
+)
+
+// timeoutKeywords 没有状态码时根据这些关键字判断为超时
+var timeoutKeywords = []string{
+	"timeout",
+	"deadline exceeded",
+	"timed out",
+}
+
+// classifyAttemptError 按请求日志中记录的状态码和错误信息对失败的尝试归类，用于渠道统计
+func classifyAttemptError(statusCode int, msg string) string {
+	switch statusCode {
+	case http.StatusTooManyRequests:
+		return attemptErrRateLimit
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return attemptErrAuth
+	case http.StatusPaymentRequired:
+		return attemptErrQuota
+	case http.StatusNotFound:
+		return attemptErrModel
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return attemptErrTimeout
+	}
+	msg = strings.ToLower(msg)
+	for _, keyword := range quotaKeywords {
+		if strings.Contains(msg, keyword) {
+			return attemptErrQuota
+		}
+	}
+	for _, keyword := range modelKeywords {
+		if strings.Contains(msg, keyword) {
+			return attemptErrModel
+		}
+	}
+	switch {
+	case statusCode >= 500:
+		return attemptErrServer
+	case statusCode >= 400:
+		return attemptErrClient
+	}
+	for _, keyword := range timeoutKeywords {
+		if strings.Contains(msg, keyword) {
+			return attemptErrTimeout
+		}
+	}
+	return attemptErrOther
+}
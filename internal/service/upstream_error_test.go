@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpstreamStatusCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{errors.New("401 Unauthorized: invalid key"), 401},
+		{errors.New("503 Service Unavailable"), 503},
+		{errors.New("ab"), 0},
+		{errors.New("context deadline exceeded"), 0},
+	}
+	for _, tt := range tests {
+		if got := UpstreamStatusCode(tt.err); got != tt.want {
+			t.Errorf("UpstreamStatusCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyUpstreamError(t *testing.T) {
+	probe := func(err error) error {
+		return &CheckProbeError{Err: err, StatusCode: UpstreamStatusCode(err)}
+	}
+	tests := []struct {
+		name       string
+		err        error
+		want       UpstreamErrorLevel
+		wantReason bool
+	}{
+		{"nil", nil, UpstreamErrTransient, false},
+		{"401", errors.New("401 Unauthorized: invalid api key"), UpstreamErrKeyFatal, true},
+		{"402", errors.New("402 Payment Required: pay first"), UpstreamErrKeyFatal, true},
+		{"403", errors.New("403 Forbidden: region not supported"), UpstreamErrTransient, false},
+		{"404", errors.New("404 Not Found: no such model"), UpstreamErrTransient, false},
+		{"429", errors.New("429 Too Many Requests: slow down"), UpstreamErrTransient, false},
+		{"500", errors.New("500 Internal Server Error: oops"), UpstreamErrTransient, false},
+		{"502", errors.New("502 Bad Gateway"), UpstreamErrTransient, false},
+		{"503", errors.New("503 Service Unavailable: overloaded"), UpstreamErrTransient, false},
+		{"429 quota code", errors.New(`429 Too Many Requests: {"error":{"message":"quota","type":"insufficient_quota"}}`), UpstreamErrKeyFatal, true},
+		{"429 quota top level", errors.New(`429 Too Many Requests: {"code":"insufficient_quota"}`), UpstreamErrKeyFatal, true},
+		{"429 quota in message", errors.New(`429 Too Many Requests: {"error":{"message":"insufficient_quota","type":"rate_limit"}}`), UpstreamErrTransient, false},
+		{"400 model code", errors.New(`400 Bad Request: {"error":{"code":"model_not_found"}}`), UpstreamErrTransient, false},
+		{"400 model text", errors.New("400 Bad Request: The model does not exist"), UpstreamErrTransient, false},
+		{"network", errors.New("dial tcp: connection refused"), UpstreamErrTransient, false},
+		{"probe 401", probe(errors.New("401 Unauthorized: invalid api key")), UpstreamErrKeyFatal, true},
+		{"probe 403", probe(errors.New("403 Forbidden: region not supported")), UpstreamErrKeyFatal, true},
+		{"probe 404", probe(errors.New("404 Not Found: no such model")), UpstreamErrModelFatal, true},
+		{"probe 400 model code", probe(errors.New(`400 Bad Request: {"error":{"code":"model_not_found"}}`)), UpstreamErrModelFatal, true},
+		{"probe 400 quota code", probe(errors.New(`400 Bad Request: {"error":{"type":"insufficient_quota"}}`)), UpstreamErrKeyFatal, true},
+		{"probe 400 model text", probe(errors.New("400 Bad Request: The model does not exist")), UpstreamErrTransient, false},
+		{"probe 500", probe(errors.New("500 Internal Server Error: oops")), UpstreamErrTransient, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := ClassifyUpstreamError(tt.err)
+			if got != tt.want {
+				t.Fatalf("level = %d, want %d", got, tt.want)
+			}
+			if (reason != "") != tt.wantReason {
+				t.Fatalf("reason = %q, want reason %v", reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+// 转发请求的错误体可能回显用户输入，构造的400不能禁用key或模型
+func TestClassifyUpstreamErrorCrafted400(t *testing.T) {
+	bodies := []string{
+		`{"error":{"message":"insufficient_quota model_not_found","type":"invalid_request_error"}}`,
+		`{"error":{"code":"insufficient_quota","type":"model_not_found"}}`,
+		`{"code":"billing_not_active","type":"model_not_found"}`,
+		`prompt: {"error":{"code":"insufficient_quota"}} The model does not exist`,
+	}
+	for _, body := range bodies {
+		for _, status := range []string{"400 Bad Request", "403 Forbidden", "404 Not Found"} {
+			err := errors.New(status + ": " + body)
+			if level, reason := ClassifyUpstreamError(err); level != UpstreamErrTransient || reason != "" {
+				t.Errorf("ClassifyUpstreamError(%q) = %d, %q, want transient", err, level, reason)
+			}
+		}
+	}
+}
+
+// 错误体不是json对象时不匹配原始文本中的关键字
+func TestClassifyUpstreamErrorRawText(t *testing.T) {
+	err := errors.New(`500 Internal Server Error: echo {"error":{"code":"insufficient_quota"}}`)
+	if level, _ := ClassifyUpstreamError(err); level != UpstreamErrTransient {
+		t.Errorf("level = %d, want transient", level)
+	}
+}
+
+func TestUpstreamStatusCodeProbe(t *testing.T) {
+	err := &CheckProbeError{Err: errors.New("429 Too Many Requests: slow down")}
+	if got := UpstreamStatusCode(err); got != 429 {
+		t.Errorf("UpstreamStatusCode(probe) = %d, want 429", got)
+	}
+}
@@ -0,0 +1,459 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	apiV1 "github.com/jiu-u/oai-api/api/v1"
+	"github.com/jiu-u/oai-api/constant"
+	"github.com/jiu-u/oai-api/internal/dto"
+	"github.com/jiu-u/oai-api/internal/model"
+	"github.com/jiu-u/oai-api/internal/repository"
+	"go.uber.org/zap"
+	"html"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ExportFormatCSV   = "csv"
+	ExportFormatJSONL = "jsonl"
+	// requestLogExportBatch 导出日志时每批读取的条数，每批写完后推送给客户端
+	requestLogExportBatch = 500
+)
+
+var ErrUsageReportNoRecipient = errors.New("没有可以接收用量报表的邮箱")
+
+var requestLogExportHeader = []string{
+	"id", "createdAt", "requestId", "userId", "username", "email", "apiKeyId",
+	"model", "upstreamModel", "channelId", "relayType", "path", "ip", "stream", "status",
+	"retryTimes", "promptTokens", "completionTokens", "totalTokens", "cost",
+	"totalLatency", "firstTokenLatency",
+}
+
+var usageExportHeader = []string{
+	"group", "name", "requests", "errors", "promptTokens", "completionTokens",
+	"totalTokens", "cost", "avgLatency",
+}
+
+type UsageReportService interface {
+	// ExportRequestLogs 把符合条件的日志逐批写入 w，不会一次加载全部结果
+	ExportRequestLogs(ctx context.Context, req *apiV1.RequestLogsExportQuery, w io.Writer) error
+	// ExportUsage 把按天的统计按分组汇总后写入 w
+	ExportUsage(ctx context.Context, req *apiV1.UsageExportQuery, w io.Writer) error
+	// SendMonthlyReport 发送某个月的用量报表，scheduled 为 true 表示定时任务调用，未开启或已发送过时跳过
+	SendMonthlyReport(ctx context.Context, month string, scheduled bool) (*apiV1.UsageReportResult, error)
+}
+
+func NewUsageReportService(
+	s *Service,
+	reqLogRepo repository.RequestLogRepository,
+	statRepo repository.RequestLogStatRepository,
+	userRepo repository.UserRepository,
+	channelRepo repository.ChannelRepository,
+	systemRepo repository.SystemRepository,
+	emailSvc EmailService,
+) UsageReportService {
+	return &usageReportService{
+		Service:     s,
+		reqLogRepo:  reqLogRepo,
+		statRepo:    statRepo,
+		userRepo:    userRepo,
+		channelRepo: channelRepo,
+		systemRepo:  systemRepo,
+		emailSvc:    emailSvc,
+	}
+}
+
+type usageReportService struct {
+	*Service
+	reqLogRepo  repository.RequestLogRepository
+	statRepo    repository.RequestLogStatRepository
+	userRepo    repository.UserRepository
+	channelRepo repository.ChannelRepository
+	systemRepo  repository.SystemRepository
+	emailSvc    EmailService
+}
+
+// exportWriter 按 format 写 csv 或 jsonl，csv 的第一行为表头
+type exportWriter struct {
+	w   io.Writer
+	csv *csv.Writer
+	enc *json.Encoder
+}
+
+func newExportWriter(w io.Writer, format string, header []string) (*exportWriter, error) {
+	if format == ExportFormatJSONL {
+		return &exportWriter{w: w, enc: json.NewEncoder(w)}, nil
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return nil, err
+	}
+	return &exportWriter{w: w, csv: cw}, nil
+}
+
+// Write jsonl 写入 item，csv 写入 record
+func (e *exportWriter) Write(item any, record []string) error {
+	if e.enc != nil {
+		return e.enc.Encode(item)
+	}
+	return e.csv.Write(record)
+}
+
+// Flush 把缓冲的内容推送给客户端
+func (e *exportWriter) Flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// csvText 以 = + - @ 开头的文本在表格软件中会被当成公式，前面加单引号
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func formatCost(cost float64) string {
+	return strconv.FormatFloat(cost, 'f', -1, 64)
+}
+
+func requestLogExportRecord(item *model.RequestLog) []string {
+	return []string{
+		strconv.FormatUint(item.Id, 10),
+		item.CreatedAt.In(time.Local).Format(time.DateTime),
+		item.RequestId,
+		strconv.FormatUint(item.UserId, 10),
+		csvText(item.Username),
+		csvText(item.Email),
+		strconv.FormatUint(item.ApiKeyId, 10),
+		csvText(item.Model),
+		csvText(item.UpstreamModel),
+		strconv.FormatUint(requestLogChannelId(item), 10),
+		item.RelayType,
+		csvText(item.Path),
+		item.Ip,
+		strconv.FormatBool(item.Stream),
+		strconv.Itoa(int(item.Status)),
+		strconv.Itoa(item.RetryTimes),
+		strconv.Itoa(item.PromptTokens),
+		strconv.Itoa(item.CompletionTokens),
+		strconv.Itoa(item.PromptTokens + item.CompletionTokens),
+		formatCost(item.Cost),
+		strconv.FormatInt(item.TotalLatency, 10),
+		strconv.FormatInt(item.FirstTokenLatency, 10),
+	}
+}
+
+func (s *usageReportService) ExportRequestLogs(ctx context.Context, req *apiV1.RequestLogsExportQuery, w io.Writer) error {
+	if _, _, err := parseStatRange(req.StartTime, req.EndTime); err != nil {
+		return err
+	}
+	if _, err := parseStatId(req.UserId); err != nil {
+		return errors.New("userId is invalid")
+	}
+	if _, err := parseStatId(req.ApiKeyId); err != nil {
+		return errors.New("apiKeyId is invalid")
+	}
+	ew, err := newExportWriter(w, req.Format, requestLogExportHeader)
+	if err != nil {
+		return err
+	}
+	q := &apiV1.RequestLogsQuery{
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+		UserId:    req.UserId,
+		Model:     req.Model,
+		ApiKeyId:  req.ApiKeyId,
+	}
+	err = s.reqLogRepo.EachRequestLogs(ctx, q, requestLogExportBatch, func(logs []*model.RequestLog) error {
+		for _, item := range logs {
+			if err := ew.Write(toRequestLogItem(item), requestLogExportRecord(item)); err != nil {
+				return err
+			}
+		}
+		return ew.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	return ew.Flush()
+}
+
+// usageExportRange 数据来自按天的统计，开始时间向前、结束时间向后对齐到整天
+func usageExportRange(start, end string) (time.Time, time.Time, error) {
+	startTime, endTime, err := parseStatRange(start, end)
+	if err != nil {
+		return startTime, endTime, err
+	}
+	startTime = statBucketTime(startTime, model.StatPeriodDay)
+	if day := statBucketTime(endTime, model.StatPeriodDay); !day.Equal(endTime) {
+		endTime = day.AddDate(0, 0, 1)
+	}
+	return startTime, endTime, nil
+}
+
+func (s *usageReportService) ExportUsage(ctx context.Context, req *apiV1.UsageExportQuery, w io.Writer) error {
+	startTime, endTime, err := usageExportRange(req.StartTime, req.EndTime)
+	if err != nil {
+		return err
+	}
+	q := &repository.RequestLogStatQuery{
+		Period:    model.StatPeriodDay,
+		StartTime: startTime,
+		EndTime:   endTime,
+		GroupBy:   req.GroupBy,
+		Model:     req.Model,
+	}
+	if q.ChannelId, err = parseStatId(req.ChannelId); err != nil {
+		return errors.New("channelId is invalid")
+	}
+	if q.UserId, err = parseStatId(req.UserId); err != nil {
+		return errors.New("userId is invalid")
+	}
+	if q.ApiKeyId, err = parseStatId(req.ApiKeyId); err != nil {
+		return errors.New("apiKeyId is invalid")
+	}
+	ew, err := newExportWriter(w, req.Format, usageExportHeader)
+	if err != nil {
+		return err
+	}
+	namer := s.newGroupNamer(req.GroupBy)
+	err = s.statRepo.EachRequestLogStatGroup(ctx, q, func(row *model.RequestLogStat) error {
+		item := s.toUsageExportRow(ctx, row, req.GroupBy, namer)
+		return ew.Write(item, []string{
+			csvText(item.Group),
+			csvText(item.Name),
+			strconv.FormatInt(item.Requests, 10),
+			strconv.FormatInt(item.Errors, 10),
+			strconv.FormatInt(item.PromptTokens, 10),
+			strconv.FormatInt(item.CompletionTokens, 10),
+			strconv.FormatInt(item.TotalTokens, 10),
+			formatCost(item.Cost),
+			strconv.FormatInt(item.AvgLatency, 10),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return ew.Flush()
+}
+
+// groupNamer 查询分组对应的用户名或渠道名，同一次导出中缓存查询结果
+type groupNamer func(ctx context.Context, id uint64) string
+
+func (s *usageReportService) newGroupNamer(groupBy string) groupNamer {
+	names := make(map[uint64]string)
+	return func(ctx context.Context, id uint64) string {
+		if id == 0 {
+			return ""
+		}
+		if name, ok := names[id]; ok {
+			return name
+		}
+		var name string
+		switch groupBy {
+		case "user":
+			if user, err := s.userRepo.FindUserById(ctx, id); err == nil {
+				name = user.Username
+			}
+		case "channel":
+			if channel, err := s.channelRepo.FindChannelById(ctx, id); err == nil {
+				name = channel.Name
+			}
+		}
+		names[id] = name
+		return name
+	}
+}
+
+func (s *usageReportService) toUsageExportRow(ctx context.Context, row *model.RequestLogStat, groupBy string, namer groupNamer) *apiV1.UsageExportRow {
+	item := &apiV1.UsageExportRow{
+		Requests:         row.Requests,
+		Errors:           row.Errors,
+		PromptTokens:     row.PromptTokens,
+		CompletionTokens: row.CompletionTokens,
+		TotalTokens:      row.PromptTokens + row.CompletionTokens,
+		Cost:             row.Cost,
+	}
+	if row.Requests > 0 {
+		item.AvgLatency = row.LatencySum / row.Requests
+	}
+	switch groupBy {
+	case "day":
+		item.Group = row.BucketTime.In(time.Local).Format(time.DateOnly)
+	case "user":
+		item.Group = statGroupKey(row, groupBy)
+		item.Name = namer(ctx, row.UserId)
+	case "channel":
+		item.Group = statGroupKey(row, groupBy)
+		item.Name = namer(ctx, row.ChannelId)
+	default:
+		item.Group = statGroupKey(row, groupBy)
+	}
+	return item
+}
+
+// reportMonthStart month 为空时取上个月
+func reportMonthStart(month string) (time.Time, error) {
+	if month == "" {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.Local), nil
+	}
+	t, err := time.ParseInLocation("2006-01", month, time.Local)
+	if err != nil {
+		return t, errors.New("month 格式应为 2006-01")
+	}
+	return t, nil
+}
+
+// reportRecipients 未配置收件人时发给所有设置了邮箱的管理员
+func (s *usageReportService) reportRecipients(ctx context.Context, cfg *dto.UsageReportConfig) ([]string, error) {
+	if len(cfg.Recipients) > 0 {
+		return cfg.Recipients, nil
+	}
+	admins, err := s.userRepo.FindUsersByRole(ctx, constant.AdminRole)
+	if err != nil {
+		return nil, err
+	}
+	var recipients []string
+	for _, admin := range admins {
+		if admin.Email != nil && *admin.Email != "" {
+			recipients = append(recipients, *admin.Email)
+		}
+	}
+	return recipients, nil
+}
+
+func (s *usageReportService) SendMonthlyReport(ctx context.Context, month string, scheduled bool) (*apiV1.UsageReportResult, error) {
+	start, err := reportMonthStart(month)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := s.systemRepo.GetUsageReportConfig(ctx)
+	if err != nil {
+		cfg = &dto.UsageReportConfig{}
+	}
+	resp := &apiV1.UsageReportResult{Month: start.Format("2006-01")}
+	if scheduled && (!cfg.Enable || cfg.LastSentMonth == resp.Month) {
+		resp.Skipped = true
+		return resp, nil
+	}
+	recipients, err := s.reportRecipients(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, ErrUsageReportNoRecipient
+	}
+	body, err := s.buildMonthlyReport(ctx, start, start.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, err
+	}
+	subject := fmt.Sprintf("%s 用量报表", resp.Month)
+	logger := s.Logger.WithContext(ctx)
+	for _, to := range recipients {
+		if err = s.emailSvc.SendEmail(ctx, to, subject, body); err != nil {
+			logger.Warn("用量报表|发送邮件失败", zap.String("email", to), zap.Error(err))
+			resp.Failed = append(resp.Failed, to)
+			continue
+		}
+		resp.Recipients = append(resp.Recipients, to)
+	}
+	if len(resp.Recipients) == 0 {
+		return resp, errors.New("用量报表邮件全部发送失败")
+	}
+	if scheduled {
+		cfg.LastSentMonth = resp.Month
+		if err = s.systemRepo.SetUsageReportConfig(ctx, cfg); err != nil {
+			logger.Error("用量报表|记录发送月份失败", zap.Error(err))
+		}
+	}
+	logger.Info("用量报表|已发送", zap.String("month", resp.Month), zap.Strings("recipients", resp.Recipients))
+	return resp, nil
+}
+
+// collectUsageRows 报表中每个分组一行，按费用从高到低排序，费用相同时请求数多的在前
+func (s *usageReportService) collectUsageRows(ctx context.Context, start, end time.Time, groupBy string) ([]*apiV1.UsageExportRow, error) {
+	var rows []*apiV1.UsageExportRow
+	namer := s.newGroupNamer(groupBy)
+	err := s.statRepo.EachRequestLogStatGroup(ctx, &repository.RequestLogStatQuery{
+		Period:    model.StatPeriodDay,
+		StartTime: start,
+		EndTime:   end,
+		GroupBy:   groupBy,
+	}, func(row *model.RequestLogStat) error {
+		rows = append(rows, s.toUsageExportRow(ctx, row, groupBy, namer))
+		return nil
+	})
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Cost != rows[j].Cost {
+			return rows[i].Cost > rows[j].Cost
+		}
+		return rows[i].Requests > rows[j].Requests
+	})
+	return rows, err
+}
+
+func (s *usageReportService) buildMonthlyReport(ctx context.Context, start, end time.Time) (string, error) {
+	users, err := s.collectUsageRows(ctx, start, end, "user")
+	if err != nil {
+		return "", err
+	}
+	models, err := s.collectUsageRows(ctx, start, end, "model")
+	if err != nil {
+		return "", err
+	}
+	var total apiV1.UsageExportRow
+	for _, row := range users {
+		total.Requests += row.Requests
+		total.Errors += row.Errors
+		total.PromptTokens += row.PromptTokens
+		total.CompletionTokens += row.CompletionTokens
+		total.TotalTokens += row.TotalTokens
+		total.Cost += row.Cost
+	}
+	var b strings.Builder
+	b.WriteString("<html><body>")
+	fmt.Fprintf(&b, "<h3>%s 用量报表</h3>", start.Format("2006-01"))
+	fmt.Fprintf(&b, "<p>统计时间：%s 至 %s</p>", start.Format(time.DateOnly), end.AddDate(0, 0, -1).Format(time.DateOnly))
+	fmt.Fprintf(&b, "<p>请求数：%d，失败数：%d，输入token：%d，输出token：%d，费用：%s</p>",
+		total.Requests, total.Errors, total.PromptTokens, total.CompletionTokens, formatCost(total.Cost))
+	writeUsageTable(&b, "按用户", "用户", users)
+	writeUsageTable(&b, "按模型", "模型", models)
+	b.WriteString("</body></html>")
+	return b.String(), nil
+}
+
+func writeUsageTable(b *strings.Builder, title string, groupTitle string, rows []*apiV1.UsageExportRow) {
+	fmt.Fprintf(b, "<h4>%s</h4>", title)
+	if len(rows) == 0 {
+		b.WriteString("<p>无数据</p>")
+		return
+	}
+	fmt.Fprintf(b, `<table border="1" cellspacing="0" cellpadding="4"><tr><th>%s</th><th>请求数</th><th>失败数</th><th>输入token</th><th>输出token</th><th>费用</th></tr>`, groupTitle)
+	for _, row := range rows {
+		name := row.Group
+		if row.Name != "" {
+			name = fmt.Sprintf("%s (%s)", row.Name, row.Group)
+		}
+		fmt.Fprintf(b, "<tr><td>%s</td><td>%d</td><td>%d</td><td>%d</td><td>%d</td><td>%s</td></tr>",
+			html.EscapeString(name), row.Requests, row.Errors, row.PromptTokens, row.CompletionTokens, formatCost(row.Cost))
+	}
+	b.WriteString("</table>")
+}
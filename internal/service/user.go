@@ -10,6 +10,8 @@ import (
 type UserService interface {
 	BanUser(ctx context.Context, userId uint64) error
 	GetUserInfo(ctx context.Context, userId uint64) (*apiV1.UserInfo, error)
+	UpdateUserGroup(ctx context.Context, userId uint64, req *apiV1.UpdateUserGroupRequest) error
+	UpdateUserCredit(ctx context.Context, userId uint64, req *apiV1.UpdateUserCreditRequest) error
 }
 
 func NewUserService(s *Service, userRepo repository.UserRepository, apikeyRepo repository.ApiKeyRepository) UserService {
@@ -31,10 +33,18 @@ func (s *userService) GetUserInfo(ctx context.Context, userId uint64) (*apiV1.Us
 	if err != nil {
 		return nil, err
 	}
+	email := ""
+	if user.Email != nil {
+		email = *user.Email
+	}
 	return &apiV1.UserInfo{
-		Id:       strconv.FormatUint(user.Id, 10),
-		Username: user.Username,
-		Email:    *user.Email,
+		Id:          strconv.FormatUint(user.Id, 10),
+		Username:    user.Username,
+		Email:       email,
+		Status:      int(user.Status),
+		Level:       user.Level,
+		Group:       user.Group,
+		CreditLimit: user.CreditLimit,
 		//LinuxDoId:       strconv.FormatUint(user.LinuxDoId, 10),
 		//LinuxDoUsername: user.LinuxDoUsername,
 	}, nil
@@ -54,3 +64,19 @@ func (s *userService) BanUser(ctx context.Context, userId uint64) error {
 		return s.apikeyRepo.DeleteKeyByUserId(ctx, userId)
 	})
 }
+
+func (s *userService) UpdateUserGroup(ctx context.Context, userId uint64, req *apiV1.UpdateUserGroupRequest) error {
+	err := s.userRepo.UpdateUserGroup(ctx, userId, normalizeGroup(req.Group), req.Level)
+	if err != nil {
+		return err
+	}
+	// 清除该用户api key的分组缓存
+	if apiKey, err := s.apikeyRepo.GetUserApiKey(ctx, userId); err == nil {
+		s.Cache.Delete(groupsCacheKey(apiKey.Content))
+	}
+	return nil
+}
+
+func (s *userService) UpdateUserCredit(ctx context.Context, userId uint64, req *apiV1.UpdateUserCreditRequest) error {
+	return s.userRepo.UpdateUserCreditLimit(ctx, userId, req.CreditLimit)
+}
@@ -0,0 +1,157 @@
+package balance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotSupported = errors.New("该渠道类型不支持查询余额")
+	ErrHostMismatch = errors.New("余额查询地址必须与渠道地址为同一主机")
+)
+
+// Fetcher 查询上游账户余额，endPoint 不包含 /v1
+type Fetcher interface {
+	Fetch(ctx context.Context, endPoint, apiKey string) (float64, error)
+}
+
+var client = &http.Client{Timeout: 15 * time.Second}
+
+// OpenAIFetcher 兼容 OpenAI 的 dashboard billing 接口，余额 = 总额度 - 近100天用量
+type OpenAIFetcher struct{}
+
+func (f *OpenAIFetcher) Fetch(ctx context.Context, endPoint, apiKey string) (float64, error) {
+	var subscription struct {
+		HardLimitUSD float64 `json:"hard_limit_usd"`
+	}
+	err := getJSON(ctx, endPoint+"/v1/dashboard/billing/subscription", apiKey, &subscription)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	startDate := now.AddDate(0, 0, -100).Format("2006-01-02")
+	endDate := now.AddDate(0, 0, 1).Format("2006-01-02")
+	var usage struct {
+		// TotalUsage 单位为美分
+		TotalUsage float64 `json:"total_usage"`
+	}
+	url := fmt.Sprintf("%s/v1/dashboard/billing/usage?start_date=%s&end_date=%s", endPoint, startDate, endDate)
+	err = getJSON(ctx, url, apiKey, &usage)
+	if err != nil {
+		return 0, err
+	}
+	return subscription.HardLimitUSD - usage.TotalUsage/100, nil
+}
+
+// SiliconFlowFetcher 硅基流动用户信息接口
+type SiliconFlowFetcher struct{}
+
+func (f *SiliconFlowFetcher) Fetch(ctx context.Context, endPoint, apiKey string) (float64, error) {
+	fetcher := &JSONPathFetcher{
+		URL:  endPoint + "/v1/user/info",
+		Path: "data.totalBalance",
+	}
+	return fetcher.Fetch(ctx, endPoint, apiKey)
+}
+
+// JSONPathFetcher 通用余额查询，请求 URL 后按 Path 取值，Path 形如 data.balance 或 data.list.0.amount
+type JSONPathFetcher struct {
+	URL  string
+	Path string
+}
+
+// Fetch 请求中会带上渠道的key，只允许请求渠道 endPoint 所在的主机
+func (f *JSONPathFetcher) Fetch(ctx context.Context, endPoint, apiKey string) (float64, error) {
+	if !sameHost(f.URL, endPoint) {
+		return 0, ErrHostMismatch
+	}
+	var data any
+	err := getJSON(ctx, f.URL, apiKey, &data)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := GetByPath(data, f.Path)
+	if !ok {
+		return 0, fmt.Errorf("余额字段不存在: %s", f.Path)
+	}
+	return toFloat(value)
+}
+
+// sameHost 协议和主机(含端口)都相同
+func sameHost(rawURL, endPoint string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	e, err := url.Parse(endPoint)
+	if err != nil || e.Host == "" {
+		return false
+	}
+	return strings.EqualFold(u.Scheme, e.Scheme) && strings.EqualFold(u.Host, e.Host)
+}
+
+// GetByPath 按点分隔的路径从json解析结果中取值，数字段表示数组下标
+func GetByPath(data any, path string) (any, bool) {
+	if path == "" {
+		return data, true
+	}
+	current := data
+	for _, field := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]any:
+			value, ok := node[field]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []any:
+			idx, err := strconv.Atoi(field)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			current = node[idx]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func toFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+	return 0, fmt.Errorf("余额字段类型错误: %T", value)
+}
+
+func getJSON(ctx context.Context, url, apiKey string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status + ": " + string(body))
+	}
+	return json.Unmarshal(body, v)
+}
@@ -26,6 +26,22 @@ type Config struct {
 		Host string `mapstructure:"host"`
 		Port int    `mapstructure:"port"`
 	} `mapstructure:"http"`
+	// Metrics port 大于0时在独立端口暴露 /metrics；token 不为空时同时在业务端口暴露，需携带 Bearer token
+	Metrics struct {
+		Host  string `mapstructure:"host"`
+		Port  int    `mapstructure:"port"`
+		Token string `mapstructure:"token"`
+	} `mapstructure:"metrics"`
+	// Trace OpenTelemetry 链路追踪，通过 OTLP/HTTP 上报，未开启时仍会透传 traceparent
+	Trace struct {
+		Enable      bool              `mapstructure:"enable"`
+		Endpoint    string            `mapstructure:"endpoint"`
+		URLPath     string            `mapstructure:"url_path"`
+		Insecure    bool              `mapstructure:"insecure"`
+		Headers     map[string]string `mapstructure:"headers"`
+		ServiceName string            `mapstructure:"service_name"`
+		SampleRatio float64           `mapstructure:"sample_ratio"`
+	} `mapstructure:"trace"`
 	Database struct {
 		Driver string `mapstructure:"driver"`
 		Dsn    string `mapstructure:"dsn"`
@@ -43,6 +59,10 @@ type Config struct {
 		Jwt struct {
 			Key string `mapstructure:"key"`
 		} `mapstructure:"jwt"`
+		Secret struct {
+			Key         string `mapstructure:"key"`
+			PreviousKey string `mapstructure:"previous_key"`
+		} `mapstructure:"secret"`
 	} `mapstructure:"security"`
 	Log struct {
 		Level         string `mapstructure:"log_level"`
@@ -79,6 +99,9 @@ func LoadConfig(path string) *Config {
 	conf.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	conf.BindEnv("oauth.linux_do.client_id", "OAI_OAUTH_LINUX_DO_CLIENT_ID")
 	conf.BindEnv("oauth.linux_do.client_secret", "OAI_OAUTH_LINUX_DO_CLIENT_SECRET")
+	conf.BindEnv("security.secret.key", "OAI_SECURITY_SECRET_KEY")
+	conf.BindEnv("security.secret.previous_key", "OAI_SECURITY_SECRET_PREVIOUS_KEY")
+	conf.BindEnv("metrics.token", "OAI_METRICS_TOKEN")
 	conf.SetConfigFile(envConf)
 	conf.AutomaticEnv()
 	err := conf.ReadInConfig()
@@ -26,3 +26,19 @@ func ProcessEmails(emails []string) []string {
 	}
 	return maskedEmails
 }
+
+// MaskSecret 隐私化处理密钥，只保留前3位和后4位
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:3] + strings.Repeat("*", 8) + secret[len(secret)-4:]
+}
+
+// IsMaskedSecret 判断是否为 MaskSecret 处理后的值，用于更新时忽略前端回传的掩码
+func IsMaskedSecret(secret string) bool {
+	return strings.Contains(secret, "****")
+}
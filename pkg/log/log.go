@@ -114,6 +114,10 @@ func (l *Logger) WithContext(ctx context.Context) *Logger {
 		ctx = c.Request.Context()
 	}
 	zl := ctx.Value(ctxLoggerKey)
+	// 包装过 *gin.Context 的ctx(例如带上了span)，日志记录器仍在 Request.Context() 中
+	if c, ok := ctx.Value(gin.ContextKey).(*gin.Context); ok && zl == nil && c.Request != nil {
+		zl = c.Request.Context().Value(ctxLoggerKey)
+	}
 	ctxLogger, ok := zl.(*zap.Logger)
 	if ok {
 		return &Logger{ctxLogger}
@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "oai"
+
+// Metrics 中转相关的 Prometheus 指标，使用独立的 Registry，避免混入第三方库注册的全局指标
+type Metrics struct {
+	registry         *prometheus.Registry
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	firstByte        *prometheus.HistogramVec
+	retries          *prometheus.CounterVec
+	upstreamStatus   *prometheus.CounterVec
+	tokens           *prometheus.CounterVec
+	inFlightRequests *prometheus.GaugeVec
+	logDropped       prometheus.Counter
+}
+
+// RelayLabels 一次中转请求的标签，Model 为调用方请求的模型，UpstreamModel 为实际转发给上游的模型
+type RelayLabels struct {
+	Model         string
+	UpstreamModel string
+	Channel       string
+	RelayType     string
+}
+
+func (l RelayLabels) values() []string {
+	return []string{l.Model, l.UpstreamModel, l.Channel, l.RelayType}
+}
+
+// UnknownModel 未配置的模型名统一使用的 model 标签
+const UnknownModel = "unknown"
+
+var relayLabelNames = []string{"model", "upstream_model", "channel", "relay_type"}
+
+func NewMetrics() *Metrics {
+	latencyBuckets := []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300}
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "relay_requests_total",
+			Help:      "中转请求总数，status 为 success 或 fail",
+		}, append(relayLabelNames, "status")),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "relay_request_duration_seconds",
+			Help:      "中转请求总耗时，从收到请求到响应体读取完毕",
+			Buckets:   latencyBuckets,
+		}, relayLabelNames),
+		firstByte: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "relay_first_byte_duration_seconds",
+			Help:      "中转请求首字节耗时，从收到请求到读到上游响应体的第一个字节",
+			Buckets:   latencyBuckets,
+		}, relayLabelNames),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "relay_retries_total",
+			Help:      "中转请求重试次数",
+		}, []string{"model", "relay_type"}),
+		upstreamStatus: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "relay_upstream_responses_total",
+			Help:      "上游响应状态码计数，无法识别状态码的错误记为 0",
+		}, append(relayLabelNames, "code")),
+		tokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "relay_tokens_total",
+			Help:      "上游返回的 usage 中消耗的 token 数，type 为 prompt 或 completion",
+		}, append(relayLabelNames, "type")),
+		inFlightRequests: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "relay_in_flight_requests",
+			Help:      "正在处理中的中转请求数",
+		}, []string{"model", "relay_type"}),
+		logDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "request_log_dropped_total",
+			Help:      "请求日志队列已满或写入失败时丢弃的日志条数",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.firstByte,
+		m.retries,
+		m.upstreamStatus,
+		m.tokens,
+		m.inFlightRequests,
+		m.logDropped,
+	)
+	return m
+}
+
+// MustRegister 注册额外的指标，例如在抓取时从数据库读取状态的 Collector
+func (m *Metrics) MustRegister(cs ...prometheus.Collector) {
+	m.registry.MustRegister(cs...)
+}
+
+// Handler 暴露 /metrics 的 http.Handler
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// IncInFlight 请求开始时调用，返回的函数在请求结束时调用
+func (m *Metrics) IncInFlight(model, relayType string) func() {
+	gauge := m.inFlightRequests.WithLabelValues(model, relayType)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+func (m *Metrics) ObserveRetry(model, relayType string) {
+	m.retries.WithLabelValues(model, relayType).Inc()
+}
+
+// ObserveUpstreamStatus 记录一次上游尝试的状态码
+func (m *Metrics) ObserveUpstreamStatus(labels RelayLabels, code int) {
+	m.upstreamStatus.WithLabelValues(append(labels.values(), strconv.Itoa(code))...).Inc()
+}
+
+// ObserveRequest 记录一次中转请求的最终结果，firstByte 为0时表示没有读到响应体，不记录首字节耗时
+func (m *Metrics) ObserveRequest(labels RelayLabels, success bool, total, firstByte time.Duration) {
+	status := "success"
+	if !success {
+		status = "fail"
+	}
+	m.requests.WithLabelValues(append(labels.values(), status)...).Inc()
+	m.requestDuration.WithLabelValues(labels.values()...).Observe(total.Seconds())
+	if firstByte > 0 {
+		m.firstByte.WithLabelValues(labels.values()...).Observe(firstByte.Seconds())
+	}
+}
+
+func (m *Metrics) ObserveTokens(labels RelayLabels, promptTokens, completionTokens int) {
+	if promptTokens > 0 {
+		m.tokens.WithLabelValues(append(labels.values(), "prompt")...).Add(float64(promptTokens))
+	}
+	if completionTokens > 0 {
+		m.tokens.WithLabelValues(append(labels.values(), "completion")...).Add(float64(completionTokens))
+	}
+}
+
+func (m *Metrics) ObserveRequestLogDropped() {
+	m.logDropped.Inc()
+}
@@ -0,0 +1,263 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"strings"
+	"time"
+)
+
+// ParseContent 把字符串或内容块数组统一解析为内容块数组
+func ParseContent(raw json.RawMessage) ([]ContentBlock, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		return []ContentBlock{{Type: BlockText, Text: text}}, nil
+	}
+	var blocks []ContentBlock
+	err := json.Unmarshal(raw, &blocks)
+	return blocks, err
+}
+
+// joinText 只取文本块，其余类型忽略
+func joinText(blocks []ContentBlock) string {
+	var texts []string
+	for _, block := range blocks {
+		if block.Type == BlockText {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ToOpenAI 转换为 OpenAI chat 请求，thinking 块和 top_k 没有对应的字段，直接丢弃
+func ToOpenAI(req *MessagesRequest) (*openai.ChatRequest, error) {
+	out := &openai.ChatRequest{
+		Model:       req.Model,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stop:        req.StopSequences,
+		Stream:      req.Stream,
+	}
+	if req.Stream {
+		out.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	if req.Metadata != nil {
+		out.User = req.Metadata.UserId
+	}
+	system, err := ParseContent(req.System)
+	if err != nil {
+		return nil, fmt.Errorf("invalid system: %w", err)
+	}
+	if text := joinText(system); text != "" {
+		out.Messages = append(out.Messages, openai.ChatMessage{Role: openai.RoleSystem, Content: text})
+	}
+	for i, msg := range req.Messages {
+		blocks, err := ParseContent(msg.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid messages.%d.content: %w", i, err)
+		}
+		switch msg.Role {
+		case "user":
+			messages, err := convertUserMessage(blocks)
+			if err != nil {
+				return nil, fmt.Errorf("invalid messages.%d: %w", i, err)
+			}
+			out.Messages = append(out.Messages, messages...)
+		case "assistant":
+			out.Messages = append(out.Messages, convertAssistantMessage(blocks))
+		default:
+			return nil, fmt.Errorf("invalid messages.%d.role: %s", i, msg.Role)
+		}
+	}
+	for _, tool := range req.Tools {
+		out.Tools = append(out.Tools, openai.Tool{
+			Type: "function",
+			Function: openai.FunctionDef{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	if req.ToolChoice != nil && len(out.Tools) > 0 {
+		switch req.ToolChoice.Type {
+		case "auto":
+			out.ToolChoice = "auto"
+		case "any":
+			out.ToolChoice = "required"
+		case "none":
+			out.ToolChoice = "none"
+		case "tool":
+			out.ToolChoice = map[string]any{
+				"type":     "function",
+				"function": map[string]string{"name": req.ToolChoice.Name},
+			}
+		}
+		if req.ToolChoice.DisableParallelToolUse {
+			parallel := false
+			out.ParallelToolCalls = &parallel
+		}
+	}
+	return out, nil
+}
+
+// convertUserMessage tool_result 转为 tool 消息放在前面，紧跟上一条 assistant 消息的 tool_calls
+func convertUserMessage(blocks []ContentBlock) ([]openai.ChatMessage, error) {
+	var messages []openai.ChatMessage
+	var parts []openai.ContentPart
+	allText := true
+	for _, block := range blocks {
+		switch block.Type {
+		case BlockText:
+			parts = append(parts, openai.ContentPart{Type: "text", Text: block.Text})
+		case BlockImage:
+			if block.Source == nil {
+				return nil, errors.New("image block without source")
+			}
+			url := block.Source.Url
+			if block.Source.Type == "base64" {
+				url = "data:" + block.Source.MediaType + ";base64," + block.Source.Data
+			}
+			parts = append(parts, openai.ContentPart{Type: "image_url", ImageUrl: &openai.ImageUrl{Url: url}})
+			allText = false
+		case BlockToolResult:
+			result, err := ParseContent(block.Content)
+			if err != nil {
+				return nil, err
+			}
+			content := joinText(result)
+			if block.IsError && content == "" {
+				content = "error"
+			}
+			messages = append(messages, openai.ChatMessage{
+				Role:       openai.RoleTool,
+				Content:    content,
+				ToolCallId: block.ToolUseId,
+			})
+		}
+	}
+	if len(parts) == 0 {
+		return messages, nil
+	}
+	// 纯文本时合并为字符串，兼容只支持字符串 content 的上游
+	var content any = parts
+	if allText {
+		texts := make([]string, len(parts))
+		for i, part := range parts {
+			texts[i] = part.Text
+		}
+		content = strings.Join(texts, "\n")
+	}
+	return append(messages, openai.ChatMessage{Role: openai.RoleUser, Content: content}), nil
+}
+
+func convertAssistantMessage(blocks []ContentBlock) openai.ChatMessage {
+	msg := openai.ChatMessage{Role: openai.RoleAssistant}
+	var texts []string
+	for _, block := range blocks {
+		switch block.Type {
+		case BlockText:
+			texts = append(texts, block.Text)
+		case BlockToolUse:
+			args := string(block.Input)
+			if args == "" {
+				args = "{}"
+			}
+			msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
+				Id:       block.Id,
+				Type:     "function",
+				Function: openai.FunctionCall{Name: block.Name, Arguments: args},
+			})
+		}
+	}
+	if len(texts) > 0 {
+		msg.Content = strings.Join(texts, "\n")
+	}
+	return msg
+}
+
+// StopReason 上游的 finish_reason 对应的 stop_reason
+func StopReason(finishReason string) string {
+	switch finishReason {
+	case openai.FinishLength:
+		return StopMaxTokens
+	case openai.FinishToolCalls, openai.FinishFunctionCall:
+		return StopToolUse
+	case openai.FinishContentFilter:
+		return StopRefusal
+	}
+	return StopEndTurn
+}
+
+func ConvertUsage(usage *openai.Usage) Usage {
+	if usage == nil {
+		return Usage{}
+	}
+	cached := usage.CachedTokens()
+	return Usage{
+		InputTokens:          usage.PromptTokens - cached,
+		OutputTokens:         usage.CompletionTokens,
+		CacheReadInputTokens: cached,
+	}
+}
+
+// MessageId 上游 id 加上 msg_ 前缀，上游没有返回 id 时按时间生成
+func MessageId(id string) string {
+	if id == "" {
+		return fmt.Sprintf("msg_%d", time.Now().UnixNano())
+	}
+	if strings.HasPrefix(id, "msg_") {
+		return id
+	}
+	return "msg_" + strings.TrimPrefix(id, "chatcmpl-")
+}
+
+// toolInput 上游返回的参数不是合法 json 对象时使用空对象
+func toolInput(arguments string) json.RawMessage {
+	if arguments != "" && json.Valid([]byte(arguments)) {
+		return json.RawMessage(arguments)
+	}
+	return json.RawMessage("{}")
+}
+
+// FromOpenAI 转换非流式响应，model 为用户请求的模型名
+func FromOpenAI(resp *openai.ChatResponse, model string) *MessagesResponse {
+	out := &MessagesResponse{
+		Id:      MessageId(resp.Id),
+		Type:    "message",
+		Role:    "assistant",
+		Model:   model,
+		Content: []any{},
+		Usage:   ConvertUsage(resp.Usage),
+	}
+	stopReason := StopEndTurn
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		if choice.Message.ReasoningContent != "" {
+			out.Content = append(out.Content, ThinkingBlock{Type: BlockThinking, Thinking: choice.Message.ReasoningContent})
+		}
+		if text := choice.Message.ContentText(); text != "" {
+			out.Content = append(out.Content, TextBlock{Type: BlockText, Text: text})
+		}
+		for _, call := range choice.Message.ToolCalls {
+			out.Content = append(out.Content, ToolUseBlock{
+				Type:  BlockToolUse,
+				Id:    call.Id,
+				Name:  call.Function.Name,
+				Input: toolInput(call.Function.Arguments),
+			})
+		}
+		stopReason = StopReason(choice.FinishReason)
+	}
+	out.StopReason = &stopReason
+	return out
+}
@@ -0,0 +1,226 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToOpenAI(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "text and system",
+			body: `{"model":"claude","max_tokens":100,"system":[{"type":"text","text":"be brief"}],
+				"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":[{"type":"text","text":"hello"}]}]}`,
+			want: `{"model":"claude","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"},
+				{"role":"assistant","content":"hello"}],"max_tokens":100,"stream":false}`,
+		},
+		{
+			name: "stream with image",
+			body: `{"model":"claude","max_tokens":10,"stream":true,"messages":[{"role":"user","content":[
+				{"type":"text","text":"what"},{"type":"image","source":{"type":"base64","media_type":"image/png","data":"AAA"}}]}]}`,
+			want: `{"model":"claude","messages":[{"role":"user","content":[{"type":"text","text":"what"},
+				{"type":"image_url","image_url":{"url":"data:image/png;base64,AAA"}}]}],"max_tokens":10,"stream":true,
+				"stream_options":{"include_usage":true}}`,
+		},
+		{
+			name: "tools",
+			body: `{"model":"claude","max_tokens":10,
+				"tools":[{"name":"get_weather","input_schema":{"type":"object"}}],
+				"tool_choice":{"type":"any","disable_parallel_tool_use":true},
+				"messages":[
+					{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"sh"}}]},
+					{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"sunny"},{"type":"text","text":"thanks"}]}]}`,
+			want: `{"model":"claude","messages":[
+				{"role":"assistant","content":null,"tool_calls":[{"id":"toolu_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"sh\"}"}}]},
+				{"role":"tool","content":"sunny","tool_call_id":"toolu_1"},
+				{"role":"user","content":"thanks"}],
+				"max_tokens":10,"stream":false,
+				"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}],
+				"tool_choice":"required","parallel_tool_calls":false}`,
+		},
+		{
+			name:    "invalid role",
+			body:    `{"model":"claude","max_tokens":10,"messages":[{"role":"system","content":"x"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "image without source",
+			body:    `{"model":"claude","max_tokens":10,"messages":[{"role":"user","content":[{"type":"image"}]}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req MessagesRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatal(err)
+			}
+			out, err := ToOpenAI(&req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, out, tt.want)
+		})
+	}
+}
+
+func TestFromOpenAI(t *testing.T) {
+	tests := []struct {
+		name string
+		resp string
+		want string
+	}{
+		{
+			name: "text",
+			resp: `{"id":"chatcmpl-abc","choices":[{"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],
+				"usage":{"prompt_tokens":10,"completion_tokens":2,"prompt_tokens_details":{"cached_tokens":4}}}`,
+			want: `{"id":"msg_abc","type":"message","role":"assistant","model":"claude","content":[{"type":"text","text":"hi"}],
+				"stop_reason":"end_turn","stop_sequence":null,
+				"usage":{"input_tokens":6,"output_tokens":2,"cache_read_input_tokens":4}}`,
+		},
+		{
+			name: "thinking and tool call",
+			resp: `{"id":"x","choices":[{"message":{"role":"assistant","content":null,"reasoning_content":"hmm",
+				"tool_calls":[{"id":"call_1","type":"function","function":{"name":"f","arguments":"not json"}}]},"finish_reason":"tool_calls"}]}`,
+			want: `{"id":"msg_x","type":"message","role":"assistant","model":"claude","content":[
+				{"type":"thinking","thinking":"hmm","signature":""},
+				{"type":"tool_use","id":"call_1","name":"f","input":{}}],
+				"stop_reason":"tool_use","stop_sequence":null,"usage":{"input_tokens":0,"output_tokens":0}}`,
+		},
+		{
+			name: "length",
+			resp: `{"id":"msg_1","choices":[{"message":{"role":"assistant","content":"abc"},"finish_reason":"length"}]}`,
+			want: `{"id":"msg_1","type":"message","role":"assistant","model":"claude","content":[{"type":"text","text":"abc"}],
+				"stop_reason":"max_tokens","stop_sequence":null,"usage":{"input_tokens":0,"output_tokens":0}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp openai.ChatResponse
+			if err := json.Unmarshal([]byte(tt.resp), &resp); err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, FromOpenAI(&resp, "claude"), tt.want)
+		})
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	tests := []struct {
+		name       string
+		stream     string
+		wantEvents []string
+		wantData   []string
+	}{
+		{
+			name: "thinking then text",
+			stream: "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"delta\":{\"reasoning_content\":\"hm\"}}]}\n\n" +
+				"data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"delta\":{\"content\":\"Hi\"},\"finish_reason\":\"stop\"}]}\n\n" +
+				"data: {\"id\":\"chatcmpl-1\",\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":1}}\n\n" +
+				"data: [DONE]\n\n",
+			wantEvents: []string{
+				"message_start",
+				"content_block_start", "content_block_delta", "content_block_stop",
+				"content_block_start", "content_block_delta", "content_block_stop",
+				"message_delta", "message_stop",
+			},
+			wantData: []string{`"id":"msg_1"`, `"thinking":"hm"`, `"text":"Hi"`, `"stop_reason":"end_turn"`, `"input_tokens":3`},
+		},
+		{
+			name: "tool call fragments",
+			stream: "data: {\"id\":\"c\",\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"function\":{\"name\":\"f\",\"arguments\":\"\"}}]}}]}\n\n" +
+				"data: {\"id\":\"c\",\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"a\\\":\"}}]}}]}\n\n" +
+				"data: {\"id\":\"c\",\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"1}\"}}]},\"finish_reason\":\"tool_calls\"}]}\n\n",
+			wantEvents: []string{
+				"message_start",
+				"content_block_start", "content_block_delta", "content_block_delta", "content_block_stop",
+				"message_delta", "message_stop",
+			},
+			wantData: []string{`"id":"call_1"`, `"partial_json":"{\"a\":"`, `"partial_json":"1}"`, `"stop_reason":"tool_use"`},
+		},
+		{
+			name:       "empty stream",
+			stream:     "data: [DONE]\n\n",
+			wantEvents: []string{"message_start", "message_delta", "message_stop"},
+			wantData:   []string{`"stop_reason":"end_turn"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			writer := NewStreamWriter(&buf, "claude")
+			if err := openai.ReadChatStream(strings.NewReader(tt.stream), writer.Chunk); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Finish(); err != nil {
+				t.Fatal(err)
+			}
+			var events []string
+			for _, line := range strings.Split(buf.String(), "\n") {
+				if name, ok := strings.CutPrefix(line, "event: "); ok {
+					events = append(events, name)
+				}
+			}
+			if !reflect.DeepEqual(events, tt.wantEvents) {
+				t.Fatalf("events = %v, want %v", events, tt.wantEvents)
+			}
+			for _, data := range tt.wantData {
+				if !strings.Contains(buf.String(), data) {
+					t.Fatalf("output missing %s:\n%s", data, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{400, ErrInvalidRequest},
+		{401, ErrAuthentication},
+		{404, ErrNotFound},
+		{429, ErrRateLimit},
+		{503, ErrOverloaded},
+		{500, ErrAPI},
+	}
+	for _, tt := range tests {
+		if got := ErrorType(tt.status); got != tt.want {
+			t.Errorf("ErrorType(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+// assertJSON 按 json 语义比较，忽略字段顺序和空白
+func assertJSON(t *testing.T, got any, want string) {
+	t.Helper()
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotValue, wantValue any
+	if err = json.Unmarshal(data, &gotValue); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid want json: %v", err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Fatalf("got  %s\nwant %s", data, want)
+	}
+}
@@ -0,0 +1,213 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// StreamWriter 把 OpenAI 的流式 chunk 转为 Anthropic 的 SSE 事件
+// 事件顺序为 message_start、若干内容块(content_block_start/delta/stop)、message_delta、message_stop
+type StreamWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	model   string
+	id      string
+
+	started    bool
+	blockIndex int
+	blockType  string
+	blockOpen  bool
+	// toolBlocks 上游 tool_calls 的 index 对应的内容块
+	toolBlocks map[int]toolBlock
+	stopReason string
+	usage      *openai.Usage
+}
+
+type toolBlock struct {
+	id    string
+	index int
+}
+
+func NewStreamWriter(w io.Writer, model string) *StreamWriter {
+	flusher, _ := w.(http.Flusher)
+	return &StreamWriter{
+		w:          w,
+		flusher:    flusher,
+		model:      model,
+		toolBlocks: make(map[int]toolBlock),
+	}
+}
+
+func (s *StreamWriter) event(name string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", name, payload); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+func (s *StreamWriter) start() error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	if s.id == "" {
+		s.id = MessageId("")
+	}
+	return s.event("message_start", map[string]any{
+		"type": "message_start",
+		"message": MessagesResponse{
+			Id:      s.id,
+			Type:    "message",
+			Role:    "assistant",
+			Model:   s.model,
+			Content: []any{},
+		},
+	})
+}
+
+func (s *StreamWriter) closeBlock() error {
+	if !s.blockOpen {
+		return nil
+	}
+	s.blockOpen = false
+	err := s.event("content_block_stop", map[string]any{"type": "content_block_stop", "index": s.blockIndex})
+	s.blockIndex++
+	return err
+}
+
+func (s *StreamWriter) openBlock(blockType string, block any) error {
+	if err := s.closeBlock(); err != nil {
+		return err
+	}
+	s.blockOpen = true
+	s.blockType = blockType
+	return s.event("content_block_start", map[string]any{
+		"type":          "content_block_start",
+		"index":         s.blockIndex,
+		"content_block": block,
+	})
+}
+
+func (s *StreamWriter) delta(index int, delta any) error {
+	return s.event("content_block_delta", map[string]any{
+		"type":  "content_block_delta",
+		"index": index,
+		"delta": delta,
+	})
+}
+
+// Chunk 处理一个上游 chunk，只使用第一个 choice
+func (s *StreamWriter) Chunk(chunk *openai.ChatChunk) error {
+	if s.id == "" && chunk.Id != "" {
+		s.id = MessageId(chunk.Id)
+	}
+	if err := s.start(); err != nil {
+		return err
+	}
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return nil
+	}
+	choice := chunk.Choices[0]
+	if choice.Delta.ReasoningContent != "" {
+		if !s.blockOpen || s.blockType != BlockThinking {
+			if err := s.openBlock(BlockThinking, ThinkingBlock{Type: BlockThinking}); err != nil {
+				return err
+			}
+		}
+		if err := s.delta(s.blockIndex, map[string]string{"type": "thinking_delta", "thinking": choice.Delta.ReasoningContent}); err != nil {
+			return err
+		}
+	}
+	if choice.Delta.Content != "" {
+		if !s.blockOpen || s.blockType != BlockText {
+			if err := s.openBlock(BlockText, TextBlock{Type: BlockText}); err != nil {
+				return err
+			}
+		}
+		if err := s.delta(s.blockIndex, map[string]string{"type": "text_delta", "text": choice.Delta.Content}); err != nil {
+			return err
+		}
+	}
+	for i, call := range choice.Delta.ToolCalls {
+		if err := s.toolCall(i, call); err != nil {
+			return err
+		}
+	}
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		s.stopReason = StopReason(*choice.FinishReason)
+	}
+	return nil
+}
+
+// toolCall 带新 id 的 chunk 开始一个新的 tool_use 块，后续只带 index 的 chunk 为参数片段
+func (s *StreamWriter) toolCall(pos int, call openai.ToolCall) error {
+	index := pos
+	if call.Index != nil {
+		index = *call.Index
+	}
+	tool, ok := s.toolBlocks[index]
+	if !ok || call.Id != "" && call.Id != tool.id {
+		id := call.Id
+		if id == "" {
+			id = fmt.Sprintf("toolu_%s_%d", strings.TrimPrefix(s.id, "msg_"), index)
+		}
+		err := s.openBlock(BlockToolUse, ToolUseBlock{
+			Type:  BlockToolUse,
+			Id:    id,
+			Name:  call.Function.Name,
+			Input: json.RawMessage("{}"),
+		})
+		if err != nil {
+			return err
+		}
+		tool = toolBlock{id: id, index: s.blockIndex}
+		s.toolBlocks[index] = tool
+	}
+	if call.Function.Arguments == "" {
+		return nil
+	}
+	return s.delta(tool.index, map[string]string{"type": "input_json_delta", "partial_json": call.Function.Arguments})
+}
+
+// Finish 上游流结束后调用，补齐 message_delta 和 message_stop
+func (s *StreamWriter) Finish() error {
+	if err := s.start(); err != nil {
+		return err
+	}
+	if err := s.closeBlock(); err != nil {
+		return err
+	}
+	stopReason := s.stopReason
+	if stopReason == "" {
+		stopReason = StopEndTurn
+	}
+	usage := ConvertUsage(s.usage)
+	err := s.event("message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": stopReason, "stop_sequence": nil},
+		"usage": usage,
+	})
+	if err != nil {
+		return err
+	}
+	return s.event("message_stop", map[string]string{"type": "message_stop"})
+}
+
+// Error 流已经开始后出错时发送 error 事件
+func (s *StreamWriter) Error(errType, message string) error {
+	return s.event("error", NewError(errType, message))
+}
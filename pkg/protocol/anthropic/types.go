@@ -0,0 +1,168 @@
+// Package anthropic Anthropic Messages API 的请求、响应和流式事件，以及与 OpenAI chat completions 之间的转换
+package anthropic
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	BlockText             = "text"
+	BlockImage            = "image"
+	BlockDocument         = "document"
+	BlockToolUse          = "tool_use"
+	BlockToolResult       = "tool_result"
+	BlockThinking         = "thinking"
+	BlockRedactedThinking = "redacted_thinking"
+)
+
+const (
+	StopEndTurn   = "end_turn"
+	StopMaxTokens = "max_tokens"
+	StopSequence  = "stop_sequence"
+	StopToolUse   = "tool_use"
+	StopRefusal   = "refusal"
+)
+
+const (
+	ErrInvalidRequest = "invalid_request_error"
+	ErrAuthentication = "authentication_error"
+	ErrAPI            = "api_error"
+	ErrNotFound       = "not_found_error"
+	ErrRateLimit      = "rate_limit_error"
+	ErrOverloaded     = "overloaded_error"
+)
+
+// MessagesRequest System 和 Message.Content 可以是字符串或内容块数组
+type MessagesRequest struct {
+	Model         string          `json:"model" binding:"required"`
+	Messages      []Message       `json:"messages" binding:"required"`
+	System        json.RawMessage `json:"system,omitempty"`
+	MaxTokens     int             `json:"max_tokens" binding:"required"`
+	StopSequences []string        `json:"stop_sequences,omitempty"`
+	Stream        bool            `json:"stream,omitempty"`
+	Temperature   *float64        `json:"temperature,omitempty"`
+	TopP          *float64        `json:"top_p,omitempty"`
+	TopK          *int            `json:"top_k,omitempty"`
+	Tools         []Tool          `json:"tools,omitempty"`
+	ToolChoice    *ToolChoice     `json:"tool_choice,omitempty"`
+	Thinking      *Thinking       `json:"thinking,omitempty"`
+	Metadata      *Metadata       `json:"metadata,omitempty"`
+}
+
+type Message struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// ContentBlock 请求中的内容块，不同类型使用不同的字段
+type ContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Source    *Source         `json:"source,omitempty"`
+	Id        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseId string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
+	Signature string          `json:"signature,omitempty"`
+}
+
+// Source Type 为 base64 时使用 MediaType 和 Data，为 url 时使用 Url
+type Source struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Url       string `json:"url,omitempty"`
+}
+
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+// ToolChoice Type 为 auto、any、tool、none，Type 为 tool 时 Name 为指定的工具
+type ToolChoice struct {
+	Type                   string `json:"type"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type Thinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
+}
+
+type Metadata struct {
+	UserId string `json:"user_id,omitempty"`
+}
+
+type MessagesResponse struct {
+	Id           string  `json:"id"`
+	Type         string  `json:"type"`
+	Role         string  `json:"role"`
+	Model        string  `json:"model"`
+	Content      []any   `json:"content"`
+	StopReason   *string `json:"stop_reason"`
+	StopSequence *string `json:"stop_sequence"`
+	Usage        Usage   `json:"usage"`
+}
+
+type TextBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type ThinkingBlock struct {
+	Type      string `json:"type"`
+	Thinking  string `json:"thinking"`
+	Signature string `json:"signature"`
+}
+
+type ToolUseBlock struct {
+	Type  string          `json:"type"`
+	Id    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+// Usage InputTokens 不包含命中缓存的部分
+type Usage struct {
+	InputTokens          int `json:"input_tokens"`
+	OutputTokens         int `json:"output_tokens"`
+	CacheReadInputTokens int `json:"cache_read_input_tokens,omitempty"`
+}
+
+type ErrorResponse struct {
+	Type  string      `json:"type"`
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// ErrorType http 状态码对应的错误类型
+func ErrorType(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return ErrInvalidRequest
+	case http.StatusUnauthorized:
+		return ErrAuthentication
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusTooManyRequests:
+		return ErrRateLimit
+	case http.StatusServiceUnavailable:
+		return ErrOverloaded
+	}
+	return ErrAPI
+}
+
+func NewError(errType, message string) *ErrorResponse {
+	return &ErrorResponse{Type: "error", Error: ErrorDetail{Type: errType, Message: message}}
+}
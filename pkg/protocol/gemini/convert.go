@@ -0,0 +1,284 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"strings"
+)
+
+// ToOpenAI 转换为 OpenAI chat 请求，model 来自请求路径，safetySettings 和 topK 没有对应的字段，直接丢弃
+func ToOpenAI(model string, req *GenerateContentRequest, stream bool) (*openai.ChatRequest, error) {
+	out := &openai.ChatRequest{
+		Model:  model,
+		Stream: stream,
+	}
+	if stream {
+		out.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	if req.SystemInstruction != nil {
+		if text := joinText(req.SystemInstruction.Parts); text != "" {
+			out.Messages = append(out.Messages, openai.ChatMessage{Role: openai.RoleSystem, Content: text})
+		}
+	}
+	calls := newCallIds()
+	for i, content := range req.Contents {
+		switch content.Role {
+		case RoleModel:
+			out.Messages = append(out.Messages, convertModelContent(content.Parts, calls))
+		case RoleUser, "function", "":
+			messages, err := convertUserContent(content.Parts, calls)
+			if err != nil {
+				return nil, fmt.Errorf("invalid contents[%d]: %w", i, err)
+			}
+			out.Messages = append(out.Messages, messages...)
+		default:
+			return nil, fmt.Errorf("invalid contents[%d].role: %s", i, content.Role)
+		}
+	}
+	if len(out.Messages) == 0 {
+		return nil, fmt.Errorf("contents is empty")
+	}
+	for _, tool := range req.Tools {
+		for _, fn := range tool.FunctionDeclarations {
+			out.Tools = append(out.Tools, openai.Tool{
+				Type: "function",
+				Function: openai.FunctionDef{
+					Name:        fn.Name,
+					Description: fn.Description,
+					Parameters:  fn.Parameters,
+				},
+			})
+		}
+	}
+	if req.ToolConfig != nil && req.ToolConfig.FunctionCallingConfig != nil && len(out.Tools) > 0 {
+		config := req.ToolConfig.FunctionCallingConfig
+		switch strings.ToUpper(config.Mode) {
+		case "AUTO":
+			out.ToolChoice = "auto"
+		case "NONE":
+			out.ToolChoice = "none"
+		case "ANY":
+			out.ToolChoice = "required"
+			// 只允许一个函数时可以直接指定
+			if len(config.AllowedFunctionNames) == 1 {
+				out.ToolChoice = map[string]any{
+					"type":     "function",
+					"function": map[string]string{"name": config.AllowedFunctionNames[0]},
+				}
+			}
+		}
+	}
+	if config := req.GenerationConfig; config != nil {
+		out.Temperature = config.Temperature
+		out.TopP = config.TopP
+		out.MaxTokens = config.MaxOutputTokens
+		out.Stop = config.StopSequences
+		out.Seed = config.Seed
+		if config.ResponseMimeType == "application/json" {
+			out.ResponseFormat = map[string]any{"type": "json_object"}
+			if len(config.ResponseSchema) > 0 {
+				out.ResponseFormat = map[string]any{
+					"type":        "json_schema",
+					"json_schema": map[string]any{"name": "response", "schema": config.ResponseSchema},
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// callIds 旧版本的 functionCall 没有 id，按函数名依次分配，functionResponse 按同样的顺序取出
+type callIds struct {
+	next    int
+	pending map[string][]string
+}
+
+func newCallIds() *callIds {
+	return &callIds{pending: make(map[string][]string)}
+}
+
+func (c *callIds) call(call *FunctionCall) string {
+	id := call.Id
+	if id == "" {
+		c.next++
+		id = fmt.Sprintf("call_%d", c.next)
+	}
+	c.pending[call.Name] = append(c.pending[call.Name], id)
+	return id
+}
+
+func (c *callIds) response(resp *FunctionResponse) string {
+	ids := c.pending[resp.Name]
+	if resp.Id != "" {
+		for i, id := range ids {
+			if id == resp.Id {
+				c.pending[resp.Name] = append(ids[:i], ids[i+1:]...)
+				break
+			}
+		}
+		return resp.Id
+	}
+	if len(ids) == 0 {
+		c.next++
+		return fmt.Sprintf("call_%d", c.next)
+	}
+	c.pending[resp.Name] = ids[1:]
+	return ids[0]
+}
+
+// joinText 只取非思考的文本
+func joinText(parts []Part) string {
+	var texts []string
+	for _, part := range parts {
+		if part.Text != "" && !part.Thought {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func convertModelContent(parts []Part, calls *callIds) openai.ChatMessage {
+	msg := openai.ChatMessage{Role: openai.RoleAssistant}
+	if text := joinText(parts); text != "" {
+		msg.Content = text
+	}
+	for _, part := range parts {
+		if part.FunctionCall == nil {
+			continue
+		}
+		args := string(part.FunctionCall.Args)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
+			Id:       calls.call(part.FunctionCall),
+			Type:     "function",
+			Function: openai.FunctionCall{Name: part.FunctionCall.Name, Arguments: args},
+		})
+	}
+	return msg
+}
+
+// convertUserContent functionResponse 转为 tool 消息放在前面，紧跟上一条 model 消息的 tool_calls
+func convertUserContent(parts []Part, calls *callIds) ([]openai.ChatMessage, error) {
+	var messages []openai.ChatMessage
+	var contentParts []openai.ContentPart
+	allText := true
+	for _, part := range parts {
+		switch {
+		case part.FunctionResponse != nil:
+			messages = append(messages, openai.ChatMessage{
+				Role:       openai.RoleTool,
+				Content:    string(part.FunctionResponse.Response),
+				ToolCallId: calls.response(part.FunctionResponse),
+			})
+		case part.InlineData != nil:
+			contentPart, err := inlineDataPart(part.InlineData)
+			if err != nil {
+				return nil, err
+			}
+			contentParts = append(contentParts, contentPart)
+			allText = false
+		case part.FileData != nil:
+			contentParts = append(contentParts, openai.ContentPart{Type: "image_url", ImageUrl: &openai.ImageUrl{Url: part.FileData.FileUri}})
+			allText = false
+		case part.Text != "" && !part.Thought:
+			contentParts = append(contentParts, openai.ContentPart{Type: "text", Text: part.Text})
+		}
+	}
+	if len(contentParts) == 0 {
+		return messages, nil
+	}
+	// 纯文本时合并为字符串，兼容只支持字符串 content 的上游
+	var content any = contentParts
+	if allText {
+		content = joinText(parts)
+	}
+	return append(messages, openai.ChatMessage{Role: openai.RoleUser, Content: content}), nil
+}
+
+// inlineDataPart 图片转为 data url，音频转为 input_audio
+func inlineDataPart(blob *Blob) (openai.ContentPart, error) {
+	mimeType := strings.ToLower(blob.MimeType)
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return openai.ContentPart{Type: "image_url", ImageUrl: &openai.ImageUrl{Url: "data:" + mimeType + ";base64," + blob.Data}}, nil
+	case strings.HasPrefix(mimeType, "audio/"):
+		format := strings.TrimPrefix(mimeType, "audio/")
+		if format == "mpeg" {
+			format = "mp3"
+		}
+		return openai.ContentPart{Type: "input_audio", InputAudio: &openai.InputAudio{Data: blob.Data, Format: format}}, nil
+	}
+	return openai.ContentPart{}, fmt.Errorf("unsupported inlineData mimeType: %s", blob.MimeType)
+}
+
+// FinishReason 上游的 finish_reason 对应的 finishReason，Gemini 调用函数时也是 STOP
+func FinishReason(finishReason string) string {
+	switch finishReason {
+	case openai.FinishStop, openai.FinishToolCalls, openai.FinishFunctionCall:
+		return FinishStop
+	case openai.FinishLength:
+		return FinishMaxTokens
+	case openai.FinishContentFilter:
+		return FinishSafety
+	}
+	return FinishOther
+}
+
+func ConvertUsage(usage *openai.Usage) *UsageMetadata {
+	if usage == nil {
+		return nil
+	}
+	return &UsageMetadata{
+		PromptTokenCount:        usage.PromptTokens,
+		CandidatesTokenCount:    usage.CompletionTokens,
+		TotalTokenCount:         usage.PromptTokens + usage.CompletionTokens,
+		CachedContentTokenCount: usage.CachedTokens(),
+	}
+}
+
+// functionArgs 上游返回的参数不是合法 json 时使用空对象
+func functionArgs(arguments string) json.RawMessage {
+	if arguments != "" && json.Valid([]byte(arguments)) {
+		return json.RawMessage(arguments)
+	}
+	return json.RawMessage("{}")
+}
+
+func functionCallPart(call openai.ToolCall) Part {
+	return Part{FunctionCall: &FunctionCall{
+		Id:   call.Id,
+		Name: call.Function.Name,
+		Args: functionArgs(call.Function.Arguments),
+	}}
+}
+
+// FromOpenAI 转换非流式响应，model 为用户请求的模型名
+func FromOpenAI(resp *openai.ChatResponse, model string) *GenerateContentResponse {
+	out := &GenerateContentResponse{
+		Candidates:    []Candidate{},
+		UsageMetadata: ConvertUsage(resp.Usage),
+		ModelVersion:  model,
+		ResponseId:    resp.Id,
+	}
+	for _, choice := range resp.Choices {
+		parts := []Part{}
+		if choice.Message.ReasoningContent != "" {
+			parts = append(parts, Part{Text: choice.Message.ReasoningContent, Thought: true})
+		}
+		if text := choice.Message.ContentText(); text != "" {
+			parts = append(parts, Part{Text: text})
+		}
+		for _, call := range choice.Message.ToolCalls {
+			parts = append(parts, functionCallPart(call))
+		}
+		out.Candidates = append(out.Candidates, Candidate{
+			Content:      Content{Role: RoleModel, Parts: parts},
+			FinishReason: FinishReason(choice.FinishReason),
+			Index:        choice.Index,
+		})
+	}
+	return out
+}
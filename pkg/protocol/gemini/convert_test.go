@@ -0,0 +1,236 @@
+package gemini
+
+import (
+	"encoding/json"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToOpenAI(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		stream  bool
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "text and system",
+			body: `{"systemInstruction":{"parts":[{"text":"be brief"}]},
+				"contents":[{"role":"user","parts":[{"text":"hi"}]},{"role":"model","parts":[{"text":"thinking","thought":true},{"text":"hello"}]}],
+				"generationConfig":{"maxOutputTokens":50,"stopSequences":["END"],"responseMimeType":"application/json"}}`,
+			want: `{"model":"gemini","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"},
+				{"role":"assistant","content":"hello"}],"max_tokens":50,"stop":["END"],"stream":false,
+				"response_format":{"type":"json_object"}}`,
+		},
+		{
+			name:   "stream with inline data",
+			stream: true,
+			body: `{"contents":[{"parts":[{"text":"listen"},{"inlineData":{"mimeType":"audio/mpeg","data":"AAA"}},
+				{"inlineData":{"mimeType":"image/png","data":"BBB"}}]}]}`,
+			want: `{"model":"gemini","messages":[{"role":"user","content":[{"type":"text","text":"listen"},
+				{"type":"input_audio","input_audio":{"data":"AAA","format":"mp3"}},
+				{"type":"image_url","image_url":{"url":"data:image/png;base64,BBB"}}]}],
+				"stream":true,"stream_options":{"include_usage":true}}`,
+		},
+		{
+			name: "function call without id",
+			body: `{"tools":[{"functionDeclarations":[{"name":"f","parameters":{"type":"object"}}]}],
+				"toolConfig":{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["f"]}},
+				"contents":[
+					{"role":"user","parts":[{"text":"go"}]},
+					{"role":"model","parts":[{"functionCall":{"name":"f","args":{"a":1}}},{"functionCall":{"name":"f"}}]},
+					{"role":"function","parts":[{"functionResponse":{"name":"f","response":{"ok":1}}},{"functionResponse":{"name":"f","response":{"ok":2}}}]}]}`,
+			want: `{"model":"gemini","messages":[
+				{"role":"user","content":"go"},
+				{"role":"assistant","content":null,"tool_calls":[
+					{"id":"call_1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}},
+					{"id":"call_2","type":"function","function":{"name":"f","arguments":"{}"}}]},
+				{"role":"tool","content":"{\"ok\":1}","tool_call_id":"call_1"},
+				{"role":"tool","content":"{\"ok\":2}","tool_call_id":"call_2"}],
+				"stream":false,
+				"tools":[{"type":"function","function":{"name":"f","parameters":{"type":"object"}}}],
+				"tool_choice":{"type":"function","function":{"name":"f"}}}`,
+		},
+		{
+			name:    "empty contents",
+			body:    `{"contents":[]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid role",
+			body:    `{"contents":[{"role":"system","parts":[{"text":"x"}]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported inline data",
+			body:    `{"contents":[{"parts":[{"inlineData":{"mimeType":"application/pdf","data":"AAA"}}]}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req GenerateContentRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatal(err)
+			}
+			out, err := ToOpenAI("gemini", &req, tt.stream)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, out, tt.want)
+		})
+	}
+}
+
+func TestFromOpenAI(t *testing.T) {
+	tests := []struct {
+		name string
+		resp string
+		want string
+	}{
+		{
+			name: "text",
+			resp: `{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi","reasoning_content":"hm"},"finish_reason":"stop"}],
+				"usage":{"prompt_tokens":10,"completion_tokens":2,"prompt_tokens_details":{"cached_tokens":4}}}`,
+			want: `{"candidates":[{"content":{"role":"model","parts":[{"text":"hm","thought":true},{"text":"hi"}]},"finishReason":"STOP","index":0}],
+				"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":2,"totalTokenCount":12,"cachedContentTokenCount":4},
+				"modelVersion":"gemini","responseId":"chatcmpl-1"}`,
+		},
+		{
+			name: "tool call",
+			resp: `{"id":"x","choices":[{"message":{"role":"assistant","content":null,
+				"tool_calls":[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}}]},"finish_reason":"tool_calls"}]}`,
+			want: `{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"id":"call_1","name":"f","args":{"a":1}}}]},
+				"finishReason":"STOP","index":0}],"modelVersion":"gemini","responseId":"x"}`,
+		},
+		{
+			name: "length",
+			resp: `{"id":"y","choices":[{"message":{"role":"assistant","content":"abc"},"finish_reason":"length"}]}`,
+			want: `{"candidates":[{"content":{"role":"model","parts":[{"text":"abc"}]},"finishReason":"MAX_TOKENS","index":0}],
+				"modelVersion":"gemini","responseId":"y"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp openai.ChatResponse
+			if err := json.Unmarshal([]byte(tt.resp), &resp); err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, FromOpenAI(&resp, "gemini"), tt.want)
+		})
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	stream := "data: {\"id\":\"c1\",\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+		"data: {\"id\":\"c1\",\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"function\":{\"name\":\"f\",\"arguments\":\"{\\\"a\\\":\"}}]}}]}\n\n" +
+		"data: {\"id\":\"c1\",\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"1}\"}}]},\"finish_reason\":\"tool_calls\"}]}\n\n" +
+		"data: {\"id\":\"c1\",\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":4}}\n\n" +
+		"data: [DONE]\n\n"
+	want := []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hi"}]},"index":0}],"modelVersion":"gemini","responseId":"c1"}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"id":"call_1","name":"f","args":{"a":1}}}]},"finishReason":"STOP","index":0}],
+			"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":4,"totalTokenCount":7},"modelVersion":"gemini","responseId":"c1"}`,
+	}
+	tests := []struct {
+		name  string
+		sse   bool
+		split func(out string) []string
+	}{
+		{
+			name: "sse",
+			sse:  true,
+			split: func(out string) []string {
+				var items []string
+				for _, event := range strings.Split(strings.TrimSpace(out), "\n\n") {
+					items = append(items, strings.TrimPrefix(event, "data: "))
+				}
+				return items
+			},
+		},
+		{
+			name: "json array",
+			split: func(out string) []string {
+				var items []json.RawMessage
+				if err := json.Unmarshal([]byte(out), &items); err != nil {
+					t.Fatalf("output is not a json array: %v\n%s", err, out)
+				}
+				var result []string
+				for _, item := range items {
+					result = append(result, string(item))
+				}
+				return result
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			writer := NewStreamWriter(&buf, "gemini", tt.sse)
+			if err := openai.ReadChatStream(strings.NewReader(stream), writer.Chunk); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Finish(); err != nil {
+				t.Fatal(err)
+			}
+			items := tt.split(buf.String())
+			if len(items) != len(want) {
+				t.Fatalf("got %d responses, want %d:\n%s", len(items), len(want), buf.String())
+			}
+			for i := range want {
+				var got any
+				if err := json.Unmarshal([]byte(items[i]), &got); err != nil {
+					t.Fatal(err)
+				}
+				assertJSON(t, got, want[i])
+			}
+		})
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{400, StatusInvalidArgument},
+		{401, StatusUnauthenticated},
+		{404, StatusNotFound},
+		{429, StatusExhausted},
+		{503, StatusUnavailable},
+		{500, StatusInternal},
+	}
+	for _, tt := range tests {
+		if got := ErrorStatus(tt.status); got != tt.want {
+			t.Errorf("ErrorStatus(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+// assertJSON 按 json 语义比较，忽略字段顺序和空白
+func assertJSON(t *testing.T, got any, want string) {
+	t.Helper()
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotValue, wantValue any
+	if err = json.Unmarshal(data, &gotValue); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid want json: %v", err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Fatalf("got  %s\nwant %s", data, want)
+	}
+}
@@ -0,0 +1,156 @@
+package gemini
+
+import (
+	"encoding/json"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"io"
+	"net/http"
+)
+
+// StreamWriter 把 OpenAI 的流式 chunk 转为 streamGenerateContent 的响应
+// sse 为 true 时(alt=sse)每个响应为一个 data 事件，否则按 Gemini 的默认格式输出一个逐步写出的 json 数组
+// 函数调用的参数分多个 chunk 返回，拼接完整后和 finishReason、usageMetadata 一起在最后一个响应中返回
+type StreamWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	model   string
+	sse     bool
+
+	id           string
+	count        int
+	toolCalls    []openai.ToolCall
+	toolIndex    map[int]int
+	finishReason string
+	usage        *openai.Usage
+}
+
+func NewStreamWriter(w io.Writer, model string, sse bool) *StreamWriter {
+	flusher, _ := w.(http.Flusher)
+	return &StreamWriter{
+		w:         w,
+		flusher:   flusher,
+		model:     model,
+		sse:       sse,
+		toolIndex: make(map[int]int),
+	}
+}
+
+func (s *StreamWriter) write(data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var prefix, suffix string
+	switch {
+	case s.sse:
+		prefix, suffix = "data: ", "\n\n"
+	case s.count == 0:
+		prefix = "["
+	default:
+		prefix = ",\r\n"
+	}
+	s.count++
+	if _, err = io.WriteString(s.w, prefix+string(payload)+suffix); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+func (s *StreamWriter) response(parts []Part, finishReason string) *GenerateContentResponse {
+	return &GenerateContentResponse{
+		Candidates: []Candidate{{
+			Content:      Content{Role: RoleModel, Parts: parts},
+			FinishReason: finishReason,
+		}},
+		ModelVersion: s.model,
+		ResponseId:   s.id,
+	}
+}
+
+// Chunk 处理一个上游 chunk，只使用第一个 choice
+func (s *StreamWriter) Chunk(chunk *openai.ChatChunk) error {
+	if s.id == "" {
+		s.id = chunk.Id
+	}
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return nil
+	}
+	choice := chunk.Choices[0]
+	for i, call := range choice.Delta.ToolCalls {
+		s.toolCall(i, call)
+	}
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		s.finishReason = *choice.FinishReason
+	}
+	var parts []Part
+	if choice.Delta.ReasoningContent != "" {
+		parts = append(parts, Part{Text: choice.Delta.ReasoningContent, Thought: true})
+	}
+	if choice.Delta.Content != "" {
+		parts = append(parts, Part{Text: choice.Delta.Content})
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return s.write(s.response(parts, ""))
+}
+
+func (s *StreamWriter) toolCall(pos int, call openai.ToolCall) {
+	index := pos
+	if call.Index != nil {
+		index = *call.Index
+	}
+	i, ok := s.toolIndex[index]
+	if !ok {
+		s.toolIndex[index] = len(s.toolCalls)
+		s.toolCalls = append(s.toolCalls, call)
+		return
+	}
+	if call.Id != "" {
+		s.toolCalls[i].Id = call.Id
+	}
+	if call.Function.Name != "" {
+		s.toolCalls[i].Function.Name = call.Function.Name
+	}
+	s.toolCalls[i].Function.Arguments += call.Function.Arguments
+}
+
+// Finish 上游流结束后调用，返回函数调用、finishReason 和 usage，json 数组格式时补上结尾
+func (s *StreamWriter) Finish() error {
+	parts := []Part{}
+	for _, call := range s.toolCalls {
+		parts = append(parts, functionCallPart(call))
+	}
+	finishReason := FinishStop
+	if s.finishReason != "" {
+		finishReason = FinishReason(s.finishReason)
+	}
+	resp := s.response(parts, finishReason)
+	resp.UsageMetadata = ConvertUsage(s.usage)
+	if err := s.write(resp); err != nil {
+		return err
+	}
+	return s.end()
+}
+
+// Error 流已经开始后出错时写入错误对象
+func (s *StreamWriter) Error(status, message string) error {
+	if err := s.write(NewError(http.StatusInternalServerError, status, message)); err != nil {
+		return err
+	}
+	return s.end()
+}
+
+func (s *StreamWriter) end() error {
+	if s.sse {
+		return nil
+	}
+	_, err := io.WriteString(s.w, "]")
+	return err
+}
@@ -0,0 +1,160 @@
+// Package gemini Gemini generateContent 的请求、响应和流式格式，以及与 OpenAI chat completions 之间的转换
+package gemini
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	RoleUser  = "user"
+	RoleModel = "model"
+)
+
+const (
+	FinishStop      = "STOP"
+	FinishMaxTokens = "MAX_TOKENS"
+	FinishSafety    = "SAFETY"
+	FinishOther     = "OTHER"
+)
+
+const (
+	StatusInvalidArgument = "INVALID_ARGUMENT"
+	StatusUnauthenticated = "UNAUTHENTICATED"
+	StatusNotFound        = "NOT_FOUND"
+	StatusExhausted       = "RESOURCE_EXHAUSTED"
+	StatusInternal        = "INTERNAL"
+	StatusUnavailable     = "UNAVAILABLE"
+)
+
+type GenerateContentRequest struct {
+	Contents          []Content         `json:"contents" binding:"required"`
+	SystemInstruction *Content          `json:"systemInstruction,omitempty"`
+	Tools             []Tool            `json:"tools,omitempty"`
+	ToolConfig        *ToolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *GenerationConfig `json:"generationConfig,omitempty"`
+	SafetySettings    json.RawMessage   `json:"safetySettings,omitempty"`
+}
+
+// Content Role 为 user 或 model，functionResponse 所在的 Content 也可能为 function
+type Content struct {
+	Role  string `json:"role,omitempty"`
+	Parts []Part `json:"parts"`
+}
+
+// Part 一个 Part 只使用其中一个字段，Thought 为 true 时 Text 为思考内容
+type Part struct {
+	Text             string            `json:"text,omitempty"`
+	Thought          bool              `json:"thought,omitempty"`
+	InlineData       *Blob             `json:"inlineData,omitempty"`
+	FileData         *FileData         `json:"fileData,omitempty"`
+	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type Blob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type FileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileUri  string `json:"fileUri"`
+}
+
+// FunctionCall 旧版本没有 Id，按函数名和顺序与 FunctionResponse 对应
+type FunctionCall struct {
+	Id   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type FunctionResponse struct {
+	Id       string          `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type Tool struct {
+	FunctionDeclarations []FunctionDeclaration `json:"functionDeclarations,omitempty"`
+}
+
+type FunctionDeclaration struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type ToolConfig struct {
+	FunctionCallingConfig *FunctionCallingConfig `json:"functionCallingConfig,omitempty"`
+}
+
+// FunctionCallingConfig Mode 为 AUTO、ANY、NONE，Mode 为 ANY 时可以用 AllowedFunctionNames 限定函数
+type FunctionCallingConfig struct {
+	Mode                 string   `json:"mode,omitempty"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type GenerationConfig struct {
+	Temperature      *float64        `json:"temperature,omitempty"`
+	TopP             *float64        `json:"topP,omitempty"`
+	TopK             *int            `json:"topK,omitempty"`
+	MaxOutputTokens  int             `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string        `json:"stopSequences,omitempty"`
+	CandidateCount   int             `json:"candidateCount,omitempty"`
+	Seed             *int            `json:"seed,omitempty"`
+	ResponseMimeType string          `json:"responseMimeType,omitempty"`
+	ResponseSchema   json.RawMessage `json:"responseSchema,omitempty"`
+}
+
+type GenerateContentResponse struct {
+	Candidates    []Candidate    `json:"candidates"`
+	UsageMetadata *UsageMetadata `json:"usageMetadata,omitempty"`
+	ModelVersion  string         `json:"modelVersion,omitempty"`
+	ResponseId    string         `json:"responseId,omitempty"`
+}
+
+type Candidate struct {
+	Content      Content `json:"content"`
+	FinishReason string  `json:"finishReason,omitempty"`
+	Index        int     `json:"index"`
+}
+
+// UsageMetadata PromptTokenCount 包含命中缓存的部分
+type UsageMetadata struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	TotalTokenCount         int `json:"totalTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+// ErrorStatus http 状态码对应的 google.rpc 状态
+func ErrorStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return StatusInvalidArgument
+	case http.StatusUnauthorized:
+		return StatusUnauthenticated
+	case http.StatusNotFound:
+		return StatusNotFound
+	case http.StatusTooManyRequests:
+		return StatusExhausted
+	case http.StatusServiceUnavailable:
+		return StatusUnavailable
+	}
+	return StatusInternal
+}
+
+func NewError(code int, status, message string) *ErrorResponse {
+	return &ErrorResponse{Error: ErrorDetail{Code: code, Message: message, Status: status}}
+}
@@ -0,0 +1,355 @@
+package ollama
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ModelId Ollama 客户端会给没有标签的模型名补上 :latest，转发前去掉
+func ModelId(name string) string {
+	return strings.TrimSuffix(name, ":latest")
+}
+
+// ChatToOpenAI 转换为 OpenAI chat 请求
+func ChatToOpenAI(req *ChatRequest) (*openai.ChatRequest, error) {
+	out := newChatRequest(req.Model, req.Options, req.IsStream())
+	if err := setFormat(out, req.Format); err != nil {
+		return nil, err
+	}
+	out.ReasoningEffort = thinkEffort(req.Think)
+	calls := newCallIds()
+	for i, msg := range req.Messages {
+		message, err := convertMessage(msg, calls)
+		if err != nil {
+			return nil, fmt.Errorf("invalid messages[%d]: %w", i, err)
+		}
+		out.Messages = append(out.Messages, message)
+	}
+	if len(out.Messages) == 0 {
+		return nil, errors.New("messages is empty")
+	}
+	for _, tool := range req.Tools {
+		out.Tools = append(out.Tools, openai.Tool{
+			Type: "function",
+			Function: openai.FunctionDef{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  tool.Function.Parameters,
+			},
+		})
+	}
+	return out, nil
+}
+
+// GenerateToOpenAI 转换为只有一轮对话的 OpenAI chat 请求，不支持 suffix 补全和 context
+func GenerateToOpenAI(req *GenerateRequest) (*openai.ChatRequest, error) {
+	if req.Suffix != "" {
+		return nil, errors.New("suffix is not supported")
+	}
+	if req.Prompt == "" && len(req.Images) == 0 {
+		return nil, errors.New("prompt is empty")
+	}
+	out := newChatRequest(req.Model, req.Options, req.IsStream())
+	if err := setFormat(out, req.Format); err != nil {
+		return nil, err
+	}
+	out.ReasoningEffort = thinkEffort(req.Think)
+	if req.System != "" && !req.Raw {
+		out.Messages = append(out.Messages, openai.ChatMessage{Role: openai.RoleSystem, Content: req.System})
+	}
+	content, err := userContent(req.Prompt, req.Images)
+	if err != nil {
+		return nil, err
+	}
+	out.Messages = append(out.Messages, openai.ChatMessage{Role: openai.RoleUser, Content: content})
+	return out, nil
+}
+
+func newChatRequest(model string, options *Options, stream bool) *openai.ChatRequest {
+	out := &openai.ChatRequest{
+		Model:  ModelId(model),
+		Stream: stream,
+	}
+	if stream {
+		out.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	if options != nil {
+		out.Temperature = options.Temperature
+		out.TopP = options.TopP
+		out.Stop = options.Stop
+		out.Seed = options.Seed
+		// num_predict 为 -1 时不限制长度
+		if options.NumPredict > 0 {
+			out.MaxTokens = options.NumPredict
+		}
+	}
+	return out
+}
+
+// setFormat format 为 "json" 或 json schema 对象
+func setFormat(out *openai.ChatRequest, format json.RawMessage) error {
+	if len(format) == 0 || string(format) == "null" || string(format) == `""` {
+		return nil
+	}
+	if format[0] == '"' {
+		if string(format) != `"json"` {
+			return fmt.Errorf("invalid format: %s", format)
+		}
+		out.ResponseFormat = map[string]any{"type": "json_object"}
+		return nil
+	}
+	out.ResponseFormat = map[string]any{
+		"type":        "json_schema",
+		"json_schema": map[string]any{"name": "response", "schema": format},
+	}
+	return nil
+}
+
+// thinkEffort think 为 low、medium、high 时对应 reasoning_effort，为 true 或 false 时由上游决定
+func thinkEffort(think json.RawMessage) string {
+	var effort string
+	if json.Unmarshal(think, &effort) == nil {
+		return effort
+	}
+	return ""
+}
+
+// callIds Ollama 的函数调用没有 id，按函数名依次分配，tool 消息按同样的顺序取出
+// tool 消息没有 tool_name 时按调用顺序取出
+type callIds struct {
+	next    int
+	order   []string
+	pending map[string][]string
+}
+
+func newCallIds() *callIds {
+	return &callIds{pending: make(map[string][]string)}
+}
+
+func (c *callIds) call(name string) string {
+	c.next++
+	id := fmt.Sprintf("call_%d", c.next)
+	c.pending[name] = append(c.pending[name], id)
+	c.order = append(c.order, id)
+	return id
+}
+
+func (c *callIds) response(name string) string {
+	var id string
+	if ids := c.pending[name]; len(ids) > 0 {
+		id = ids[0]
+	} else if len(c.order) > 0 {
+		id = c.order[0]
+	} else {
+		c.next++
+		return fmt.Sprintf("call_%d", c.next)
+	}
+	c.remove(id)
+	return id
+}
+
+func (c *callIds) remove(id string) {
+	for i, v := range c.order {
+		if v == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	for name, ids := range c.pending {
+		for i, v := range ids {
+			if v == id {
+				c.pending[name] = append(ids[:i], ids[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func convertMessage(msg Message, calls *callIds) (openai.ChatMessage, error) {
+	switch msg.Role {
+	case openai.RoleSystem:
+		return openai.ChatMessage{Role: openai.RoleSystem, Content: msg.Content}, nil
+	case openai.RoleUser:
+		content, err := userContent(msg.Content, msg.Images)
+		if err != nil {
+			return openai.ChatMessage{}, err
+		}
+		return openai.ChatMessage{Role: openai.RoleUser, Content: content}, nil
+	case openai.RoleAssistant:
+		out := openai.ChatMessage{Role: openai.RoleAssistant}
+		if msg.Content != "" {
+			out.Content = msg.Content
+		}
+		for _, call := range msg.ToolCalls {
+			args := string(call.Function.Arguments)
+			if args == "" || args == "null" {
+				args = "{}"
+			}
+			out.ToolCalls = append(out.ToolCalls, openai.ToolCall{
+				Id:       calls.call(call.Function.Name),
+				Type:     "function",
+				Function: openai.FunctionCall{Name: call.Function.Name, Arguments: args},
+			})
+		}
+		return out, nil
+	case openai.RoleTool:
+		return openai.ChatMessage{
+			Role:       openai.RoleTool,
+			Content:    msg.Content,
+			ToolCallId: calls.response(msg.ToolName),
+		}, nil
+	}
+	return openai.ChatMessage{}, fmt.Errorf("invalid role: %s", msg.Role)
+}
+
+// userContent 没有图片时为字符串，兼容只支持字符串 content 的上游
+func userContent(text string, images []string) (any, error) {
+	if len(images) == 0 {
+		return text, nil
+	}
+	var parts []openai.ContentPart
+	if text != "" {
+		parts = append(parts, openai.ContentPart{Type: "text", Text: text})
+	}
+	for i, image := range images {
+		url, err := imageDataUrl(image)
+		if err != nil {
+			return nil, fmt.Errorf("invalid images[%d]: %w", i, err)
+		}
+		parts = append(parts, openai.ContentPart{Type: "image_url", ImageUrl: &openai.ImageUrl{Url: url}})
+	}
+	return parts, nil
+}
+
+// imageDataUrl Ollama 的图片不带 mime 类型，根据解码后的内容判断
+func imageDataUrl(data string) (string, error) {
+	if strings.HasPrefix(data, "data:") {
+		return data, nil
+	}
+	head := data
+	if len(head) > 64 {
+		head = head[:64]
+	}
+	decoded, err := base64.StdEncoding.DecodeString(head[:len(head)/4*4])
+	if err != nil {
+		return "", errors.New("image is not base64")
+	}
+	mimeType := http.DetectContentType(decoded)
+	if !strings.HasPrefix(mimeType, "image/") {
+		mimeType = "image/png"
+	}
+	return "data:" + mimeType + ";base64," + data, nil
+}
+
+// DoneReason 上游的 finish_reason 对应的 done_reason，调用函数时也是 stop
+func DoneReason(finishReason string) string {
+	if finishReason == openai.FinishLength {
+		return DoneLength
+	}
+	return DoneStop
+}
+
+// toolCall 上游返回的参数不是合法 json 时使用空对象
+func toolCall(call openai.ToolCall) ToolCall {
+	args := json.RawMessage("{}")
+	if call.Function.Arguments != "" && json.Valid([]byte(call.Function.Arguments)) {
+		args = json.RawMessage(call.Function.Arguments)
+	}
+	return ToolCall{Function: ToolCallFunction{Name: call.Function.Name, Arguments: args}}
+}
+
+func metrics(usage *openai.Usage, start time.Time) Metrics {
+	m := Metrics{TotalDuration: time.Since(start).Nanoseconds()}
+	if usage != nil {
+		m.PromptEvalCount = usage.PromptTokens
+		m.EvalCount = usage.CompletionTokens
+	}
+	return m
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+// ChatFromOpenAI 转换非流式响应，只使用第一个 choice，model 为用户请求的模型名，start 为开始处理请求的时间
+func ChatFromOpenAI(resp *openai.ChatResponse, model string, start time.Time) *ChatResponse {
+	out := &ChatResponse{
+		Model:      model,
+		CreatedAt:  now(),
+		Message:    Message{Role: openai.RoleAssistant},
+		Done:       true,
+		DoneReason: DoneStop,
+		Metrics:    metrics(resp.Usage, start),
+	}
+	if len(resp.Choices) == 0 {
+		return out
+	}
+	choice := resp.Choices[0]
+	out.Message.Content = choice.Message.ContentText()
+	out.Message.Thinking = choice.Message.ReasoningContent
+	for _, call := range choice.Message.ToolCalls {
+		out.Message.ToolCalls = append(out.Message.ToolCalls, toolCall(call))
+	}
+	out.DoneReason = DoneReason(choice.FinishReason)
+	return out
+}
+
+// GenerateFromOpenAI 同 ChatFromOpenAI，输出放在 response 中
+func GenerateFromOpenAI(resp *openai.ChatResponse, model string, start time.Time) *GenerateResponse {
+	chat := ChatFromOpenAI(resp, model, start)
+	return &GenerateResponse{
+		Model:      chat.Model,
+		CreatedAt:  chat.CreatedAt,
+		Response:   chat.Message.Content,
+		Thinking:   chat.Message.Thinking,
+		Done:       true,
+		DoneReason: chat.DoneReason,
+		Metrics:    chat.Metrics,
+	}
+}
+
+// EmbeddingsToOpenAI 转换为 OpenAI embeddings 请求体
+func EmbeddingsToOpenAI(req *EmbeddingsRequest) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"model": ModelId(req.Model),
+		"input": req.Prompt,
+	})
+}
+
+// EmbeddingsFromOpenAI 只取第一个向量，上游返回 base64 编码的向量时不支持
+func EmbeddingsFromOpenAI(body []byte) (*EmbeddingsResponse, error) {
+	var resp struct {
+		Data []struct {
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	out := &EmbeddingsResponse{Embedding: []float64{}}
+	if len(resp.Data) > 0 && resp.Data[0].Embedding != nil {
+		out.Embedding = resp.Data[0].Embedding
+	}
+	return out, nil
+}
+
+// Tags 模型列表转换为 /api/tags 的格式
+func Tags(modelIds []string) *TagsResponse {
+	out := &TagsResponse{Models: make([]ModelTag, 0, len(modelIds))}
+	modifiedAt := now()
+	for _, modelId := range modelIds {
+		out.Models = append(out.Models, ModelTag{
+			Name:       modelId,
+			Model:      modelId,
+			ModifiedAt: modifiedAt,
+			Details:    ModelDetails{Families: []string{}},
+		})
+	}
+	return out
+}
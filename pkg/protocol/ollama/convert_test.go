@@ -0,0 +1,317 @@
+package ollama
+
+import (
+	"encoding/json"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChatToOpenAI(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "default stream with options",
+			body: `{"model":"llama3:latest","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}],
+				"options":{"temperature":0.5,"num_predict":-1,"stop":["END"],"num_ctx":4096},"format":"json","think":"high","keep_alive":"5m"}`,
+			want: `{"model":"llama3","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}],
+				"temperature":0.5,"stop":["END"],"stream":true,"stream_options":{"include_usage":true},
+				"response_format":{"type":"json_object"},"reasoning_effort":"high"}`,
+		},
+		{
+			name: "image and schema",
+			body: `{"model":"llava","stream":false,"think":true,"options":{"num_predict":10},
+				"format":{"type":"object"},
+				"messages":[{"role":"user","content":"what","images":["iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="]}]}`,
+			want: `{"model":"llava","messages":[{"role":"user","content":[{"type":"text","text":"what"},
+				{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="}}]}],
+				"max_tokens":10,"stream":false,
+				"response_format":{"type":"json_schema","json_schema":{"name":"response","schema":{"type":"object"}}}}`,
+		},
+		{
+			name: "tool calls without id",
+			body: `{"model":"qwen","stream":false,"tools":[{"type":"function","function":{"name":"f","parameters":{"type":"object"}}}],
+				"messages":[
+					{"role":"user","content":"go"},
+					{"role":"assistant","content":"","tool_calls":[{"function":{"name":"f","arguments":{"a":1}}},{"function":{"name":"g","arguments":null}}]},
+					{"role":"tool","content":"G","tool_name":"g"},
+					{"role":"tool","content":"F"}]}`,
+			want: `{"model":"qwen","messages":[
+				{"role":"user","content":"go"},
+				{"role":"assistant","content":null,"tool_calls":[
+					{"id":"call_1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}},
+					{"id":"call_2","type":"function","function":{"name":"g","arguments":"{}"}}]},
+				{"role":"tool","content":"G","tool_call_id":"call_2"},
+				{"role":"tool","content":"F","tool_call_id":"call_1"}],
+				"stream":false,
+				"tools":[{"type":"function","function":{"name":"f","parameters":{"type":"object"}}}]}`,
+		},
+		{
+			name:    "empty messages",
+			body:    `{"model":"llama3","messages":[]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid role",
+			body:    `{"model":"llama3","messages":[{"role":"bot","content":"x"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid format",
+			body:    `{"model":"llama3","format":"yaml","messages":[{"role":"user","content":"x"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid image",
+			body:    `{"model":"llama3","messages":[{"role":"user","content":"x","images":["@@@@"]}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req ChatRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatal(err)
+			}
+			out, err := ChatToOpenAI(&req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, out, tt.want)
+		})
+	}
+}
+
+func TestGenerateToOpenAI(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "system",
+			body: `{"model":"llama3","prompt":"hi","system":"be brief","stream":false}`,
+			want: `{"model":"llama3","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}],"stream":false}`,
+		},
+		{
+			name: "raw ignores system",
+			body: `{"model":"llama3","prompt":"hi","system":"be brief","raw":true,"stream":false}`,
+			want: `{"model":"llama3","messages":[{"role":"user","content":"hi"}],"stream":false}`,
+		},
+		{
+			name:    "suffix",
+			body:    `{"model":"llama3","prompt":"def f(","suffix":"return 1"}`,
+			wantErr: true,
+		},
+		{
+			name:    "empty prompt",
+			body:    `{"model":"llama3"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req GenerateRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatal(err)
+			}
+			out, err := GenerateToOpenAI(&req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, out, tt.want)
+		})
+	}
+}
+
+func TestChatFromOpenAI(t *testing.T) {
+	tests := []struct {
+		name       string
+		resp       string
+		wantMsg    string
+		wantReason string
+		wantEval   int
+	}{
+		{
+			name:       "text",
+			resp:       `{"choices":[{"message":{"role":"assistant","content":"hi","reasoning_content":"hm"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":4}}`,
+			wantMsg:    `{"role":"assistant","content":"hi","thinking":"hm"}`,
+			wantReason: DoneStop,
+			wantEval:   4,
+		},
+		{
+			name: "tool call",
+			resp: `{"choices":[{"message":{"role":"assistant","content":null,
+				"tool_calls":[{"id":"c1","type":"function","function":{"name":"f","arguments":"bad json"}}]},"finish_reason":"tool_calls"}]}`,
+			wantMsg:    `{"role":"assistant","content":"","tool_calls":[{"function":{"name":"f","arguments":{}}}]}`,
+			wantReason: DoneStop,
+		},
+		{
+			name:       "length",
+			resp:       `{"choices":[{"message":{"role":"assistant","content":"abc"},"finish_reason":"length"}]}`,
+			wantMsg:    `{"role":"assistant","content":"abc"}`,
+			wantReason: DoneLength,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp openai.ChatResponse
+			if err := json.Unmarshal([]byte(tt.resp), &resp); err != nil {
+				t.Fatal(err)
+			}
+			out := ChatFromOpenAI(&resp, "llama3:latest", time.Now())
+			if out.Model != "llama3:latest" || !out.Done || out.DoneReason != tt.wantReason || out.EvalCount != tt.wantEval {
+				t.Fatalf("unexpected response: %+v", out)
+			}
+			assertJSON(t, out.Message, tt.wantMsg)
+
+			generate := GenerateFromOpenAI(&resp, "llama3:latest", time.Now())
+			if generate.Response != out.Message.Content || generate.DoneReason != tt.wantReason {
+				t.Fatalf("unexpected generate response: %+v", generate)
+			}
+		})
+	}
+}
+
+func TestEmbeddings(t *testing.T) {
+	body, err := EmbeddingsToOpenAI(&EmbeddingsRequest{Model: "nomic:latest", Prompt: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, json.RawMessage(body), `{"model":"nomic","input":"hi"}`)
+
+	tests := []struct {
+		body    string
+		want    []float64
+		wantErr bool
+	}{
+		{`{"data":[{"embedding":[0.1,0.2]},{"embedding":[0.3]}]}`, []float64{0.1, 0.2}, false},
+		{`{"data":[]}`, []float64{}, false},
+		{`not json`, nil, true},
+	}
+	for _, tt := range tests {
+		resp, err := EmbeddingsFromOpenAI([]byte(tt.body))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("EmbeddingsFromOpenAI(%s) want error", tt.body)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(resp.Embedding, tt.want) {
+			t.Errorf("EmbeddingsFromOpenAI(%s) = %v, %v, want %v", tt.body, resp, err, tt.want)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	out := Tags([]string{"gpt-4o", "llama3"})
+	if len(out.Models) != 2 || out.Models[0].Name != "gpt-4o" || out.Models[1].Model != "llama3" {
+		t.Fatalf("unexpected tags: %+v", out)
+	}
+	// families 为空数组而不是 null，部分客户端不接受 null
+	data, _ := json.Marshal(out)
+	if !strings.Contains(string(data), `"families":[]`) {
+		t.Fatalf("families should be an empty array: %s", data)
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	stream := "data: {\"choices\":[{\"delta\":{\"reasoning_content\":\"hm\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"c1\",\"function\":{\"name\":\"f\",\"arguments\":\"{\\\"a\\\":\"}}]}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"1}\"}}]},\"finish_reason\":\"tool_calls\"}]}\n\n" +
+		"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":4}}\n\n" +
+		"data: [DONE]\n\n"
+	tests := []struct {
+		name     string
+		generate bool
+		want     []string
+	}{
+		{
+			name: "chat",
+			want: []string{
+				`{"message":{"role":"assistant","content":"","thinking":"hm"},"done":false}`,
+				`{"message":{"role":"assistant","content":"Hi"},"done":false}`,
+				`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"f","arguments":{"a":1}}}]},"done":false}`,
+				`{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":3,"eval_count":4}`,
+			},
+		},
+		{
+			name:     "generate",
+			generate: true,
+			want: []string{
+				`{"response":"","thinking":"hm","done":false}`,
+				`{"response":"Hi","done":false}`,
+				`{"response":"","done":true,"done_reason":"stop","prompt_eval_count":3,"eval_count":4}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			writer := NewStreamWriter(&buf, "llama3", tt.generate, time.Now())
+			if err := openai.ReadChatStream(strings.NewReader(stream), writer.Chunk); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Finish(); err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			if len(lines) != len(tt.want) {
+				t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(tt.want), buf.String())
+			}
+			for i, line := range lines {
+				var got map[string]any
+				if err := json.Unmarshal([]byte(line), &got); err != nil {
+					t.Fatal(err)
+				}
+				// 时间相关的字段每次不同，不参与比较
+				if got["model"] != "llama3" {
+					t.Fatalf("line %d model = %v", i, got["model"])
+				}
+				delete(got, "model")
+				delete(got, "created_at")
+				delete(got, "total_duration")
+				assertJSON(t, got, tt.want[i])
+			}
+		})
+	}
+}
+
+// assertJSON 按 json 语义比较，忽略字段顺序和空白
+func assertJSON(t *testing.T, got any, want string) {
+	t.Helper()
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotValue, wantValue any
+	if err = json.Unmarshal(data, &gotValue); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid want json: %v", err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Fatalf("got  %s\nwant %s", data, want)
+	}
+}
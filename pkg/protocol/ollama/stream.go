@@ -0,0 +1,147 @@
+package ollama
+
+import (
+	"encoding/json"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"io"
+	"net/http"
+	"time"
+)
+
+// StreamWriter 把 OpenAI 的流式 chunk 转为 Ollama 的 NDJSON 流，每行一个响应对象
+// generate 为 true 时按 /api/generate 的格式输出，否则按 /api/chat 的格式
+// 函数调用的参数分多个 chunk 返回，拼接完整后在 done 之前的一行中返回
+type StreamWriter struct {
+	w        io.Writer
+	flusher  http.Flusher
+	model    string
+	generate bool
+	start    time.Time
+
+	toolCalls    []openai.ToolCall
+	toolIndex    map[int]int
+	finishReason string
+	usage        *openai.Usage
+}
+
+func NewStreamWriter(w io.Writer, model string, generate bool, start time.Time) *StreamWriter {
+	flusher, _ := w.(http.Flusher)
+	return &StreamWriter{
+		w:         w,
+		flusher:   flusher,
+		model:     model,
+		generate:  generate,
+		start:     start,
+		toolIndex: make(map[int]int),
+	}
+}
+
+func (s *StreamWriter) write(data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err = s.w.Write(append(payload, '\n')); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+// message 写出一行，done 为 true 时带上 done_reason 和 usage
+func (s *StreamWriter) message(msg Message, done bool) error {
+	var doneReason string
+	var m Metrics
+	if done {
+		doneReason = DoneStop
+		if s.finishReason != "" {
+			doneReason = DoneReason(s.finishReason)
+		}
+		m = metrics(s.usage, s.start)
+	}
+	if s.generate {
+		return s.write(&GenerateResponse{
+			Model:      s.model,
+			CreatedAt:  now(),
+			Response:   msg.Content,
+			Thinking:   msg.Thinking,
+			Done:       done,
+			DoneReason: doneReason,
+			Metrics:    m,
+		})
+	}
+	return s.write(&ChatResponse{
+		Model:      s.model,
+		CreatedAt:  now(),
+		Message:    msg,
+		Done:       done,
+		DoneReason: doneReason,
+		Metrics:    m,
+	})
+}
+
+// Chunk 处理一个上游 chunk，只使用第一个 choice
+func (s *StreamWriter) Chunk(chunk *openai.ChatChunk) error {
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return nil
+	}
+	choice := chunk.Choices[0]
+	for i, call := range choice.Delta.ToolCalls {
+		s.toolCall(i, call)
+	}
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		s.finishReason = *choice.FinishReason
+	}
+	if choice.Delta.Content == "" && choice.Delta.ReasoningContent == "" {
+		return nil
+	}
+	return s.message(Message{
+		Role:     openai.RoleAssistant,
+		Content:  choice.Delta.Content,
+		Thinking: choice.Delta.ReasoningContent,
+	}, false)
+}
+
+func (s *StreamWriter) toolCall(pos int, call openai.ToolCall) {
+	index := pos
+	if call.Index != nil {
+		index = *call.Index
+	}
+	i, ok := s.toolIndex[index]
+	if !ok {
+		s.toolIndex[index] = len(s.toolCalls)
+		s.toolCalls = append(s.toolCalls, call)
+		return
+	}
+	if call.Id != "" {
+		s.toolCalls[i].Id = call.Id
+	}
+	if call.Function.Name != "" {
+		s.toolCalls[i].Function.Name = call.Function.Name
+	}
+	s.toolCalls[i].Function.Arguments += call.Function.Arguments
+}
+
+// Finish 上游流结束后调用，/api/chat 有函数调用时先写出函数调用，最后写出 done 为 true 的一行
+func (s *StreamWriter) Finish() error {
+	if len(s.toolCalls) > 0 && !s.generate {
+		msg := Message{Role: openai.RoleAssistant}
+		for _, call := range s.toolCalls {
+			msg.ToolCalls = append(msg.ToolCalls, toolCall(call))
+		}
+		if err := s.message(msg, false); err != nil {
+			return err
+		}
+	}
+	return s.message(Message{Role: openai.RoleAssistant}, true)
+}
+
+// Error 流已经开始后出错时写入一行错误对象，Ollama 客户端读到 error 字段时结束
+func (s *StreamWriter) Error(message string) error {
+	return s.write(NewError(message))
+}
@@ -0,0 +1,151 @@
+// Package ollama Ollama 的 /api/chat、/api/generate、/api/embeddings 和 /api/tags 的请求、响应格式，以及与 OpenAI 之间的转换
+package ollama
+
+import "encoding/json"
+
+const (
+	DoneStop   = "stop"
+	DoneLength = "length"
+)
+
+// ChatRequest Stream 未传时 Ollama 默认为流式
+type ChatRequest struct {
+	Model    string          `json:"model" binding:"required"`
+	Messages []Message       `json:"messages"`
+	Tools    []Tool          `json:"tools,omitempty"`
+	Format   json.RawMessage `json:"format,omitempty"`
+	Options  *Options        `json:"options,omitempty"`
+	Stream   *bool           `json:"stream,omitempty"`
+	Think    json.RawMessage `json:"think,omitempty"`
+	// KeepAlive 模型常驻时间，对上游没有意义，直接丢弃
+	KeepAlive json.RawMessage `json:"keep_alive,omitempty"`
+}
+
+func (r *ChatRequest) IsStream() bool {
+	return r.Stream == nil || *r.Stream
+}
+
+// GenerateRequest Raw 为 true 时不拼接 System，Context 为旧版本的对话上下文，不支持
+type GenerateRequest struct {
+	Model     string          `json:"model" binding:"required"`
+	Prompt    string          `json:"prompt"`
+	Suffix    string          `json:"suffix,omitempty"`
+	System    string          `json:"system,omitempty"`
+	Images    []string        `json:"images,omitempty"`
+	Format    json.RawMessage `json:"format,omitempty"`
+	Options   *Options        `json:"options,omitempty"`
+	Stream    *bool           `json:"stream,omitempty"`
+	Raw       bool            `json:"raw,omitempty"`
+	Think     json.RawMessage `json:"think,omitempty"`
+	KeepAlive json.RawMessage `json:"keep_alive,omitempty"`
+}
+
+func (r *GenerateRequest) IsStream() bool {
+	return r.Stream == nil || *r.Stream
+}
+
+// Message Images 为不带 data url 前缀的 base64，tool 消息用 ToolName 标识对应的函数
+type Message struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Thinking  string     `json:"thinking,omitempty"`
+	Images    []string   `json:"images,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"`
+}
+
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+// ToolCall Ollama 的函数调用没有 id，参数为 json 对象而不是字符串
+type ToolCall struct {
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// Options 只转换 OpenAI 中有对应字段的参数，其余如 num_ctx、top_k 直接丢弃
+type Options struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+}
+
+// Metrics 耗时单位为纳秒，上游没有加载和输入处理的耗时，只返回总耗时
+type Metrics struct {
+	TotalDuration   int64 `json:"total_duration,omitempty"`
+	LoadDuration    int64 `json:"load_duration,omitempty"`
+	PromptEvalCount int   `json:"prompt_eval_count,omitempty"`
+	EvalCount       int   `json:"eval_count,omitempty"`
+}
+
+type ChatResponse struct {
+	Model      string  `json:"model"`
+	CreatedAt  string  `json:"created_at"`
+	Message    Message `json:"message"`
+	Done       bool    `json:"done"`
+	DoneReason string  `json:"done_reason,omitempty"`
+	Metrics
+}
+
+type GenerateResponse struct {
+	Model      string `json:"model"`
+	CreatedAt  string `json:"created_at"`
+	Response   string `json:"response"`
+	Thinking   string `json:"thinking,omitempty"`
+	Done       bool   `json:"done"`
+	DoneReason string `json:"done_reason,omitempty"`
+	Metrics
+}
+
+type EmbeddingsRequest struct {
+	Model  string `json:"model" binding:"required"`
+	Prompt string `json:"prompt"`
+}
+
+type EmbeddingsResponse struct {
+	Embedding []float64 `json:"embedding"`
+}
+
+type TagsResponse struct {
+	Models []ModelTag `json:"models"`
+}
+
+// ModelTag 网关不知道模型的大小和摘要，只填充名称，其余字段为零值
+type ModelTag struct {
+	Name       string       `json:"name"`
+	Model      string       `json:"model"`
+	ModifiedAt string       `json:"modified_at"`
+	Size       int64        `json:"size"`
+	Digest     string       `json:"digest"`
+	Details    ModelDetails `json:"details"`
+}
+
+type ModelDetails struct {
+	Format            string   `json:"format"`
+	Family            string   `json:"family"`
+	Families          []string `json:"families"`
+	ParameterSize     string   `json:"parameter_size"`
+	QuantizationLevel string   `json:"quantization_level"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewError(msg string) *ErrorResponse {
+	return &ErrorResponse{Error: msg}
+}
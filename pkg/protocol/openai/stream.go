@@ -0,0 +1,60 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+var (
+	dataPrefix = []byte("data:")
+	doneData   = []byte("[DONE]")
+)
+
+// ReadChatStream 逐个解析 SSE 中的 chunk 交给 fn，遇到 [DONE] 或读到末尾时返回 nil
+// 上游在流中返回错误对象时返回该错误
+func ReadChatStream(r io.Reader, fn func(chunk *ChatChunk) error) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if stop, handleErr := handleStreamLine(line, fn); handleErr != nil || stop {
+				return handleErr
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func handleStreamLine(line []byte, fn func(chunk *ChatChunk) error) (bool, error) {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, dataPrefix) {
+		return false, nil
+	}
+	data := bytes.TrimSpace(line[len(dataPrefix):])
+	if len(data) == 0 {
+		return false, nil
+	}
+	if bytes.Equal(data, doneData) {
+		return true, nil
+	}
+	if bytes.Contains(data, []byte(`"error"`)) {
+		var errResp ErrorResponse
+		if json.Unmarshal(data, &errResp) == nil && errResp.Error.Message != "" {
+			return true, errors.New(errResp.Error.Message)
+		}
+	}
+	chunk := new(ChatChunk)
+	if err := json.Unmarshal(data, chunk); err != nil {
+		// 个别上游会插入非 json 的数据行，跳过
+		return false, nil
+	}
+	return false, fn(chunk)
+}
@@ -0,0 +1,125 @@
+package openai
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReadChatStream(t *testing.T) {
+	tests := []struct {
+		name        string
+		stream      string
+		wantContent string
+		wantChunks  int
+		wantErr     string
+	}{
+		{
+			name: "done",
+			stream: "data: {\"choices\":[{\"delta\":{\"content\":\"He\"}}]}\n\n" +
+				": keep-alive\n\n" +
+				"data:{\"choices\":[{\"delta\":{\"content\":\"llo\"}}]}\n\n" +
+				"data: [DONE]\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"ignored\"}}]}\n\n",
+			wantContent: "Hello",
+			wantChunks:  2,
+		},
+		{
+			name:        "eof without done",
+			stream:      "data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}]}",
+			wantContent: "a",
+			wantChunks:  1,
+		},
+		{
+			name:        "skip invalid line",
+			stream:      "data: not-json\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"b\"}}]}\n\n",
+			wantContent: "b",
+			wantChunks:  1,
+		},
+		{
+			name:    "upstream error",
+			stream:  "data: {\"error\":{\"message\":\"overloaded\",\"type\":\"server_error\"}}\n\n",
+			wantErr: "overloaded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var content string
+			var chunks int
+			err := ReadChatStream(strings.NewReader(tt.stream), func(chunk *ChatChunk) error {
+				chunks++
+				if len(chunk.Choices) > 0 {
+					content += chunk.Choices[0].Delta.Content
+				}
+				return nil
+			})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content != tt.wantContent || chunks != tt.wantChunks {
+				t.Fatalf("content = %q, chunks = %d, want %q, %d", content, chunks, tt.wantContent, tt.wantChunks)
+			}
+		})
+	}
+}
+
+func TestReadChatStreamCallbackError(t *testing.T) {
+	want := errors.New("client gone")
+	err := ReadChatStream(strings.NewReader("data: {\"choices\":[]}\n\n"), func(*ChatChunk) error {
+		return want
+	})
+	if !errors.Is(err, want) {
+		t.Fatalf("err = %v, want %v", err, want)
+	}
+}
+
+func TestUsageDetails(t *testing.T) {
+	tests := []struct {
+		name      string
+		usage     *Usage
+		cached    int
+		reasoning int
+	}{
+		{"nil", nil, 0, 0},
+		{"no details", &Usage{PromptTokens: 10}, 0, 0},
+		{
+			"details",
+			&Usage{
+				PromptTokensDetails:     &PromptTokensDetails{CachedTokens: 3},
+				CompletionTokensDetails: &CompletionTokensDetails{ReasoningTokens: 5},
+			},
+			3, 5,
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.usage.CachedTokens(); got != tt.cached {
+			t.Errorf("%s: CachedTokens() = %d, want %d", tt.name, got, tt.cached)
+		}
+		if got := tt.usage.ReasoningTokens(); got != tt.reasoning {
+			t.Errorf("%s: ReasoningTokens() = %d, want %d", tt.name, got, tt.reasoning)
+		}
+	}
+}
+
+func TestContentText(t *testing.T) {
+	tests := []struct {
+		content any
+		want    string
+	}{
+		{"hi", "hi"},
+		{nil, ""},
+		{[]any{map[string]any{"type": "text", "text": "a"}, map[string]any{"type": "image_url"}, map[string]any{"text": "b"}}, "ab"},
+	}
+	for _, tt := range tests {
+		msg := ChatMessage{Content: tt.content}
+		if got := msg.ContentText(); got != tt.want {
+			t.Errorf("ContentText(%v) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
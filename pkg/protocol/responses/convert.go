@@ -0,0 +1,352 @@
+package responses
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"strings"
+	"time"
+)
+
+// NewId 生成带前缀的随机 id，如 resp_、msg_、fc_
+func NewId(prefix string) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%s_%d", prefix, time.Now().UnixNano())
+	}
+	return prefix + "_" + hex.EncodeToString(b)
+}
+
+// ParseInput 字符串输入转换为一条 user 消息
+func ParseInput(raw json.RawMessage) ([]InputItem, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		return []InputItem{{Type: ItemMessage, Role: openai.RoleUser, Content: raw}}, nil
+	}
+	var items []InputItem
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+	for i := range items {
+		if items[i].Type == "" {
+			items[i].Type = ItemMessage
+		}
+	}
+	return items, nil
+}
+
+// parseContent 把字符串或内容数组统一解析为内容数组
+func parseContent(raw json.RawMessage) ([]InputContent, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		return []InputContent{{Type: ContentInputText, Text: text}}, nil
+	}
+	var contents []InputContent
+	err := json.Unmarshal(raw, &contents)
+	return contents, err
+}
+
+// outputText function_call_output 的 output 为字符串或内容数组，只取文本
+func outputText(raw json.RawMessage) string {
+	contents, err := parseContent(raw)
+	if err != nil {
+		return string(raw)
+	}
+	var texts []string
+	for _, content := range contents {
+		if content.Text != "" {
+			texts = append(texts, content.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ToChat 转换为 OpenAI chat 请求，items 为之前的对话加上本次的输入
+// reasoning 输入项没有对应的字段，直接丢弃
+func ToChat(req *Request, items []InputItem) (*openai.ChatRequest, error) {
+	out := &openai.ChatRequest{
+		Model:             req.Model,
+		MaxTokens:         req.MaxOutputTokens,
+		Temperature:       req.Temperature,
+		TopP:              req.TopP,
+		Stream:            req.Stream,
+		ParallelToolCalls: req.ParallelToolCalls,
+		User:              req.User,
+	}
+	if req.Stream {
+		out.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	if req.Reasoning != nil {
+		out.ReasoningEffort = req.Reasoning.Effort
+	}
+	if req.Instructions != "" {
+		out.Messages = append(out.Messages, openai.ChatMessage{Role: openai.RoleSystem, Content: req.Instructions})
+	}
+	messages, err := itemsToMessages(items)
+	if err != nil {
+		return nil, err
+	}
+	out.Messages = append(out.Messages, messages...)
+	if len(out.Messages) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	for _, tool := range req.Tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("unsupported tool type: %s", tool.Type)
+		}
+		out.Tools = append(out.Tools, openai.Tool{
+			Type: "function",
+			Function: openai.FunctionDef{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	if len(out.Tools) > 0 {
+		out.ToolChoice = convertToolChoice(req.ToolChoice)
+	} else {
+		out.ParallelToolCalls = nil
+	}
+	if req.Text != nil && req.Text.Format != nil {
+		switch req.Text.Format.Type {
+		case "json_object":
+			out.ResponseFormat = map[string]any{"type": "json_object"}
+		case "json_schema":
+			schema := map[string]any{"name": req.Text.Format.Name, "schema": req.Text.Format.Schema}
+			if req.Text.Format.Strict != nil {
+				schema["strict"] = *req.Text.Format.Strict
+			}
+			out.ResponseFormat = map[string]any{"type": "json_schema", "json_schema": schema}
+		}
+	}
+	return out, nil
+}
+
+// convertToolChoice 字符串原样使用，{"type":"function","name":...} 转换为 chat 的格式
+func convertToolChoice(choice any) any {
+	m, ok := choice.(map[string]any)
+	if !ok {
+		return choice
+	}
+	if m["type"] == "function" {
+		return map[string]any{"type": "function", "function": map[string]any{"name": m["name"]}}
+	}
+	return nil
+}
+
+func itemsToMessages(items []InputItem) ([]openai.ChatMessage, error) {
+	var messages []openai.ChatMessage
+	for i, item := range items {
+		switch item.Type {
+		case ItemMessage:
+			msg, err := convertMessage(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid input[%d]: %w", i, err)
+			}
+			messages = append(messages, msg)
+		case ItemFunctionCall:
+			call := openai.ToolCall{
+				Id:       item.CallId,
+				Type:     "function",
+				Function: openai.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			}
+			// 连续的函数调用合并到同一条 assistant 消息中
+			if n := len(messages); n > 0 && messages[n-1].Role == openai.RoleAssistant {
+				messages[n-1].ToolCalls = append(messages[n-1].ToolCalls, call)
+				continue
+			}
+			messages = append(messages, openai.ChatMessage{Role: openai.RoleAssistant, ToolCalls: []openai.ToolCall{call}})
+		case ItemFunctionCallOutput:
+			messages = append(messages, openai.ChatMessage{
+				Role:       openai.RoleTool,
+				Content:    outputText(item.Output),
+				ToolCallId: item.CallId,
+			})
+		case ItemReasoning:
+		default:
+			return nil, fmt.Errorf("unsupported input[%d].type: %s", i, item.Type)
+		}
+	}
+	return messages, nil
+}
+
+func convertMessage(item InputItem) (openai.ChatMessage, error) {
+	role := item.Role
+	switch role {
+	case "developer":
+		role = openai.RoleSystem
+	case openai.RoleSystem, openai.RoleUser, openai.RoleAssistant:
+	default:
+		return openai.ChatMessage{}, fmt.Errorf("invalid role: %s", item.Role)
+	}
+	contents, err := parseContent(item.Content)
+	if err != nil {
+		return openai.ChatMessage{}, err
+	}
+	var parts []openai.ContentPart
+	allText := true
+	for _, content := range contents {
+		switch content.Type {
+		case ContentInputText, ContentOutputText:
+			parts = append(parts, openai.ContentPart{Type: "text", Text: content.Text})
+		case ContentRefusal:
+			parts = append(parts, openai.ContentPart{Type: "text", Text: content.Refusal})
+		case ContentInputImage:
+			parts = append(parts, openai.ContentPart{Type: "image_url", ImageUrl: &openai.ImageUrl{Url: content.ImageUrl, Detail: content.Detail}})
+			allText = false
+		default:
+			return openai.ChatMessage{}, fmt.Errorf("unsupported content type: %s", content.Type)
+		}
+	}
+	msg := openai.ChatMessage{Role: role}
+	// 纯文本时合并为字符串，兼容只支持字符串 content 的上游
+	if allText {
+		texts := make([]string, len(parts))
+		for i, part := range parts {
+			texts[i] = part.Text
+		}
+		msg.Content = strings.Join(texts, "\n")
+	} else {
+		msg.Content = parts
+	}
+	return msg, nil
+}
+
+// OutputToInput 把输出项转换为下一轮对话的输入项，reasoning 不保留
+func OutputToInput(output []OutputItem) []InputItem {
+	var items []InputItem
+	for _, item := range output {
+		switch item.Type {
+		case ItemMessage:
+			content, _ := json.Marshal(item.Content)
+			items = append(items, InputItem{Type: ItemMessage, Role: openai.RoleAssistant, Content: content})
+		case ItemFunctionCall:
+			items = append(items, InputItem{Type: ItemFunctionCall, CallId: item.CallId, Name: item.Name, Arguments: item.Arguments})
+		}
+	}
+	return items
+}
+
+func ConvertUsage(usage *openai.Usage) *Usage {
+	if usage == nil {
+		return nil
+	}
+	return &Usage{
+		InputTokens:         usage.PromptTokens,
+		InputTokensDetails:  InputTokensDetails{CachedTokens: usage.CachedTokens()},
+		OutputTokens:        usage.CompletionTokens,
+		OutputTokensDetails: OutputTokensDetails{ReasoningTokens: usage.ReasoningTokens()},
+		TotalTokens:         usage.PromptTokens + usage.CompletionTokens,
+	}
+}
+
+// NewResponse 响应的公共字段，Output 和 Usage 由调用方填充
+func NewResponse(id string, req *Request, status string) *Response {
+	return &Response{
+		Id:                 id,
+		Object:             "response",
+		CreatedAt:          time.Now().Unix(),
+		Status:             status,
+		Model:              req.Model,
+		Output:             []OutputItem{},
+		Instructions:       req.Instructions,
+		PreviousResponseId: req.PreviousResponseId,
+		Metadata:           req.Metadata,
+	}
+}
+
+// setFinish 输出被截断时状态为 incomplete
+func (r *Response) setFinish(finishReason string) {
+	r.Status = StatusCompleted
+	switch finishReason {
+	case openai.FinishLength:
+		r.Status = StatusIncomplete
+		r.IncompleteDetails = &IncompleteDetails{Reason: "max_output_tokens"}
+	case openai.FinishContentFilter:
+		r.Status = StatusIncomplete
+		r.IncompleteDetails = &IncompleteDetails{Reason: "content_filter"}
+	}
+}
+
+func messageItem(text string, status string) OutputItem {
+	return OutputItem{
+		Type:    ItemMessage,
+		Id:      NewId("msg"),
+		Status:  status,
+		Role:    openai.RoleAssistant,
+		Content: []OutputContent{{Type: ContentOutputText, Text: text, Annotations: []any{}}},
+	}
+}
+
+func reasoningItem(text string) OutputItem {
+	return OutputItem{
+		Type:    ItemReasoning,
+		Id:      NewId("rs"),
+		Summary: []SummaryText{{Type: "summary_text", Text: text}},
+	}
+}
+
+func functionCallItem(call openai.ToolCall, status string) OutputItem {
+	callId := call.Id
+	if callId == "" {
+		callId = NewId("call")
+	}
+	return OutputItem{
+		Type:      ItemFunctionCall,
+		Id:        NewId("fc"),
+		Status:    status,
+		CallId:    callId,
+		Name:      call.Function.Name,
+		Arguments: call.Function.Arguments,
+	}
+}
+
+// FromChat 转换非流式响应，只使用第一个 choice
+func FromChat(resp *openai.ChatResponse, req *Request, id string) *Response {
+	out := NewResponse(id, req, StatusCompleted)
+	out.Usage = ConvertUsage(resp.Usage)
+	if len(resp.Choices) == 0 {
+		return out
+	}
+	choice := resp.Choices[0]
+	if choice.Message.ReasoningContent != "" {
+		out.Output = append(out.Output, reasoningItem(choice.Message.ReasoningContent))
+	}
+	if text := choice.Message.ContentText(); text != "" {
+		out.Output = append(out.Output, messageItem(text, StatusCompleted))
+	}
+	for _, call := range choice.Message.ToolCalls {
+		out.Output = append(out.Output, functionCallItem(call, StatusCompleted))
+	}
+	out.setFinish(choice.FinishReason)
+	return out
+}
+
+// NativeBody 原生支持 Responses API 的渠道使用原始请求体，只把 input 替换为完整的对话
+// 对话状态由网关保存，上游不需要保存
+func NativeBody(raw []byte, items []InputItem) ([]byte, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+	input, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	body["input"] = input
+	body["store"] = json.RawMessage("false")
+	delete(body, "previous_response_id")
+	return json.Marshal(body)
+}
@@ -0,0 +1,385 @@
+package responses
+
+import (
+	"encoding/json"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInput(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want []InputItem
+	}{
+		{"empty", ``, nil},
+		{"null", `null`, nil},
+		{"string", `"hi"`, []InputItem{{Type: ItemMessage, Role: "user", Content: json.RawMessage(`"hi"`)}}},
+		{
+			"items",
+			`[{"role":"user","content":"hi"},{"type":"function_call_output","call_id":"c1","output":"ok"}]`,
+			[]InputItem{
+				{Type: ItemMessage, Role: "user", Content: json.RawMessage(`"hi"`)},
+				{Type: ItemFunctionCallOutput, CallId: "c1", Output: json.RawMessage(`"ok"`)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseInput(json.RawMessage(tt.raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ParseInput() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if _, err := ParseInput(json.RawMessage(`{"role":"user"}`)); err == nil {
+		t.Fatal("ParseInput(object) should fail")
+	}
+}
+
+func TestToChat(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "instructions and text",
+			body: `{"model":"gpt","instructions":"be brief","input":"hi","max_output_tokens":20,
+				"reasoning":{"effort":"low"},"parallel_tool_calls":false,
+				"text":{"format":{"type":"json_schema","name":"out","schema":{"type":"object"},"strict":true}}}`,
+			want: `{"model":"gpt","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}],
+				"max_tokens":20,"stream":false,"reasoning_effort":"low",
+				"response_format":{"type":"json_schema","json_schema":{"name":"out","schema":{"type":"object"},"strict":true}}}`,
+		},
+		{
+			name: "stream with image",
+			body: `{"model":"gpt","stream":true,"input":[{"role":"developer","content":"sys"},
+				{"role":"user","content":[{"type":"input_text","text":"what"},{"type":"input_image","image_url":"https://x/a.png","detail":"low"}]}]}`,
+			want: `{"model":"gpt","messages":[{"role":"system","content":"sys"},
+				{"role":"user","content":[{"type":"text","text":"what"},{"type":"image_url","image_url":{"url":"https://x/a.png","detail":"low"}}]}],
+				"stream":true,"stream_options":{"include_usage":true}}`,
+		},
+		{
+			name: "function calls",
+			body: `{"model":"gpt","tools":[{"type":"function","name":"f","parameters":{"type":"object"}}],
+				"tool_choice":{"type":"function","name":"f"},
+				"input":[
+					{"role":"user","content":"go"},
+					{"type":"reasoning","id":"rs_1"},
+					{"type":"function_call","call_id":"c1","name":"f","arguments":"{}"},
+					{"type":"function_call","call_id":"c2","name":"f","arguments":"{\"a\":1}"},
+					{"type":"function_call_output","call_id":"c1","output":"one"},
+					{"type":"function_call_output","call_id":"c2","output":[{"type":"input_text","text":"two"}]}]}`,
+			want: `{"model":"gpt","messages":[
+				{"role":"user","content":"go"},
+				{"role":"assistant","content":null,"tool_calls":[
+					{"id":"c1","type":"function","function":{"name":"f","arguments":"{}"}},
+					{"id":"c2","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}}]},
+				{"role":"tool","content":"one","tool_call_id":"c1"},
+				{"role":"tool","content":"two","tool_call_id":"c2"}],
+				"stream":false,
+				"tools":[{"type":"function","function":{"name":"f","parameters":{"type":"object"}}}],
+				"tool_choice":{"type":"function","function":{"name":"f"}}}`,
+		},
+		{
+			name:    "builtin tool",
+			body:    `{"model":"gpt","input":"hi","tools":[{"type":"web_search"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "empty input",
+			body:    `{"model":"gpt"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid role",
+			body:    `{"model":"gpt","input":[{"role":"tool","content":"x"}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req Request
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatal(err)
+			}
+			items, err := ParseInput(req.Input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := ToChat(&req, items)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, out, tt.want)
+		})
+	}
+}
+
+func TestFromChat(t *testing.T) {
+	tests := []struct {
+		name       string
+		resp       string
+		wantStatus string
+		wantTypes  []string
+		wantUsage  *Usage
+	}{
+		{
+			name: "text with reasoning",
+			resp: `{"choices":[{"message":{"role":"assistant","content":"hi","reasoning_content":"hm"},"finish_reason":"stop"}],
+				"usage":{"prompt_tokens":10,"completion_tokens":5,"prompt_tokens_details":{"cached_tokens":2},"completion_tokens_details":{"reasoning_tokens":3}}}`,
+			wantStatus: StatusCompleted,
+			wantTypes:  []string{ItemReasoning, ItemMessage},
+			wantUsage: &Usage{
+				InputTokens: 10, InputTokensDetails: InputTokensDetails{CachedTokens: 2},
+				OutputTokens: 5, OutputTokensDetails: OutputTokensDetails{ReasoningTokens: 3},
+				TotalTokens: 15,
+			},
+		},
+		{
+			name: "tool call",
+			resp: `{"choices":[{"message":{"role":"assistant","content":null,
+				"tool_calls":[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`,
+			wantStatus: StatusCompleted,
+			wantTypes:  []string{ItemFunctionCall},
+		},
+		{
+			name:       "length",
+			resp:       `{"choices":[{"message":{"role":"assistant","content":"abc"},"finish_reason":"length"}]}`,
+			wantStatus: StatusIncomplete,
+			wantTypes:  []string{ItemMessage},
+		},
+	}
+	req := &Request{Model: "gpt", Instructions: "be brief"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp openai.ChatResponse
+			if err := json.Unmarshal([]byte(tt.resp), &resp); err != nil {
+				t.Fatal(err)
+			}
+			out := FromChat(&resp, req, "resp_1")
+			if out.Id != "resp_1" || out.Model != "gpt" || out.Object != "response" || out.Instructions != "be brief" {
+				t.Fatalf("unexpected response fields: %+v", out)
+			}
+			if out.Status != tt.wantStatus {
+				t.Fatalf("status = %q, want %q", out.Status, tt.wantStatus)
+			}
+			var types []string
+			for _, item := range out.Output {
+				types = append(types, item.Type)
+			}
+			if !reflect.DeepEqual(types, tt.wantTypes) {
+				t.Fatalf("output types = %v, want %v", types, tt.wantTypes)
+			}
+			if !reflect.DeepEqual(out.Usage, tt.wantUsage) {
+				t.Fatalf("usage = %+v, want %+v", out.Usage, tt.wantUsage)
+			}
+			// 输出项可以原样作为下一轮的输入
+			messages, err := itemsToMessages(OutputToInput(out.Output))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(messages) != 1 || messages[0].Role != openai.RoleAssistant {
+				t.Fatalf("OutputToInput messages = %+v", messages)
+			}
+		})
+	}
+}
+
+func TestNativeBody(t *testing.T) {
+	raw := []byte(`{"model":"gpt","input":"again","previous_response_id":"resp_0","store":true,"tools":[{"type":"web_search"}]}`)
+	items := []InputItem{
+		{Type: ItemMessage, Role: "user", Content: json.RawMessage(`"hi"`)},
+		{Type: ItemMessage, Role: "user", Content: json.RawMessage(`"again"`)},
+	}
+	out, err := NativeBody(raw, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, json.RawMessage(out), `{"model":"gpt","store":false,"tools":[{"type":"web_search"}],
+		"input":[{"type":"message","role":"user","content":"hi"},{"type":"message","role":"user","content":"again"}]}`)
+	if _, err = NativeBody([]byte(`[]`), items); err == nil {
+		t.Fatal("NativeBody with invalid body should fail")
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	tests := []struct {
+		name       string
+		stream     string
+		wantEvents []string
+		wantStatus string
+		wantItems  string
+	}{
+		{
+			name: "reasoning then text",
+			stream: "data: {\"choices\":[{\"delta\":{\"reasoning_content\":\"hm\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"He\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"llo\"},\"finish_reason\":\"stop\"}]}\n\n" +
+				"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":4}}\n\n" +
+				"data: [DONE]\n\n",
+			wantEvents: []string{
+				"response.created", "response.in_progress",
+				"response.output_item.added", "response.reasoning_summary_part.added", "response.reasoning_summary_text.delta",
+				"response.reasoning_summary_text.done", "response.reasoning_summary_part.done", "response.output_item.done",
+				"response.output_item.added", "response.content_part.added", "response.output_text.delta", "response.output_text.delta",
+				"response.output_text.done", "response.content_part.done", "response.output_item.done",
+				"response.completed",
+			},
+			wantStatus: StatusCompleted,
+			wantItems:  "reasoning:hm,message:Hello",
+		},
+		{
+			name: "tool call fragments",
+			stream: "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"function\":{\"name\":\"f\",\"arguments\":\"{\\\"a\\\":\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"1}\"}}]},\"finish_reason\":\"tool_calls\"}]}\n\n",
+			wantEvents: []string{
+				"response.created", "response.in_progress",
+				"response.output_item.added", "response.function_call_arguments.delta", "response.function_call_arguments.delta",
+				"response.function_call_arguments.done", "response.output_item.done",
+				"response.completed",
+			},
+			wantStatus: StatusCompleted,
+			wantItems:  `function_call:{"a":1}`,
+		},
+		{
+			name:       "length",
+			stream:     "data: {\"choices\":[{\"delta\":{\"content\":\"a\"},\"finish_reason\":\"length\"}]}\n\n",
+			wantStatus: StatusIncomplete,
+			wantItems:  "message:a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			writer := NewStreamWriter(&buf, &Request{Model: "gpt"}, "resp_1")
+			if err := openai.ReadChatStream(strings.NewReader(tt.stream), writer.Chunk); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Finish(); err != nil {
+				t.Fatal(err)
+			}
+			var events []string
+			for _, line := range strings.Split(buf.String(), "\n") {
+				if name, ok := strings.CutPrefix(line, "event: "); ok {
+					events = append(events, name)
+				}
+			}
+			if tt.wantEvents != nil && !reflect.DeepEqual(events, tt.wantEvents) {
+				t.Fatalf("events = %v, want %v", events, tt.wantEvents)
+			}
+			resp := writer.Response()
+			if resp.Status != tt.wantStatus {
+				t.Fatalf("status = %q, want %q", resp.Status, tt.wantStatus)
+			}
+			var items []string
+			for _, item := range resp.Output {
+				switch item.Type {
+				case ItemMessage:
+					items = append(items, item.Type+":"+item.Content[0].Text)
+				case ItemReasoning:
+					items = append(items, item.Type+":"+item.Summary[0].Text)
+				case ItemFunctionCall:
+					items = append(items, item.Type+":"+item.Arguments)
+				}
+			}
+			if got := strings.Join(items, ","); got != tt.wantItems {
+				t.Fatalf("items = %s, want %s", got, tt.wantItems)
+			}
+		})
+	}
+}
+
+func TestCopyStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		stream     string
+		wantStatus string
+	}{
+		{
+			name: "completed",
+			stream: "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"hi\"}\n\n" +
+				"event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"status\":\"completed\"}}\n\n",
+			wantStatus: StatusCompleted,
+		},
+		{
+			name:       "incomplete",
+			stream:     "data: {\"type\":\"response.incomplete\",\"response\":{\"id\":\"resp_1\",\"status\":\"incomplete\"}}\n\n",
+			wantStatus: StatusIncomplete,
+		},
+		{
+			name:   "no final event",
+			stream: "event: response.created\ndata: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_1\"}}\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			resp, err := CopyStream(&buf, strings.NewReader(tt.stream))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.stream {
+				t.Fatalf("stream not copied as is:\n%s", buf.String())
+			}
+			if tt.wantStatus == "" {
+				if resp != nil {
+					t.Fatalf("resp = %+v, want nil", resp)
+				}
+				return
+			}
+			if resp == nil || resp.Id != "resp_1" || resp.Status != tt.wantStatus {
+				t.Fatalf("resp = %+v, want status %q", resp, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{400, "invalid_request_error"},
+		{404, "invalid_request_error"},
+		{429, "rate_limit_error"},
+		{503, "server_error"},
+	}
+	for _, tt := range tests {
+		if got := ErrorType(tt.status); got != tt.want {
+			t.Errorf("ErrorType(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+// assertJSON 按 json 语义比较，忽略字段顺序和空白
+func assertJSON(t *testing.T, got any, want string) {
+	t.Helper()
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotValue, wantValue any
+	if err = json.Unmarshal(data, &gotValue); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid want json: %v", err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Fatalf("got  %s\nwant %s", data, want)
+	}
+}
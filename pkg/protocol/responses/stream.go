@@ -0,0 +1,317 @@
+package responses
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jiu-u/oai-api/pkg/protocol/openai"
+	"io"
+	"net/http"
+)
+
+// StreamWriter 把 OpenAI 的流式 chunk 转为 Responses API 的 SSE 事件
+// 事件顺序为 response.created、response.in_progress、若干输出项(output_item.added、内容增量、output_item.done)、response.completed
+// 同一时间只有一个输出项处于打开状态，新的输出项开始时关闭上一个
+type StreamWriter struct {
+	w        io.Writer
+	flusher  http.Flusher
+	response *Response
+	sequence int
+
+	started bool
+	// open 当前打开的输出项在 Output 中的序号，-1 表示没有
+	open int
+	text *bytes.Buffer
+	// toolItems 上游 tool_calls 的 index 对应的输出项序号
+	toolItems    map[int]int
+	finishReason string
+	usage        *openai.Usage
+}
+
+func NewStreamWriter(w io.Writer, req *Request, id string) *StreamWriter {
+	flusher, _ := w.(http.Flusher)
+	return &StreamWriter{
+		w:         w,
+		flusher:   flusher,
+		response:  NewResponse(id, req, StatusInProgress),
+		open:      -1,
+		text:      new(bytes.Buffer),
+		toolItems: make(map[int]int),
+	}
+}
+
+// Response 流结束后的完整响应
+func (s *StreamWriter) Response() *Response {
+	return s.response
+}
+
+func (s *StreamWriter) event(name string, fields map[string]any) error {
+	fields["type"] = name
+	fields["sequence_number"] = s.sequence
+	s.sequence++
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", name, payload); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+func (s *StreamWriter) start() error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	if err := s.event("response.created", map[string]any{"response": s.response}); err != nil {
+		return err
+	}
+	return s.event("response.in_progress", map[string]any{"response": s.response})
+}
+
+func (s *StreamWriter) openItem(item OutputItem) error {
+	if err := s.closeItem(); err != nil {
+		return err
+	}
+	s.response.Output = append(s.response.Output, item)
+	s.open = len(s.response.Output) - 1
+	s.text.Reset()
+	return s.event("response.output_item.added", map[string]any{"output_index": s.open, "item": item})
+}
+
+// closeItem 补齐当前输出项的 done 事件
+func (s *StreamWriter) closeItem() error {
+	if s.open < 0 {
+		return nil
+	}
+	index := s.open
+	s.open = -1
+	item := &s.response.Output[index]
+	var err error
+	switch item.Type {
+	case ItemMessage:
+		part := OutputContent{Type: ContentOutputText, Text: s.text.String(), Annotations: []any{}}
+		item.Content = []OutputContent{part}
+		item.Status = StatusCompleted
+		err = s.events(
+			"response.output_text.done", map[string]any{"item_id": item.Id, "output_index": index, "content_index": 0, "text": part.Text},
+			"response.content_part.done", map[string]any{"item_id": item.Id, "output_index": index, "content_index": 0, "part": part},
+		)
+	case ItemReasoning:
+		part := SummaryText{Type: "summary_text", Text: s.text.String()}
+		item.Summary = []SummaryText{part}
+		err = s.events(
+			"response.reasoning_summary_text.done", map[string]any{"item_id": item.Id, "output_index": index, "summary_index": 0, "text": part.Text},
+			"response.reasoning_summary_part.done", map[string]any{"item_id": item.Id, "output_index": index, "summary_index": 0, "part": part},
+		)
+	case ItemFunctionCall:
+		item.Status = StatusCompleted
+		err = s.event("response.function_call_arguments.done", map[string]any{"item_id": item.Id, "output_index": index, "arguments": item.Arguments})
+	}
+	if err != nil {
+		return err
+	}
+	return s.event("response.output_item.done", map[string]any{"output_index": index, "item": *item})
+}
+
+// events 依次发送多个事件，参数为事件名和字段交替
+func (s *StreamWriter) events(pairs ...any) error {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if err := s.event(pairs[i].(string), pairs[i+1].(map[string]any)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *StreamWriter) openType() string {
+	if s.open < 0 {
+		return ""
+	}
+	return s.response.Output[s.open].Type
+}
+
+// Chunk 处理一个上游 chunk，只使用第一个 choice
+func (s *StreamWriter) Chunk(chunk *openai.ChatChunk) error {
+	if err := s.start(); err != nil {
+		return err
+	}
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return nil
+	}
+	choice := chunk.Choices[0]
+	if delta := choice.Delta.ReasoningContent; delta != "" {
+		if s.openType() != ItemReasoning {
+			item := OutputItem{Type: ItemReasoning, Id: NewId("rs"), Summary: []SummaryText{}}
+			if err := s.openItem(item); err != nil {
+				return err
+			}
+			err := s.event("response.reasoning_summary_part.added", map[string]any{
+				"item_id": item.Id, "output_index": s.open, "summary_index": 0,
+				"part": SummaryText{Type: "summary_text", Text: ""},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		s.text.WriteString(delta)
+		err := s.event("response.reasoning_summary_text.delta", map[string]any{
+			"item_id": s.response.Output[s.open].Id, "output_index": s.open, "summary_index": 0, "delta": delta,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if delta := choice.Delta.Content; delta != "" {
+		if s.openType() != ItemMessage {
+			item := OutputItem{Type: ItemMessage, Id: NewId("msg"), Status: StatusInProgress, Role: openai.RoleAssistant, Content: []OutputContent{}}
+			if err := s.openItem(item); err != nil {
+				return err
+			}
+			err := s.event("response.content_part.added", map[string]any{
+				"item_id": item.Id, "output_index": s.open, "content_index": 0,
+				"part": OutputContent{Type: ContentOutputText, Annotations: []any{}},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		s.text.WriteString(delta)
+		err := s.event("response.output_text.delta", map[string]any{
+			"item_id": s.response.Output[s.open].Id, "output_index": s.open, "content_index": 0, "delta": delta,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i, call := range choice.Delta.ToolCalls {
+		if err := s.toolCall(i, call); err != nil {
+			return err
+		}
+	}
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		s.finishReason = *choice.FinishReason
+	}
+	return nil
+}
+
+// toolCall 新的 index 开始一个 function_call 输出项，后续的 chunk 为参数片段
+func (s *StreamWriter) toolCall(pos int, call openai.ToolCall) error {
+	index := pos
+	if call.Index != nil {
+		index = *call.Index
+	}
+	itemIndex, ok := s.toolItems[index]
+	if !ok {
+		arguments := call.Function.Arguments
+		call.Function.Arguments = ""
+		if err := s.openItem(functionCallItem(call, StatusInProgress)); err != nil {
+			return err
+		}
+		itemIndex = s.open
+		s.toolItems[index] = itemIndex
+		call.Function.Arguments = arguments
+	}
+	if call.Function.Arguments == "" {
+		return nil
+	}
+	item := &s.response.Output[itemIndex]
+	item.Arguments += call.Function.Arguments
+	// 已经关闭的输出项只记录参数，不再发送增量
+	if itemIndex != s.open {
+		return nil
+	}
+	return s.event("response.function_call_arguments.delta", map[string]any{
+		"item_id": item.Id, "output_index": itemIndex, "delta": call.Function.Arguments,
+	})
+}
+
+// Finish 上游流结束后调用，关闭输出项并发送 response.completed 或 response.incomplete
+func (s *StreamWriter) Finish() error {
+	if err := s.start(); err != nil {
+		return err
+	}
+	if err := s.closeItem(); err != nil {
+		return err
+	}
+	s.response.setFinish(s.finishReason)
+	s.response.Usage = ConvertUsage(s.usage)
+	name := "response.completed"
+	if s.response.Status == StatusIncomplete {
+		name = "response.incomplete"
+	}
+	return s.event(name, map[string]any{"response": s.response})
+}
+
+// Error 流已经开始后出错时发送 response.failed
+func (s *StreamWriter) Error(message string) error {
+	s.response.Status = StatusFailed
+	s.response.Error = &ErrorDetail{Code: "server_error", Message: message}
+	return s.event("response.failed", map[string]any{"response": s.response})
+}
+
+// CopyStream 把原生 Responses API 的 SSE 原样写给客户端，返回结束事件中的完整响应
+// 上游没有返回结束事件时返回的响应为 nil
+func CopyStream(w io.Writer, r io.Reader) (*Response, error) {
+	flusher, _ := w.(http.Flusher)
+	reader := bufio.NewReaderSize(r, 64*1024)
+	var final *Response
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if _, writeErr := w.Write(line); writeErr != nil {
+				return final, writeErr
+			}
+			if resp := parseFinalEvent(line); resp != nil {
+				final = resp
+			}
+			// 空行为一个事件的结尾
+			if flusher != nil && len(bytes.TrimSpace(line)) == 0 {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return final, nil
+			}
+			return final, err
+		}
+	}
+}
+
+var finalEvents = [][]byte{[]byte(`"response.completed"`), []byte(`"response.incomplete"`)}
+
+func parseFinalEvent(line []byte) *Response {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, []byte("data:")) {
+		return nil
+	}
+	data := line[len("data:"):]
+	matched := false
+	for _, name := range finalEvents {
+		if bytes.Contains(data, name) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return nil
+	}
+	var event struct {
+		Type     string    `json:"type"`
+		Response *Response `json:"response"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil
+	}
+	return event.Response
+}
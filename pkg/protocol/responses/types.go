@@ -0,0 +1,190 @@
+// Package responses OpenAI Responses API 的请求、响应和流式事件，以及与 chat completions 之间的转换
+package responses
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	ItemMessage            = "message"
+	ItemFunctionCall       = "function_call"
+	ItemFunctionCallOutput = "function_call_output"
+	ItemReasoning          = "reasoning"
+)
+
+const (
+	ContentInputText  = "input_text"
+	ContentInputImage = "input_image"
+	ContentInputFile  = "input_file"
+	ContentOutputText = "output_text"
+	ContentRefusal    = "refusal"
+)
+
+const (
+	StatusCompleted  = "completed"
+	StatusIncomplete = "incomplete"
+	StatusInProgress = "in_progress"
+	StatusFailed     = "failed"
+)
+
+// Request Input 为字符串或输入项数组，PreviousResponseId 不为空时在之前的对话后继续
+// Store 为 nil 时默认保存对话状态
+type Request struct {
+	Model              string            `json:"model" binding:"required"`
+	Input              json.RawMessage   `json:"input"`
+	Instructions       string            `json:"instructions,omitempty"`
+	PreviousResponseId string            `json:"previous_response_id,omitempty"`
+	Tools              []Tool            `json:"tools,omitempty"`
+	ToolChoice         any               `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool             `json:"parallel_tool_calls,omitempty"`
+	MaxOutputTokens    int               `json:"max_output_tokens,omitempty"`
+	Temperature        *float64          `json:"temperature,omitempty"`
+	TopP               *float64          `json:"top_p,omitempty"`
+	Stream             bool              `json:"stream,omitempty"`
+	Store              *bool             `json:"store,omitempty"`
+	Text               *TextConfig       `json:"text,omitempty"`
+	Reasoning          *Reasoning        `json:"reasoning,omitempty"`
+	User               string            `json:"user,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+// ShouldStore 是否保存对话状态供 previous_response_id 使用
+func (r *Request) ShouldStore() bool {
+	return r.Store == nil || *r.Store
+}
+
+// InputItem 输入项，Type 为空时按 message 处理，Content 为字符串或内容数组
+// 响应中的 message、function_call 输出项也可以原样作为输入项
+type InputItem struct {
+	Type      string          `json:"type,omitempty"`
+	Id        string          `json:"id,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	Status    string          `json:"status,omitempty"`
+	CallId    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    json.RawMessage `json:"output,omitempty"`
+}
+
+type InputContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageUrl string `json:"image_url,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Refusal  string `json:"refusal,omitempty"`
+}
+
+// Tool 只有 function 类型可以转换为 chat completions，其余内置工具只能发给原生支持的渠道
+type Tool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+	Strict      *bool  `json:"strict,omitempty"`
+}
+
+type TextConfig struct {
+	Format *TextFormat `json:"format,omitempty"`
+}
+
+// TextFormat Type 为 text、json_object、json_schema
+type TextFormat struct {
+	Type   string `json:"type"`
+	Name   string `json:"name,omitempty"`
+	Schema any    `json:"schema,omitempty"`
+	Strict *bool  `json:"strict,omitempty"`
+}
+
+type Reasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+type Response struct {
+	Id                 string             `json:"id"`
+	Object             string             `json:"object"`
+	CreatedAt          int64              `json:"created_at"`
+	Status             string             `json:"status"`
+	Model              string             `json:"model"`
+	Output             []OutputItem       `json:"output"`
+	Usage              *Usage             `json:"usage"`
+	Instructions       string             `json:"instructions,omitempty"`
+	PreviousResponseId string             `json:"previous_response_id,omitempty"`
+	IncompleteDetails  *IncompleteDetails `json:"incomplete_details"`
+	Error              *ErrorDetail       `json:"error"`
+	Metadata           map[string]string  `json:"metadata,omitempty"`
+}
+
+type IncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+// OutputItem Type 为 message 时使用 Role 和 Content，为 function_call 时使用 CallId、Name 和 Arguments，为 reasoning 时使用 Summary
+type OutputItem struct {
+	Type      string          `json:"type"`
+	Id        string          `json:"id"`
+	Status    string          `json:"status,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	Content   []OutputContent `json:"content,omitempty"`
+	CallId    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Summary   []SummaryText   `json:"summary,omitempty"`
+}
+
+type OutputContent struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations"`
+}
+
+type SummaryText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Usage InputTokens 包含命中缓存的部分
+type Usage struct {
+	InputTokens         int                 `json:"input_tokens"`
+	InputTokensDetails  InputTokensDetails  `json:"input_tokens_details"`
+	OutputTokens        int                 `json:"output_tokens"`
+	OutputTokensDetails OutputTokensDetails `json:"output_tokens_details"`
+	TotalTokens         int                 `json:"total_tokens"`
+}
+
+type InputTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type OutputTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Type    string `json:"type,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// ErrorType http 状态码对应的 OpenAI 错误类型
+func ErrorType(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusNotFound:
+		return "invalid_request_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	}
+	return "server_error"
+}
+
+func NewError(errType, message string) *ErrorResponse {
+	return &ErrorResponse{Error: ErrorDetail{Type: errType, Message: message}}
+}
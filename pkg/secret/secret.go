@@ -0,0 +1,133 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/jiu-u/oai-api/pkg/config"
+	"io"
+	"os"
+	"strings"
+)
+
+// Prefix 密文前缀，用于区分历史明文数据
+const Prefix = "enc:v1:"
+
+// KeyEnv 加密密钥的环境变量
+const KeyEnv = "OAI_SECURITY_SECRET_KEY"
+
+var ErrDecrypt = errors.New("secret decrypt failed")
+
+// Cipher 使用 AES-GCM 加密数据库中的敏感字段(渠道key、smtp密码、oauth secret等)
+// primary 用于加密和解密，previous 仅用于解密，轮换密钥时使用
+type Cipher struct {
+	primary  cipher.AEAD
+	previous cipher.AEAD
+}
+
+// NewCipher 生产环境必须通过环境变量设置密钥，避免使用提交在配置文件中的密钥
+func NewCipher(conf *config.Config) *Cipher {
+	if conf.Env == "production" && os.Getenv(KeyEnv) == "" {
+		panic(KeyEnv + " is not set, it is required in production")
+	}
+	c, err := New(conf.Security.Secret.Key, conf.Security.Secret.PreviousKey)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func New(key string, previousKey string) (*Cipher, error) {
+	if key == "" {
+		return nil, errors.New("security.secret.key is empty, set it in config or " + KeyEnv)
+	}
+	primary, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cipher{primary: primary}
+	if previousKey != "" {
+		c.previous, err = newAEAD(previousKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// newAEAD 对任意长度的密钥做 sha256，得到 AES-256 的密钥
+func newAEAD(key string) (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt 加密明文，已经加密的数据原样返回
+func (c *Cipher) Encrypt(plain string) (string, error) {
+	if plain == "" || IsEncrypted(plain) {
+		return plain, nil
+	}
+	nonce := make([]byte, c.primary.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := c.primary.Seal(nonce, nonce, []byte(plain), nil)
+	return Prefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密密文，没有前缀的历史明文数据原样返回
+func (c *Cipher) Decrypt(text string) (string, error) {
+	if !IsEncrypted(text) {
+		return text, nil
+	}
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(text, Prefix))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrDecrypt, err.Error())
+	}
+	plain, err := open(c.primary, raw)
+	if err == nil {
+		return plain, nil
+	}
+	if c.previous != nil {
+		plain, err = open(c.previous, raw)
+		if err == nil {
+			return plain, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrDecrypt, err.Error())
+}
+
+// Rotate 使用 primary 密钥重新加密，兼容历史明文和 previous 密钥加密的数据
+func (c *Cipher) Rotate(text string) (string, error) {
+	if text == "" {
+		return text, nil
+	}
+	plain, err := c.Decrypt(text)
+	if err != nil {
+		return "", err
+	}
+	return c.Encrypt(plain)
+}
+
+func open(aead cipher.AEAD, raw []byte) (string, error) {
+	if len(raw) < aead.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	nonce, data := raw[:aead.NonceSize()], raw[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func IsEncrypted(text string) bool {
+	return strings.HasPrefix(text, Prefix)
+}
@@ -0,0 +1,136 @@
+package secret
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCipherRoundTrip(t *testing.T) {
+	c, err := New("primary-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		plain string
+	}{
+		{"empty", ""},
+		{"ascii", "sk-abcdefghijklmnopqrstuvwxyz"},
+		{"unicode", "密码-🔑"},
+		{"long", strings.Repeat("x", 4096)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := c.Encrypt(tt.plain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.plain != "" && (!IsEncrypted(enc) || enc == tt.plain) {
+				t.Fatalf("Encrypt(%q) = %q, want prefixed ciphertext", tt.plain, enc)
+			}
+			// 已加密的数据原样返回
+			again, err := c.Encrypt(enc)
+			if err != nil || again != enc {
+				t.Fatalf("Encrypt(ciphertext) = %q, %v, want unchanged", again, err)
+			}
+			got, err := c.Decrypt(enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.plain {
+				t.Fatalf("Decrypt() = %q, want %q", got, tt.plain)
+			}
+		})
+	}
+}
+
+func TestCipherPlaintextPassThrough(t *testing.T) {
+	c, err := New("primary-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"", "legacy-plain-key", "enc:v0:not-ours"} {
+		got, err := c.Decrypt(text)
+		if err != nil {
+			t.Fatalf("Decrypt(%q) error: %v", text, err)
+		}
+		if got != text {
+			t.Fatalf("Decrypt(%q) = %q, want unchanged", text, got)
+		}
+	}
+}
+
+func TestCipherRotation(t *testing.T) {
+	oldCipher, err := New("old-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldText, err := oldCipher.Encrypt("secret-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := New("new-key", "old-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newOnly, err := New("new-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"previous key", oldText, "secret-value"},
+		{"plaintext", "legacy-plain", "legacy-plain"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rotated.Decrypt(tt.text)
+			if err != nil || got != tt.want {
+				t.Fatalf("Decrypt() = %q, %v, want %q", got, err, tt.want)
+			}
+			out, err := rotated.Rotate(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.text != "" && !IsEncrypted(out) {
+				t.Fatalf("Rotate() = %q, want ciphertext", out)
+			}
+			// 轮换后只使用新密钥也能解密
+			got, err = newOnly.Decrypt(out)
+			if err != nil || got != tt.want {
+				t.Fatalf("Decrypt(rotated) = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err = newOnly.Decrypt(oldText); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("Decrypt without previous key error = %v, want ErrDecrypt", err)
+	}
+	if _, err = newOnly.Rotate(oldText); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("Rotate without previous key error = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestCipherDecryptInvalid(t *testing.T) {
+	c, err := New("primary-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{Prefix + "!!!", Prefix + "YWJj", Prefix} {
+		if _, err = c.Decrypt(text); !errors.Is(err, ErrDecrypt) {
+			t.Fatalf("Decrypt(%q) error = %v, want ErrDecrypt", text, err)
+		}
+	}
+}
+
+func TestNewEmptyKey(t *testing.T) {
+	if _, err := New("", ""); err == nil {
+		t.Fatal("New with empty key should fail")
+	}
+}
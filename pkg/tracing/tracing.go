@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/jiu-u/oai-api/pkg/config"
+	"github.com/jiu-u/oai-api/pkg/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"time"
+)
+
+const instrumentationName = "github.com/jiu-u/oai-api"
+
+// Tracing 持有当前进程使用的 Tracer 和 W3C traceparent 传播器
+type Tracing struct {
+	Tracer     trace.Tracer
+	Propagator propagation.TextMapPropagator
+}
+
+// NewTracing 根据配置创建 OTLP 导出器，并注册为全局 TracerProvider，供 Start 和 gorm 插件使用
+// 未开启时使用全局的空实现，只透传上游带来的 traceparent
+func NewTracing(cfg *config.Config, logger *log.Logger) (*Tracing, func(), error) {
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	otel.SetTextMapPropagator(propagator)
+	t := &Tracing{
+		Tracer:     otel.Tracer(instrumentationName),
+		Propagator: propagator,
+	}
+	if !cfg.Trace.Enable {
+		return t, func() {}, nil
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Trace.Endpoint)}
+	if cfg.Trace.URLPath != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(cfg.Trace.URLPath))
+	}
+	if cfg.Trace.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(cfg.Trace.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(cfg.Trace.Headers))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	serviceName := cfg.Trace.ServiceName
+	if serviceName == "" {
+		serviceName = cfg.App.Name
+	}
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(cfg.App.Version),
+		semconv.DeploymentEnvironment(cfg.Env),
+	)
+	ratio := cfg.Trace.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	t.Tracer = provider.Tracer(instrumentationName)
+	cleanup := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			logger.Warn("链路追踪|关闭失败", zap.Error(err))
+		}
+	}
+	return t, cleanup, nil
+}
+
+// Start 创建子span，返回的ctx包装了传入的ctx，原有的值(包括gin的Keys)仍然可以取到
+// handler 把 *gin.Context 直接传给service，父span存放在 Request.Context() 中，需要从这里取出
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	parent := ctx
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		if c, ok := ctx.Value(gin.ContextKey).(*gin.Context); ok && c.Request != nil {
+			parent = c.Request.Context()
+		}
+	}
+	_, span := otel.Tracer(instrumentationName).Start(parent, name, opts...)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// RecordError 记录错误并把span状态标记为失败
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
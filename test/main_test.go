@@ -13,6 +13,7 @@ import (
 	"github.com/jiu-u/oai-api/pkg/encrypte"
 	"github.com/jiu-u/oai-api/pkg/jwt"
 	"github.com/jiu-u/oai-api/pkg/log"
+	"github.com/jiu-u/oai-api/pkg/secret"
 	"github.com/jiu-u/oai-api/pkg/sid"
 	"os"
 	"testing"
@@ -33,11 +34,17 @@ func setup() {
 	repositoryRepository := repository.NewRepository(logger, db)
 	transaction := repository.NewTransaction(repositoryRepository)
 	cacheCache := cache.New()
-	serviceService := service.NewService(sidSid, transaction, logger, jwtJWT, cacheCache)
+	cipher := secret.NewCipher(cfg)
+	serviceService := service.NewService(sidSid, transaction, logger, jwtJWT, cacheCache, cipher)
 	channelRepository := repository.NewChannelRepository(repositoryRepository)
 	channelModelRepository := repository.NewChannelModelRepository(repositoryRepository)
-	loadBalanceServiceBeta := service.NewLoadBalanceServiceBeta(serviceService, channelRepository, channelModelRepository)
-	channelSvc = service.NewChannelService(serviceService, channelRepository, channelModelRepository, loadBalanceServiceBeta)
+	channelKeyRepository := repository.NewChannelKeyRepository(repositoryRepository)
+	userRepository := repository.NewUserRepository(repositoryRepository)
+	systemRepository := repository.NewSystemRepository(repositoryRepository, cipher)
+	emailService := service.NewEmailService(systemRepository)
+	notifyService := service.NewNotifyService(serviceService, userRepository, systemRepository, emailService)
+	loadBalanceServiceBeta := service.NewLoadBalanceServiceBeta(serviceService, channelRepository, channelModelRepository, channelKeyRepository, notifyService)
+	channelSvc = service.NewChannelService(serviceService, channelRepository, channelModelRepository, channelKeyRepository, loadBalanceServiceBeta)
 }
 
 // teardown 清理测试环境